@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Juicern/luma/internal/config"
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository"
+	"github.com/Juicern/luma/internal/service"
+	"github.com/Juicern/luma/internal/storage"
+)
+
+const usage = `Usage: admin <command> [arguments]
+
+Commands:
+  create -email EMAIL -password PASSWORD [-name NAME]   create (or promote) an admin account
+  promote EMAIL                                         grant the admin role to an existing user
+  demote EMAIL                                          revoke the admin role from a user
+  reset-token [-ttl 24h] EMAIL                          print a one-time password reset token
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	ctx := context.Background()
+
+	db, err := storage.NewDatabase(ctx, cfg.Database)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	if err := storage.RunMigrations(ctx, db); err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
+
+	audit := service.NewAuditService(repository.NewAuditEventRepository(db), slog.Default())
+	users := service.NewUserService(
+		repository.NewUserRepository(db),
+		repository.NewUserSessionRepository(db),
+		repository.NewPasswordResetRepository(db),
+		audit,
+	)
+	// Changes made from the CLI have no acting user; the user agent marks
+	// their origin in the audit log.
+	ctx = service.WithActor(ctx, service.Actor{Client: service.ClientInfo{UserAgent: "cmd/admin"}})
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		name := fs.String("name", "", "display name")
+		email := fs.String("email", "", "account email")
+		password := fs.String("password", "", "initial password (only used for new accounts)")
+		_ = fs.Parse(args)
+		if *email == "" {
+			log.Fatal("create: -email is required")
+		}
+		user, err := users.EnsureAdmin(ctx, *name, *email, *password)
+		if err != nil {
+			log.Fatalf("create: %v", err)
+		}
+		log.Printf("%s (%s) is an admin.", user.Email, user.ID)
+	case "promote", "demote":
+		if len(args) != 1 {
+			log.Fatalf("%s: expected exactly one email", cmd)
+		}
+		role := domain.UserRoleAdmin
+		if cmd == "demote" {
+			role = domain.UserRoleMember
+		}
+		user, err := users.GetByEmail(ctx, args[0])
+		if err != nil {
+			log.Fatalf("%s: lookup %s: %v", cmd, args[0], err)
+		}
+		if user, err = users.SetRole(ctx, user.ID, role); err != nil {
+			log.Fatalf("%s: %v", cmd, err)
+		}
+		log.Printf("%s is now %s.", user.Email, user.Role)
+	case "reset-token":
+		fs := flag.NewFlagSet("reset-token", flag.ExitOnError)
+		ttl := fs.Duration("ttl", 24*time.Hour, "how long the token stays valid")
+		_ = fs.Parse(args)
+		if fs.NArg() != 1 {
+			log.Fatal("reset-token: expected exactly one email")
+		}
+		token, expiresAt, err := users.IssueResetToken(ctx, fs.Arg(0), *ttl)
+		if err != nil {
+			log.Fatalf("reset-token: %v", err)
+		}
+		fmt.Println(token)
+		log.Printf("Token for %s is valid until %s. Redeem it with POST /api/v1/password/reset.", fs.Arg(0), expiresAt.Format(time.RFC3339))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -2,15 +2,58 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/Juicern/luma/internal/config"
 	"github.com/Juicern/luma/internal/storage"
 )
 
+const usage = `Usage: migrate [command] [arguments]
+
+Commands:
+  up                                    apply all pending migrations (default)
+  down N                                revert the N most recent migrations
+  status                                list migrations and when they were applied
+  create [-dir DIR] NAME                add an empty up/down migration pair for each dialect
+`
+
 func main() {
-	cfg := config.Load()
+	cmd, args := "up", []string(nil)
+	if len(os.Args) > 1 {
+		cmd, args = os.Args[1], os.Args[2:]
+	}
+
+	if cmd == "create" {
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		dir := fs.String("dir", "internal/storage/migrations", "migrations directory")
+		_ = fs.Parse(args)
+		if fs.NArg() != 1 {
+			log.Fatal("create: expected exactly one name")
+		}
+		for _, dialect := range []storage.Dialect{storage.DialectPostgres, storage.DialectSQLite} {
+			up, down, err := storage.CreateMigration(filepath.Join(*dir, string(dialect)), fs.Arg(0))
+			if err != nil {
+				log.Fatalf("create: %v", err)
+			}
+			log.Printf("Created %s and %s.", up, down)
+		}
+		return
+	}
+
+	switch cmd {
+	case "up", "down", "status":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 
+	cfg := config.Load()
 	ctx := context.Background()
 
 	db, err := storage.NewDatabase(ctx, cfg.Database)
@@ -19,9 +62,42 @@ func main() {
 	}
 	defer db.Close()
 
-	if err := storage.RunMigrations(ctx, db); err != nil {
-		log.Fatalf("migrate: %v", err)
+	switch cmd {
+	case "up":
+		applied, err := storage.MigrateUp(ctx, db)
+		if err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied %04d_%s.", m.Version, m.Name)
+		}
+		log.Println("Migrations applied successfully.")
+	case "down":
+		if len(args) != 1 {
+			log.Fatal("down: expected the number of migrations to revert")
+		}
+		steps, err := strconv.Atoi(args[0])
+		if err != nil || steps <= 0 {
+			log.Fatalf("down: invalid count %q", args[0])
+		}
+		reverted, err := storage.MigrateDown(ctx, db, steps)
+		if err != nil {
+			log.Fatalf("down: %v", err)
+		}
+		for _, m := range reverted {
+			log.Printf("Reverted %04d_%s.", m.Version, m.Name)
+		}
+	case "status":
+		states, err := storage.MigrationStatus(ctx, db)
+		if err != nil {
+			log.Fatalf("status: %v", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s %s\n", state.Version, state.Name, applied)
+		}
 	}
-
-	log.Println("Migrations applied successfully.")
 }
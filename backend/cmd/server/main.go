@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Juicern/luma/internal/config"
+	"github.com/Juicern/luma/internal/domain"
 	"github.com/Juicern/luma/internal/httpapi"
+	"github.com/Juicern/luma/internal/postprocess"
 	"github.com/Juicern/luma/internal/providers"
 	"github.com/Juicern/luma/internal/repository"
+	"github.com/Juicern/luma/internal/repository/memory"
 	"github.com/Juicern/luma/internal/server"
 	"github.com/Juicern/luma/internal/service"
 	"github.com/Juicern/luma/internal/storage"
+	"github.com/Juicern/luma/internal/templates"
 )
 
 func main() {
@@ -36,40 +42,198 @@ func main() {
 	}
 
 	systemRepo := repository.NewSystemPromptRepository(db)
+	userPromptRepo := repository.NewUserSystemPromptRepository(db)
 	presetRepo := repository.NewPromptPresetRepository(db)
 	apiKeyRepo := repository.NewAPIKeyRepository(db)
 	transcriptionLogRepo := repository.NewTranscriptionLogRepository(db)
 	userSessionRepo := repository.NewUserSessionRepository(db)
 	userRepo := repository.NewUserRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	auditRepo := repository.NewAuditEventRepository(db)
+	userIdentityRepo := repository.NewUserIdentityRepository(db)
+	userVariableRepo := repository.NewUserVariableRepository(db)
+	workspaceRepo := repository.NewWorkspaceRepository(db)
+	redactionRepo := repository.NewRedactionRepository(db)
+	fallbackRepo := repository.NewFallbackChainRepository(db)
 
-	promptService := service.NewPromptService(systemRepo, presetRepo)
+	catalog, err := templates.Load()
+	if err != nil {
+		logger.Error("failed to load template catalog", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	auditService := service.NewAuditService(auditRepo, logger)
+	variableService := service.NewVariableService(userVariableRepo, userRepo)
+	promptService := service.NewPromptService(systemRepo, userPromptRepo, presetRepo, catalog, variableService, auditService)
 	if _, err := promptService.EnsureDefaultSystemPrompt(ctx); err != nil {
 		logger.Error("failed to initialize system prompt", slog.Any("error", err))
 		os.Exit(1)
 	}
 
-	userService := service.NewUserService(userRepo)
-	authService := service.NewAuthService(userRepo, userSessionRepo)
-	apiKeyService := service.NewAPIKeyService(apiKeyRepo, cfg.Security.EncryptionKey)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo, variableService, auditService)
+	userService := service.NewUserService(userRepo, userSessionRepo, passwordResetRepo, auditService)
+	if err := ensureAdmin(ctx, cfg.Auth, userService, logger); err != nil {
+		logger.Error("failed to bootstrap admin account", slog.Any("error", err))
+		os.Exit(1)
+	}
+	authService := service.NewAuthService(userRepo, userSessionRepo, userIdentityRepo, cfg.Auth.SessionTTL, newLoginLimiter(cfg.Auth.Lockout, db), newOIDCConnector(cfg.Auth), auditService)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, cfg.Security.EncryptionKey, auditService)
 	llmRegistry := providers.NewRegistry()
 	llmRegistry.Register("openai", providers.NewOpenAIClient(providerBaseURL(cfg, "openai")))
 	llmRegistry.Register("gemini", providers.EchoClient{})
+	llmRegistry.Register("anthropic", providers.NewAnthropicClient(providerBaseURL(cfg, "anthropic")))
+	llmRegistry.RegisterKeyless("ollama", providers.NewOllamaClient(providerBaseURL(cfg, "ollama")))
 
 	transcriptionService := service.NewTranscriptionService(apiKeyService, transcriptionLogRepo, providerBaseMap(cfg))
-	composerService := service.NewComposeService(promptService, apiKeyService, llmRegistry)
+	contextPolicy, err := newContextPolicy(cfg.Compose)
+	if err != nil {
+		logger.Error("invalid compose configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	redactionService := service.NewRedactionService(redactionRepo, cfg.Compose.RedactPII, auditService)
+	steps, err := postprocess.Parse(cfg.Compose.Postprocess)
+	if err != nil {
+		logger.Error("invalid compose configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	fallbackService, err := service.NewFallbackService(fallbackRepo, cfg.Compose.Fallback, service.RetryPolicy(cfg.Compose.Retry), auditService)
+	if err != nil {
+		logger.Error("invalid compose configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	composerService := service.NewComposeService(promptService, apiKeyService, variableService, workspaceService, redactionService, fallbackService, llmRegistry, contextPolicy, steps)
 
-	handler := httpapi.NewRouter(userService, authService, promptService, apiKeyService, transcriptionService, composerService, logger)
+	handler := httpapi.NewRouter(cfg.Auth, userService, authService, promptService, variableService, apiKeyService, workspaceService, redactionService, fallbackService, transcriptionService, composerService, auditService, logger)
 	srv := server.New(cfg, handler, logger)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	go runSessionCleanup(ctx, authService, cfg.Auth.SessionCleanupInterval, logger)
+	go runFailedLoginFlush(ctx, authService)
+
 	if err := srv.Run(ctx); err != nil {
 		logger.Error("server stopped with error", slog.Any("error", err))
 		os.Exit(1)
 	}
 }
 
+// ensureAdmin applies the configured bootstrap admin, or warns when the
+// instance has no admin at all.
+func ensureAdmin(ctx context.Context, cfg config.AuthConfig, users *service.UserService, logger *slog.Logger) error {
+	if cfg.BootstrapAdmin.Email != "" {
+		admin, err := users.EnsureAdmin(ctx, cfg.BootstrapAdmin.Name, cfg.BootstrapAdmin.Email, cfg.BootstrapAdmin.Password)
+		if err != nil {
+			return err
+		}
+		logger.Info("bootstrap admin ready", slog.String("email", admin.Email))
+		return nil
+	}
+	admins, err := users.CountAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		logger.Warn("no admin account exists; set auth.bootstrap_admin or run `go run ./cmd/admin promote <email>`")
+	}
+	return nil
+}
+
+// newOIDCConnector returns nil, disabling single sign-on, unless an issuer is
+// configured.
+func newOIDCConnector(cfg config.AuthConfig) *service.OIDCConnector {
+	if cfg.OIDC.Issuer == "" {
+		return nil
+	}
+	autoCreate := cfg.AllowRegistration
+	if cfg.OIDC.AutoCreate != nil {
+		autoCreate = *cfg.OIDC.AutoCreate
+	}
+	return service.NewOIDCConnector(service.OIDCOptions{
+		Issuer:         cfg.OIDC.Issuer,
+		ClientID:       cfg.OIDC.ClientID,
+		ClientSecret:   cfg.OIDC.ClientSecret,
+		RedirectURL:    cfg.OIDC.RedirectURL,
+		Scopes:         cfg.OIDC.Scopes,
+		AllowedDomains: cfg.OIDC.AllowedDomains,
+		AutoCreate:     autoCreate,
+	})
+}
+
+func newLoginLimiter(cfg config.LockoutConfig, db *sql.DB) *service.LoginLimiter {
+	var store repository.LoginAttemptStore = memory.NewLoginAttemptRepository(memory.NewDB())
+	// "postgres" predates SQLite support and means the same as "database".
+	if strings.EqualFold(cfg.Store, "database") || strings.EqualFold(cfg.Store, "postgres") {
+		store = repository.NewLoginAttemptRepository(db)
+	}
+	return service.NewLoginLimiter(store, service.LoginLimitPolicy{
+		MaxAccountFailures: cfg.MaxAccountFailures,
+		MaxIPFailures:      cfg.MaxIPFailures,
+		Window:             cfg.Window,
+		BaseLockout:        cfg.BaseLockout,
+		MaxLockout:         cfg.MaxLockout,
+	})
+}
+
+func newContextPolicy(cfg config.ComposeConfig) (service.ContextPolicy, error) {
+	strategy := service.TruncateHeadTail
+	if strings.EqualFold(cfg.Truncation, string(service.TruncateSummarize)) {
+		strategy = service.TruncateSummarize
+	}
+	injection, err := service.NewInjectionPolicy(domain.InjectionAction(strings.ToLower(cfg.Injection.Action)), cfg.Injection.Patterns)
+	if err != nil {
+		return service.ContextPolicy{}, err
+	}
+	return service.ContextPolicy{
+		BudgetTokens:        cfg.ContextBudgetTokens,
+		Strategy:            strategy,
+		SummaryModel:        cfg.SummaryModel,
+		ReserveOutputTokens: cfg.ReserveOutputTokens,
+		ContextWindows:      cfg.ContextWindows,
+		Injection:           injection,
+	}, nil
+}
+
+// runSessionCleanup purges expired login sessions every interval until ctx is
+// cancelled.
+func runSessionCleanup(ctx context.Context, auth *service.AuthService, interval time.Duration, logger *slog.Logger) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := auth.PurgeExpiredSessions(ctx)
+			if err != nil {
+				logger.Warn("session cleanup failed", slog.Any("error", err))
+				continue
+			}
+			if purged > 0 {
+				logger.Info("purged expired sessions", slog.Int64("count", purged))
+			}
+		}
+	}
+}
+
+// runFailedLoginFlush writes out counts of failed logins left out of the
+// audit log once their sample window has passed.
+func runFailedLoginFlush(ctx context.Context, auth *service.AuthService) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			auth.FlushFailedLogins(ctx)
+		}
+	}
+}
+
 func providerBaseURL(cfg config.Config, name string) string {
 	for _, provider := range cfg.Providers {
 		if strings.EqualFold(provider.Name, name) {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -13,6 +14,8 @@ type Config struct {
 	Database  DatabaseConfig   `yaml:"database"`
 	Providers []ProviderConfig `yaml:"providers"`
 	Security  SecurityConfig   `yaml:"security"`
+	Auth      AuthConfig       `yaml:"auth"`
+	Compose   ComposeConfig    `yaml:"compose"`
 }
 
 type ServerConfig struct {
@@ -34,6 +37,115 @@ type SecurityConfig struct {
 	EncryptionKeyEnv string `yaml:"encryption_key_env"`
 }
 
+// ComposeConfig bounds the clipboard context sent with a rewrite.
+type ComposeConfig struct {
+	// ContextBudgetTokens caps the tokens of context text sent with one
+	// rewrite. 0 removes the cap; the model's context window still applies.
+	ContextBudgetTokens int `yaml:"context_budget_tokens"`
+	// Truncation is how oversized context is cut down: "head_tail" keeps its
+	// beginning and end, "summarize" asks SummaryModel for a summary first.
+	Truncation string `yaml:"truncation"`
+	// SummaryModel is a cheap model of the rewrite's provider.
+	SummaryModel string `yaml:"summary_model"`
+	// ReserveOutputTokens is the room kept for the answer when a request
+	// does not set max_tokens.
+	ReserveOutputTokens int `yaml:"reserve_output_tokens"`
+	// ContextWindows are model context lengths in tokens, keyed by model
+	// name or name prefix. "default" applies to models not listed.
+	ContextWindows map[string]int `yaml:"context_windows"`
+	// Injection configures the prompt-injection detector for context text.
+	Injection InjectionConfig `yaml:"injection"`
+	// RedactPII redacts personal data for users who have not chosen
+	// themselves.
+	RedactPII bool `yaml:"redact_pii"`
+	// Postprocess is the chain of cleanup steps run on answers whose request
+	// and presets do not choose one. ["none"] runs none.
+	Postprocess []string `yaml:"postprocess"`
+	// Fallback is the chain of providers, as "provider" or "provider/model",
+	// tried for users who have not set their own when a rewrite's provider
+	// keeps failing.
+	Fallback []string    `yaml:"fallback"`
+	Retry    RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig controls how failed provider calls are retried before the
+// fallback chain is tried. Only rate limits, server errors and timeouts are
+// retried.
+type RetryConfig struct {
+	// MaxAttempts counts the first call; 1 disables retries.
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff doubles with each retry up to MaxBackoff; the wait is
+	// a random share of it.
+	InitialBackoff time.Duration `yaml:"-"`
+	MaxBackoff     time.Duration `yaml:"-"`
+	// AttemptTimeout bounds each call. 0 leaves it unbounded.
+	AttemptTimeout time.Duration `yaml:"-"`
+}
+
+type InjectionConfig struct {
+	// Action is what happens when context text looks like a prompt
+	// injection: "warn" records it, "strip" removes the matching lines,
+	// "refuse" skips the rewrite and "off" disables the detector.
+	Action string `yaml:"action"`
+	// Patterns are extra regular expressions, matched case-insensitively in
+	// addition to the built-in ones.
+	Patterns []string `yaml:"patterns"`
+}
+
+type AuthConfig struct {
+	// AllowRegistration lets anyone create a member account through
+	// POST /users. When disabled only admins can create users.
+	AllowRegistration bool                 `yaml:"allow_registration"`
+	BootstrapAdmin    BootstrapAdminConfig `yaml:"bootstrap_admin"`
+	// SessionTTL is the sliding idle timeout of login sessions.
+	SessionTTL time.Duration `yaml:"-"`
+	// SessionCleanupInterval is how often expired sessions are purged.
+	SessionCleanupInterval time.Duration `yaml:"-"`
+	Lockout                LockoutConfig `yaml:"lockout"`
+	OIDC                   OIDCConfig    `yaml:"oidc"`
+}
+
+// OIDCConfig enables sign-in through an OpenID Connect provider. It is active
+// when Issuer is set.
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL must point at /api/v1/auth/oidc/callback on this server.
+	RedirectURL string `yaml:"redirect_url"`
+	// Scopes are requested in addition to "openid".
+	Scopes []string `yaml:"scopes"`
+	// DisplayName labels the sign-in button, e.g. "Okta".
+	DisplayName string `yaml:"display_name"`
+	// AllowedDomains limits sign-in to these email domains. Empty allows all.
+	AllowedDomains []string `yaml:"allowed_domains"`
+	// PostLoginURL is where the browser lands after signing in.
+	PostLoginURL string `yaml:"post_login_url"`
+	// AutoCreate creates accounts for identities that have none. Unset, it
+	// follows AllowRegistration.
+	AutoCreate *bool `yaml:"auto_create"`
+}
+
+// LockoutConfig controls failed-login lockouts. A threshold of 0 disables
+// the corresponding limit.
+type LockoutConfig struct {
+	// Store is "memory" (default, per instance) or "database" (shared through
+	// the configured database; "postgres" is accepted as an alias).
+	Store              string        `yaml:"store"`
+	MaxAccountFailures int           `yaml:"max_account_failures"`
+	MaxIPFailures      int           `yaml:"max_ip_failures"`
+	Window             time.Duration `yaml:"-"`
+	BaseLockout        time.Duration `yaml:"-"`
+	MaxLockout         time.Duration `yaml:"-"`
+}
+
+// BootstrapAdminConfig describes an admin account ensured on startup.
+type BootstrapAdminConfig struct {
+	Name     string `yaml:"name"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+}
+
 type fileConfig struct {
 	Server struct {
 		Port            string `yaml:"port"`
@@ -42,6 +154,38 @@ type fileConfig struct {
 	Database  DatabaseConfig   `yaml:"database"`
 	Providers []ProviderConfig `yaml:"providers"`
 	Security  SecurityConfig   `yaml:"security"`
+	Auth      struct {
+		AllowRegistration      *bool                `yaml:"allow_registration"`
+		BootstrapAdmin         BootstrapAdminConfig `yaml:"bootstrap_admin"`
+		SessionTTLHours        int                  `yaml:"session_ttl_hours"`
+		SessionCleanupInterval int                  `yaml:"session_cleanup_minutes"`
+		Lockout                struct {
+			Store              string `yaml:"store"`
+			MaxAccountFailures int    `yaml:"max_account_failures"`
+			MaxIPFailures      int    `yaml:"max_ip_failures"`
+			WindowMinutes      int    `yaml:"window_minutes"`
+			BaseLockoutSeconds int    `yaml:"base_lockout_seconds"`
+			MaxLockoutMinutes  int    `yaml:"max_lockout_minutes"`
+		} `yaml:"lockout"`
+		OIDC OIDCConfig `yaml:"oidc"`
+	} `yaml:"auth"`
+	Compose struct {
+		ContextBudgetTokens *int            `yaml:"context_budget_tokens"`
+		Truncation          string          `yaml:"truncation"`
+		SummaryModel        string          `yaml:"summary_model"`
+		ReserveOutputTokens int             `yaml:"reserve_output_tokens"`
+		ContextWindows      map[string]int  `yaml:"context_windows"`
+		Injection           InjectionConfig `yaml:"injection"`
+		RedactPII           *bool           `yaml:"redact_pii"`
+		Postprocess         []string        `yaml:"postprocess"`
+		Fallback            []string        `yaml:"fallback"`
+		Retry               struct {
+			MaxAttempts           int  `yaml:"max_attempts"`
+			InitialBackoffMillis  int  `yaml:"initial_backoff_ms"`
+			MaxBackoffMillis      int  `yaml:"max_backoff_ms"`
+			AttemptTimeoutSeconds *int `yaml:"attempt_timeout_seconds"`
+		} `yaml:"retry"`
+	} `yaml:"compose"`
 }
 
 func (f fileConfig) toConfig() Config {
@@ -52,20 +196,71 @@ func (f fileConfig) toConfig() Config {
 		Database:  f.Database,
 		Providers: f.Providers,
 		Security:  f.Security,
+		Compose: ComposeConfig{
+			Truncation:          f.Compose.Truncation,
+			SummaryModel:        f.Compose.SummaryModel,
+			ReserveOutputTokens: f.Compose.ReserveOutputTokens,
+			ContextWindows:      f.Compose.ContextWindows,
+			Injection:           f.Compose.Injection,
+			Postprocess:         f.Compose.Postprocess,
+			Fallback:            f.Compose.Fallback,
+			Retry: RetryConfig{
+				MaxAttempts:    f.Compose.Retry.MaxAttempts,
+				InitialBackoff: time.Duration(f.Compose.Retry.InitialBackoffMillis) * time.Millisecond,
+				MaxBackoff:     time.Duration(f.Compose.Retry.MaxBackoffMillis) * time.Millisecond,
+			},
+		},
+		Auth: AuthConfig{
+			BootstrapAdmin: f.Auth.BootstrapAdmin,
+			OIDC:           f.Auth.OIDC,
+			Lockout: LockoutConfig{
+				Store:              f.Auth.Lockout.Store,
+				MaxAccountFailures: f.Auth.Lockout.MaxAccountFailures,
+				MaxIPFailures:      f.Auth.Lockout.MaxIPFailures,
+				Window:             time.Duration(f.Auth.Lockout.WindowMinutes) * time.Minute,
+				BaseLockout:        time.Duration(f.Auth.Lockout.BaseLockoutSeconds) * time.Second,
+				MaxLockout:         time.Duration(f.Auth.Lockout.MaxLockoutMinutes) * time.Minute,
+			},
+		},
 	}
 
 	if f.Server.ShutdownTimeout > 0 {
 		cfg.Server.ShutdownTimeout = time.Duration(f.Server.ShutdownTimeout) * time.Second
 	}
+	if f.Auth.SessionTTLHours > 0 {
+		cfg.Auth.SessionTTL = time.Duration(f.Auth.SessionTTLHours) * time.Hour
+	}
+	if f.Auth.SessionCleanupInterval > 0 {
+		cfg.Auth.SessionCleanupInterval = time.Duration(f.Auth.SessionCleanupInterval) * time.Minute
+	}
 
 	return cfg
 }
 
+// applyFlags copies settings that were explicitly present in the file and
+// whose zero value means something; it cannot be told apart from "unset"
+// after toConfig.
+func (f fileConfig) applyFlags(cfg *Config) {
+	if f.Auth.AllowRegistration != nil {
+		cfg.Auth.AllowRegistration = *f.Auth.AllowRegistration
+	}
+	if f.Compose.ContextBudgetTokens != nil {
+		cfg.Compose.ContextBudgetTokens = *f.Compose.ContextBudgetTokens
+	}
+	if f.Compose.RedactPII != nil {
+		cfg.Compose.RedactPII = *f.Compose.RedactPII
+	}
+	if f.Compose.Retry.AttemptTimeoutSeconds != nil {
+		cfg.Compose.Retry.AttemptTimeout = time.Duration(*f.Compose.Retry.AttemptTimeoutSeconds) * time.Second
+	}
+}
+
 func Load() Config {
 	cfg := defaultConfig()
 
 	if fileCfg, err := loadFromFile(); err == nil {
-		cfg = mergeConfigs(cfg, fileCfg)
+		cfg = mergeConfigs(cfg, fileCfg.toConfig())
+		fileCfg.applyFlags(&cfg)
 	}
 
 	if port := os.Getenv("HTTP_PORT"); port != "" {
@@ -82,6 +277,78 @@ func Load() Config {
 		cfg.Database.DSN = dsn
 	}
 
+	if allow := os.Getenv("LUMA_ALLOW_REGISTRATION"); allow != "" {
+		if enabled, err := strconv.ParseBool(allow); err == nil {
+			cfg.Auth.AllowRegistration = enabled
+		}
+	}
+
+	if ttl := os.Getenv("LUMA_SESSION_TTL_HOURS"); ttl != "" {
+		if hours, err := strconv.Atoi(ttl); err == nil && hours > 0 {
+			cfg.Auth.SessionTTL = time.Duration(hours) * time.Hour
+		}
+	}
+
+	if store := os.Getenv("LUMA_LOCKOUT_STORE"); store != "" {
+		cfg.Auth.Lockout.Store = store
+	}
+
+	if name := os.Getenv("LUMA_ADMIN_NAME"); name != "" {
+		cfg.Auth.BootstrapAdmin.Name = name
+	}
+	if email := os.Getenv("LUMA_ADMIN_EMAIL"); email != "" {
+		cfg.Auth.BootstrapAdmin.Email = email
+	}
+	if password := os.Getenv("LUMA_ADMIN_PASSWORD"); password != "" {
+		cfg.Auth.BootstrapAdmin.Password = password
+	}
+
+	if issuer := os.Getenv("LUMA_OIDC_ISSUER"); issuer != "" {
+		cfg.Auth.OIDC.Issuer = issuer
+	}
+	if clientID := os.Getenv("LUMA_OIDC_CLIENT_ID"); clientID != "" {
+		cfg.Auth.OIDC.ClientID = clientID
+	}
+	if secret := os.Getenv("LUMA_OIDC_CLIENT_SECRET"); secret != "" {
+		cfg.Auth.OIDC.ClientSecret = secret
+	}
+	if redirect := os.Getenv("LUMA_OIDC_REDIRECT_URL"); redirect != "" {
+		cfg.Auth.OIDC.RedirectURL = redirect
+	}
+
+	if budget := os.Getenv("LUMA_CONTEXT_BUDGET_TOKENS"); budget != "" {
+		if tokens, err := strconv.Atoi(budget); err == nil && tokens >= 0 {
+			cfg.Compose.ContextBudgetTokens = tokens
+		}
+	}
+	if truncation := os.Getenv("LUMA_CONTEXT_TRUNCATION"); truncation != "" {
+		cfg.Compose.Truncation = truncation
+	}
+	if action := os.Getenv("LUMA_INJECTION_ACTION"); action != "" {
+		cfg.Compose.Injection.Action = action
+	}
+	if redact := os.Getenv("LUMA_REDACT_PII"); redact != "" {
+		if enabled, err := strconv.ParseBool(redact); err == nil {
+			cfg.Compose.RedactPII = enabled
+		}
+	}
+	if steps := os.Getenv("LUMA_POSTPROCESS"); steps != "" {
+		cfg.Compose.Postprocess = strings.Split(steps, ",")
+	}
+	if chain := os.Getenv("LUMA_FALLBACK"); chain != "" {
+		cfg.Compose.Fallback = strings.Split(chain, ",")
+	}
+	if attempts := os.Getenv("LUMA_RETRY_MAX_ATTEMPTS"); attempts != "" {
+		if n, err := strconv.Atoi(attempts); err == nil && n > 0 {
+			cfg.Compose.Retry.MaxAttempts = n
+		}
+	}
+	if timeout := os.Getenv("LUMA_ATTEMPT_TIMEOUT"); timeout != "" {
+		if seconds, err := strconv.Atoi(timeout); err == nil && seconds >= 0 {
+			cfg.Compose.Retry.AttemptTimeout = time.Duration(seconds) * time.Second
+		}
+	}
+
 	if key := os.Getenv(cfg.Security.EncryptionKeyEnv); key != "" {
 		cfg.Security.EncryptionKey = key
 	} else if key := os.Getenv("LUMA_SECRET_KEY"); key != "" {
@@ -103,14 +370,60 @@ func defaultConfig() Config {
 		Providers: []ProviderConfig{
 			{Name: "openai", BaseURL: "https://api.openai.com/v1"},
 			{Name: "gemini", BaseURL: "https://generativelanguage.googleapis.com/v1beta"},
+			{Name: "anthropic", BaseURL: "https://api.anthropic.com"},
+			{Name: "ollama", BaseURL: "http://localhost:11434"},
 		},
 		Security: SecurityConfig{
 			EncryptionKeyEnv: "LUMA_SECRET_KEY",
 		},
+		Auth: AuthConfig{
+			AllowRegistration:      true,
+			SessionTTL:             30 * 24 * time.Hour,
+			SessionCleanupInterval: time.Hour,
+			Lockout: LockoutConfig{
+				Store:              "memory",
+				MaxAccountFailures: 5,
+				MaxIPFailures:      20,
+				Window:             15 * time.Minute,
+				BaseLockout:        time.Minute,
+				MaxLockout:         time.Hour,
+			},
+			OIDC: OIDCConfig{
+				Scopes:       []string{"profile", "email"},
+				DisplayName:  "Single sign-on",
+				PostLoginURL: "/",
+			},
+		},
+		Compose: ComposeConfig{
+			ContextBudgetTokens: 4000,
+			Truncation:          "head_tail",
+			SummaryModel:        "gpt-4o-mini",
+			ReserveOutputTokens: 1024,
+			ContextWindows: map[string]int{
+				"default":       8192,
+				"gpt-4o":        128000,
+				"gpt-4.1":       1047576,
+				"gpt-4-turbo":   128000,
+				"gpt-4":         8192,
+				"gpt-3.5-turbo": 16385,
+				"gemini-1.5":    1048576,
+				"gemini-2":      1048576,
+			},
+			Injection: InjectionConfig{Action: "warn"},
+			Postprocess: []string{
+				"strip_preamble", "strip_quotes", "whitespace", "cjk_punctuation", "numerals",
+			},
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				InitialBackoff: 500 * time.Millisecond,
+				MaxBackoff:     8 * time.Second,
+				AttemptTimeout: time.Minute,
+			},
+		},
 	}
 }
 
-func loadFromFile() (Config, error) {
+func loadFromFile() (fileConfig, error) {
 	path := os.Getenv("LUMA_CONFIG")
 	if path == "" {
 		path = "config.yaml"
@@ -118,15 +431,15 @@ func loadFromFile() (Config, error) {
 
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return Config{}, err
+		return fileConfig{}, err
 	}
 
 	var cfg fileConfig
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return Config{}, err
+		return fileConfig{}, err
 	}
 
-	return cfg.toConfig(), nil
+	return cfg, nil
 }
 
 func mergeConfigs(base, override Config) Config {
@@ -148,6 +461,78 @@ func mergeConfigs(base, override Config) Config {
 	if override.Security.EncryptionKeyEnv != "" {
 		base.Security.EncryptionKeyEnv = override.Security.EncryptionKeyEnv
 	}
+	if override.Auth.BootstrapAdmin.Email != "" {
+		base.Auth.BootstrapAdmin = override.Auth.BootstrapAdmin
+	}
+	if override.Auth.OIDC.Issuer != "" {
+		oidc := override.Auth.OIDC
+		if len(oidc.Scopes) == 0 {
+			oidc.Scopes = base.Auth.OIDC.Scopes
+		}
+		if oidc.DisplayName == "" {
+			oidc.DisplayName = base.Auth.OIDC.DisplayName
+		}
+		if oidc.PostLoginURL == "" {
+			oidc.PostLoginURL = base.Auth.OIDC.PostLoginURL
+		}
+		base.Auth.OIDC = oidc
+	}
+	if override.Auth.SessionTTL != 0 {
+		base.Auth.SessionTTL = override.Auth.SessionTTL
+	}
+	if override.Auth.SessionCleanupInterval != 0 {
+		base.Auth.SessionCleanupInterval = override.Auth.SessionCleanupInterval
+	}
+	if override.Auth.Lockout.Store != "" {
+		base.Auth.Lockout.Store = override.Auth.Lockout.Store
+	}
+	if override.Auth.Lockout.MaxAccountFailures != 0 {
+		base.Auth.Lockout.MaxAccountFailures = override.Auth.Lockout.MaxAccountFailures
+	}
+	if override.Auth.Lockout.MaxIPFailures != 0 {
+		base.Auth.Lockout.MaxIPFailures = override.Auth.Lockout.MaxIPFailures
+	}
+	if override.Auth.Lockout.Window != 0 {
+		base.Auth.Lockout.Window = override.Auth.Lockout.Window
+	}
+	if override.Auth.Lockout.BaseLockout != 0 {
+		base.Auth.Lockout.BaseLockout = override.Auth.Lockout.BaseLockout
+	}
+	if override.Auth.Lockout.MaxLockout != 0 {
+		base.Auth.Lockout.MaxLockout = override.Auth.Lockout.MaxLockout
+	}
+	if override.Compose.Truncation != "" {
+		base.Compose.Truncation = override.Compose.Truncation
+	}
+	if override.Compose.SummaryModel != "" {
+		base.Compose.SummaryModel = override.Compose.SummaryModel
+	}
+	if override.Compose.ReserveOutputTokens != 0 {
+		base.Compose.ReserveOutputTokens = override.Compose.ReserveOutputTokens
+	}
+	if override.Compose.Injection.Action != "" {
+		base.Compose.Injection.Action = override.Compose.Injection.Action
+	}
+	base.Compose.Injection.Patterns = append(base.Compose.Injection.Patterns, override.Compose.Injection.Patterns...)
+	if override.Compose.Postprocess != nil {
+		base.Compose.Postprocess = override.Compose.Postprocess
+	}
+	if override.Compose.Fallback != nil {
+		base.Compose.Fallback = override.Compose.Fallback
+	}
+	if override.Compose.Retry.MaxAttempts != 0 {
+		base.Compose.Retry.MaxAttempts = override.Compose.Retry.MaxAttempts
+	}
+	if override.Compose.Retry.InitialBackoff != 0 {
+		base.Compose.Retry.InitialBackoff = override.Compose.Retry.InitialBackoff
+	}
+	if override.Compose.Retry.MaxBackoff != 0 {
+		base.Compose.Retry.MaxBackoff = override.Compose.Retry.MaxBackoff
+	}
+	// Listed windows are added to the defaults rather than replacing them.
+	for model, tokens := range override.Compose.ContextWindows {
+		base.Compose.ContextWindows[model] = tokens
+	}
 
 	return base
 }
@@ -11,19 +11,218 @@ type SystemPrompt struct {
 }
 
 type PromptPreset struct {
-	ID          string    `db:"id" json:"id"`
-	UserID      string    `db:"user_id" json:"user_id"`
-	Name        string    `db:"name" json:"name"`
+	ID          string  `db:"id" json:"id"`
+	UserID      string  `db:"user_id" json:"user_id"`
+	Name        string  `db:"name" json:"name"`
+	PromptText  string  `db:"prompt_text" json:"prompt_text"`
+	TemplateKey *string `db:"template_key" json:"template_key,omitempty"`
+	// TemplateVersion and TemplateChecksum record which catalog template
+	// version was installed and the checksum of its text at the time. They
+	// are zero for presets not installed from the catalog.
+	TemplateVersion  int    `db:"template_version" json:"template_version,omitempty"`
+	TemplateChecksum string `db:"template_checksum" json:"-"`
+	GenerationSettings
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// GenerationSettings choose the provider, model and sampling parameters of a
+// generation, whether personal data is redacted from what is sent and how the
+// answer is cleaned up and formatted. Empty or nil fields leave the choice to
+// a fallback: a request's settings fall back to its preset's, and those to the
+// user's and provider defaults.
+type GenerationSettings struct {
+	Provider    string   `db:"provider" json:"provider,omitempty"`
+	Model       string   `db:"model" json:"model,omitempty"`
+	Temperature *float64 `db:"temperature" json:"temperature,omitempty"`
+	MaxTokens   *int     `db:"max_tokens" json:"max_tokens,omitempty"`
+	TopP        *float64 `db:"top_p" json:"top_p,omitempty"`
+	RedactPII   *bool    `db:"redact_pii" json:"redact_pii,omitempty"`
+	// Postprocess names the cleanup steps run on the answer; ["none"] runs
+	// none.
+	Postprocess []string `db:"postprocess" json:"postprocess,omitempty"`
+	// OutputFormat is the shape of the answer; empty leaves it as the model
+	// writes it.
+	OutputFormat OutputFormat `db:"output_format" json:"output_format,omitempty"`
+	// Fallback lists the "provider/model" pairs tried in order when the
+	// provider fails; a bare provider uses its default model. ["none"]
+	// tries none.
+	Fallback []string `db:"fallback" json:"fallback,omitempty"`
+}
+
+// Or returns s with its unset fields taken from fallback.
+func (s GenerationSettings) Or(fallback GenerationSettings) GenerationSettings {
+	if s.Provider == "" {
+		s.Provider = fallback.Provider
+	}
+	if s.Model == "" {
+		s.Model = fallback.Model
+	}
+	if s.Temperature == nil {
+		s.Temperature = fallback.Temperature
+	}
+	if s.MaxTokens == nil {
+		s.MaxTokens = fallback.MaxTokens
+	}
+	if s.TopP == nil {
+		s.TopP = fallback.TopP
+	}
+	if s.RedactPII == nil {
+		s.RedactPII = fallback.RedactPII
+	}
+	if s.Postprocess == nil {
+		s.Postprocess = fallback.Postprocess
+	}
+	if s.OutputFormat == "" {
+		s.OutputFormat = fallback.OutputFormat
+	}
+	if s.Fallback == nil {
+		s.Fallback = fallback.Fallback
+	}
+	return s
+}
+
+// SystemPromptMode says how a user's system prompt combines with the global
+// one.
+type SystemPromptMode string
+
+const (
+	SystemPromptReplace SystemPromptMode = "replace"
+	SystemPromptAppend  SystemPromptMode = "append"
+)
+
+func (m SystemPromptMode) Valid() bool {
+	return m == SystemPromptReplace || m == SystemPromptAppend
+}
+
+// UserSystemPrompt is a user's own system prompt, used in place of or after
+// the global one.
+type UserSystemPrompt struct {
+	UserID     string           `db:"user_id" json:"user_id"`
+	Mode       SystemPromptMode `db:"mode" json:"mode"`
+	PromptText string           `db:"prompt_text" json:"prompt_text"`
+	UpdatedAt  time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+// PromptRevision is one saved state of a preset or of the system prompt.
+// Revisions are numbered from 1 per prompt and never change once written.
+type PromptRevision struct {
+	ID         string    `db:"id" json:"id"`
+	PromptID   string    `db:"prompt_id" json:"prompt_id"`
+	Revision   int       `db:"revision" json:"revision"`
+	Name       string    `db:"name" json:"name,omitempty"`
+	PromptText string    `db:"prompt_text" json:"prompt_text"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// UserVariable is a custom {{name}} placeholder value defined by a user.
+type UserVariable struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	Value     string    `db:"value" json:"value"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Workspace is a team sharing presets and a system prompt.
+type Workspace struct {
+	ID        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// WorkspaceRole is a member's role in a workspace. Owners manage the
+// workspace and its members, editors maintain its prompts, and members use
+// them.
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleOwner  WorkspaceRole = "owner"
+	WorkspaceRoleEditor WorkspaceRole = "editor"
+	WorkspaceRoleMember WorkspaceRole = "member"
+)
+
+func (r WorkspaceRole) Valid() bool {
+	switch r {
+	case WorkspaceRoleOwner, WorkspaceRoleEditor, WorkspaceRoleMember:
+		return true
+	}
+	return false
+}
+
+// CanEdit reports whether the role may change the workspace's prompts.
+func (r WorkspaceRole) CanEdit() bool {
+	return r == WorkspaceRoleOwner || r == WorkspaceRoleEditor
+}
+
+type WorkspaceMember struct {
+	WorkspaceID string        `db:"workspace_id" json:"workspace_id"`
+	UserID      string        `db:"user_id" json:"user_id"`
+	Role        WorkspaceRole `db:"role" json:"role"`
+	CreatedAt   time.Time     `db:"created_at" json:"created_at"`
+}
+
+// WorkspaceMembership is a workspace together with the caller's role in it.
+type WorkspaceMembership struct {
+	Workspace
+	Role WorkspaceRole `json:"role"`
+}
+
+// WorkspacePreset is a preset owned by a workspace and shared with its
+// members.
+type WorkspacePreset struct {
+	ID          string `db:"id" json:"id"`
+	WorkspaceID string `db:"workspace_id" json:"workspace_id"`
+	Name        string `db:"name" json:"name"`
+	PromptText  string `db:"prompt_text" json:"prompt_text"`
+	GenerationSettings
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// WorkspaceSystemPrompt is a workspace's addition to the global system
+// prompt.
+type WorkspaceSystemPrompt struct {
+	WorkspaceID string    `db:"workspace_id" json:"workspace_id"`
 	PromptText  string    `db:"prompt_text" json:"prompt_text"`
-	TemplateKey *string   `db:"template_key" json:"template_key,omitempty"`
-	CreatedAt   time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// RedactionSetting says whether a user's rewrites have personal data redacted
+// when neither the request nor its preset decides.
+// FallbackChain is a user's own fallback chain, used by rewrites whose
+// request and presets do not set one.
+type FallbackChain struct {
+	UserID    string    `db:"user_id" json:"user_id"`
+	Chain     []string  `db:"chain" json:"chain"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type RedactionSetting struct {
+	UserID    string    `db:"user_id" json:"user_id"`
+	Enabled   bool      `db:"enabled" json:"enabled"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// RedactionRule is a user's own pattern of text to redact. Its name labels
+// the placeholders that stand in for matches.
+type RedactionRule struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	Pattern   string    `db:"pattern" json:"pattern"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
 type APIKey struct {
 	ID           string    `db:"id"`
 	UserID       string    `db:"user_id"`
 	ProviderName string    `db:"provider_name"`
+	Label        string    `db:"label"`
+	IsDefault    bool      `db:"is_default"`
 	EncryptedKey string    `db:"encrypted_key"`
 	CreatedAt    time.Time `db:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at"`
@@ -60,28 +259,229 @@ type Message struct {
 }
 
 type TranscriptionLog struct {
-	ID              string    `db:"id"`
-	UserID          string    `db:"user_id"`
-	Mode            string    `db:"mode"`
-	Transcript      string    `db:"transcript"`
-	GeneratedText   *string   `db:"generated_text"`
-	DurationSeconds float64   `db:"duration_seconds"`
-	CreatedAt       time.Time `db:"created_at"`
+	ID              string  `db:"id"`
+	UserID          string  `db:"user_id"`
+	Mode            string  `db:"mode"`
+	Transcript      string  `db:"transcript"`
+	GeneratedText   *string `db:"generated_text"`
+	DurationSeconds float64 `db:"duration_seconds"`
+	// ContextTruncated is set when the rewrite's context was cut to fit.
+	ContextTruncated bool `db:"context_truncated"`
+	// ContextInjection is what was done about a suspected prompt injection
+	// in the context; empty when none was found.
+	ContextInjection InjectionAction `db:"context_injection"`
+	// OutputFormat is the format GeneratedText was written in, and
+	// EmailSubject the subject of an email draft.
+	OutputFormat OutputFormat `db:"output_format"`
+	EmailSubject string       `db:"email_subject"`
+	// Candidates are the rewrites of a request for several, the first of
+	// which is GeneratedText. ChosenCandidate is the index of the one the
+	// user copied.
+	Candidates      []RewriteCandidate
+	ChosenCandidate *int `db:"chosen_candidate"`
+	// Provider and Model are those that answered, after any fallback.
+	Provider  string    `db:"provider"`
+	Model     string    `db:"model"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ComposeOutcome is what a finished rewrite records on its log entry.
+// GeneratedText is nil when the rewrite was refused.
+type ComposeOutcome struct {
+	GeneratedText    *string
+	ContextTruncated bool
+	ContextInjection InjectionAction
+	OutputFormat     OutputFormat
+	EmailSubject     string
+	Candidates       []RewriteCandidate
+	Provider         string
+	Model            string
+}
+
+// RewriteCandidate is one of several rewrites generated for one request.
+// PresetID and Temperature are set on candidates composed with a preset or
+// temperature of their own.
+type RewriteCandidate struct {
+	Text         string       `db:"text" json:"text"`
+	OutputFormat OutputFormat `db:"output_format" json:"output_format,omitempty"`
+	EmailSubject string       `db:"email_subject" json:"subject,omitempty"`
+	PresetID     string       `db:"preset_id" json:"preset_id,omitempty"`
+	Temperature  *float64     `db:"temperature" json:"temperature,omitempty"`
 }
 
+// OutputFormat is the shape of a rewrite's text.
+type OutputFormat string
+
+const (
+	// OutputPlain is text without any markup.
+	OutputPlain OutputFormat = "plain"
+	// OutputMarkdown is Markdown.
+	OutputMarkdown OutputFormat = "markdown"
+	// OutputHTML is an HTML fragment, rendered from the model's Markdown.
+	OutputHTML OutputFormat = "html"
+	// OutputEmail is an email draft: a subject and a plain-text body.
+	OutputEmail OutputFormat = "email"
+)
+
+func (f OutputFormat) Valid() bool {
+	switch f {
+	case OutputPlain, OutputMarkdown, OutputHTML, OutputEmail:
+		return true
+	}
+	return false
+}
+
+// InjectionAction is what is done with clipboard context that looks like a
+// prompt injection.
+type InjectionAction string
+
+const (
+	// InjectionOff does not screen the context.
+	InjectionOff InjectionAction = "off"
+	// InjectionWarn sends the context as is and records the finding.
+	InjectionWarn InjectionAction = "warn"
+	// InjectionStrip removes the offending lines before sending.
+	InjectionStrip InjectionAction = "strip"
+	// InjectionRefuse does not run the rewrite.
+	InjectionRefuse InjectionAction = "refuse"
+)
+
+func (a InjectionAction) Valid() bool {
+	switch a {
+	case InjectionOff, InjectionWarn, InjectionStrip, InjectionRefuse:
+		return true
+	}
+	return false
+}
+
+type UserRole string
+
+const (
+	UserRoleAdmin  UserRole = "admin"
+	UserRoleMember UserRole = "member"
+)
+
 type User struct {
 	ID           string    `db:"id"`
 	Name         string    `db:"name"`
 	Email        string    `db:"email"`
 	PasswordHash string    `db:"password_hash"`
+	Role         UserRole  `db:"role"`
 	CreatedAt    time.Time `db:"created_at"`
 }
 
+func (u User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
 type UserSession struct {
-	ID        string    `db:"id"`
-	UserID    string    `db:"user_id"`
-	Token     string    `db:"token"`
+	ID        string `db:"id"`
+	UserID    string `db:"user_id"`
+	TokenHash string `db:"token_hash"`
+	// Token is the plaintext bearer token. It is only set on the value
+	// returned when the session is issued and is never persisted.
+	Token     string    `db:"-"`
+	UserAgent string    `db:"user_agent"`
+	IPAddress string    `db:"ip_address"`
 	ExpiresAt time.Time `db:"expires_at"`
 	CreatedAt time.Time `db:"created_at"`
 	LastUsed  time.Time `db:"last_used_at"`
 }
+
+type PasswordResetToken struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the issuer and its subject claim.
+type UserIdentity struct {
+	ID          string    `db:"id"`
+	UserID      string    `db:"user_id"`
+	Issuer      string    `db:"issuer"`
+	Subject     string    `db:"subject"`
+	Email       string    `db:"email"`
+	CreatedAt   time.Time `db:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at"`
+}
+
+// LoginAttempt tracks recent failed logins for one key, either an account
+// ("account:<email>") or a client address ("ip:<addr>").
+type LoginAttempt struct {
+	Key           string     `db:"attempt_key"`
+	Failures      int        `db:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at"`
+	LockedUntil   *time.Time `db:"locked_until"`
+}
+
+type AuditAction string
+
+const (
+	AuditLogin                  AuditAction = "auth.login"
+	AuditLoginFailed            AuditAction = "auth.login_failed"
+	AuditLockout                AuditAction = "auth.lockout"
+	AuditLogout                 AuditAction = "auth.logout"
+	AuditSessionRevoked         AuditAction = "auth.session_revoked"
+	AuditIdentityLinked         AuditAction = "auth.identity_linked"
+	AuditUserCreated            AuditAction = "user.created"
+	AuditUserDeleted            AuditAction = "user.deleted"
+	AuditUserRoleChanged        AuditAction = "user.role_changed"
+	AuditPasswordChanged        AuditAction = "user.password_changed"
+	AuditPasswordResetIssued    AuditAction = "user.password_reset_issued"
+	AuditPasswordReset          AuditAction = "user.password_reset"
+	AuditSystemPromptUpdated    AuditAction = "system_prompt.updated"
+	AuditUserSystemPromptSet    AuditAction = "system_prompt.user_set"
+	AuditUserSystemPromptClear  AuditAction = "system_prompt.user_cleared"
+	AuditPresetCreated          AuditAction = "preset.created"
+	AuditPresetUpdated          AuditAction = "preset.updated"
+	AuditPresetDeleted          AuditAction = "preset.deleted"
+	AuditAPIKeyStored           AuditAction = "api_key.stored"
+	AuditAPIKeyDeleted          AuditAction = "api_key.deleted"
+	AuditAPIKeyDefaultChanged   AuditAction = "api_key.default_changed"
+	AuditAPIKeysRevealed        AuditAction = "api_key.revealed"
+	AuditWorkspaceCreated       AuditAction = "workspace.created"
+	AuditWorkspaceUpdated       AuditAction = "workspace.updated"
+	AuditWorkspaceDeleted       AuditAction = "workspace.deleted"
+	AuditWorkspaceMemberSet     AuditAction = "workspace.member_set"
+	AuditWorkspaceMemberRemoved AuditAction = "workspace.member_removed"
+	AuditWorkspacePromptSet     AuditAction = "workspace.system_prompt_updated"
+	AuditRedactionUpdated       AuditAction = "redaction.updated"
+	AuditRedactionRuleSet       AuditAction = "redaction.rule_set"
+	AuditRedactionRuleDeleted   AuditAction = "redaction.rule_deleted"
+	AuditFallbackUpdated        AuditAction = "fallback.updated"
+	AuditFallbackCleared        AuditAction = "fallback.cleared"
+)
+
+// AuditEvent records a security-relevant or configuration change. Actor is
+// who did it, Subject the user whose account or data was affected; either
+// may be empty (for example a failed login for an unknown email).
+type AuditEvent struct {
+	ID            string            `db:"id" json:"id"`
+	ActorUserID   string            `db:"actor_user_id" json:"actor_user_id,omitempty"`
+	SubjectUserID string            `db:"subject_user_id" json:"subject_user_id,omitempty"`
+	Action        AuditAction       `db:"action" json:"action"`
+	TargetType    string            `db:"target_type" json:"target_type,omitempty"`
+	TargetID      string            `db:"target_id" json:"target_id,omitempty"`
+	IPAddress     string            `db:"ip_address" json:"ip_address,omitempty"`
+	UserAgent     string            `db:"user_agent" json:"user_agent,omitempty"`
+	Metadata      map[string]string `db:"metadata" json:"metadata,omitempty"`
+	CreatedAt     time.Time         `db:"created_at" json:"created_at"`
+}
+
+// AuditFilter narrows an audit query. Zero fields do not filter.
+type AuditFilter struct {
+	// UserID matches events where the user is either actor or subject.
+	UserID      string
+	ActorUserID string
+	// Action matches exactly, or by prefix when it ends in "*" ("auth.*").
+	Action string
+	Since  time.Time
+	Until  time.Time
+	// Before continues a listing after the event with this ID.
+	Before string
+	Limit  int
+}
@@ -3,30 +3,48 @@ package httpapi
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
 
 	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/promptvars"
 	"github.com/Juicern/luma/internal/service"
 )
 
-const sessionCookieName = "luma_session"
+const (
+	sessionCookieName  = "luma_session"
+	oidcFlowCookieName = "luma_oidc_flow"
+	userContextKey     = "luma_user"
+	maxPresetFileSize  = 1 << 20
+)
 
 type API struct {
-	users         *service.UserService
-	auth          *service.AuthService
-	prompts       *service.PromptService
-	keys          *service.APIKeyService
-	transcription *service.TranscriptionService
-	composer      *service.ComposeService
-	logger        *slog.Logger
+	users             *service.UserService
+	auth              *service.AuthService
+	prompts           *service.PromptService
+	variables         *service.VariableService
+	keys              *service.APIKeyService
+	transcription     *service.TranscriptionService
+	workspaces        *service.WorkspaceService
+	redaction         *service.RedactionService
+	fallback          *service.FallbackService
+	composer          *service.ComposeService
+	audit             *service.AuditService
+	logger            *slog.Logger
+	allowRegistration bool
+	oidcName          string
+	postLoginURL      string
 }
 
 func (api *API) registerRoutes(r *gin.RouterGroup) {
@@ -34,24 +52,92 @@ func (api *API) registerRoutes(r *gin.RouterGroup) {
 	r.POST("/logout", api.logout)
 	r.GET("/session", api.currentSession)
 
-	r.GET("/users", api.listUsers)
-	r.POST("/users", api.createUser)
+	r.GET("/auth/oidc", api.oidcInfo)
+	r.GET("/auth/oidc/login", api.oidcLogin)
+	r.GET("/auth/oidc/callback", api.oidcCallback)
+
+	r.GET("/auth/sessions", api.listSessions)
+	r.DELETE("/auth/sessions", api.revokeOtherSessions)
+	r.DELETE("/auth/sessions/:id", api.revokeSession)
+
+	r.GET("/users", api.requireAdmin, api.listUsers)
+	r.POST("/users", api.registrationGate, api.createUser)
+	r.PUT("/users/:id/role", api.requireAdmin, api.setUserRole)
+	r.DELETE("/users/:id", api.requireAdmin, api.deleteUser)
+
+	r.PUT("/account/password", api.changePassword)
+	r.DELETE("/account", api.deleteAccount)
+	r.POST("/password/reset", api.resetPassword)
 
 	r.GET("/system-prompt", api.getSystemPrompt)
-	r.PUT("/system-prompt", api.updateSystemPrompt)
+	r.PUT("/system-prompt", api.requireAdmin, api.updateSystemPrompt)
+	r.GET("/system-prompt/revisions", api.requireAdmin, api.listSystemPromptRevisions)
+	r.GET("/system-prompt/diff", api.requireAdmin, api.diffSystemPrompt)
+	r.POST("/system-prompt/revisions/:revision/restore", api.requireAdmin, api.restoreSystemPrompt)
+	r.GET("/system-prompt/override", api.getUserSystemPrompt)
+	r.PUT("/system-prompt/override", api.setUserSystemPrompt)
+	r.DELETE("/system-prompt/override", api.deleteUserSystemPrompt)
+	r.GET("/system-prompt/effective", api.effectiveSystemPrompt)
 
 	r.GET("/presets", api.listPresets)
 	r.POST("/presets", api.createPreset)
+	r.GET("/presets/export", api.exportPresets)
+	r.POST("/presets/import", api.importPresets)
 	r.PUT("/presets/:id", api.updatePreset)
 	r.DELETE("/presets/:id", api.deletePreset)
+	r.GET("/presets/:id/revisions", api.listPresetRevisions)
+	r.GET("/presets/:id/diff", api.diffPreset)
+	r.POST("/presets/:id/revisions/:revision/restore", api.restorePresetRevision)
+
+	r.GET("/templates", api.listTemplates)
+	r.POST("/templates/:key/install", api.installTemplate)
+	r.POST("/templates/update", api.updateTemplates)
+
+	r.GET("/variables", api.listVariables)
+	r.PUT("/variables/:name", api.setVariable)
+	r.DELETE("/variables/:name", api.deleteVariable)
+	r.GET("/redaction", api.getRedaction)
+	r.PUT("/redaction", api.updateRedaction)
+	r.PUT("/redaction/rules/:name", api.setRedactionRule)
+	r.DELETE("/redaction/rules/:name", api.deleteRedactionRule)
+	r.GET("/fallback", api.getFallback)
+	r.PUT("/fallback", api.updateFallback)
+	r.DELETE("/fallback", api.deleteFallback)
+
+	r.GET("/workspaces", api.listWorkspaces)
+	r.POST("/workspaces", api.createWorkspace)
+	r.GET("/workspaces/:id", api.getWorkspace)
+	r.PUT("/workspaces/:id", api.renameWorkspace)
+	r.DELETE("/workspaces/:id", api.deleteWorkspace)
+
+	r.GET("/workspaces/:id/members", api.listWorkspaceMembers)
+	r.POST("/workspaces/:id/members", api.addWorkspaceMember)
+	r.PUT("/workspaces/:id/members/:user_id", api.setWorkspaceMember)
+	r.DELETE("/workspaces/:id/members/:user_id", api.removeWorkspaceMember)
+
+	r.GET("/workspaces/:id/presets", api.listWorkspacePresets)
+	r.POST("/workspaces/:id/presets", api.createWorkspacePreset)
+	r.PUT("/workspaces/:id/presets/:preset_id", api.updateWorkspacePreset)
+	r.DELETE("/workspaces/:id/presets/:preset_id", api.deleteWorkspacePreset)
+
+	r.GET("/workspaces/:id/system-prompt", api.getWorkspaceSystemPrompt)
+	r.PUT("/workspaces/:id/system-prompt", api.updateWorkspaceSystemPrompt)
+	r.DELETE("/workspaces/:id/system-prompt", api.deleteWorkspaceSystemPrompt)
 
 	r.GET("/api-keys", api.listAPIKeys)
 	r.PUT("/api-keys/:provider", api.upsertAPIKey)
+	r.PUT("/api-keys/:provider/default", api.setDefaultAPIKey)
 	r.DELETE("/api-keys/:provider", api.deleteAPIKey)
 
+	r.GET("/audit", api.listAuditEvents)
+
 	r.GET("/transcriptions", api.listTranscriptions)
 	r.GET("/transcriptions/:id", api.getTranscription)
+	r.GET("/transcriptions/:id/email.eml", api.downloadEmailDraft)
+	r.PUT("/transcriptions/:id/choice", api.chooseCandidate)
 	r.POST("/transcriptions", api.createTranscription)
+
+	r.POST("/compose/preview", api.previewComposition)
 }
 
 func (api *API) login(c *gin.Context) {
@@ -63,12 +149,8 @@ func (api *API) login(c *gin.Context) {
 		api.validationError(c, "email and password are required")
 		return
 	}
-	user, session, err := api.auth.Login(c.Request.Context(), payload.Email, payload.Password)
+	user, session, err := api.auth.Login(c.Request.Context(), payload.Email, payload.Password, clientInfo(c))
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidCredentials) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_credentials"})
-			return
-		}
 		api.handleError(c, err)
 		return
 	}
@@ -85,6 +167,65 @@ func (api *API) logout(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func (api *API) oidcInfo(c *gin.Context) {
+	if !api.auth.OIDCEnabled() {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   true,
+		"name":      api.oidcName,
+		"login_url": "/api/v1/auth/oidc/login",
+	})
+}
+
+// oidcLogin redirects the browser to the identity provider. The flow state is
+// kept in a short-lived cookie scoped to the callback.
+func (api *API) oidcLogin(c *gin.Context) {
+	authURL, flow, err := api.auth.BeginOIDC(c.Request.Context())
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    strings.Join([]string{flow.State, flow.Nonce, flow.Verifier}, "."),
+		Path:     "/api/v1/auth/oidc",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int((10 * time.Minute).Seconds()),
+	})
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (api *API) oidcCallback(c *gin.Context) {
+	var flow service.OIDCFlow
+	if cookie, err := c.Request.Cookie(oidcFlowCookieName); err == nil {
+		if parts := strings.Split(cookie.Value, "."); len(parts) == 3 {
+			flow = service.OIDCFlow{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+		}
+	}
+	// The flow state is single use.
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    "",
+		Path:     "/api/v1/auth/oidc",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "oidc_login_failed", "message": providerErr})
+		return
+	}
+	_, session, err := api.auth.CompleteOIDC(c.Request.Context(), flow, c.Query("state"), c.Query("code"), clientInfo(c))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	api.setSessionCookie(c, session.Token, session.ExpiresAt)
+	c.Redirect(http.StatusFound, api.postLoginURL)
+}
+
 func (api *API) currentSession(c *gin.Context) {
 	user, ok := api.requireSessionUser(c)
 	if !ok {
@@ -93,6 +234,68 @@ func (api *API) currentSession(c *gin.Context) {
 	c.JSON(http.StatusOK, toUserResponse(user))
 }
 
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (api *API) listSessions(c *gin.Context) {
+	user, current, ok := api.requireSession(c)
+	if !ok {
+		return
+	}
+	sessions, err := api.auth.ListSessions(c.Request.Context(), user.ID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, sessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsed,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current.ID,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (api *API) revokeSession(c *gin.Context) {
+	user, current, ok := api.requireSession(c)
+	if !ok {
+		return
+	}
+	if err := api.auth.RevokeSession(c.Request.Context(), user.ID, c.Param("id")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if c.Param("id") == current.ID {
+		api.clearSessionCookie(c)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) revokeOtherSessions(c *gin.Context) {
+	user, current, ok := api.requireSession(c)
+	if !ok {
+		return
+	}
+	if err := api.auth.RevokeOtherSessions(c.Request.Context(), user.ID, current.ID); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 func (api *API) getSystemPrompt(c *gin.Context) {
 	prompt, err := api.prompts.GetSystemPrompt(c.Request.Context())
 	if err != nil {
@@ -122,6 +325,108 @@ func (api *API) updateSystemPrompt(c *gin.Context) {
 	c.JSON(http.StatusOK, prompt)
 }
 
+func (api *API) listSystemPromptRevisions(c *gin.Context) {
+	revisions, err := api.prompts.ListSystemPromptRevisions(c.Request.Context())
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if revisions == nil {
+		revisions = []domain.PromptRevision{}
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (api *API) diffSystemPrompt(c *gin.Context) {
+	from, to, ok := api.revisionRange(c)
+	if !ok {
+		return
+	}
+	diff, err := api.prompts.DiffSystemPromptRevisions(c.Request.Context(), from, to)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (api *API) restoreSystemPrompt(c *gin.Context) {
+	revision, ok := api.revisionParam(c)
+	if !ok {
+		return
+	}
+	prompt, err := api.prompts.RestoreSystemPromptRevision(c.Request.Context(), revision)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (api *API) getUserSystemPrompt(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	prompt, err := api.prompts.GetUserSystemPrompt(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (api *API) setUserSystemPrompt(c *gin.Context) {
+	var payload struct {
+		Mode       domain.SystemPromptMode `json:"mode"`
+		PromptText string                  `json:"prompt_text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "prompt_text is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if payload.Mode == "" {
+		payload.Mode = domain.SystemPromptAppend
+	}
+	prompt, err := api.prompts.SetUserSystemPrompt(c.Request.Context(), userID, payload.Mode, payload.PromptText)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (api *API) deleteUserSystemPrompt(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.prompts.DeleteUserSystemPrompt(c.Request.Context(), userID); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// effectiveSystemPrompt shows the system prompt the user's rewrites are sent
+// with, optionally inside a workspace, and which layers it came from.
+func (api *API) effectiveSystemPrompt(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	prompt, err := api.composer.EffectiveSystemPrompt(c.Request.Context(), userID, c.Query("workspace_id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
 func (api *API) listPresets(c *gin.Context) {
 	userID, ok := api.requireUserQuery(c)
 	if !ok {
@@ -141,6 +446,7 @@ func (api *API) createPreset(c *gin.Context) {
 		Name        string `json:"name" binding:"required"`
 		PromptText  string `json:"prompt_text" binding:"required"`
 		TemplateKey string `json:"template_key"`
+		domain.GenerationSettings
 	}
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		api.validationError(c, "name and prompt_text are required")
@@ -155,7 +461,7 @@ func (api *API) createPreset(c *gin.Context) {
 		copyKey := payload.TemplateKey
 		templateKey = &copyKey
 	}
-	preset, err := api.prompts.CreatePreset(c.Request.Context(), userID, payload.Name, payload.PromptText, templateKey)
+	preset, err := api.prompts.CreatePreset(c.Request.Context(), userID, payload.Name, payload.PromptText, templateKey, payload.GenerationSettings)
 	if err != nil {
 		api.handleError(c, err)
 		return
@@ -165,38 +471,270 @@ func (api *API) createPreset(c *gin.Context) {
 
 func (api *API) updatePreset(c *gin.Context) {
 	var payload struct {
-		UserID      string `json:"user_id"`
-		Name        string `json:"name" binding:"required"`
-		PromptText  string `json:"prompt_text" binding:"required"`
-		TemplateKey string `json:"template_key"`
+		UserID      string `json:"user_id"`
+		Name        string `json:"name" binding:"required"`
+		PromptText  string `json:"prompt_text" binding:"required"`
+		TemplateKey string `json:"template_key"`
+		domain.GenerationSettings
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "name and prompt_text are required")
+		return
+	}
+	userID, ok := api.resolveUserID(c, payload.UserID)
+	if !ok {
+		return
+	}
+	var templateKey *string
+	if strings.TrimSpace(payload.TemplateKey) != "" {
+		copyKey := payload.TemplateKey
+		templateKey = &copyKey
+	}
+	preset, err := api.prompts.UpdatePreset(c.Request.Context(), c.Param("id"), userID, payload.Name, payload.PromptText, templateKey, payload.GenerationSettings)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preset)
+}
+
+func (api *API) deletePreset(c *gin.Context) {
+	userID, ok := api.resolveUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+	if err := api.prompts.DeletePreset(c.Request.Context(), c.Param("id"), userID); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// exportPresets downloads the caller's presets as a JSON file, or as YAML
+// with ?format=yaml.
+func (api *API) exportPresets(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	file, err := api.prompts.ExportPresets(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	var data []byte
+	var contentType, ext string
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		data, err = json.MarshalIndent(file, "", "  ")
+		contentType, ext = "application/json", "json"
+	case "yaml", "yml":
+		data, err = yaml.Marshal(file)
+		contentType, ext = "application/yaml", "yaml"
+	default:
+		api.validationError(c, "format must be json or yaml")
+		return
+	}
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="luma-presets.`+ext+`"`)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// importPresets reads a preset file (JSON or YAML) from the request body.
+// ?strategy=skip|overwrite|rename resolves clashes; ?dry_run=true only
+// reports what would change.
+func (api *API) importPresets(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	strategy, err := service.ParseImportStrategy(c.Query("strategy"))
+	if err != nil {
+		api.validationError(c, "strategy must be skip, overwrite or rename")
+		return
+	}
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			api.validationError(c, "dry_run must be true or false")
+			return
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPresetFileSize+1))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if len(data) > maxPresetFileSize {
+		api.validationError(c, "preset file is too large")
+		return
+	}
+	file, err := service.ParsePresetFile(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_preset_file", "message": err.Error()})
+		return
+	}
+	report, err := api.prompts.ImportPresets(c.Request.Context(), userID, file, strategy, dryRun)
+	if errors.Is(err, service.ErrInvalidPresetFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_preset_file", "dry_run": report.DryRun, "results": report.Results})
+		return
+	}
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (api *API) listPresetRevisions(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	revisions, err := api.prompts.ListPresetRevisions(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if revisions == nil {
+		revisions = []domain.PromptRevision{}
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// diffPreset compares two revisions (?from=1&to=3). Without to it shows the
+// latest revision; without from, the change that produced it.
+func (api *API) diffPreset(c *gin.Context) {
+	from, to, ok := api.revisionRange(c)
+	if !ok {
+		return
+	}
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	diff, err := api.prompts.DiffPresetRevisions(c.Request.Context(), userID, c.Param("id"), from, to)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (api *API) restorePresetRevision(c *gin.Context) {
+	revision, ok := api.revisionParam(c)
+	if !ok {
+		return
+	}
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	preset, err := api.prompts.RestorePresetRevision(c.Request.Context(), userID, c.Param("id"), revision)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preset)
+}
+
+func (api *API) listTemplates(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	statuses, err := api.prompts.ListTemplates(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+func (api *API) installTemplate(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	preset, err := api.prompts.InstallTemplate(c.Request.Context(), userID, c.Param("key"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, preset)
+}
+
+// updateTemplates applies catalog updates to the user's unedited template
+// presets. An empty body updates every installed template.
+func (api *API) updateTemplates(c *gin.Context) {
+	var payload struct {
+		UserID string   `json:"user_id"`
+		Keys   []string `json:"keys"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			api.validationError(c, "keys must be a list of template keys")
+			return
+		}
+	}
+	userID, ok := api.resolveUserID(c, payload.UserID)
+	if !ok {
+		return
+	}
+	result, err := api.prompts.UpdateTemplates(c.Request.Context(), userID, payload.Keys)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (api *API) listVariables(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	variables, err := api.variables.List(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if variables == nil {
+		variables = []domain.UserVariable{}
+	}
+	c.JSON(http.StatusOK, gin.H{"builtin": promptvars.Builtins(), "variables": variables})
+}
+
+func (api *API) setVariable(c *gin.Context) {
+	var payload struct {
+		UserID string `json:"user_id"`
+		Value  string `json:"value"`
 	}
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		api.validationError(c, "name and prompt_text are required")
+		api.validationError(c, "invalid payload")
 		return
 	}
 	userID, ok := api.resolveUserID(c, payload.UserID)
 	if !ok {
 		return
 	}
-	var templateKey *string
-	if strings.TrimSpace(payload.TemplateKey) != "" {
-		copyKey := payload.TemplateKey
-		templateKey = &copyKey
-	}
-	preset, err := api.prompts.UpdatePreset(c.Request.Context(), c.Param("id"), userID, payload.Name, payload.PromptText, templateKey)
+	variable, err := api.variables.Set(c.Request.Context(), userID, c.Param("name"), payload.Value)
 	if err != nil {
 		api.handleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, preset)
+	c.JSON(http.StatusOK, variable)
 }
 
-func (api *API) deletePreset(c *gin.Context) {
-	userID, ok := api.resolveUserID(c, c.Query("user_id"))
+func (api *API) deleteVariable(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
 	if !ok {
 		return
 	}
-	if err := api.prompts.DeletePreset(c.Request.Context(), c.Param("id"), userID); err != nil {
+	if err := api.variables.Delete(c.Request.Context(), userID, c.Param("name")); err != nil {
 		api.handleError(c, err)
 		return
 	}
@@ -218,8 +756,10 @@ func (api *API) listAPIKeys(c *gin.Context) {
 
 func (api *API) upsertAPIKey(c *gin.Context) {
 	var payload struct {
-		UserID string `json:"user_id"`
-		APIKey string `json:"api_key" binding:"required"`
+		UserID  string `json:"user_id"`
+		APIKey  string `json:"api_key" binding:"required"`
+		Label   string `json:"label"`
+		Default bool   `json:"default"`
 	}
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		api.validationError(c, "api_key is required")
@@ -229,7 +769,27 @@ func (api *API) upsertAPIKey(c *gin.Context) {
 	if !ok {
 		return
 	}
-	if _, err := api.keys.Upsert(c.Request.Context(), userID, c.Param("provider"), payload.APIKey); err != nil {
+	if _, err := api.keys.Upsert(c.Request.Context(), userID, c.Param("provider"), payload.Label, payload.APIKey, payload.Default); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) setDefaultAPIKey(c *gin.Context) {
+	var payload struct {
+		UserID string `json:"user_id"`
+		Label  string `json:"label" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "label is required")
+		return
+	}
+	userID, ok := api.resolveUserID(c, payload.UserID)
+	if !ok {
+		return
+	}
+	if err := api.keys.SetDefault(c.Request.Context(), userID, c.Param("provider"), payload.Label); err != nil {
 		api.handleError(c, err)
 		return
 	}
@@ -241,7 +801,7 @@ func (api *API) deleteAPIKey(c *gin.Context) {
 	if !ok {
 		return
 	}
-	if err := api.keys.Delete(c.Request.Context(), userID, c.Param("provider")); err != nil {
+	if err := api.keys.Delete(c.Request.Context(), userID, c.Param("provider"), c.Query("label")); err != nil {
 		api.handleError(c, err)
 		return
 	}
@@ -266,12 +826,20 @@ func (api *API) createUser(c *gin.Context) {
 		Name     string `json:"name" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required,min=8"`
+		Role     string `json:"role"`
 	}
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		api.validationError(c, "name, email, and password are required")
 		return
 	}
-	user, err := api.users.Create(c.Request.Context(), payload.Name, payload.Email, payload.Password)
+	role := domain.UserRole(payload.Role)
+	if role != "" && role != domain.UserRoleMember {
+		if caller, ok := contextUser(c); !ok || !caller.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+	}
+	user, err := api.users.Create(c.Request.Context(), payload.Name, payload.Email, payload.Password, role)
 	if err != nil {
 		api.handleError(c, err)
 		return
@@ -279,23 +847,112 @@ func (api *API) createUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, toUserResponse(user))
 }
 
+func (api *API) setUserRole(c *gin.Context) {
+	var payload struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "role is required")
+		return
+	}
+	user, err := api.users.SetRole(c.Request.Context(), c.Param("id"), domain.UserRole(payload.Role))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toUserResponse(user))
+}
+
+func (api *API) deleteUser(c *gin.Context) {
+	if err := api.users.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) changePassword(c *gin.Context) {
+	user, session, ok := api.requireSession(c)
+	if !ok {
+		return
+	}
+	// current_password is checked by the service; accounts without a
+	// password may leave it out.
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "new_password is required")
+		return
+	}
+	if err := api.users.ChangePassword(c.Request.Context(), user.ID, session.ID, payload.CurrentPassword, payload.NewPassword); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) deleteAccount(c *gin.Context) {
+	user, ok := api.requireSessionUser(c)
+	if !ok {
+		return
+	}
+	// Accounts without a password may send no body.
+	var payload struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		api.validationError(c, "password must be a string")
+		return
+	}
+	if err := api.users.DeleteSelf(c.Request.Context(), user.ID, payload.Password); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	api.clearSessionCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) resetPassword(c *gin.Context) {
+	var payload struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "token and new_password are required")
+		return
+	}
+	if err := api.users.ResetPassword(c.Request.Context(), payload.Token, payload.NewPassword); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 func (api *API) requireUserQuery(c *gin.Context) (string, bool) {
 	return api.resolveUserID(c, c.Query("user_id"))
 }
 
 type userResponse struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Email string          `json:"email"`
+	Role  domain.UserRole `json:"role"`
+	// HasPassword is false for accounts created through single sign-on that
+	// have not set a password yet.
+	HasPassword bool      `json:"has_password"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 func toUserResponse(u domain.User) userResponse {
 	return userResponse{
-		ID:        u.ID,
-		Name:      u.Name,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
+		ID:          u.ID,
+		Name:        u.Name,
+		Email:       u.Email,
+		Role:        u.Role,
+		HasPassword: u.PasswordHash != "",
+		CreatedAt:   u.CreatedAt,
 	}
 }
 
@@ -310,7 +967,10 @@ func (api *API) createTranscription(c *gin.Context) {
 	if !ok {
 		return
 	}
-	provider := c.PostForm("provider")
+	// The form's provider picks the speech-to-text provider and, when set,
+	// overrides the preset's provider for the rewrite.
+	composeProvider := strings.TrimSpace(c.PostForm("provider"))
+	provider := composeProvider
 	if provider == "" {
 		provider = "openai"
 	}
@@ -319,25 +979,28 @@ func (api *API) createTranscription(c *gin.Context) {
 		mode = "content"
 	}
 	durationSeconds := parseDuration(c.PostForm("duration_seconds"))
-	model := c.PostForm("model")
+	keyLabel := strings.TrimSpace(c.PostForm("key_label"))
 	presetID := strings.TrimSpace(c.PostForm("preset_id"))
 	presetText := c.PostForm("preset_text")
 	temporaryPrompt := c.PostForm("temporary_prompt")
 	contextText := c.PostForm("context_text")
-
-	type promptResult struct {
-		text string
-		err  error
+	targetApp := strings.TrimSpace(c.PostForm("target_app"))
+	timezone := strings.TrimSpace(c.PostForm("timezone"))
+	contextLanguage := strings.TrimSpace(c.PostForm("context_language"))
+	workspaceID := strings.TrimSpace(c.PostForm("workspace_id"))
+	workspacePresetID := strings.TrimSpace(c.PostForm("workspace_preset_id"))
+	settings, err := generationForm(c)
+	if err != nil {
+		api.validationError(c, err.Error())
+		return
+	}
+	settings.Provider = composeProvider
+	settings.Model = c.PostForm("model")
+	candidates, variants, err := candidateForm(c)
+	if err != nil {
+		api.validationError(c, err.Error())
+		return
 	}
-	systemPromptCh := make(chan promptResult, 1)
-	go func() {
-		prompt, err := api.prompts.GetSystemPrompt(c.Request.Context())
-		if err != nil {
-			systemPromptCh <- promptResult{err: err}
-			return
-		}
-		systemPromptCh <- promptResult{text: prompt.PromptText}
-	}()
 
 	f, err := file.Open()
 	if err != nil {
@@ -352,43 +1015,30 @@ func (api *API) createTranscription(c *gin.Context) {
 		return
 	}
 
-	entry, err := api.transcription.Transcribe(c.Request.Context(), userID, provider, mode, durationSeconds, data, file.Filename)
+	entry, err := api.transcription.Transcribe(c.Request.Context(), userID, provider, keyLabel, mode, durationSeconds, data, file.Filename)
 	if err != nil {
 		api.handleError(c, err)
 		return
 	}
 
-	var systemPromptText string
-	var promptErr error
 	if entry.Mode == "content" {
-		res := <-systemPromptCh
-		if res.err != nil {
-			promptErr = res.err
-		} else {
-			systemPromptText = res.text
-		}
 		api.launchComposition(service.ComposeRequest{
-			UserID:          userID,
-			Provider:        provider,
-			Model:           model,
-			SystemPrompt:    systemPromptText,
-			PresetID:        presetID,
-			PresetText:      presetText,
-			TemporaryPrompt: temporaryPrompt,
-			ContextText:     contextText,
-			Content:         entry.Transcript,
+			UserID:             userID,
+			KeyLabel:           keyLabel,
+			GenerationSettings: settings,
+			PresetID:           presetID,
+			PresetText:         presetText,
+			WorkspaceID:        workspaceID,
+			WorkspacePresetID:  workspacePresetID,
+			TemporaryPrompt:    temporaryPrompt,
+			ContextText:        contextText,
+			Content:            entry.Transcript,
+			TargetApp:          targetApp,
+			Timezone:           timezone,
+			ContextLanguage:    contextLanguage,
+			Candidates:         candidates,
+			Variants:           variants,
 		}, entry.ID)
-	} else {
-		select {
-		case res := <-systemPromptCh:
-			if res.err != nil {
-				promptErr = res.err
-			}
-		default:
-		}
-	}
-	if promptErr != nil {
-		api.logger.Warn("system prompt fetch failed", slog.Any("error", promptErr))
 	}
 	processing := entry.Mode == "content"
 	c.JSON(http.StatusOK, gin.H{
@@ -402,6 +1052,94 @@ func (api *API) createTranscription(c *gin.Context) {
 	})
 }
 
+// previewComposition resolves a rewrite request and returns what would be
+// sent to the provider, without sending it.
+func (api *API) previewComposition(c *gin.Context) {
+	var payload struct {
+		Content           string `json:"content" binding:"required"`
+		PresetID          string `json:"preset_id"`
+		PresetText        string `json:"preset_text"`
+		WorkspaceID       string `json:"workspace_id"`
+		WorkspacePresetID string `json:"workspace_preset_id"`
+		TemporaryPrompt   string `json:"temporary_prompt"`
+		ContextText       string `json:"context_text"`
+		TargetApp         string `json:"target_app"`
+		Timezone          string `json:"timezone"`
+		ContextLanguage   string `json:"context_language"`
+		domain.GenerationSettings
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "content is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	preview, err := api.composer.Preview(c.Request.Context(), service.ComposeRequest{
+		UserID:             userID,
+		GenerationSettings: payload.GenerationSettings,
+		PresetID:           payload.PresetID,
+		PresetText:         payload.PresetText,
+		WorkspaceID:        payload.WorkspaceID,
+		WorkspacePresetID:  payload.WorkspacePresetID,
+		TemporaryPrompt:    payload.TemporaryPrompt,
+		ContextText:        payload.ContextText,
+		Content:            payload.Content,
+		TargetApp:          payload.TargetApp,
+		Timezone:           payload.Timezone,
+		ContextLanguage:    payload.ContextLanguage,
+	})
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// listAuditEvents pages through the audit log, newest first. Admins see every
+// event; other users only events where they are the actor or the subject.
+func (api *API) listAuditEvents(c *gin.Context) {
+	user, ok := api.requireSessionUser(c)
+	if !ok {
+		return
+	}
+	filter := domain.AuditFilter{
+		ActorUserID: c.Query("actor"),
+		Action:      c.Query("action"),
+		Before:      c.Query("before"),
+		Limit:       parseLimit(c.Query("limit")),
+	}
+	if !user.IsAdmin() {
+		filter.UserID = user.ID
+	}
+	for param, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			api.validationError(c, param+" must be an RFC 3339 timestamp")
+			return
+		}
+		*dst = parsed
+	}
+	events, err := api.audit.List(c.Request.Context(), filter)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if events == nil {
+		events = []domain.AuditEvent{}
+	}
+	resp := gin.H{"events": events}
+	if filter.Limit > 0 && len(events) == filter.Limit {
+		resp["next_before"] = events[len(events)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
 func (api *API) listTranscriptions(c *gin.Context) {
 	userID, ok := api.requireUserQuery(c)
 	if !ok {
@@ -415,14 +1153,7 @@ func (api *API) listTranscriptions(c *gin.Context) {
 	}
 	resp := make([]gin.H, 0, len(entries))
 	for _, entry := range entries {
-		resp = append(resp, gin.H{
-			"id":               entry.ID,
-			"mode":             entry.Mode,
-			"transcription":    entry.Transcript,
-			"transformed_text": entry.GeneratedText,
-			"duration_seconds": entry.DurationSeconds,
-			"created_at":       entry.CreatedAt,
-		})
+		resp = append(resp, transcriptionJSON(entry))
 	}
 	c.JSON(http.StatusOK, resp)
 }
@@ -437,37 +1168,154 @@ func (api *API) getTranscription(c *gin.Context) {
 		api.handleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"id":               entry.ID,
-		"mode":             entry.Mode,
-		"transcription":    entry.Transcript,
-		"transformed_text": entry.GeneratedText,
-		"duration_seconds": entry.DurationSeconds,
-		"created_at":       entry.CreatedAt,
-	})
+	c.JSON(http.StatusOK, transcriptionJSON(entry))
+}
+
+// chooseCandidate records which candidate of a transcription the user copied.
+func (api *API) chooseCandidate(c *gin.Context) {
+	var payload struct {
+		UserID string `json:"user_id"`
+		Index  *int   `json:"index" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "index is required")
+		return
+	}
+	userID, ok := api.resolveUserID(c, payload.UserID)
+	if !ok {
+		return
+	}
+	entry, err := api.transcription.ChooseCandidate(c.Request.Context(), userID, c.Param("id"), *payload.Index)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transcriptionJSON(entry))
+}
+
+func transcriptionJSON(entry domain.TranscriptionLog) gin.H {
+	return gin.H{
+		"id":                entry.ID,
+		"mode":              entry.Mode,
+		"transcription":     entry.Transcript,
+		"transformed_text":  entry.GeneratedText,
+		"duration_seconds":  entry.DurationSeconds,
+		"context_truncated": entry.ContextTruncated,
+		"context_injection": entry.ContextInjection,
+		"output_format":     entry.OutputFormat,
+		"subject":           entry.EmailSubject,
+		"candidates":        entry.Candidates,
+		"chosen_candidate":  entry.ChosenCandidate,
+		"provider":          entry.Provider,
+		"model":             entry.Model,
+		"created_at":        entry.CreatedAt,
+	}
+}
+
+// downloadEmailDraft serves the email draft of a transcription as an .eml
+// file.
+func (api *API) downloadEmailDraft(c *gin.Context) {
+	userID, ok := api.requireUserQuery(c)
+	if !ok {
+		return
+	}
+	draft, err := api.transcription.EmailDraft(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="draft.eml"`)
+	c.Data(http.StatusOK, "message/rfc822", draft)
 }
 
 func (api *API) launchComposition(req service.ComposeRequest, logID string) {
 	go func() {
 		result, err := api.composer.Compose(context.Background(), req)
-		if err != nil {
+		refused := errors.Is(err, service.ErrContextInjection)
+		if err != nil && !refused {
 			api.logger.Warn("compose failed", slog.String("log_id", logID), slog.Any("error", err))
 			return
 		}
-		if err := api.transcription.AttachGeneratedText(context.Background(), logID, result); err != nil {
+		outcome := domain.ComposeOutcome{ContextTruncated: result.Context.Truncated}
+		if injection := result.Context.Injection; injection != nil {
+			outcome.ContextInjection = injection.Action
+			api.logger.Info("suspected prompt injection in context", slog.String("log_id", logID), slog.String("action", string(injection.Action)))
+		}
+		if !refused {
+			outcome.GeneratedText = &result.Text
+			outcome.OutputFormat, outcome.EmailSubject = result.Format, result.Subject
+			outcome.Candidates = result.Candidates
+			outcome.Provider, outcome.Model = result.Provider, result.Model
+		}
+		if err := api.transcription.AttachComposition(context.Background(), logID, outcome); err != nil {
 			api.logger.Warn("failed to attach generated text", slog.String("log_id", logID), slog.Any("error", err))
 		}
 	}()
 }
 
 func (api *API) handleError(c *gin.Context, err error) {
+	var lockErr *service.LockoutError
+	var undefinedErr *service.UndefinedVariablesError
 	switch {
+	case errors.As(err, &lockErr):
+		retryAfter := int(math.Ceil(lockErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too_many_attempts", "retry_after": retryAfter})
 	case errors.Is(err, sql.ErrNoRows):
 		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 	case errors.Is(err, service.ErrMissingAPIKey):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing_api_key"})
 	case errors.Is(err, service.ErrProviderNotSupported):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "provider_not_supported"})
+	case errors.Is(err, service.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_role"})
+	case errors.Is(err, service.ErrInvalidCandidate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_candidate"})
+	case errors.Is(err, service.ErrNotEmailDraft):
+		c.JSON(http.StatusConflict, gin.H{"error": "not_email_draft"})
+	case errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "last_admin"})
+	case errors.Is(err, service.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_credentials"})
+	case errors.Is(err, service.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "weak_password"})
+	case errors.Is(err, service.ErrInvalidResetToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_reset_token"})
+	case errors.Is(err, service.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "template_not_found"})
+	case errors.Is(err, service.ErrTemplateInstalled):
+		c.JSON(http.StatusConflict, gin.H{"error": "template_installed"})
+	case errors.As(err, &undefinedErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "undefined_variable", "variables": undefinedErr.Names})
+	case errors.Is(err, service.ErrInvalidVariableName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_variable_name"})
+	case errors.Is(err, service.ErrInvalidGenerationSettings):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_generation_settings", "message": err.Error()})
+	case errors.Is(err, service.ErrInvalidRedactionRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_redaction_rule", "message": err.Error()})
+	case errors.Is(err, service.ErrInvalidFallback):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_fallback", "message": err.Error()})
+	case errors.Is(err, service.ErrInvalidSystemPromptMode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_system_prompt_mode"})
+	case errors.Is(err, service.ErrInvalidWorkspaceRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_workspace_role"})
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "workspace_forbidden"})
+	case errors.Is(err, service.ErrLastWorkspaceOwner):
+		c.JSON(http.StatusConflict, gin.H{"error": "last_workspace_owner"})
+	case errors.Is(err, service.ErrOIDCDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc_disabled"})
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_oidc_state"})
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		api.logger.Warn("oidc login failed", slog.Any("error", err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "oidc_login_failed"})
+	case errors.Is(err, service.ErrOIDCEmailNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "oidc_email_not_allowed"})
+	case errors.Is(err, service.ErrOIDCEmailUnverified):
+		c.JSON(http.StatusForbidden, gin.H{"error": "oidc_email_unverified"})
+	case errors.Is(err, service.ErrOIDCNoAccount):
+		c.JSON(http.StatusForbidden, gin.H{"error": "oidc_no_account"})
 	default:
 		api.logger.Error("request failed", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
@@ -509,12 +1357,25 @@ func (api *API) clearSessionCookie(c *gin.Context) {
 }
 
 func (api *API) requireSessionUser(c *gin.Context) (domain.User, bool) {
+	user, _, ok := api.requireSession(c)
+	return user, ok
+}
+
+// requireSessionUserID is requireSessionUser for handlers that only need the
+// user's ID. Routes that act on data shared with others or on a user's
+// protections use it rather than trusting a user_id sent by the client.
+func (api *API) requireSessionUserID(c *gin.Context) (string, bool) {
+	user, ok := api.requireSessionUser(c)
+	return user.ID, ok
+}
+
+func (api *API) requireSession(c *gin.Context) (domain.User, domain.UserSession, bool) {
 	token, err := api.sessionTokenFromCookie(c)
 	if err != nil || token == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "not_authenticated"})
-		return domain.User{}, false
+		return domain.User{}, domain.UserSession{}, false
 	}
-	user, _, err := api.auth.Verify(c.Request.Context(), token)
+	user, session, err := api.auth.Verify(c.Request.Context(), token)
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrSessionExpired):
@@ -524,17 +1385,98 @@ func (api *API) requireSessionUser(c *gin.Context) (domain.User, bool) {
 		default:
 			api.handleError(c, err)
 		}
+		return domain.User{}, domain.UserSession{}, false
+	}
+	// Expiry slides with use; keep the cookie in step with it.
+	api.setSessionCookie(c, token, session.ExpiresAt)
+	setActorUser(c, user.ID)
+	return user, session, true
+}
+
+// requireAdmin is a middleware that only lets authenticated admins through.
+func (api *API) requireAdmin(c *gin.Context) {
+	user, ok := api.requireSessionUser(c)
+	if !ok {
+		c.Abort()
+		return
+	}
+	if !user.IsAdmin() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	c.Set(userContextKey, user)
+	c.Next()
+}
+
+// registrationGate guards user creation: admins may always create accounts,
+// everyone else only while open self-registration is enabled.
+func (api *API) registrationGate(c *gin.Context) {
+	if token, err := api.sessionTokenFromCookie(c); err == nil && token != "" {
+		if user, _, err := api.auth.Verify(c.Request.Context(), token); err == nil {
+			c.Set(userContextKey, user)
+			setActorUser(c, user.ID)
+			if user.IsAdmin() {
+				c.Next()
+				return
+			}
+		}
+	}
+	if !api.allowRegistration {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "registration_disabled"})
+		return
+	}
+	c.Next()
+}
+
+func contextUser(c *gin.Context) (domain.User, bool) {
+	value, ok := c.Get(userContextKey)
+	if !ok {
 		return domain.User{}, false
 	}
-	return user, true
+	user, ok := value.(domain.User)
+	return user, ok
+}
+
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// attachActor is a middleware that records the calling client on the request
+// context so services can attribute audit events. The user is added once the
+// session has been verified.
+func attachActor(c *gin.Context) {
+	ctx := service.WithActor(c.Request.Context(), service.Actor{Client: clientInfo(c)})
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+func setActorUser(c *gin.Context, userID string) {
+	actor := service.ActorFromContext(c.Request.Context())
+	actor.UserID = userID
+	c.Request = c.Request.WithContext(service.WithActor(c.Request.Context(), actor))
 }
 
+// resolveUserID returns the user named by provided, else the session's. Only
+// a verified session makes a user the actor of audit events; a named user
+// without one is recorded as claimed_user_id.
 func (api *API) resolveUserID(c *gin.Context, provided string) (string, bool) {
 	if provided != "" {
 		if _, err := api.users.Get(c.Request.Context(), provided); err != nil {
 			api.handleError(c, err)
 			return "", false
 		}
+		if token, err := api.sessionTokenFromCookie(c); err == nil && token != "" {
+			if user, _, err := api.auth.Verify(c.Request.Context(), token); err == nil {
+				setActorUser(c, user.ID)
+				return provided, true
+			}
+		}
+		actor := service.ActorFromContext(c.Request.Context())
+		actor.ClaimedUserID = provided
+		c.Request = c.Request.WithContext(service.WithActor(c.Request.Context(), actor))
 		return provided, true
 	}
 	user, ok := api.requireSessionUser(c)
@@ -544,6 +1486,123 @@ func (api *API) resolveUserID(c *gin.Context, provided string) (string, bool) {
 	return user.ID, true
 }
 
+func (api *API) revisionParam(c *gin.Context) (int, bool) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		api.validationError(c, "revision must be a positive number")
+		return 0, false
+	}
+	return revision, true
+}
+
+// revisionRange reads the optional ?from= and ?to= revision numbers; zero
+// means not given.
+func (api *API) revisionRange(c *gin.Context) (int, int, bool) {
+	var bounds [2]int
+	for i, name := range []string{"from", "to"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			api.validationError(c, name+" must be a positive revision number")
+			return 0, 0, false
+		}
+		bounds[i] = n
+	}
+	return bounds[0], bounds[1], true
+}
+
+// generationForm reads the optional sampling parameters, redaction switch,
+// post-processing steps, output format and fallback chain of a multipart
+// request. Steps and fallback entries are separated by commas.
+func generationForm(c *gin.Context) (domain.GenerationSettings, error) {
+	var settings domain.GenerationSettings
+	for field, dst := range map[string]**float64{"temperature": &settings.Temperature, "top_p": &settings.TopP} {
+		value := strings.TrimSpace(c.PostForm(field))
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return settings, errors.New(field + " must be a number")
+		}
+		*dst = &parsed
+	}
+	if value := strings.TrimSpace(c.PostForm("max_tokens")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return settings, errors.New("max_tokens must be an integer")
+		}
+		settings.MaxTokens = &parsed
+	}
+	if value := strings.TrimSpace(c.PostForm("redact_pii")); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return settings, errors.New("redact_pii must be true or false")
+		}
+		settings.RedactPII = &parsed
+	}
+	if value := strings.TrimSpace(c.PostForm("postprocess")); value != "" {
+		settings.Postprocess = strings.Split(value, ",")
+	}
+	settings.OutputFormat = domain.OutputFormat(c.PostForm("output_format"))
+	if value := strings.TrimSpace(c.PostForm("fallback")); value != "" {
+		settings.Fallback = strings.Split(value, ",")
+	}
+	return settings, nil
+}
+
+// candidateForm reads how many rewrites a multipart request asks for: n
+// candidates from one provider call, or one per entry of the comma-separated
+// candidate_presets and candidate_temperatures. When both lists are given
+// they are paired up in order.
+func candidateForm(c *gin.Context) (int, []service.ComposeVariant, error) {
+	var n int
+	if value := strings.TrimSpace(c.PostForm("n")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > service.MaxCandidates {
+			return 0, nil, fmt.Errorf("n must be an integer between 1 and %d", service.MaxCandidates)
+		}
+		n = parsed
+	}
+	presets := splitList(c.PostForm("candidate_presets"))
+	temperatures := splitList(c.PostForm("candidate_temperatures"))
+	if len(presets) > 0 && len(temperatures) > 0 && len(presets) != len(temperatures) {
+		return 0, nil, errors.New("candidate_presets and candidate_temperatures must have the same number of entries")
+	}
+	variants := make([]service.ComposeVariant, max(len(presets), len(temperatures)))
+	for i, id := range presets {
+		variants[i].PresetID = id
+	}
+	for i, value := range temperatures {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, nil, errors.New("candidate_temperatures must be numbers")
+		}
+		variants[i].Temperature = &parsed
+	}
+	switch {
+	case len(variants) > service.MaxCandidates:
+		return 0, nil, fmt.Errorf("at most %d candidate variants are allowed", service.MaxCandidates)
+	case n > 1 && len(variants) > 0:
+		return 0, nil, errors.New("n cannot be combined with candidate_presets or candidate_temperatures")
+	}
+	return n, variants, nil
+}
+
+// splitList splits a comma-separated form value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func parseDuration(value string) float64 {
 	if value == "" {
 		return 0
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (api *API) getFallback(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	settings, err := api.fallback.Settings(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (api *API) updateFallback(c *gin.Context) {
+	var payload struct {
+		Chain []string `json:"chain" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "chain is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	settings, err := api.fallback.SetChain(c.Request.Context(), userID, payload.Chain)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (api *API) deleteFallback(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.fallback.ClearChain(c.Request.Context(), userID); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (api *API) getRedaction(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	settings, err := api.redaction.Settings(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (api *API) updateRedaction(c *gin.Context) {
+	var payload struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "enabled is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	settings, err := api.redaction.SetEnabled(c.Request.Context(), userID, *payload.Enabled)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (api *API) setRedactionRule(c *gin.Context) {
+	var payload struct {
+		Pattern string `json:"pattern" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "pattern is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	rule, err := api.redaction.SetRule(c.Request.Context(), userID, c.Param("name"), payload.Pattern)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (api *API) deleteRedactionRule(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.redaction.DeleteRule(c.Request.Context(), userID, c.Param("name")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
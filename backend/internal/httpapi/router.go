@@ -6,29 +6,44 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/Juicern/luma/internal/config"
 	"github.com/Juicern/luma/internal/service"
 )
 
 func NewRouter(
+	authCfg config.AuthConfig,
 	userService *service.UserService,
 	authService *service.AuthService,
 	promptService *service.PromptService,
+	variableService *service.VariableService,
 	apiKeyService *service.APIKeyService,
+	workspaceService *service.WorkspaceService,
+	redactionService *service.RedactionService,
+	fallbackService *service.FallbackService,
 	transcriptionService *service.TranscriptionService,
 	composerService *service.ComposeService,
+	auditService *service.AuditService,
 	logger *slog.Logger,
 ) http.Handler {
 	r := gin.New()
-	r.Use(gin.Logger(), gin.Recovery())
+	r.Use(gin.Logger(), gin.Recovery(), attachActor)
 
 	api := &API{
-		users:         userService,
-		auth:          authService,
-		prompts:       promptService,
-		keys:          apiKeyService,
-		transcription: transcriptionService,
-		composer:      composerService,
-		logger:        logger,
+		users:             userService,
+		auth:              authService,
+		prompts:           promptService,
+		variables:         variableService,
+		keys:              apiKeyService,
+		transcription:     transcriptionService,
+		workspaces:        workspaceService,
+		redaction:         redactionService,
+		fallback:          fallbackService,
+		composer:          composerService,
+		audit:             auditService,
+		logger:            logger,
+		allowRegistration: authCfg.AllowRegistration,
+		oidcName:          authCfg.OIDC.DisplayName,
+		postLoginURL:      authCfg.OIDC.PostLoginURL,
 	}
 
 	r.GET("/healthz", func(c *gin.Context) {
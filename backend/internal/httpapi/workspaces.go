@@ -0,0 +1,276 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+func (api *API) listWorkspaces(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	workspaces, err := api.workspaces.List(c.Request.Context(), userID)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if workspaces == nil {
+		workspaces = []domain.WorkspaceMembership{}
+	}
+	c.JSON(http.StatusOK, workspaces)
+}
+
+func (api *API) createWorkspace(c *gin.Context) {
+	var payload struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.Name) == "" {
+		api.validationError(c, "name is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	workspace, err := api.workspaces.Create(c.Request.Context(), userID, strings.TrimSpace(payload.Name))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, workspace)
+}
+
+func (api *API) getWorkspace(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	workspace, err := api.workspaces.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workspace)
+}
+
+func (api *API) renameWorkspace(c *gin.Context) {
+	var payload struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.Name) == "" {
+		api.validationError(c, "name is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	workspace, err := api.workspaces.Rename(c.Request.Context(), userID, c.Param("id"), strings.TrimSpace(payload.Name))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workspace)
+}
+
+func (api *API) deleteWorkspace(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.workspaces.Delete(c.Request.Context(), userID, c.Param("id")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) listWorkspaceMembers(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	members, err := api.workspaces.Members(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// addWorkspaceMember invites an existing account by email.
+func (api *API) addWorkspaceMember(c *gin.Context) {
+	var payload struct {
+		Email string               `json:"email" binding:"required"`
+		Role  domain.WorkspaceRole `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "email is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if payload.Role == "" {
+		payload.Role = domain.WorkspaceRoleMember
+	}
+	member, err := api.workspaces.AddMemberByEmail(c.Request.Context(), userID, c.Param("id"), strings.TrimSpace(payload.Email), payload.Role)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+func (api *API) setWorkspaceMember(c *gin.Context) {
+	var payload struct {
+		Role domain.WorkspaceRole `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "role is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	member, err := api.workspaces.SetMember(c.Request.Context(), userID, c.Param("id"), c.Param("user_id"), payload.Role)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+func (api *API) removeWorkspaceMember(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.workspaces.RemoveMember(c.Request.Context(), userID, c.Param("id"), c.Param("user_id")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) listWorkspacePresets(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	presets, err := api.workspaces.Presets(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	if presets == nil {
+		presets = []domain.WorkspacePreset{}
+	}
+	c.JSON(http.StatusOK, presets)
+}
+
+type workspacePresetPayload struct {
+	Name       string `json:"name" binding:"required"`
+	PromptText string `json:"prompt_text" binding:"required"`
+	domain.GenerationSettings
+}
+
+func (api *API) createWorkspacePreset(c *gin.Context) {
+	var payload workspacePresetPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "name and prompt_text are required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	preset, err := api.workspaces.CreatePreset(c.Request.Context(), userID, c.Param("id"), payload.Name, payload.PromptText, payload.GenerationSettings)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, preset)
+}
+
+func (api *API) updateWorkspacePreset(c *gin.Context) {
+	var payload workspacePresetPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "name and prompt_text are required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	preset, err := api.workspaces.UpdatePreset(c.Request.Context(), userID, c.Param("id"), c.Param("preset_id"), payload.Name, payload.PromptText, payload.GenerationSettings)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preset)
+}
+
+func (api *API) deleteWorkspacePreset(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.workspaces.DeletePreset(c.Request.Context(), userID, c.Param("id"), c.Param("preset_id")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *API) getWorkspaceSystemPrompt(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	prompt, err := api.workspaces.SystemPrompt(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (api *API) updateWorkspaceSystemPrompt(c *gin.Context) {
+	var payload struct {
+		PromptText string `json:"prompt_text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		api.validationError(c, "prompt_text is required")
+		return
+	}
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	prompt, err := api.workspaces.SetSystemPrompt(c.Request.Context(), userID, c.Param("id"), payload.PromptText)
+	if err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (api *API) deleteWorkspaceSystemPrompt(c *gin.Context) {
+	userID, ok := api.requireSessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := api.workspaces.DeleteSystemPrompt(c.Request.Context(), userID, c.Param("id")); err != nil {
+		api.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
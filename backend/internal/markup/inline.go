@@ -0,0 +1,224 @@
+package markup
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	escapedChar = regexp.MustCompile("\\\\([!-/:-@\\[-`{-~])")
+	codeSpan    = regexp.MustCompile("(`+)(.+?)(`+)")
+	linkSpan    = regexp.MustCompile(`(!?)\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	autolink    = regexp.MustCompile(`<((?:https?://|mailto:)[^>\s]+)>`)
+	bareURL     = regexp.MustCompile(`https?://[^\s<>()]*[^\s<>().,;:!?'"]`)
+	// placeholder marks a span rendered ahead of the rest, so that the
+	// emphasis rules never see inside code or addresses.
+	placeholder = regexp.MustCompile("\ue000(\\d+)\ue001")
+
+	strongSpan = []*regexp.Regexp{
+		regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`),
+		regexp.MustCompile(`(^|\W)__(\S(?:.*?\S)?)__($|\W)`),
+	}
+	emSpan = []*regexp.Regexp{
+		regexp.MustCompile(`(^|[^\w*])\*([^\s*](?:[^*]*[^\s*])?)\*($|[^\w*])`),
+		regexp.MustCompile(`(^|\W)_([^\s_](?:[^_]*[^\s_])?)_($|\W)`),
+	}
+	delSpan = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+)
+
+// renderInline renders the spans of one line.
+func renderInline(text string, s *style) string {
+	var spans []string
+	hold := func(rendered string) string {
+		spans = append(spans, rendered)
+		return "\ue000" + strconv.Itoa(len(spans)-1) + "\ue001"
+	}
+
+	text = escapedChar.ReplaceAllStringFunc(text, func(m string) string { return hold(s.text(m[1:])) })
+	text = codeSpan.ReplaceAllStringFunc(text, func(m string) string {
+		parts := codeSpan.FindStringSubmatch(m)
+		if parts[1] != parts[3] {
+			return m
+		}
+		return hold(s.code(strings.TrimSpace(parts[2])))
+	})
+	text = linkSpan.ReplaceAllStringFunc(text, func(m string) string {
+		parts := linkSpan.FindStringSubmatch(m)
+		if parts[1] == "!" {
+			return hold(s.image(parts[2], parts[3]))
+		}
+		return hold(s.link(renderInline(parts[2], s), parts[3]))
+	})
+	text = autolink.ReplaceAllStringFunc(text, func(m string) string {
+		url := m[1 : len(m)-1]
+		return hold(s.link(s.text(url), url))
+	})
+	text = bareURL.ReplaceAllStringFunc(text, func(url string) string { return hold(s.link(s.text(url), url)) })
+
+	text = s.text(text)
+	// Each rule runs twice: matches that share a boundary character are
+	// only found on the second pass.
+	for range 2 {
+		for _, re := range strongSpan {
+			text = replaceSpan(re, text, s.strong)
+		}
+		text = replaceSpan(delSpan, text, s.del)
+		for _, re := range emSpan {
+			text = replaceSpan(re, text, s.em)
+		}
+	}
+
+	for placeholder.MatchString(text) {
+		text = placeholder.ReplaceAllStringFunc(text, func(m string) string {
+			i, _ := strconv.Atoi(placeholder.FindStringSubmatch(m)[1])
+			return spans[i]
+		})
+	}
+	return text
+}
+
+// replaceSpan wraps the content of each match of re. Patterns with three
+// groups keep their first and last, the boundaries around the markers.
+func replaceSpan(re *regexp.Regexp, text string, wrap func(string) string) string {
+	return re.ReplaceAllStringFunc(text, func(m string) string {
+		parts := re.FindStringSubmatch(m)
+		if len(parts) == 4 {
+			return parts[1] + wrap(parts[2]) + parts[3]
+		}
+		return wrap(parts[1])
+	})
+}
+
+// safeURL reports whether a link may be kept in HTML.
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
+
+var htmlStyle = &style{
+	text: func(s string) string { return html.EscapeString(s) },
+	code: func(s string) string { return "<code>" + html.EscapeString(s) + "</code>" },
+	link: func(text, url string) string {
+		if !safeURL(url) {
+			return text
+		}
+		return `<a href="` + html.EscapeString(url) + `">` + text + "</a>"
+	},
+	image: func(alt, url string) string {
+		if !safeURL(url) {
+			return html.EscapeString(alt)
+		}
+		return `<img src="` + html.EscapeString(url) + `" alt="` + html.EscapeString(alt) + `">`
+	},
+	strong: func(s string) string { return "<strong>" + s + "</strong>" },
+	em:     func(s string) string { return "<em>" + s + "</em>" },
+	del:    func(s string) string { return "<del>" + s + "</del>" },
+
+	lineBreak: "<br>\n",
+	blockSep:  "\n",
+	paragraph: func(s string) string { return "<p>" + s + "</p>" },
+	heading: func(level int, text string) string {
+		tag := "h" + strconv.Itoa(level)
+		return "<" + tag + ">" + text + "</" + tag + ">"
+	},
+	codeBlock: func(lang string, lines []string) string {
+		open := "<pre><code>"
+		if lang != "" {
+			open = `<pre><code class="language-` + html.EscapeString(lang) + `">`
+		}
+		return open + html.EscapeString(strings.Join(lines, "\n")) + "</code></pre>"
+	},
+	quote: func(inner string) string { return "<blockquote>\n" + inner + "\n</blockquote>" },
+	list:  htmlList,
+	rule:  "<hr>",
+}
+
+func htmlList(items []listItem, inline func(string) string) string {
+	var b strings.Builder
+	// open holds, for each list still open, its closing tag.
+	var open []string
+	depths := listDepths(items)
+	for i, item := range items {
+		depth := depths[i]
+		for len(open) > depth+1 {
+			b.WriteString("</li>\n" + open[len(open)-1] + "\n")
+			open = open[:len(open)-1]
+		}
+		if len(open) == depth+1 {
+			b.WriteString("</li>\n")
+		} else {
+			tag := "ul"
+			if item.ordered {
+				tag = "ol"
+			}
+			if len(open) > 0 {
+				b.WriteString("\n")
+			}
+			if item.ordered && item.number != 1 {
+				b.WriteString("<ol start=\"" + strconv.Itoa(item.number) + "\">\n")
+			} else {
+				b.WriteString("<" + tag + ">\n")
+			}
+			open = append(open, "</"+tag+">")
+		}
+		b.WriteString("<li>" + joinInline(item.lines, "<br>\n", inline))
+	}
+	for len(open) > 0 {
+		b.WriteString("</li>\n" + open[len(open)-1])
+		if open = open[:len(open)-1]; len(open) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+var plainStyle = &style{
+	text: func(s string) string { return s },
+	code: func(s string) string { return s },
+	link: func(text, url string) string {
+		address := strings.TrimPrefix(url, "mailto:")
+		if text == "" || text == url || text == address {
+			return address
+		}
+		return text + " (" + address + ")"
+	},
+	image:  func(alt, url string) string { return alt },
+	strong: func(s string) string { return s },
+	em:     func(s string) string { return s },
+	del:    func(s string) string { return s },
+
+	lineBreak: "\n",
+	blockSep:  "\n\n",
+	paragraph: func(s string) string { return s },
+	heading:   func(level int, text string) string { return text },
+	codeBlock: func(lang string, lines []string) string { return strings.Join(lines, "\n") },
+	quote: func(inner string) string {
+		lines := strings.Split(inner, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return strings.Join(lines, "\n")
+	},
+	list: plainList,
+}
+
+func plainList(items []listItem, inline func(string) string) string {
+	var b strings.Builder
+	depths := listDepths(items)
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		indent := strings.Repeat("  ", depths[i])
+		marker := "• "
+		if item.ordered {
+			marker = strconv.Itoa(item.number) + ". "
+		}
+		// Continuation lines line up with the text after the marker.
+		pad := "\n" + indent + strings.Repeat(" ", len([]rune(marker)))
+		b.WriteString(indent + marker + joinInline(item.lines, pad, inline))
+	}
+	return b.String()
+}
@@ -0,0 +1,227 @@
+// Package markup converts the Markdown that models write into HTML or plain
+// text. It covers what rewrites use: paragraphs, headings, lists, quotes,
+// code, emphasis and links. Raw HTML in the input is escaped, never passed
+// through.
+package markup
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HTML renders markdown as an HTML fragment.
+func HTML(markdown string) string {
+	return render(parse(markdown), htmlStyle)
+}
+
+// Plain renders markdown as plain text: markers are removed, list items are
+// bulleted with "•" and links are followed by their address.
+func Plain(markdown string) string {
+	return render(parse(markdown), plainStyle)
+}
+
+type blockKind int
+
+const (
+	paragraph blockKind = iota
+	heading
+	code
+	quote
+	list
+	rule
+)
+
+type block struct {
+	kind  blockKind
+	level int
+	// lines are the text of paragraphs, headings and code, and the inner
+	// Markdown of quotes.
+	lines []string
+	lang  string
+	items []listItem
+}
+
+type listItem struct {
+	indent  int
+	ordered bool
+	number  int
+	lines   []string
+}
+
+var (
+	fenceLine   = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+-]*)")
+	headingLine = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	ruleLine    = regexp.MustCompile(`^\s{0,3}([-*_])(?:\s*[-*_]){2,}\s*$`)
+	quoteLine   = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	itemLine    = regexp.MustCompile(`^(\s*)(?:([-*+])|(\d{1,9})[.)])\s+(.*)$`)
+)
+
+// startsBlock reports whether line opens a block other than a paragraph.
+func startsBlock(line string) bool {
+	return fenceLine.MatchString(line) || headingLine.MatchString(line) || quoteLine.MatchString(line) ||
+		itemLine.MatchString(line) || isRule(line)
+}
+
+// isRule tells "---" from a list item such as "- - -" only by the marker
+// being the same throughout.
+func isRule(line string) bool {
+	m := ruleLine.FindStringSubmatch(line)
+	return m != nil && strings.Count(line, m[1]) == len(strings.Join(strings.Fields(line), ""))
+}
+
+func parse(markdown string) []block {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var blocks []block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case fenceLine.MatchString(line):
+			m := fenceLine.FindStringSubmatch(line)
+			b := block{kind: code, lang: m[2]}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				b.lines = append(b.lines, lines[i])
+			}
+			// An unclosed fence runs to the end of the text.
+			i++
+			blocks = append(blocks, b)
+		case headingLine.MatchString(line):
+			m := headingLine.FindStringSubmatch(line)
+			blocks = append(blocks, block{kind: heading, level: len(m[1]), lines: []string{m[2]}})
+			i++
+		case isRule(line):
+			blocks = append(blocks, block{kind: rule})
+			i++
+		case quoteLine.MatchString(line):
+			b := block{kind: quote}
+			for ; i < len(lines) && quoteLine.MatchString(lines[i]); i++ {
+				b.lines = append(b.lines, quoteLine.FindStringSubmatch(lines[i])[1])
+			}
+			blocks = append(blocks, b)
+		case itemLine.MatchString(line):
+			var b block
+			b, i = parseList(lines, i)
+			blocks = append(blocks, b)
+		default:
+			b := block{kind: paragraph}
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && (len(b.lines) == 0 || !startsBlock(lines[i])); i++ {
+				b.lines = append(b.lines, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+// parseList reads list items from lines[i] on. Indented lines continue the
+// item before them; a blank line ends the list unless another item of the
+// same kind follows.
+func parseList(lines []string, i int) (block, int) {
+	b := block{kind: list}
+	for i < len(lines) {
+		line := lines[i]
+		if m := itemLine.FindStringSubmatch(line); m != nil && !isRule(line) {
+			item := listItem{indent: len(strings.ReplaceAll(m[1], "\t", "    ")), lines: []string{m[4]}}
+			if m[3] != "" {
+				item.ordered = true
+				item.number, _ = strconv.Atoi(m[3])
+			}
+			// A bulleted list and a numbered one next to it are two lists.
+			if first := b.items; len(first) > 0 && item.indent <= first[0].indent && item.ordered != first[0].ordered {
+				break
+			}
+			b.items = append(b.items, item)
+			i++
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			if i+1 < len(lines) && itemLine.MatchString(lines[i+1]) {
+				i++
+				continue
+			}
+			break
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") && startsBlock(line) {
+			break
+		}
+		last := &b.items[len(b.items)-1]
+		last.lines = append(last.lines, strings.TrimSpace(line))
+		i++
+	}
+	return b, i
+}
+
+// style renders inline spans and blocks for one output format.
+type style struct {
+	text   func(string) string
+	code   func(string) string
+	link   func(text, url string) string
+	image  func(alt, url string) string
+	strong func(string) string
+	em     func(string) string
+	del    func(string) string
+
+	// lineBreak joins the lines of a paragraph or list item; blockSep joins
+	// blocks.
+	lineBreak string
+	blockSep  string
+
+	paragraph func(string) string
+	heading   func(level int, text string) string
+	codeBlock func(lang string, lines []string) string
+	quote     func(inner string) string
+	list      func(items []listItem, inline func(string) string) string
+	rule      string
+}
+
+func render(blocks []block, s *style) string {
+	inline := func(text string) string { return renderInline(text, s) }
+	var parts []string
+	for _, b := range blocks {
+		var out string
+		switch b.kind {
+		case paragraph:
+			out = s.paragraph(joinInline(b.lines, s.lineBreak, inline))
+		case heading:
+			out = s.heading(b.level, inline(b.lines[0]))
+		case code:
+			out = s.codeBlock(b.lang, b.lines)
+		case quote:
+			out = s.quote(render(parse(strings.Join(b.lines, "\n")), s))
+		case list:
+			out = s.list(b.items, inline)
+		case rule:
+			out = s.rule
+		}
+		if out != "" {
+			parts = append(parts, out)
+		}
+	}
+	return strings.Join(parts, s.blockSep)
+}
+
+func joinInline(lines []string, sep string, inline func(string) string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = inline(line)
+	}
+	return strings.Join(rendered, sep)
+}
+
+// listDepths gives each item its nesting depth from its indentation.
+func listDepths(items []listItem) []int {
+	depths := make([]int, len(items))
+	var indents []int
+	for i, item := range items {
+		for len(indents) > 0 && item.indent < indents[len(indents)-1] {
+			indents = indents[:len(indents)-1]
+		}
+		if len(indents) == 0 || item.indent > indents[len(indents)-1] {
+			indents = append(indents, item.indent)
+		}
+		depths[i] = len(indents) - 1
+	}
+	return depths
+}
@@ -0,0 +1,444 @@
+package postprocess
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	englishUnits = map[string]int{
+		"zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9,
+		"ten": 10, "eleven": 11, "twelve": 12, "thirteen": 13, "fourteen": 14, "fifteen": 15, "sixteen": 16,
+		"seventeen": 17, "eighteen": 18, "nineteen": 19,
+	}
+	englishTens = map[string]int{
+		"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50, "sixty": 60, "seventy": 70, "eighty": 80, "ninety": 90,
+	}
+	englishScales = map[string]int{"hundred": 100, "thousand": 1_000, "million": 1_000_000, "billion": 1_000_000_000}
+
+	// englishSuffixes turn "twenty dollars" into "$20".
+	englishSuffixes = map[string][2]string{
+		"dollar": {"$", ""}, "dollars": {"$", ""}, "bucks": {"$", ""},
+		"euro": {"€", ""}, "euros": {"€", ""},
+		"percent": {"", "%"},
+	}
+
+	wordPattern = regexp.MustCompile(`[A-Za-z]+`)
+)
+
+func numerals(text string) string {
+	return chineseNumerals(englishNumerals(text))
+}
+
+// englishPhrase is a number phrase found by englishNumerals, with the
+// currency or percent words that follow it.
+type englishPhrase struct {
+	// first and last are the indexes of its first and last number words;
+	// stop is the index of its last word, suffix included.
+	first, last, stop int
+	value             int
+	prefix, suffix    string
+}
+
+// englishNumerals rewrites number phrases such as "twenty-five" or "three
+// hundred and five". Phrases next to each other are rewritten together: a
+// pair such as "nineteen ninety-nine" is read as a year, and a run with a
+// bare "one" in it is left alone, since "one" is a pronoun as often as a
+// number.
+func englishNumerals(text string) string {
+	words := wordPattern.FindAllStringIndex(text, -1)
+	lower := func(i int) string { return strings.ToLower(text[words[i][0]:words[i][1]]) }
+	// joined reports whether words i and i+1 are separated by a single
+	// space or hyphen.
+	joined := func(i int) bool {
+		gap := text[words[i][1]:words[i+1][0]]
+		return gap == " " || gap == "-"
+	}
+
+	var phrases []englishPhrase
+	for i := 0; i < len(words); i++ {
+		value, end, ok := englishNumber(lower, joined, i, len(words))
+		if !ok {
+			continue
+		}
+		p := englishPhrase{first: i, last: end, stop: end, value: value}
+		if end+1 < len(words) && joined(end) && text[words[end][1]] == ' ' {
+			if affix, ok := englishSuffixes[lower(end+1)]; ok {
+				p.prefix, p.suffix, p.stop = affix[0], affix[1], end+1
+			} else if lower(end+1) == "per" && end+2 < len(words) && joined(end+1) && lower(end+2) == "cent" {
+				p.suffix, p.stop = "%", end+2
+			}
+		}
+		phrases = append(phrases, p)
+		i = p.stop
+	}
+
+	var b strings.Builder
+	last := 0
+	replace := func(from, to int, number string) {
+		b.WriteString(text[last:words[from][0]])
+		b.WriteString(number)
+		last = words[to][1]
+	}
+	for i := 0; i < len(phrases); {
+		// A run is a sequence of phrases with nothing but a space or hyphen
+		// between them. A suffix ends it.
+		n := 1
+		for i+n < len(phrases) {
+			prev, next := phrases[i+n-1], phrases[i+n]
+			if prev.stop != prev.last || next.first != prev.last+1 || !joined(prev.last) {
+				break
+			}
+			n++
+		}
+		run := phrases[i : i+n]
+		i += n
+		if year, ok := englishYear(lower, run); ok {
+			replace(run[0].first, run[1].stop, run[1].prefix+strconv.Itoa(year)+run[1].suffix)
+			continue
+		}
+		if !rewritableRun(lower, run) {
+			continue
+		}
+		for _, p := range run {
+			replace(p.first, p.stop, p.prefix+groupDigits(p.value)+p.suffix)
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// englishYear reads a run such as "nineteen ninety-nine" or "twenty twelve"
+// as a year: a single teen or tens word from thirteen up, then a number
+// from ten to ninety-nine that starts with a teen or tens word. "ten
+// fifteen" and "eleven thirty" are more often times and are not read as
+// years.
+func englishYear(lower func(int) string, run []englishPhrase) (int, bool) {
+	if len(run) != 2 {
+		return 0, false
+	}
+	century, rest := run[0], run[1]
+	if century.first != century.last || century.value < 13 || century.value > 99 || century.suffix != "" || century.prefix != "" {
+		return 0, false
+	}
+	if rest.value < 10 || rest.value > 99 || !startsWithTens(lower(rest.first)) {
+		return 0, false
+	}
+	return century.value*100 + rest.value, true
+}
+
+// rewritableRun reports whether the phrases of a run can each be written in
+// digits. Runs with a bare "one", or in which a tens word follows a number
+// from ten to ninety-nine, are left as words rather than split into numbers
+// that were never said.
+func rewritableRun(lower func(int) string, run []englishPhrase) bool {
+	for k, p := range run {
+		if p.first == p.last && p.stop == p.last && lower(p.first) == "one" {
+			return false
+		}
+		if k > 0 && run[k-1].value >= 10 && run[k-1].value <= 99 {
+			if _, ok := englishTens[lower(p.first)]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// startsWithTens reports whether word is a teen or tens word.
+func startsWithTens(word string) bool {
+	_, tens := englishTens[word]
+	return tens || englishUnits[word] >= 10
+}
+
+// englishNumber reads the longest number phrase starting at word i and
+// returns its value and the index of its last word.
+func englishNumber(lower func(int) string, joined func(int) bool, i, n int) (int, int, bool) {
+	first := lower(i)
+	if _, ok := englishUnits[first]; !ok {
+		if _, ok := englishTens[first]; !ok {
+			return 0, 0, false
+		}
+	}
+
+	total, current := 0, 0
+	// prev is the kind of the last word read: unit, teen, tens, hundred or
+	// scale.
+	prev, lastScale := "", 0
+	end := i
+	for j := i; j < n; j++ {
+		if j > i && !joined(j-1) {
+			break
+		}
+		word := lower(j)
+		// "and" continues a phrase only between a scale and a number.
+		if word == "and" {
+			if (prev != "hundred" && prev != "scale") || j+1 >= n || !joined(j) {
+				break
+			}
+			if _, ok := englishUnits[lower(j+1)]; !ok {
+				if _, ok := englishTens[lower(j+1)]; !ok {
+					break
+				}
+			}
+			continue
+		}
+		if v, ok := englishUnits[word]; ok {
+			if prev == "unit" || prev == "teen" || (prev == "tens" && v >= 10) {
+				break
+			}
+			if v < 10 {
+				prev = "unit"
+			} else {
+				prev = "teen"
+			}
+			current += v
+		} else if v, ok := englishTens[word]; ok {
+			if prev != "" && prev != "hundred" && prev != "scale" {
+				break
+			}
+			prev = "tens"
+			current += v
+		} else if v, ok := englishScales[word]; ok {
+			if prev == "scale" || current == 0 {
+				break
+			}
+			if v == 100 {
+				if prev == "hundred" || current >= 100 {
+					break
+				}
+				current *= 100
+				prev = "hundred"
+			} else {
+				if lastScale != 0 && v >= lastScale {
+					break
+				}
+				total += current * v
+				current, lastScale = 0, v
+				prev = "scale"
+			}
+		} else {
+			break
+		}
+		end = j
+	}
+	return total + current, end, true
+}
+
+// groupDigits writes n with thousands separators from 10,000 up.
+func groupDigits(n int) string {
+	s := strconv.Itoa(n)
+	if n < 10_000 {
+		return s
+	}
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var (
+	chineseDigits = map[rune]int{'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	chineseUnits  = map[rune]int{'十': 10, '百': 100, '千': 1_000, '万': 10_000, '亿': 100_000_000}
+
+	// chineseMeasures are the measure words and units after which a single
+	// numeral is clearly a quantity.
+	chineseMeasures = []string{
+		"分钟", "小时", "公里", "公斤", "厘米", "千米",
+		"个", "位", "名", "人", "次", "遍", "本", "张", "条", "件", "块", "元", "角", "岁", "天", "年", "月", "日",
+		"号", "周", "点", "秒", "斤", "克", "米", "页", "台", "辆", "杯", "瓶", "份", "章", "节", "层", "楼", "倍",
+		"家", "间", "座", "只", "双", "套", "篇", "首", "项", "种",
+	}
+)
+
+const chinesePercent = "百分之"
+
+// chineseNumerals rewrites Chinese numbers that are clearly quantities:
+// those with both a digit and a unit such as 二十五 or 三百, single numerals
+// before a measure word such as 五个, and percentages. Idioms such as 一起,
+// 十分 or 千万 are left alone, as are lone 一 and 两.
+func chineseNumerals(text string) string {
+	if !strings.ContainsFunc(text, isCJK) {
+		return text
+	}
+	runes := []rune(text)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		percent := strings.HasPrefix(string(runes[i:]), chinesePercent)
+		start := i
+		if percent {
+			start += len([]rune(chinesePercent))
+		}
+		end := start
+		for end < len(runes) && isChineseNumeral(runes[end]) {
+			end++
+		}
+		if end == start {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		run, rest := runes[start:end], string(runes[end:])
+		value, ok := parseChinese(run)
+		if fraction := chineseFraction(runes[end:]); ok && !percent && fraction != "" {
+			b.WriteString(strconv.Itoa(value) + "." + fraction)
+			i = end + 1 + len([]rune(fraction))
+			continue
+		}
+		if !ok || !(percent || isQuantity(run, rest)) {
+			if percent {
+				// Only the 百 of 百分之 was consumed; read the rest again.
+				b.WriteRune(runes[i])
+				i++
+				continue
+			}
+			b.WriteString(string(run))
+			i = end
+			continue
+		}
+		if percent {
+			b.WriteString(strconv.Itoa(value) + "%")
+		} else {
+			b.WriteString(formatChinese(run, value))
+		}
+		i = end
+	}
+	return b.String()
+}
+
+func isChineseNumeral(r rune) bool {
+	_, digit := chineseDigits[r]
+	_, unit := chineseUnits[r]
+	return digit || unit
+}
+
+// isQuantity decides whether a numeral run followed by rest should be
+// written in digits.
+func isQuantity(run []rune, rest string) bool {
+	first := run[0]
+	if _, ok := chineseDigits[first]; !ok && first != '十' {
+		return false
+	}
+	hasDigit, hasUnit := false, false
+	for _, r := range run {
+		if _, ok := chineseDigits[r]; ok {
+			hasDigit = true
+		} else {
+			hasUnit = true
+		}
+	}
+	if hasDigit && hasUnit {
+		return true
+	}
+	if len(run) != 1 || first == '一' || first == '两' || first == '零' || first == '〇' {
+		return false
+	}
+	for _, measure := range chineseMeasures {
+		if strings.HasPrefix(rest, measure) {
+			return true
+		}
+	}
+	return false
+}
+
+// chineseFraction reads the decimals of 三点五 from rest, which starts after
+// the integer part. 一点一点 (little by little) is not a number.
+func chineseFraction(rest []rune) string {
+	if len(rest) < 2 || rest[0] != '点' {
+		return ""
+	}
+	var b strings.Builder
+	n := 1
+	for ; n < len(rest); n++ {
+		d, ok := chineseDigits[rest[n]]
+		if !ok {
+			break
+		}
+		b.WriteString(strconv.Itoa(d))
+	}
+	if n == 1 || n < len(rest) && (rest[n] == '点' || isChineseNumeral(rest[n])) {
+		return ""
+	}
+	return b.String()
+}
+
+// parseChinese reads a Chinese number, including the spoken shorthand in
+// which 一百五 means 150 and 两万五 means 25,000.
+func parseChinese(run []rune) (int, bool) {
+	total, section := 0, 0
+	digit := -1
+	lastUnit, lastBig, prevUnit := 0, 0, 0
+	// zero is set when a 零 came after the last unit.
+	zero := false
+	for _, r := range run {
+		if d, ok := chineseDigits[r]; ok {
+			if digit > 0 || (digit == 0 && d == 0) {
+				return 0, false
+			}
+			zero = zero || d == 0
+			digit = d
+			continue
+		}
+		unit := chineseUnits[r]
+		switch unit {
+		case 10, 100, 1_000:
+			switch {
+			case digit < 0:
+				// 十五 and 百分之百 leave out the 一, but only up front.
+				if section != 0 || total != 0 {
+					return 0, false
+				}
+				digit = 1
+			case digit == 0:
+				// 一千零十
+				if unit != 10 {
+					return 0, false
+				}
+				digit = 1
+			}
+			if lastUnit != 0 && unit >= lastUnit {
+				return 0, false
+			}
+			section += digit * unit
+			lastUnit = unit
+		default:
+			if digit > 0 {
+				section += digit
+			}
+			if section == 0 || (lastBig != 0 && unit >= lastBig && unit != 100_000_000) {
+				return 0, false
+			}
+			if unit == 100_000_000 {
+				total = (total + section) * unit
+			} else {
+				total += section * unit
+			}
+			section, lastUnit, lastBig = 0, 0, unit
+		}
+		digit, zero, prevUnit = -1, false, unit
+	}
+	if digit > 0 {
+		if prevUnit >= 100 && !zero {
+			digit *= prevUnit / 10
+		}
+		section += digit
+	}
+	return total + section, true
+}
+
+// formatChinese keeps a trailing 万 or 亿 of a round number, as in 3万. A
+// 万 after an 亿, as in 三亿五千万, is not kept.
+func formatChinese(run []rune, value int) string {
+	switch last := run[len(run)-1]; {
+	case last == '亿' && value%100_000_000 == 0:
+		return strconv.Itoa(value/100_000_000) + "亿"
+	case last == '万' && value%10_000 == 0 && value < 100_000_000:
+		return strconv.Itoa(value/10_000) + "万"
+	}
+	return strconv.Itoa(value)
+}
@@ -0,0 +1,78 @@
+package postprocess
+
+import "testing"
+
+func TestEnglishNumerals(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"twenty-five apples", "25 apples"},
+		{"three hundred and five", "305"},
+		{"two thousand and twenty", "2020"},
+		{"forty thousand people", "40,000 people"},
+		{"twenty dollars", "$20"},
+		{"ten percent", "10%"},
+		{"five per cent", "5%"},
+		{"one dollar", "$1"},
+		{"one hundred", "100"},
+		{"twenty-one", "21"},
+		{"this one is better", "this one is better"},
+		{"one of them", "one of them"},
+		{"and then there was one", "and then there was one"},
+		// Year-style pairs are read as one year.
+		{"Twenty twenty-four was a year.", "2024 was a year."},
+		{"nineteen ninety-nine", "1999"},
+		{"in twenty twelve", "in 2012"},
+		{"nineteen oh five", "19 oh 5"},
+		// A tens word after a complete number is not split into two numbers.
+		{"eleven thirty", "eleven thirty"},
+		{"twenty-four twenty", "twenty-four twenty"},
+		// A run with a bare "one" stays as words.
+		{"one two three", "one two three"},
+		{"three two one", "three two one"},
+		{"I have one two-bedroom flat", "I have one two-bedroom flat"},
+		{"five six seven", "5 6 7"},
+		{"Zero", "0"},
+		{"someone threw it", "someone threw it"},
+		{"five, six", "5, 6"},
+	}
+	for _, tt := range tests {
+		if got := englishNumerals(tt.in); got != tt.want {
+			t.Errorf("englishNumerals(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestChineseNumerals(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"二十五个人", "25个人"},
+		{"三百", "300"},
+		{"五个", "5个"},
+		{"三万", "3万"},
+		{"两亿", "2亿"},
+		{"三亿五千万", "350000000"},
+		{"百分之五十", "50%"},
+		{"百分之百", "100%"},
+		{"一百五", "150"},
+		{"两万五", "25000"},
+		{"一千零十", "1010"},
+		{"三点五公斤", "3.5公斤"},
+		{"十五", "15"},
+		// Idioms and lone numerals stay as they are.
+		{"我们一起去", "我们一起去"},
+		{"十分感谢", "十分感谢"},
+		{"千万不要", "千万不要"},
+		{"一点一点地", "一点一点地"},
+		{"万一下雨", "万一下雨"},
+		{"一个", "一个"},
+		{"两个", "两个"},
+		{"no Chinese here", "no Chinese here"},
+	}
+	for _, tt := range tests {
+		if got := chineseNumerals(tt.in); got != tt.want {
+			t.Errorf("chineseNumerals(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package postprocess cleans up model output with deterministic steps, for
+// the formatting rules that models follow only most of the time.
+package postprocess
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Step is one cleanup of a chain.
+type Step string
+
+const (
+	// StripPreamble drops a leading "Here is the rewritten message:" line.
+	StripPreamble Step = "strip_preamble"
+	// StripQuotes removes quotes or a code fence wrapped around the whole
+	// text.
+	StripQuotes Step = "strip_quotes"
+	// Whitespace trims the text and its lines, collapses runs of spaces and
+	// keeps at most one blank line in a row.
+	Whitespace Step = "whitespace"
+	// CJKPunctuation uses full-width punctuation after CJK text and
+	// half-width punctuation in Latin sentences, and half-width letters and
+	// digits throughout.
+	CJKPunctuation Step = "cjk_punctuation"
+	// Numerals writes English and Chinese number words as digits.
+	Numerals Step = "numerals"
+
+	// None stands alone for a chain that does nothing, where leaving the
+	// chain empty would fall back to a default.
+	None Step = "none"
+)
+
+// order is the order steps run in, whatever the order they are listed in.
+// Punctuation is fixed before numerals, while the neighbours of a mark are
+// still Han characters.
+var order = []Step{StripPreamble, StripQuotes, Whitespace, CJKPunctuation, Numerals}
+
+var steps = map[Step]func(string) string{
+	StripPreamble:  stripPreamble,
+	StripQuotes:    stripQuotes,
+	Whitespace:     normalizeWhitespace,
+	CJKPunctuation: cjkPunctuation,
+	Numerals:       numerals,
+}
+
+// Steps lists every step in the order they run.
+func Steps() []Step {
+	return slices.Clone(order)
+}
+
+// Parse checks a chain given by name and returns it deduplicated. None may
+// only appear on its own.
+func Parse(names []string) ([]Step, error) {
+	var chain []Step
+	for _, name := range names {
+		step := Step(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := steps[step]; !ok && step != None {
+			return nil, fmt.Errorf("unknown post-processing step %q", name)
+		}
+		if !slices.Contains(chain, step) {
+			chain = append(chain, step)
+		}
+	}
+	if slices.Contains(chain, None) && len(chain) > 1 {
+		return nil, fmt.Errorf("post-processing step %q cannot be combined with others", None)
+	}
+	return chain, nil
+}
+
+// Apply runs the steps of chain on text. Unknown steps are ignored.
+func Apply(text string, chain []Step) string {
+	for _, step := range order {
+		if slices.Contains(chain, step) {
+			text = steps[step](text)
+		}
+	}
+	return text
+}
+
+var (
+	// preamblePattern matches an English or Chinese lead-in ending in a
+	// colon, alone on the first line or in front of the text.
+	preamblePattern = regexp.MustCompile(`(?i)^\s*(?:(?:sure|okay|ok|certainly|of course|absolutely)[!,.]?\s*)?` +
+		`(?:here(?:'s|’s| is| are)\b[^\n:：]{0,80}|(?:the\s+|your\s+)?(?:rewritten|revised|edited|polished|updated)\b[^\n:：]{0,40})[:：][ \t]*\n?`)
+	cjkPreamblePattern = regexp.MustCompile(`^\s*(?:好的[，,。！!]?\s*)?(?:以下是|下面是|这是)?[^\n:：]{0,20}(?:改写|重写|润色|修改|优化)[^\n:：]{0,12}[:：][ \t]*\n?`)
+)
+
+func stripPreamble(text string) string {
+	for _, pattern := range []*regexp.Regexp{preamblePattern, cjkPreamblePattern} {
+		if loc := pattern.FindStringIndex(text); loc != nil && strings.TrimSpace(text[loc[1]:]) != "" {
+			return strings.TrimLeft(text[loc[1]:], " \t\n")
+		}
+	}
+	return text
+}
+
+// quotePairs are the opening and closing quotes StripQuotes removes.
+var quotePairs = [][2]string{
+	{`"`, `"`}, {"'", "'"}, {"“", "”"}, {"‘", "’"}, {"「", "」"}, {"『", "』"}, {"«", "»"},
+}
+
+var fencePattern = regexp.MustCompile("^```[A-Za-z0-9_-]*\\n((?s:.*?))\\n?```$")
+
+func stripQuotes(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if match := fencePattern.FindStringSubmatch(trimmed); match != nil && !strings.Contains(match[1], "```") {
+		return match[1]
+	}
+	for _, pair := range quotePairs {
+		open, close := pair[0], pair[1]
+		if len(trimmed) < len(open)+len(close) || !strings.HasPrefix(trimmed, open) || !strings.HasSuffix(trimmed, close) {
+			continue
+		}
+		inner := trimmed[len(open) : len(trimmed)-len(close)]
+		// "A" and "B" starts and ends with quotes without being quoted.
+		if strings.Contains(inner, open) || strings.Contains(inner, close) {
+			continue
+		}
+		return strings.TrimSpace(inner)
+	}
+	return text
+}
+
+var (
+	innerSpaces = regexp.MustCompile(`(\S)[ \t]{2,}`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+func normalizeWhitespace(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		// Leading indentation is kept for nested lists and code.
+		lines[i] = innerSpaces.ReplaceAllString(strings.TrimRight(line, " \t"), "$1 ")
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// isCJK reports whether r is a Han, kana or Hangul character.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// halfToFull and fullToHalf map the punctuation CJKPunctuation converts.
+var (
+	halfToFull = map[rune]rune{',': '，', '.': '。', '!': '！', '?': '？', ';': '；', ':': '：'}
+	fullToHalf = map[rune]rune{'，': ',', '。': '.', '！': '!', '？': '?', '；': ';', '：': ':'}
+)
+
+func cjkPunctuation(text string) string {
+	runes := []rune(text)
+	// neighbour returns the nearest rune in direction dir that is not a
+	// space, or 0 at either end.
+	neighbour := func(i, dir int) rune {
+		for j := i + dir; j >= 0 && j < len(runes); j += dir {
+			if runes[j] != ' ' && runes[j] != '\t' {
+				return runes[j]
+			}
+		}
+		return 0
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r >= '０' && r <= '９', r >= 'Ａ' && r <= 'Ｚ', r >= 'ａ' && r <= 'ｚ':
+			b.WriteRune(r - '０' + '0') // the same offset for letters
+			continue
+		}
+		if full, ok := halfToFull[r]; ok && i > 0 && isCJK(runes[i-1]) {
+			next := neighbour(i, +1)
+			// 3.5, 12:30 and URLs keep their half-width marks.
+			if (r == '.' || r == ':') && i+1 < len(runes) && runes[i+1] != ' ' && !isCJK(runes[i+1]) && next != 0 && next != '\n' {
+				b.WriteRune(r)
+				continue
+			}
+			b.WriteRune(full)
+			// Full-width punctuation carries its own spacing.
+			for i+1 < len(runes) && runes[i+1] == ' ' && isCJK(next) {
+				i++
+			}
+			continue
+		}
+		if half, ok := fullToHalf[r]; ok && !cjkSentence(runes, i) {
+			next := neighbour(i, +1)
+			if prev := neighbour(i, -1); prev != 0 && !isPunct(prev) {
+				b.WriteRune(half)
+				if next != 0 && next != '\n' && i+1 < len(runes) && runes[i+1] != ' ' {
+					b.WriteRune(' ')
+				}
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// cjkSentence reports whether the sentence around the mark at i has any CJK
+// text, looking no further than the previous and next sentence ends.
+func cjkSentence(runes []rune, i int) bool {
+	for _, dir := range []int{-1, +1} {
+		for j := i + dir; j >= 0 && j < len(runes); j += dir {
+			r := runes[j]
+			// The dots of v1.2 or x.com do not end a sentence.
+			end := strings.ContainsRune(".!?", r) && (j+1 == len(runes) || unicode.IsSpace(runes[j+1]))
+			if r == '\n' || end || strings.ContainsRune("。！？", r) {
+				break
+			}
+			if isCJK(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || r == utf8.RuneError
+}
@@ -0,0 +1,139 @@
+package postprocess
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    []Step
+		wantErr bool
+	}{
+		{names: nil, want: nil},
+		{names: []string{" Whitespace ", "numerals", "whitespace"}, want: []Step{Whitespace, Numerals}},
+		{names: []string{"none"}, want: []Step{None}},
+		{names: []string{"none", "whitespace"}, wantErr: true},
+		{names: []string{"spellcheck"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.names)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.names, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Parse(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain []Step
+		in    string
+		want  string
+	}{
+		{name: "no steps", chain: nil, in: "  Here is the rewrite: hi  ", want: "  Here is the rewrite: hi  "},
+		{name: "none", chain: []Step{None}, in: "  hi  ", want: "  hi  "},
+		{name: "unknown step", chain: []Step{"spellcheck"}, in: " hi ", want: " hi "},
+		{
+			name:  "listed order does not matter",
+			chain: []Step{Whitespace, StripQuotes, StripPreamble},
+			in:    "Sure! Here is the rewritten message:\n\"Meet  at noon.\"",
+			want:  "Meet at noon.",
+		},
+		{
+			name:  "punctuation before numerals",
+			chain: []Step{Numerals, CJKPunctuation},
+			in:    "我们需要二十五个,好吗?",
+			want:  "我们需要25个，好吗？",
+		},
+		{
+			name:  "numerals",
+			chain: []Step{Numerals},
+			in:    "Twenty twenty-four was a year; one two three; 三百人",
+			want:  "2024 was a year; one two three; 300人",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Apply(tt.in, tt.chain); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripPreamble(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Here is the rewritten message:\nSee you soon.", "See you soon."},
+		{"Sure, here's your email: Hi Bob", "Hi Bob"},
+		{"以下是改写后的内容：\n明天见。", "明天见。"},
+		{"Here is what I think: nothing", "nothing"},
+		// A preamble with nothing after it is the whole answer.
+		{"Here is the rewrite:", "Here is the rewrite:"},
+		{"Note: bring snacks", "Note: bring snacks"},
+	}
+	for _, tt := range tests {
+		if got := stripPreamble(tt.in); got != tt.want {
+			t.Errorf("stripPreamble(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStripQuotes(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`"Hello there"`, "Hello there"},
+		{"「你好」", "你好"},
+		{"```\nfmt.Println(1)\n```", "fmt.Println(1)"},
+		{"```go\nx := 1\n```", "x := 1"},
+		{`"A" and "B"`, `"A" and "B"`},
+		{`He said "hi"`, `He said "hi"`},
+	}
+	for _, tt := range tests {
+		if got := stripQuotes(tt.in); got != tt.want {
+			t.Errorf("stripQuotes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"  a   b  ", "a b"},
+		{"a\r\nb", "a\nb"},
+		{"a\n\n\n\nb", "a\n\nb"},
+		{"- item\n    - nested  item", "- item\n    - nested item"},
+	}
+	for _, tt := range tests {
+		if got := normalizeWhitespace(tt.in); got != tt.want {
+			t.Errorf("normalizeWhitespace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCJKPunctuation(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"你好,世界!", "你好，世界！"},
+		{"Hello，world！", "Hello, world!"},
+		{"版本是3.5,时间是12:30。", "版本是3.5,时间是12:30。"},
+		{"好的. 明天见", "好的。明天见"},
+		{"ＡＢＣ１２３", "ABC123"},
+		{"打开x.com看看", "打开x.com看看"},
+	}
+	for _, tt := range tests {
+		if got := cjkPunctuation(tt.in); got != tt.want {
+			t.Errorf("cjkPunctuation(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
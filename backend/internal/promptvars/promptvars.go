@@ -0,0 +1,167 @@
+// Package promptvars expands {{name}} placeholders in prompt text.
+//
+// A placeholder is a name made of lowercase letters, digits, "_" and "."
+// between double braces, optionally padded with spaces: {{user.name}},
+// {{ date }}. Any other use of braces is left alone, so prompts that contain
+// JSON or code are not affected.
+package promptvars
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Built-in variable names. Custom per-user variables may not reuse them.
+const (
+	UserName        = "user.name"
+	UserEmail       = "user.email"
+	Date            = "date"
+	Time            = "time"
+	Timezone        = "timezone"
+	TargetApp       = "target_app"
+	ContextLanguage = "context.language"
+)
+
+var builtins = []string{UserName, UserEmail, Date, Time, Timezone, TargetApp, ContextLanguage}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z0-9_.]+)\s*\}\}`)
+
+// Builtins lists the built-in variable names.
+func Builtins() []string {
+	return slices.Clone(builtins)
+}
+
+func IsBuiltin(name string) bool {
+	return slices.Contains(builtins, name)
+}
+
+// Names returns the distinct variable names referenced by text, in order of
+// first use.
+func Names(text string) []string {
+	var names []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Undefined returns the names referenced by text that defined rejects.
+func Undefined(text string, defined func(name string) bool) []string {
+	var missing []string
+	for _, name := range Names(text) {
+		if !defined(name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Expand replaces every placeholder whose name is in vars. Unknown
+// placeholders are kept verbatim so a prompt never silently loses text.
+func Expand(text string, vars map[string]string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// Environment is what the client tells us about the moment of the request.
+type Environment struct {
+	Now time.Time
+	// Location is the user's time zone. Nil means the server's.
+	Location  *time.Location
+	TargetApp string
+	// ContextLanguage is the language of the clipboard/context text as the
+	// client detected it. When empty it is guessed from ContextText.
+	ContextLanguage string
+	ContextText     string
+}
+
+// BuiltinValues returns the built-in variables for a user and environment.
+func BuiltinValues(userName, userEmail string, env Environment) map[string]string {
+	now := env.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if env.Location != nil {
+		now = now.In(env.Location)
+	}
+	language := env.ContextLanguage
+	if language == "" {
+		language = DetectLanguage(env.ContextText)
+	}
+	return map[string]string{
+		UserName:        userName,
+		UserEmail:       userEmail,
+		Date:            now.Format("2006-01-02"),
+		Time:            now.Format("15:04"),
+		Timezone:        now.Location().String(),
+		TargetApp:       env.TargetApp,
+		ContextLanguage: language,
+	}
+}
+
+// scriptLanguages maps writing systems to the language most likely meant.
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "Japanese"},
+	{unicode.Katakana, "Japanese"},
+	{unicode.Hangul, "Korean"},
+	{unicode.Han, "Chinese"},
+	{unicode.Cyrillic, "Russian"},
+	{unicode.Arabic, "Arabic"},
+	{unicode.Hebrew, "Hebrew"},
+	{unicode.Greek, "Greek"},
+	{unicode.Thai, "Thai"},
+	{unicode.Devanagari, "Hindi"},
+}
+
+// DetectLanguage guesses the language of text from its dominant script. It
+// cannot tell Latin-script languages apart and reports them as English; an
+// empty text yields "".
+func DetectLanguage(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				counts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Kana marks Japanese even in text that is mostly kanji.
+	if counts["Japanese"] > 0 && counts["Japanese"]+counts["Chinese"] >= letters/2 {
+		return "Japanese"
+	}
+	best, bestCount := "English", 0
+	for _, script := range scriptLanguages {
+		if n := counts[script.language]; n > bestCount {
+			best, bestCount = script.language, n
+		}
+	}
+	if bestCount*2 < letters {
+		return "English"
+	}
+	return best
+}
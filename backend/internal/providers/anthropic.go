@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens is sent when a request sets no max_tokens, which
+	// the Messages API requires.
+	anthropicMaxTokens = 1024
+)
+
+// AnthropicClient calls the Anthropic Messages API.
+type AnthropicClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewAnthropicClient(baseURL string) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	return &AnthropicClient{baseURL: strings.TrimRight(baseURL, "/"), http: http.DefaultClient}
+}
+
+type anthropicRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func (c *AnthropicClient) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+	if req.APIKey == "" {
+		return "", errors.New("missing Anthropic API key")
+	}
+	body := anthropicRequest{
+		Model:       req.Model,
+		System:      req.SystemPrompt,
+		MaxTokens:   anthropicMaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if req.MaxTokens != nil {
+		body.MaxTokens = *req.MaxTokens
+	}
+	// The system prompt is a field of its own rather than a message.
+	for _, message := range BuildMessages(req) {
+		if message.Role != RoleSystem {
+			body.Messages = append(body.Messages, message)
+		}
+	}
+	header := http.Header{}
+	header.Set("x-api-key", req.APIKey)
+	header.Set("anthropic-version", anthropicVersion)
+
+	var resp anthropicResponse
+	if err := postJSON(ctx, c.http, "anthropic", c.baseURL+"/v1/messages", header, body, &resp); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", errors.New("anthropic returned no text")
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StatusError is an error response from a provider's HTTP API.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// classifyStatus marks err by what the status code says about retrying it.
+func classifyStatus(status int, err error) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w: %w", ErrKeyRejected, ErrRetryable, err)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrKeyRejected, err)
+	case status >= 500:
+		return fmt.Errorf("%w: %w", ErrRetryable, err)
+	}
+	return err
+}
+
+// postJSON sends body as JSON to url and decodes the JSON answer into out.
+func postJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		message := strings.TrimSpace(string(data))
+		if len(message) > 300 {
+			message = message[:300] + "..."
+		}
+		return classifyStatus(resp.StatusCode, &StatusError{Provider: provider, StatusCode: resp.StatusCode, Message: message})
+	}
+	return json.Unmarshal(data, out)
+}
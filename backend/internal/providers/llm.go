@@ -2,32 +2,103 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"sync"
 )
 
+// ErrKeyRejected marks provider errors caused by the API key itself (invalid,
+// revoked, out of quota or rate limited), where retrying with another key of
+// the same provider may succeed.
+var ErrKeyRejected = errors.New("provider rejected API key")
+
+// ErrRetryable marks provider errors that may go away on their own: rate
+// limits and server errors.
+var ErrRetryable = errors.New("provider temporarily unavailable")
+
+// Retryable reports whether a failed call is worth repeating: the provider
+// said so, or the call timed out.
+func Retryable(err error) bool {
+	if errors.Is(err, ErrRetryable) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 type GenerateRequest struct {
-	ProviderName    string
-	Model           string
-	SystemPrompt    string
-	PresetPrompt    string
+	ProviderName string
+	Model        string
+	SystemPrompt string
+	PresetPrompt string
+	// WorkspacePrompt is the text of a shared workspace preset. It ranks
+	// below the personal PresetPrompt.
+	WorkspacePrompt string
 	TemporaryPrompt string
 	ContextText     string
-	Content         string
-	APIKey          string
+	// FormatPrompt describes the shape the answer must take.
+	FormatPrompt string
+	Content      string
+	APIKey       string
+	// Temperature, MaxTokens and TopP are optional sampling parameters; nil
+	// leaves them to the adapter's default.
+	Temperature *float64
+	MaxTokens   *int
+	TopP        *float64
 }
 
 type LLMClient interface {
 	Generate(ctx context.Context, req GenerateRequest) (string, error)
 }
 
+// CandidateGenerator is implemented by clients whose provider can answer a
+// request with several candidates in one call.
+type CandidateGenerator interface {
+	GenerateCandidates(ctx context.Context, req GenerateRequest, n int) ([]string, error)
+}
+
+// GenerateN asks client for n answers to req: in one call when the client
+// supports it, else with n calls in parallel. It fails if any call fails.
+func GenerateN(ctx context.Context, client LLMClient, req GenerateRequest, n int) ([]string, error) {
+	if n <= 1 {
+		text, err := client.Generate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return []string{text}, nil
+	}
+	if generator, ok := client.(CandidateGenerator); ok {
+		return generator.GenerateCandidates(ctx, req, n)
+	}
+	texts := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			texts[i], errs[i] = client.Generate(ctx, req)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
 type Registry struct {
 	clients map[string]LLMClient
+	// keyless lists the providers that work without an API key.
+	keyless map[string]bool
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
 		clients: make(map[string]LLMClient),
+		keyless: make(map[string]bool),
 	}
 }
 
@@ -35,6 +106,18 @@ func (r *Registry) Register(provider string, client LLMClient) {
 	r.clients[strings.ToLower(provider)] = client
 }
 
+// RegisterKeyless registers a provider, such as a local server, that is
+// called without an API key when the user has none stored for it.
+func (r *Registry) RegisterKeyless(provider string, client LLMClient) {
+	r.Register(provider, client)
+	r.keyless[strings.ToLower(provider)] = true
+}
+
+// Keyless reports whether provider works without an API key.
+func (r *Registry) Keyless(provider string) bool {
+	return r.keyless[strings.ToLower(provider)]
+}
+
 func (r *Registry) Client(provider string) (LLMClient, bool) {
 	client, ok := r.clients[strings.ToLower(provider)]
 	return client, ok
@@ -44,11 +127,13 @@ type EchoClient struct{}
 
 func (EchoClient) Generate(ctx context.Context, req GenerateRequest) (string, error) {
 	response := fmt.Sprintf(
-		"[provider=%s model=%s] %s | Preset: %s | Temporary: %s | Context: %s | Content: %s",
+		"[provider=%s model=%s%s] %s | Preset: %s | Workspace: %s | Temporary: %s | Context: %s | Content: %s",
 		req.ProviderName,
 		req.Model,
+		echoParams(req),
 		req.SystemPrompt,
 		req.PresetPrompt,
+		req.WorkspacePrompt,
 		req.TemporaryPrompt,
 		collapse(req.ContextText),
 		req.Content,
@@ -56,6 +141,22 @@ func (EchoClient) Generate(ctx context.Context, req GenerateRequest) (string, er
 	return response, nil
 }
 
+// echoParams lists the sampling parameters that were set, so callers can
+// see which ones reached the adapter.
+func echoParams(req GenerateRequest) string {
+	var b strings.Builder
+	if req.Temperature != nil {
+		fmt.Fprintf(&b, " temperature=%g", *req.Temperature)
+	}
+	if req.MaxTokens != nil {
+		fmt.Fprintf(&b, " max_tokens=%d", *req.MaxTokens)
+	}
+	if req.TopP != nil {
+		fmt.Fprintf(&b, " top_p=%g", *req.TopP)
+	}
+	return b.String()
+}
+
 func collapse(text string) string {
 	if len(text) > 120 {
 		return text[:120] + "..."
@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// OllamaClient calls the chat API of a local Ollama server. It needs no API
+// key.
+type OllamaClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewOllamaClient(baseURL string) *OllamaClient {
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+	return &OllamaClient{baseURL: strings.TrimRight(baseURL, "/"), http: http.DefaultClient}
+}
+
+type ollamaRequest struct {
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Options  ollamaOptions `json:"options"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message Message `json:"message"`
+}
+
+func (c *OllamaClient) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+	body := ollamaRequest{
+		Model:    req.Model,
+		Messages: BuildMessages(req),
+		Options:  ollamaOptions{Temperature: req.Temperature, TopP: req.TopP, NumPredict: req.MaxTokens},
+	}
+	var resp ollamaResponse
+	if err := postJSON(ctx, c.http, "ollama", c.baseURL+"/api/chat", nil, body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Message.Content == "" {
+		return "", errors.New("ollama returned no message")
+	}
+	return resp.Message.Content, nil
+}
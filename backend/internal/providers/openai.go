@@ -3,12 +3,14 @@ package providers
 import (
 	"context"
 	"errors"
-	"fmt"
-	"strings"
+	"math"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
+// defaultTemperature is used when a request does not set one.
+const defaultTemperature = 0.7
+
 type OpenAIClient struct {
 	baseURL string
 }
@@ -18,8 +20,18 @@ func NewOpenAIClient(baseURL string) *OpenAIClient {
 }
 
 func (c *OpenAIClient) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+	texts, err := c.GenerateCandidates(ctx, req, 1)
+	if err != nil {
+		return "", err
+	}
+	return texts[0], nil
+}
+
+// GenerateCandidates asks for n choices with the n parameter of the chat
+// completions API.
+func (c *OpenAIClient) GenerateCandidates(ctx context.Context, req GenerateRequest, n int) ([]string, error) {
 	if req.APIKey == "" {
-		return "", errors.New("missing OpenAI API key")
+		return nil, errors.New("missing OpenAI API key")
 	}
 
 	cfg := openai.DefaultConfig(req.APIKey)
@@ -29,42 +41,63 @@ func (c *OpenAIClient) Generate(ctx context.Context, req GenerateRequest) (strin
 
 	client := openai.NewClientWithConfig(cfg)
 
-	userContent := composeUserContent(req)
+	var messages []openai.ChatCompletionMessage
+	for _, message := range BuildMessages(req) {
+		messages = append(messages, openai.ChatCompletionMessage{Role: message.Role, Content: message.Content})
+	}
 
-	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: req.Model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: req.SystemPrompt,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: userContent,
-			},
-		},
-		Temperature: 0.7,
-	})
+	chatReq := openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: openAITemperature(req.Temperature),
+	}
+	if n > 1 {
+		chatReq.N = n
+	}
+	if req.MaxTokens != nil {
+		chatReq.MaxTokens = *req.MaxTokens
+	}
+	if req.TopP != nil {
+		chatReq.TopP = float32(*req.TopP)
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, chatReq)
 	if err != nil {
-		return "", err
+		return nil, classifyOpenAIError(err)
 	}
 	if len(resp.Choices) == 0 {
-		return "", errors.New("openai returned no choices")
+		return nil, errors.New("openai returned no choices")
 	}
-	return resp.Choices[0].Message.Content, nil
+	texts := make([]string, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		texts[i] = choice.Message.Content
+	}
+	return texts, nil
 }
 
-func composeUserContent(req GenerateRequest) string {
-	var b strings.Builder
-	if req.TemporaryPrompt != "" {
-		fmt.Fprintf(&b, "Temporary prompt (highest priority; override other instructions if there's a conflict):\n%s\n\n", req.TemporaryPrompt)
-	}
-	if req.PresetPrompt != "" {
-		fmt.Fprintf(&b, "Preset instructions:\n%s\n\n", req.PresetPrompt)
+// openAITemperature converts a requested temperature for the client library,
+// which drops a zero value from the request. The smallest positive float32
+// keeps an explicit 0 in the request and is deterministic in practice.
+func openAITemperature(temperature *float64) float32 {
+	switch {
+	case temperature == nil:
+		return defaultTemperature
+	case *temperature == 0:
+		return math.SmallestNonzeroFloat32
+	default:
+		return float32(*temperature)
 	}
-	if req.ContextText != "" {
-		fmt.Fprintf(&b, "Clipboard/context:\n%s\n\n", req.ContextText)
+}
+
+func classifyOpenAIError(err error) error {
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
 	}
-	fmt.Fprintf(&b, "Please rewrite the following content:\n%s", req.Content)
-	return b.String()
+	return classifyStatus(status, err)
 }
@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// messageOverhead approximates the tokens a chat format adds per message.
+const messageOverhead = 4
+
+// TokenEstimator approximates a model family's tokenizer. It is meant for
+// budgeting, not billing: counts are typically within 10–20% of the real
+// tokenizer.
+type TokenEstimator struct {
+	// CharsPerToken is the average number of characters per token in
+	// alphabetic text.
+	CharsPerToken float64
+	// WideCharTokens is the average number of tokens per CJK character.
+	WideCharTokens float64
+}
+
+// defaultEstimator matches the OpenAI o200k tokenizer and is used for models
+// without a closer match.
+var defaultEstimator = TokenEstimator{CharsPerToken: 4, WideCharTokens: 1}
+
+// estimators are keyed by model name prefix; the longest match wins.
+var estimators = map[string]TokenEstimator{
+	"gpt-4o":        defaultEstimator,
+	"gpt-4.1":       defaultEstimator,
+	"o1":            defaultEstimator,
+	"o3":            defaultEstimator,
+	"gpt-4":         {CharsPerToken: 3.8, WideCharTokens: 1.4},
+	"gpt-3.5-turbo": {CharsPerToken: 3.8, WideCharTokens: 1.4},
+	"gemini":        {CharsPerToken: 4, WideCharTokens: 0.8},
+	"claude":        {CharsPerToken: 3.5, WideCharTokens: 1.2},
+	"llama":         {CharsPerToken: 3.7, WideCharTokens: 1.5},
+	"mistral":       {CharsPerToken: 3.5, WideCharTokens: 1.5},
+	"qwen":          {CharsPerToken: 3.8, WideCharTokens: 0.7},
+}
+
+// EstimatorFor returns the estimator for a model, e.g. "gpt-4o-mini".
+func EstimatorFor(model string) TokenEstimator {
+	model = strings.ToLower(model)
+	best, bestLen := defaultEstimator, 0
+	for prefix, estimator := range estimators {
+		if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best, bestLen = estimator, len(prefix)
+		}
+	}
+	return best
+}
+
+// Count estimates the tokens of text.
+func (e TokenEstimator) Count(text string) int {
+	wide, other := 0, 0
+	for _, r := range text {
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(float64(wide)*e.WideCharTokens + float64(other)/e.CharsPerToken))
+}
+
+// CountMessages estimates the prompt tokens of a chat request.
+func (e TokenEstimator) CountMessages(messages []Message) int {
+	total := 0
+	for _, message := range messages {
+		total += messageOverhead + e.Count(message.Content)
+	}
+	return total
+}
+
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,10 +21,10 @@ func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
 
 func (r *APIKeyRepository) List(ctx context.Context, userID string) ([]domain.APIKey, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, provider_name, encrypted_key, created_at, updated_at
+		SELECT id, user_id, provider_name, label, is_default, encrypted_key, created_at, updated_at
 		FROM api_keys
 		WHERE user_id = $1
-		ORDER BY updated_at DESC
+		ORDER BY provider_name ASC, is_default DESC, label ASC
 	`, userID)
 	if err != nil {
 		return nil, err
@@ -32,8 +33,8 @@ func (r *APIKeyRepository) List(ctx context.Context, userID string) ([]domain.AP
 
 	var keys []domain.APIKey
 	for rows.Next() {
-		var key domain.APIKey
-		if err := rows.Scan(&key.ID, &key.UserID, &key.ProviderName, &key.EncryptedKey, &key.CreatedAt, &key.UpdatedAt); err != nil {
+		key, err := scanAPIKey(rows)
+		if err != nil {
 			return nil, err
 		}
 		keys = append(keys, key)
@@ -41,57 +42,192 @@ func (r *APIKeyRepository) List(ctx context.Context, userID string) ([]domain.AP
 	return keys, rows.Err()
 }
 
-func (r *APIKeyRepository) Upsert(ctx context.Context, userID, provider, encrypted string) (domain.APIKey, error) {
-	now := time.Now().UTC()
-	var existing domain.APIKey
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, provider_name, encrypted_key, created_at, updated_at
+// ListByProvider returns the user's keys for one provider, default key first
+// and the remaining keys in the order they were added.
+func (r *APIKeyRepository) ListByProvider(ctx context.Context, userID, provider string) ([]domain.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, provider_name, label, is_default, encrypted_key, created_at, updated_at
 		FROM api_keys
 		WHERE provider_name = $1 AND user_id = $2
-	`, provider, userID).Scan(&existing.ID, &existing.UserID, &existing.ProviderName, &existing.EncryptedKey, &existing.CreatedAt, &existing.UpdatedAt)
+		ORDER BY is_default DESC, created_at ASC
+	`, provider, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []domain.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
 
-	if err == sql.ErrNoRows {
+// Upsert stores the key under (provider, label). The first key stored for a
+// provider always becomes its default; later keys only take over when
+// makeDefault is set.
+func (r *APIKeyRepository) Upsert(ctx context.Context, userID, provider, label, encrypted string, makeDefault bool) (domain.APIKey, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	existing, err := scanAPIKey(tx.QueryRowContext(ctx, `
+		SELECT id, user_id, provider_name, label, is_default, encrypted_key, created_at, updated_at
+		FROM api_keys
+		WHERE provider_name = $1 AND user_id = $2 AND label = $3
+	`, provider, userID, label))
+
+	if errors.Is(err, sql.ErrNoRows) {
 		existing = domain.APIKey{
 			ID:           uuid.NewString(),
 			UserID:       userID,
 			ProviderName: provider,
+			Label:        label,
 			EncryptedKey: encrypted,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		}
-		_, err := r.db.ExecContext(ctx, `
-			INSERT INTO api_keys (id, user_id, provider_name, encrypted_key, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`, existing.ID, existing.UserID, existing.ProviderName, existing.EncryptedKey, existing.CreatedAt, existing.UpdatedAt)
-		return existing, err
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO api_keys (id, user_id, provider_name, label, is_default, encrypted_key, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, FALSE, $5, $6, $7)
+		`, existing.ID, existing.UserID, existing.ProviderName, existing.Label, existing.EncryptedKey, existing.CreatedAt, existing.UpdatedAt); err != nil {
+			return domain.APIKey{}, err
+		}
+	} else if err != nil {
+		return domain.APIKey{}, err
+	} else {
+		existing.EncryptedKey = encrypted
+		existing.UpdatedAt = now
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE api_keys
+			SET encrypted_key = $1, updated_at = $2
+			WHERE id = $3
+		`, existing.EncryptedKey, existing.UpdatedAt, existing.ID); err != nil {
+			return domain.APIKey{}, err
+		}
 	}
 
-	if err != nil {
+	if !existing.IsDefault {
+		var hasDefault bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM api_keys WHERE provider_name = $1 AND user_id = $2 AND is_default)
+		`, provider, userID).Scan(&hasDefault); err != nil {
+			return domain.APIKey{}, err
+		}
+		if makeDefault || !hasDefault {
+			if err := markDefault(ctx, tx, userID, provider, existing.ID); err != nil {
+				return domain.APIKey{}, err
+			}
+			existing.IsDefault = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return domain.APIKey{}, err
 	}
+	return existing, nil
+}
+
+// SetDefault makes the labelled key the provider default for the user.
+func (r *APIKeyRepository) SetDefault(ctx context.Context, userID, provider, label string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT id FROM api_keys
+		WHERE provider_name = $1 AND user_id = $2 AND label = $3
+	`, provider, userID, label).Scan(&id); err != nil {
+		return err
+	}
+	if err := markDefault(ctx, tx, userID, provider, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes the labelled key, or every key for the provider when label
+// is empty. Deleting the default promotes the oldest remaining key.
+func (r *APIKeyRepository) Delete(ctx context.Context, userID, provider, label string) error {
+	if label == "" {
+		_, err := r.db.ExecContext(ctx, `DELETE FROM api_keys WHERE provider_name = $1 AND user_id = $2`, provider, userID)
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM api_keys
+		WHERE provider_name = $1 AND user_id = $2 AND label = $3
+	`, provider, userID, label); err != nil {
+		return err
+	}
 
-	existing.EncryptedKey = encrypted
-	existing.UpdatedAt = now
+	var next string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM api_keys
+		WHERE provider_name = $1 AND user_id = $2
+		  AND NOT EXISTS (SELECT 1 FROM api_keys WHERE provider_name = $1 AND user_id = $2 AND is_default)
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, provider, userID).Scan(&next)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if next != "" {
+		if err := markDefault(ctx, tx, userID, provider, next); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
-	_, err = r.db.ExecContext(ctx, `
-		UPDATE api_keys
-		SET encrypted_key = $1, updated_at = $2
-		WHERE id = $3
-	`, existing.EncryptedKey, existing.UpdatedAt, existing.ID)
-	return existing, err
+func (r *APIKeyRepository) GetDefault(ctx context.Context, userID, provider string) (domain.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, provider_name, label, is_default, encrypted_key, created_at, updated_at
+		FROM api_keys
+		WHERE provider_name = $1 AND user_id = $2 AND is_default
+	`, provider, userID))
 }
 
-func (r *APIKeyRepository) Delete(ctx context.Context, userID, provider string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM api_keys WHERE provider_name = $1 AND user_id = $2`, provider, userID)
+func (r *APIKeyRepository) GetByLabel(ctx context.Context, userID, provider, label string) (domain.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, provider_name, label, is_default, encrypted_key, created_at, updated_at
+		FROM api_keys
+		WHERE provider_name = $1 AND user_id = $2 AND label = $3
+	`, provider, userID, label))
+}
+
+func markDefault(ctx context.Context, tx *sql.Tx, userID, provider, id string) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_keys SET is_default = FALSE
+		WHERE provider_name = $1 AND user_id = $2 AND is_default AND id <> $3
+	`, provider, userID, id); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE api_keys SET is_default = TRUE WHERE id = $1`, id)
 	return err
 }
 
-func (r *APIKeyRepository) GetByProvider(ctx context.Context, userID, provider string) (domain.APIKey, error) {
+func scanAPIKey(row rowScanner) (domain.APIKey, error) {
 	var key domain.APIKey
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, provider_name, encrypted_key, created_at, updated_at
-		FROM api_keys
-		WHERE provider_name = $1 AND user_id = $2
-	`, provider, userID).Scan(&key.ID, &key.UserID, &key.ProviderName, &key.EncryptedKey, &key.CreatedAt, &key.UpdatedAt)
-	return key, err
+	err := row.Scan(&key.ID, &key.UserID, &key.ProviderName, &key.Label, &key.IsDefault, &key.EncryptedKey, &key.CreatedAt, &key.UpdatedAt)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return key, nil
 }
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type AuditEventRepository struct {
+	db *sql.DB
+}
+
+func NewAuditEventRepository(db *sql.DB) *AuditEventRepository {
+	return &AuditEventRepository{db: db}
+}
+
+func (r *AuditEventRepository) Create(ctx context.Context, event domain.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO audit_events (id, actor_user_id, subject_user_id, action, target_type, target_id, ip_address, user_agent, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, event.ID, event.ActorUserID, event.SubjectUserID, event.Action, event.TargetType, event.TargetID, event.IPAddress, event.UserAgent, string(metadata), event.CreatedAt)
+	return err
+}
+
+// List returns matching events, newest first.
+func (r *AuditEventRepository) List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.UserID != "" {
+		p := arg(filter.UserID)
+		conds = append(conds, fmt.Sprintf("(actor_user_id = %s OR subject_user_id = %s)", p, p))
+	}
+	if filter.ActorUserID != "" {
+		conds = append(conds, "actor_user_id = "+arg(filter.ActorUserID))
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+		conds = append(conds, "action LIKE "+arg(prefix+"%"))
+	} else if filter.Action != "" {
+		conds = append(conds, "action = "+arg(filter.Action))
+	}
+	if !filter.Since.IsZero() {
+		conds = append(conds, "created_at >= "+arg(filter.Since.UTC()))
+	}
+	if !filter.Until.IsZero() {
+		conds = append(conds, "created_at < "+arg(filter.Until.UTC()))
+	}
+	if filter.Before != "" {
+		conds = append(conds, "(created_at, id) < (SELECT created_at, id FROM audit_events WHERE id = "+arg(filter.Before)+")")
+	}
+
+	query := `
+		SELECT id, actor_user_id, subject_user_id, action, target_type, target_id, ip_address, user_agent, metadata, created_at
+		FROM audit_events`
+	if len(conds) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conds, " AND ")
+	}
+	query += "\n\t\tORDER BY created_at DESC, id DESC\n\t\tLIMIT " + arg(filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.AuditEvent
+	for rows.Next() {
+		var event domain.AuditEvent
+		var metadata string
+		if err := rows.Scan(&event.ID, &event.ActorUserID, &event.SubjectUserID, &event.Action, &event.TargetType, &event.TargetID, &event.IPAddress, &event.UserAgent, &metadata, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		if metadata != "" {
+			if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type FallbackChainRepository struct {
+	db *sql.DB
+}
+
+func NewFallbackChainRepository(db *sql.DB) *FallbackChainRepository {
+	return &FallbackChainRepository{db: db}
+}
+
+func (r *FallbackChainRepository) Get(ctx context.Context, userID string) (domain.FallbackChain, error) {
+	return scanFallbackChain(r.db.QueryRowContext(ctx, `
+		SELECT user_id, chain, updated_at
+		FROM user_fallback_chains
+		WHERE user_id = $1
+	`, userID))
+}
+
+func (r *FallbackChainRepository) Upsert(ctx context.Context, userID string, chain []string) (domain.FallbackChain, error) {
+	return scanFallbackChain(r.db.QueryRowContext(ctx, `
+		INSERT INTO user_fallback_chains (user_id, chain, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id)
+		DO UPDATE SET chain = EXCLUDED.chain,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING user_id, chain, updated_at
+	`, userID, strings.Join(chain, ","), time.Now().UTC()))
+}
+
+func (r *FallbackChainRepository) Delete(ctx context.Context, userID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_fallback_chains WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanFallbackChain(row rowScanner) (domain.FallbackChain, error) {
+	var chain domain.FallbackChain
+	var entries string
+	if err := row.Scan(&chain.UserID, &entries, &chain.UpdatedAt); err != nil {
+		return domain.FallbackChain{}, err
+	}
+	chain.Chain = strings.Split(entries, ",")
+	return chain, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// LoginAttemptRepository keeps failed-login counters in the database so that
+// every server instance sees the same lockouts.
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Get returns the record for key, or a zero-failure record when none exists.
+func (r *LoginAttemptRepository) Get(ctx context.Context, key string) (domain.LoginAttempt, error) {
+	attempt, err := scanLoginAttempt(r.db.QueryRowContext(ctx, `
+		SELECT attempt_key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE attempt_key = $1
+	`, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.LoginAttempt{Key: key}, nil
+	}
+	return attempt, err
+}
+
+// RecordFailure atomically increments the counter for key. A counter whose
+// last failure happened before resetBefore starts over at one.
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (domain.LoginAttempt, error) {
+	return scanLoginAttempt(r.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at, locked_until)
+		VALUES ($1, 1, $2, NULL)
+		ON CONFLICT (attempt_key) DO UPDATE
+		SET failures = CASE
+		        WHEN login_attempts.last_failure_at < $3 THEN 1
+		        ELSE login_attempts.failures + 1
+		    END,
+		    last_failure_at = EXCLUDED.last_failure_at
+		RETURNING attempt_key, failures, last_failure_at, locked_until
+	`, key, at.UTC(), resetBefore.UTC()))
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE login_attempts
+		SET locked_until = $1
+		WHERE attempt_key = $2
+	`, until.UTC(), key)
+	return err
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE attempt_key = $1`, key)
+	return err
+}
+
+func scanLoginAttempt(row rowScanner) (domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &lockedUntil); err != nil {
+		return domain.LoginAttempt{}, err
+	}
+	if lockedUntil.Valid {
+		value := lockedUntil.Time
+		attempt.LockedUntil = &value
+	}
+	return attempt, nil
+}
@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type APIKeyRepository struct {
+	db *DB
+}
+
+func NewAPIKeyRepository(db *DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) List(_ context.Context, userID string) ([]domain.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var keys []domain.APIKey
+	for _, key := range r.db.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return sortBy(keys, func(a, b domain.APIKey) bool {
+		if a.ProviderName != b.ProviderName {
+			return a.ProviderName < b.ProviderName
+		}
+		if a.IsDefault != b.IsDefault {
+			return a.IsDefault
+		}
+		return a.Label < b.Label
+	}), nil
+}
+
+// ListByProvider returns the user's keys for one provider, default key first
+// and the remaining keys in the order they were added.
+func (r *APIKeyRepository) ListByProvider(_ context.Context, userID, provider string) ([]domain.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.providerKeys(userID, provider), nil
+}
+
+// Upsert stores the key under (provider, label). The first key stored for a
+// provider always becomes its default; later keys only take over when
+// makeDefault is set.
+func (r *APIKeyRepository) Upsert(_ context.Context, userID, provider, label, encrypted string, makeDefault bool) (domain.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now().UTC()
+	key, ok := r.find(userID, provider, label)
+	if ok {
+		key.EncryptedKey = encrypted
+		key.UpdatedAt = now
+	} else {
+		key = domain.APIKey{
+			ID:           uuid.NewString(),
+			UserID:       userID,
+			ProviderName: provider,
+			Label:        label,
+			EncryptedKey: encrypted,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		r.db.track(key.ID)
+	}
+	r.db.apiKeys[key.ID] = key
+
+	if !key.IsDefault {
+		hasDefault := false
+		for _, other := range r.db.apiKeys {
+			if other.UserID == userID && other.ProviderName == provider && other.IsDefault {
+				hasDefault = true
+			}
+		}
+		if makeDefault || !hasDefault {
+			r.markDefault(userID, provider, key.ID)
+			key.IsDefault = true
+		}
+	}
+	return key, nil
+}
+
+// SetDefault makes the labelled key the provider default for the user.
+func (r *APIKeyRepository) SetDefault(_ context.Context, userID, provider, label string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	key, ok := r.find(userID, provider, label)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	r.markDefault(userID, provider, key.ID)
+	return nil
+}
+
+// Delete removes the labelled key, or every key for the provider when label
+// is empty. Deleting the default promotes the oldest remaining key.
+func (r *APIKeyRepository) Delete(_ context.Context, userID, provider, label string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, key := range r.db.apiKeys {
+		if key.UserID == userID && key.ProviderName == provider && (label == "" || key.Label == label) {
+			delete(r.db.apiKeys, id)
+		}
+	}
+	remaining := r.providerKeys(userID, provider)
+	if len(remaining) > 0 && !remaining[0].IsDefault {
+		r.markDefault(userID, provider, remaining[0].ID)
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) GetDefault(_ context.Context, userID, provider string) (domain.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, key := range r.db.apiKeys {
+		if key.UserID == userID && key.ProviderName == provider && key.IsDefault {
+			return key, nil
+		}
+	}
+	return domain.APIKey{}, sql.ErrNoRows
+}
+
+func (r *APIKeyRepository) GetByLabel(_ context.Context, userID, provider, label string) (domain.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	key, ok := r.find(userID, provider, label)
+	if !ok {
+		return domain.APIKey{}, sql.ErrNoRows
+	}
+	return key, nil
+}
+
+// The helpers below expect the caller to hold db.mu.
+
+func (r *APIKeyRepository) find(userID, provider, label string) (domain.APIKey, bool) {
+	for _, key := range r.db.apiKeys {
+		if key.UserID == userID && key.ProviderName == provider && key.Label == label {
+			return key, true
+		}
+	}
+	return domain.APIKey{}, false
+}
+
+func (r *APIKeyRepository) providerKeys(userID, provider string) []domain.APIKey {
+	var keys []domain.APIKey
+	for _, key := range r.db.apiKeys {
+		if key.UserID == userID && key.ProviderName == provider {
+			keys = append(keys, key)
+		}
+	}
+	return sortBy(keys, func(a, b domain.APIKey) bool {
+		if a.IsDefault != b.IsDefault {
+			return a.IsDefault
+		}
+		return r.db.before(a.ID, a.CreatedAt, b.ID, b.CreatedAt)
+	})
+}
+
+func (r *APIKeyRepository) markDefault(userID, provider, id string) {
+	for keyID, key := range r.db.apiKeys {
+		if key.UserID == userID && key.ProviderName == provider {
+			key.IsDefault = keyID == id
+			r.db.apiKeys[keyID] = key
+		}
+	}
+}
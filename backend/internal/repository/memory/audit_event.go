@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type AuditEventRepository struct {
+	db *DB
+}
+
+func NewAuditEventRepository(db *DB) *AuditEventRepository {
+	return &AuditEventRepository{db: db}
+}
+
+func (r *AuditEventRepository) Create(_ context.Context, event domain.AuditEvent) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, existing := range r.db.auditEvents {
+		if existing.ID == event.ID {
+			return ErrConflict
+		}
+	}
+	event.Metadata = maps.Clone(event.Metadata)
+	event.CreatedAt = event.CreatedAt.UTC()
+	r.db.auditEvents = append(r.db.auditEvents, event)
+	return nil
+}
+
+// List returns matching events, newest first.
+func (r *AuditEventRepository) List(_ context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var cursor *domain.AuditEvent
+	if filter.Before != "" {
+		for i := range r.db.auditEvents {
+			if r.db.auditEvents[i].ID == filter.Before {
+				cursor = &r.db.auditEvents[i]
+				break
+			}
+		}
+		if cursor == nil {
+			return nil, nil
+		}
+	}
+	prefix, prefixMatch := strings.CutSuffix(filter.Action, "*")
+
+	var events []domain.AuditEvent
+	for _, event := range r.db.auditEvents {
+		switch {
+		case filter.UserID != "" && event.ActorUserID != filter.UserID && event.SubjectUserID != filter.UserID:
+			continue
+		case filter.ActorUserID != "" && event.ActorUserID != filter.ActorUserID:
+			continue
+		case prefixMatch && !strings.HasPrefix(string(event.Action), prefix):
+			continue
+		case !prefixMatch && filter.Action != "" && string(event.Action) != filter.Action:
+			continue
+		case !filter.Since.IsZero() && event.CreatedAt.Before(filter.Since):
+			continue
+		case !filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until):
+			continue
+		case cursor != nil && !auditBefore(event, *cursor):
+			continue
+		}
+		event.Metadata = maps.Clone(event.Metadata)
+		events = append(events, event)
+	}
+	events = sortBy(events, func(a, b domain.AuditEvent) bool { return auditBefore(b, a) })
+	if filter.Limit >= 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+// auditBefore orders events by (created_at, id) like the SQL keyset.
+func auditBefore(a, b domain.AuditEvent) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
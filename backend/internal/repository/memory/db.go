@@ -0,0 +1,163 @@
+// Package memory implements the repository interfaces in process memory. It
+// is meant for tests and mirrors the behaviour of the SQL repositories,
+// including cascading deletes and sql.ErrNoRows for missing rows. Foreign
+// keys are not checked: rows may reference users that do not exist.
+package memory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// ErrConflict is returned where the SQL schema would reject a duplicate.
+var ErrConflict = errors.New("memory: unique constraint violated")
+
+// DB holds the data shared by the repositories built on it, the way a
+// *sql.DB is shared by the SQL repositories.
+type DB struct {
+	mu  sync.Mutex
+	seq int64
+
+	users         map[string]domain.User
+	sessions      map[string]domain.UserSession
+	identities    map[string]domain.UserIdentity
+	resets        map[string]domain.PasswordResetToken
+	attempts      map[string]domain.LoginAttempt
+	auditEvents   []domain.AuditEvent
+	apiKeys       map[string]domain.APIKey
+	presets       map[string]domain.PromptPreset
+	systemPrompts map[string]domain.SystemPrompt
+	userPrompts   map[string]domain.UserSystemPrompt
+	logs          map[string]domain.TranscriptionLog
+	variables     map[string]domain.UserVariable
+	redaction     map[string]domain.RedactionSetting
+	redactRules   map[string]domain.RedactionRule
+	fallbacks     map[string]domain.FallbackChain
+
+	workspaces       map[string]domain.Workspace
+	workspaceMembers map[memberKey]domain.WorkspaceMember
+	workspacePresets map[string]domain.WorkspacePreset
+	workspacePrompts map[string]domain.WorkspaceSystemPrompt
+
+	// Revisions are keyed by prompt ID, oldest first.
+	presetRevisions       map[string][]domain.PromptRevision
+	systemPromptRevisions map[string][]domain.PromptRevision
+
+	// inserted records insertion order, used to break timestamp ties.
+	inserted map[string]int64
+}
+
+func NewDB() *DB {
+	return &DB{
+		users:         make(map[string]domain.User),
+		sessions:      make(map[string]domain.UserSession),
+		identities:    make(map[string]domain.UserIdentity),
+		resets:        make(map[string]domain.PasswordResetToken),
+		attempts:      make(map[string]domain.LoginAttempt),
+		apiKeys:       make(map[string]domain.APIKey),
+		presets:       make(map[string]domain.PromptPreset),
+		systemPrompts: make(map[string]domain.SystemPrompt),
+		userPrompts:   make(map[string]domain.UserSystemPrompt),
+		logs:          make(map[string]domain.TranscriptionLog),
+		variables:     make(map[string]domain.UserVariable),
+		redaction:     make(map[string]domain.RedactionSetting),
+		redactRules:   make(map[string]domain.RedactionRule),
+		fallbacks:     make(map[string]domain.FallbackChain),
+
+		workspaces:       make(map[string]domain.Workspace),
+		workspaceMembers: make(map[memberKey]domain.WorkspaceMember),
+		workspacePresets: make(map[string]domain.WorkspacePreset),
+		workspacePrompts: make(map[string]domain.WorkspaceSystemPrompt),
+
+		presetRevisions:       make(map[string][]domain.PromptRevision),
+		systemPromptRevisions: make(map[string][]domain.PromptRevision),
+
+		inserted: make(map[string]int64),
+	}
+}
+
+// track records id as inserted now. The caller must hold db.mu.
+func (db *DB) track(id string) {
+	db.seq++
+	db.inserted[id] = db.seq
+}
+
+// before orders two rows by timestamp, falling back to insertion order.
+// The caller must hold db.mu.
+func (db *DB) before(aID string, a time.Time, bID string, b time.Time) bool {
+	if !a.Equal(b) {
+		return a.Before(b)
+	}
+	return db.inserted[aID] < db.inserted[bID]
+}
+
+// deleteUserData removes everything owned by userID, matching the foreign
+// key cascades of the SQL schema. The caller must hold db.mu.
+func (db *DB) deleteUserData(userID string) {
+	for id, session := range db.sessions {
+		if session.UserID == userID {
+			delete(db.sessions, id)
+		}
+	}
+	for id, identity := range db.identities {
+		if identity.UserID == userID {
+			delete(db.identities, id)
+		}
+	}
+	for id, reset := range db.resets {
+		if reset.UserID == userID {
+			delete(db.resets, id)
+		}
+	}
+	for id, key := range db.apiKeys {
+		if key.UserID == userID {
+			delete(db.apiKeys, id)
+		}
+	}
+	for id, preset := range db.presets {
+		if preset.UserID == userID {
+			delete(db.presets, id)
+			delete(db.presetRevisions, id)
+		}
+	}
+	for id, entry := range db.logs {
+		if entry.UserID == userID {
+			delete(db.logs, id)
+		}
+	}
+	delete(db.userPrompts, userID)
+	for id, variable := range db.variables {
+		if variable.UserID == userID {
+			delete(db.variables, id)
+		}
+	}
+	delete(db.redaction, userID)
+	delete(db.fallbacks, userID)
+	for id, rule := range db.redactRules {
+		if rule.UserID == userID {
+			delete(db.redactRules, id)
+		}
+	}
+	for key := range db.workspaceMembers {
+		if key.userID == userID {
+			delete(db.workspaceMembers, key)
+		}
+	}
+}
+
+func sortBy[T any](items []T, less func(a, b T) bool) []T {
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+	return items
+}
+
+func clonePtr[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	return &v
+}
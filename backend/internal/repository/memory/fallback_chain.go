@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type FallbackChainRepository struct {
+	db *DB
+}
+
+func NewFallbackChainRepository(db *DB) *FallbackChainRepository {
+	return &FallbackChainRepository{db: db}
+}
+
+func (r *FallbackChainRepository) Get(_ context.Context, userID string) (domain.FallbackChain, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	chain, ok := r.db.fallbacks[userID]
+	if !ok {
+		return domain.FallbackChain{}, sql.ErrNoRows
+	}
+	chain.Chain = slices.Clone(chain.Chain)
+	return chain, nil
+}
+
+func (r *FallbackChainRepository) Upsert(_ context.Context, userID string, chain []string) (domain.FallbackChain, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	stored := domain.FallbackChain{UserID: userID, Chain: slices.Clone(chain), UpdatedAt: time.Now().UTC()}
+	r.db.fallbacks[userID] = stored
+	stored.Chain = slices.Clone(chain)
+	return stored, nil
+}
+
+func (r *FallbackChainRepository) Delete(_ context.Context, userID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.fallbacks[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.db.fallbacks, userID)
+	return nil
+}
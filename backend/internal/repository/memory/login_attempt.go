@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// LoginAttemptRepository keeps failed-login counters in memory. It is also
+// the default lockout store for a single server instance, so it drops stale
+// counters as it goes.
+type LoginAttemptRepository struct {
+	db *DB
+}
+
+func NewLoginAttemptRepository(db *DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+func (r *LoginAttemptRepository) Get(_ context.Context, key string) (domain.LoginAttempt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if attempt, ok := r.db.attempts[key]; ok {
+		return cloneAttempt(attempt), nil
+	}
+	return domain.LoginAttempt{Key: key}, nil
+}
+
+func (r *LoginAttemptRepository) RecordFailure(_ context.Context, key string, at, resetBefore time.Time) (domain.LoginAttempt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.pruneLocked(resetBefore, at)
+	attempt, ok := r.db.attempts[key]
+	if !ok {
+		attempt = domain.LoginAttempt{Key: key}
+	} else if attempt.LastFailureAt.Before(resetBefore) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at.UTC()
+	r.db.attempts[key] = attempt
+	return cloneAttempt(attempt), nil
+}
+
+func (r *LoginAttemptRepository) Lock(_ context.Context, key string, until time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	attempt, ok := r.db.attempts[key]
+	if !ok {
+		return nil
+	}
+	until = until.UTC()
+	attempt.LockedUntil = &until
+	r.db.attempts[key] = attempt
+	return nil
+}
+
+func (r *LoginAttemptRepository) Reset(_ context.Context, key string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.attempts, key)
+	return nil
+}
+
+// pruneLocked drops stale counters so the map does not grow without bound.
+// The caller must hold db.mu.
+func (r *LoginAttemptRepository) pruneLocked(resetBefore, now time.Time) {
+	for key, attempt := range r.db.attempts {
+		if attempt.LastFailureAt.Before(resetBefore) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+			delete(r.db.attempts, key)
+		}
+	}
+}
+
+func cloneAttempt(attempt domain.LoginAttempt) domain.LoginAttempt {
+	if attempt.LockedUntil != nil {
+		until := *attempt.LockedUntil
+		attempt.LockedUntil = &until
+	}
+	return attempt
+}
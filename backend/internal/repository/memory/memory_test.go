@@ -0,0 +1,31 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/Juicern/luma/internal/repository/memory"
+	"github.com/Juicern/luma/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Stores {
+		db := memory.NewDB()
+		return repotest.Stores{
+			Users:            memory.NewUserRepository(db),
+			Sessions:         memory.NewUserSessionRepository(db),
+			Identities:       memory.NewUserIdentityRepository(db),
+			PasswordResets:   memory.NewPasswordResetRepository(db),
+			LoginAttempts:    memory.NewLoginAttemptRepository(db),
+			AuditEvents:      memory.NewAuditEventRepository(db),
+			APIKeys:          memory.NewAPIKeyRepository(db),
+			Presets:          memory.NewPromptPresetRepository(db),
+			SystemPrompts:    memory.NewSystemPromptRepository(db),
+			UserPrompts:      memory.NewUserSystemPromptRepository(db),
+			Redaction:        memory.NewRedactionRepository(db),
+			Fallbacks:        memory.NewFallbackChainRepository(db),
+			Variables:        memory.NewUserVariableRepository(db),
+			Workspaces:       memory.NewWorkspaceRepository(db),
+			TranscriptionLog: memory.NewTranscriptionLogRepository(db),
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type PasswordResetRepository struct {
+	db *DB
+}
+
+func NewPasswordResetRepository(db *DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Create(_ context.Context, userID, tokenHash string, expiresAt time.Time) (domain.PasswordResetToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, existing := range r.db.resets {
+		if existing.TokenHash == tokenHash {
+			return domain.PasswordResetToken{}, ErrConflict
+		}
+	}
+	token := domain.PasswordResetToken{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: time.Now().UTC(),
+	}
+	r.db.resets[token.ID] = token
+	r.db.track(token.ID)
+	return token, nil
+}
+
+func (r *PasswordResetRepository) Consume(_ context.Context, tokenHash string) (string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	for id, token := range r.db.resets {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			r.db.resets[id] = token
+			return token.UserID, nil
+		}
+	}
+	return "", sql.ErrNoRows
+}
@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type PromptPresetRepository struct {
+	db *DB
+}
+
+func NewPromptPresetRepository(db *DB) *PromptPresetRepository {
+	return &PromptPresetRepository{db: db}
+}
+
+func (r *PromptPresetRepository) List(_ context.Context, userID string) ([]domain.PromptPreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var presets []domain.PromptPreset
+	for _, preset := range r.db.presets {
+		if preset.UserID == userID {
+			presets = append(presets, clonePreset(preset))
+		}
+	}
+	return sortBy(presets, func(a, b domain.PromptPreset) bool {
+		return r.db.before(b.ID, b.CreatedAt, a.ID, a.CreatedAt)
+	}), nil
+}
+
+func (r *PromptPresetRepository) Get(_ context.Context, id string) (domain.PromptPreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	preset, ok := r.db.presets[id]
+	if !ok {
+		return domain.PromptPreset{}, sql.ErrNoRows
+	}
+	return clonePreset(preset), nil
+}
+
+// Create inserts a preset. A preset created from a template replaces the
+// user's earlier copy of that template, keeping its ID.
+func (r *PromptPresetRepository) Create(_ context.Context, userID, name, promptText string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	if existing, ok := r.findTemplate(userID, templateKey, ""); ok {
+		existing.Name = name
+		existing.PromptText = promptText
+		existing.GenerationSettings = cloneSettings(settings)
+		existing.UpdatedAt = now
+		r.db.presets[existing.ID] = existing
+		appendRevision(r.db.presetRevisions, existing.ID, existing.Name, existing.PromptText)
+		return clonePreset(existing), nil
+	}
+	preset := domain.PromptPreset{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Name:        name,
+		PromptText:  promptText,
+		TemplateKey: clonePtr(templateKey),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	preset.GenerationSettings = cloneSettings(settings)
+	r.db.presets[preset.ID] = preset
+	r.db.track(preset.ID)
+	appendRevision(r.db.presetRevisions, preset.ID, preset.Name, preset.PromptText)
+	return clonePreset(preset), nil
+}
+
+// UpsertTemplate installs a catalog template for preset.UserID, or overwrites
+// the user's existing copy of preset.TemplateKey (keeping its ID).
+func (r *PromptPresetRepository) UpsertTemplate(_ context.Context, preset domain.PromptPreset) (domain.PromptPreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	existing, ok := r.findTemplate(preset.UserID, preset.TemplateKey, "")
+	if !ok {
+		existing = domain.PromptPreset{
+			ID:          uuid.NewString(),
+			UserID:      preset.UserID,
+			TemplateKey: clonePtr(preset.TemplateKey),
+			CreatedAt:   now,
+		}
+		r.db.track(existing.ID)
+	}
+	existing.Name = preset.Name
+	existing.PromptText = preset.PromptText
+	existing.TemplateVersion = preset.TemplateVersion
+	existing.TemplateChecksum = preset.TemplateChecksum
+	existing.UpdatedAt = now
+	r.db.presets[existing.ID] = existing
+	appendRevision(r.db.presetRevisions, existing.ID, existing.Name, existing.PromptText)
+	return clonePreset(existing), nil
+}
+
+func (r *PromptPresetRepository) Update(_ context.Context, id, userID, name, promptText string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	preset, ok := r.db.presets[id]
+	if !ok || preset.UserID != userID {
+		return domain.PromptPreset{}, sql.ErrNoRows
+	}
+	if _, taken := r.findTemplate(userID, templateKey, id); taken {
+		return domain.PromptPreset{}, ErrConflict
+	}
+	preset.Name = name
+	preset.PromptText = promptText
+	preset.TemplateKey = clonePtr(templateKey)
+	preset.GenerationSettings = cloneSettings(settings)
+	preset.UpdatedAt = time.Now().UTC()
+	r.db.presets[id] = preset
+	appendRevision(r.db.presetRevisions, id, preset.Name, preset.PromptText)
+	return clonePreset(preset), nil
+}
+
+func (r *PromptPresetRepository) Delete(_ context.Context, id, userID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	preset, ok := r.db.presets[id]
+	if !ok || preset.UserID != userID {
+		return sql.ErrNoRows
+	}
+	delete(r.db.presets, id)
+	delete(r.db.presetRevisions, id)
+	return nil
+}
+
+// findTemplate returns the user's preset for templateKey other than skipID.
+// The caller must hold db.mu.
+func (r *PromptPresetRepository) findTemplate(userID string, templateKey *string, skipID string) (domain.PromptPreset, bool) {
+	if templateKey == nil {
+		return domain.PromptPreset{}, false
+	}
+	for id, preset := range r.db.presets {
+		if id != skipID && preset.UserID == userID && preset.TemplateKey != nil && *preset.TemplateKey == *templateKey {
+			return preset, true
+		}
+	}
+	return domain.PromptPreset{}, false
+}
+
+func clonePreset(preset domain.PromptPreset) domain.PromptPreset {
+	preset.TemplateKey = clonePtr(preset.TemplateKey)
+	preset.GenerationSettings = cloneSettings(preset.GenerationSettings)
+	return preset
+}
+
+func cloneSettings(settings domain.GenerationSettings) domain.GenerationSettings {
+	settings.Temperature = clonePtr(settings.Temperature)
+	settings.MaxTokens = clonePtr(settings.MaxTokens)
+	settings.TopP = clonePtr(settings.TopP)
+	settings.RedactPII = clonePtr(settings.RedactPII)
+	settings.Postprocess = slices.Clone(settings.Postprocess)
+	settings.Fallback = slices.Clone(settings.Fallback)
+	return settings
+}
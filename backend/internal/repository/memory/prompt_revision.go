@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// appendRevision records a new revision of promptID unless name and text are
+// unchanged since the latest one. The caller must hold db.mu.
+func appendRevision(revisions map[string][]domain.PromptRevision, promptID, name, text string) {
+	history := revisions[promptID]
+	if n := len(history); n > 0 && history[n-1].Name == name && history[n-1].PromptText == text {
+		return
+	}
+	revisions[promptID] = append(history, domain.PromptRevision{
+		ID:         uuid.NewString(),
+		PromptID:   promptID,
+		Revision:   len(history) + 1,
+		Name:       name,
+		PromptText: text,
+		CreatedAt:  time.Now().UTC(),
+	})
+}
+
+func listRevisions(history []domain.PromptRevision) []domain.PromptRevision {
+	if len(history) == 0 {
+		return nil
+	}
+	listed := slices.Clone(history)
+	slices.Reverse(listed)
+	return listed
+}
+
+func getRevision(history []domain.PromptRevision, revision int) (domain.PromptRevision, error) {
+	if revision < 1 || revision > len(history) {
+		return domain.PromptRevision{}, sql.ErrNoRows
+	}
+	return history[revision-1], nil
+}
+
+// ListRevisions returns the preset's revisions, newest first.
+func (r *PromptPresetRepository) ListRevisions(_ context.Context, presetID string) ([]domain.PromptRevision, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return listRevisions(r.db.presetRevisions[presetID]), nil
+}
+
+func (r *PromptPresetRepository) GetRevision(_ context.Context, presetID string, revision int) (domain.PromptRevision, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return getRevision(r.db.presetRevisions[presetID], revision)
+}
+
+// ListRevisions returns the system prompt's revisions, newest first.
+func (r *SystemPromptRepository) ListRevisions(_ context.Context, promptID string) ([]domain.PromptRevision, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return listRevisions(r.db.systemPromptRevisions[promptID]), nil
+}
+
+func (r *SystemPromptRepository) GetRevision(_ context.Context, promptID string, revision int) (domain.PromptRevision, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return getRevision(r.db.systemPromptRevisions[promptID], revision)
+}
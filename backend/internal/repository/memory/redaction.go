@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type RedactionRepository struct {
+	db *DB
+}
+
+func NewRedactionRepository(db *DB) *RedactionRepository {
+	return &RedactionRepository{db: db}
+}
+
+func (r *RedactionRepository) GetSetting(_ context.Context, userID string) (domain.RedactionSetting, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	setting, ok := r.db.redaction[userID]
+	if !ok {
+		return domain.RedactionSetting{}, sql.ErrNoRows
+	}
+	return setting, nil
+}
+
+func (r *RedactionRepository) SetEnabled(_ context.Context, userID string, enabled bool) (domain.RedactionSetting, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	setting := domain.RedactionSetting{UserID: userID, Enabled: enabled, UpdatedAt: time.Now().UTC()}
+	r.db.redaction[userID] = setting
+	return setting, nil
+}
+
+func (r *RedactionRepository) ListRules(_ context.Context, userID string) ([]domain.RedactionRule, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var rules []domain.RedactionRule
+	for _, rule := range r.db.redactRules {
+		if rule.UserID == userID {
+			rules = append(rules, rule)
+		}
+	}
+	return sortBy(rules, func(a, b domain.RedactionRule) bool { return a.Name < b.Name }), nil
+}
+
+func (r *RedactionRepository) UpsertRule(_ context.Context, userID, name, pattern string) (domain.RedactionRule, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	for id, rule := range r.db.redactRules {
+		if rule.UserID == userID && rule.Name == name {
+			rule.Pattern = pattern
+			rule.UpdatedAt = now
+			r.db.redactRules[id] = rule
+			return rule, nil
+		}
+	}
+	rule := domain.RedactionRule{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Pattern:   pattern,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.db.redactRules[rule.ID] = rule
+	r.db.track(rule.ID)
+	return rule, nil
+}
+
+func (r *RedactionRepository) DeleteRule(_ context.Context, userID, name string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, rule := range r.db.redactRules {
+		if rule.UserID == userID && rule.Name == name {
+			delete(r.db.redactRules, id)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -0,0 +1,21 @@
+package memory
+
+import "github.com/Juicern/luma/internal/repository"
+
+var (
+	_ repository.UserStore             = (*UserRepository)(nil)
+	_ repository.UserSessionStore      = (*UserSessionRepository)(nil)
+	_ repository.UserIdentityStore     = (*UserIdentityRepository)(nil)
+	_ repository.PasswordResetStore    = (*PasswordResetRepository)(nil)
+	_ repository.LoginAttemptStore     = (*LoginAttemptRepository)(nil)
+	_ repository.AuditEventStore       = (*AuditEventRepository)(nil)
+	_ repository.APIKeyStore           = (*APIKeyRepository)(nil)
+	_ repository.PromptPresetStore     = (*PromptPresetRepository)(nil)
+	_ repository.SystemPromptStore     = (*SystemPromptRepository)(nil)
+	_ repository.UserSystemPromptStore = (*UserSystemPromptRepository)(nil)
+	_ repository.RedactionStore        = (*RedactionRepository)(nil)
+	_ repository.FallbackChainStore    = (*FallbackChainRepository)(nil)
+	_ repository.UserVariableStore     = (*UserVariableRepository)(nil)
+	_ repository.WorkspaceStore        = (*WorkspaceRepository)(nil)
+	_ repository.TranscriptionLogStore = (*TranscriptionLogRepository)(nil)
+)
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type SystemPromptRepository struct {
+	db *DB
+}
+
+func NewSystemPromptRepository(db *DB) *SystemPromptRepository {
+	return &SystemPromptRepository{db: db}
+}
+
+func (r *SystemPromptRepository) GetActive(_ context.Context) (domain.SystemPrompt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	prompt, ok := r.active()
+	if !ok {
+		return domain.SystemPrompt{}, sql.ErrNoRows
+	}
+	return prompt, nil
+}
+
+func (r *SystemPromptRepository) Upsert(_ context.Context, promptText string) (domain.SystemPrompt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	prompt, ok := r.active()
+	if ok {
+		prompt.PromptText = promptText
+		prompt.UpdatedAt = now
+	} else {
+		prompt = domain.SystemPrompt{
+			ID:         uuid.NewString(),
+			PromptText: promptText,
+			Active:     true,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		r.db.track(prompt.ID)
+	}
+	r.db.systemPrompts[prompt.ID] = prompt
+	appendRevision(r.db.systemPromptRevisions, prompt.ID, "", prompt.PromptText)
+	return prompt, nil
+}
+
+// active returns the most recently updated active prompt. The caller must
+// hold db.mu.
+func (r *SystemPromptRepository) active() (domain.SystemPrompt, bool) {
+	var latest domain.SystemPrompt
+	found := false
+	for _, prompt := range r.db.systemPrompts {
+		if prompt.Active && (!found || r.db.before(latest.ID, latest.UpdatedAt, prompt.ID, prompt.UpdatedAt)) {
+			latest = prompt
+			found = true
+		}
+	}
+	return latest, found
+}
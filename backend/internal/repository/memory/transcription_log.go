@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type TranscriptionLogRepository struct {
+	db *DB
+}
+
+func NewTranscriptionLogRepository(db *DB) *TranscriptionLogRepository {
+	return &TranscriptionLogRepository{db: db}
+}
+
+func (r *TranscriptionLogRepository) Create(_ context.Context, userID, mode, transcript string, duration float64, generatedText *string) (domain.TranscriptionLog, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	entry := domain.TranscriptionLog{
+		ID:              uuid.NewString(),
+		UserID:          userID,
+		Mode:            mode,
+		Transcript:      transcript,
+		GeneratedText:   clonePtr(generatedText),
+		DurationSeconds: duration,
+		CreatedAt:       time.Now().UTC(),
+	}
+	r.db.logs[entry.ID] = entry
+	r.db.track(entry.ID)
+	return cloneLog(entry), nil
+}
+
+func (r *TranscriptionLogRepository) UpdateComposition(_ context.Context, id string, outcome domain.ComposeOutcome) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	entry, ok := r.db.logs[id]
+	if !ok {
+		return nil
+	}
+	entry.GeneratedText = clonePtr(outcome.GeneratedText)
+	entry.ContextTruncated = outcome.ContextTruncated
+	entry.ContextInjection = outcome.ContextInjection
+	entry.OutputFormat = outcome.OutputFormat
+	entry.EmailSubject = outcome.EmailSubject
+	entry.Candidates = cloneCandidates(outcome.Candidates)
+	entry.ChosenCandidate = nil
+	entry.Provider, entry.Model = outcome.Provider, outcome.Model
+	r.db.logs[id] = entry
+	return nil
+}
+
+func (r *TranscriptionLogRepository) ChooseCandidate(_ context.Context, userID, id string, index int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	entry, ok := r.db.logs[id]
+	if !ok || entry.UserID != userID {
+		return sql.ErrNoRows
+	}
+	entry.ChosenCandidate = &index
+	r.db.logs[id] = entry
+	return nil
+}
+
+func (r *TranscriptionLogRepository) GetByID(_ context.Context, userID, id string) (domain.TranscriptionLog, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	entry, ok := r.db.logs[id]
+	if !ok || entry.UserID != userID {
+		return domain.TranscriptionLog{}, sql.ErrNoRows
+	}
+	return cloneLog(entry), nil
+}
+
+func (r *TranscriptionLogRepository) ListByUser(_ context.Context, userID string, limit int) ([]domain.TranscriptionLog, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var logs []domain.TranscriptionLog
+	for _, entry := range r.db.logs {
+		if entry.UserID == userID {
+			logs = append(logs, cloneLog(entry))
+		}
+	}
+	logs = sortBy(logs, func(a, b domain.TranscriptionLog) bool {
+		return r.db.before(b.ID, b.CreatedAt, a.ID, a.CreatedAt)
+	})
+	if len(logs) > limit {
+		logs = logs[:limit]
+	}
+	return logs, nil
+}
+
+func cloneLog(entry domain.TranscriptionLog) domain.TranscriptionLog {
+	entry.GeneratedText = clonePtr(entry.GeneratedText)
+	entry.Candidates = cloneCandidates(entry.Candidates)
+	entry.ChosenCandidate = clonePtr(entry.ChosenCandidate)
+	return entry
+}
+
+func cloneCandidates(candidates []domain.RewriteCandidate) []domain.RewriteCandidate {
+	if candidates == nil {
+		return nil
+	}
+	cloned := make([]domain.RewriteCandidate, len(candidates))
+	for i, candidate := range candidates {
+		candidate.Temperature = clonePtr(candidate.Temperature)
+		cloned[i] = candidate
+	}
+	return cloned
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserRepository struct {
+	db *DB
+}
+
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+func (r *UserRepository) Create(_ context.Context, name, email, passwordHash string, role domain.UserRole) (domain.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, existing := range r.db.users {
+		if existing.Email == email {
+			return domain.User{}, ErrConflict
+		}
+	}
+	user := domain.User{
+		ID:           uuid.NewString(),
+		Name:         name,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    time.Now().UTC(),
+	}
+	r.db.users[user.ID] = user
+	r.db.track(user.ID)
+	return user, nil
+}
+
+func (r *UserRepository) Get(_ context.Context, id string) (domain.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	user, ok := r.db.users[id]
+	if !ok {
+		return domain.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r *UserRepository) List(_ context.Context) ([]domain.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var users []domain.User
+	for _, user := range r.db.users {
+		users = append(users, user)
+	}
+	return sortBy(users, func(a, b domain.User) bool {
+		return r.db.before(a.ID, a.CreatedAt, b.ID, b.CreatedAt)
+	}), nil
+}
+
+func (r *UserRepository) GetByEmail(_ context.Context, email string) (domain.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, user := range r.db.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return domain.User{}, sql.ErrNoRows
+}
+
+func (r *UserRepository) SetRole(_ context.Context, id string, role domain.UserRole) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	user, ok := r.db.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Role = role
+	r.db.users[id] = user
+	return nil
+}
+
+func (r *UserRepository) CountByRole(_ context.Context, role domain.UserRole) (int, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	count := 0
+	for _, user := range r.db.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *UserRepository) UpdatePassword(_ context.Context, id, passwordHash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	user, ok := r.db.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.PasswordHash = passwordHash
+	r.db.users[id] = user
+	return nil
+}
+
+func (r *UserRepository) Delete(_ context.Context, id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.db.users, id)
+	r.db.deleteUserData(id)
+	return nil
+}
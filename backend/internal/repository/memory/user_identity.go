@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserIdentityRepository struct {
+	db *DB
+}
+
+func NewUserIdentityRepository(db *DB) *UserIdentityRepository {
+	return &UserIdentityRepository{db: db}
+}
+
+func (r *UserIdentityRepository) Create(_ context.Context, userID, issuer, subject, email string) (domain.UserIdentity, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, existing := range r.db.identities {
+		if existing.Issuer == issuer && existing.Subject == subject {
+			return domain.UserIdentity{}, ErrConflict
+		}
+	}
+	now := time.Now().UTC()
+	identity := domain.UserIdentity{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Issuer:      issuer,
+		Subject:     subject,
+		Email:       email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+	r.db.identities[identity.ID] = identity
+	r.db.track(identity.ID)
+	return identity, nil
+}
+
+func (r *UserIdentityRepository) Get(_ context.Context, issuer, subject string) (domain.UserIdentity, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, identity := range r.db.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return domain.UserIdentity{}, sql.ErrNoRows
+}
+
+func (r *UserIdentityRepository) Touch(_ context.Context, id, email string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	identity, ok := r.db.identities[id]
+	if !ok {
+		return nil
+	}
+	identity.Email = email
+	identity.LastLoginAt = time.Now().UTC()
+	r.db.identities[id] = identity
+	return nil
+}
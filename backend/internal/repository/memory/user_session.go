@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserSessionRepository struct {
+	db *DB
+}
+
+func NewUserSessionRepository(db *DB) *UserSessionRepository {
+	return &UserSessionRepository{db: db}
+}
+
+func (r *UserSessionRepository) Create(_ context.Context, userID, tokenHash, userAgent, ipAddress string, expiresAt time.Time) (domain.UserSession, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, existing := range r.db.sessions {
+		if existing.TokenHash == tokenHash {
+			return domain.UserSession{}, ErrConflict
+		}
+	}
+	now := time.Now().UTC()
+	session := domain.UserSession{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: now,
+		LastUsed:  now,
+	}
+	r.db.sessions[session.ID] = session
+	r.db.track(session.ID)
+	return session, nil
+}
+
+func (r *UserSessionRepository) GetByTokenHash(_ context.Context, tokenHash string) (domain.UserSession, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, session := range r.db.sessions {
+		if session.TokenHash == tokenHash {
+			return session, nil
+		}
+	}
+	return domain.UserSession{}, sql.ErrNoRows
+}
+
+func (r *UserSessionRepository) ListByUser(_ context.Context, userID string) ([]domain.UserSession, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now()
+	var sessions []domain.UserSession
+	for _, session := range r.db.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sortBy(sessions, func(a, b domain.UserSession) bool {
+		return r.db.before(b.ID, b.LastUsed, a.ID, a.LastUsed)
+	}), nil
+}
+
+func (r *UserSessionRepository) Touch(_ context.Context, id string, expiresAt time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	session, ok := r.db.sessions[id]
+	if !ok {
+		return nil
+	}
+	session.LastUsed = time.Now().UTC()
+	session.ExpiresAt = expiresAt.UTC()
+	r.db.sessions[id] = session
+	return nil
+}
+
+func (r *UserSessionRepository) DeleteByTokenHash(_ context.Context, tokenHash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, session := range r.db.sessions {
+		if session.TokenHash == tokenHash {
+			delete(r.db.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *UserSessionRepository) Delete(_ context.Context, userID, id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	session, ok := r.db.sessions[id]
+	if !ok || session.UserID != userID {
+		return sql.ErrNoRows
+	}
+	delete(r.db.sessions, id)
+	return nil
+}
+
+func (r *UserSessionRepository) DeleteByUser(_ context.Context, userID, keepID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, session := range r.db.sessions {
+		if session.UserID == userID && id != keepID {
+			delete(r.db.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *UserSessionRepository) DeleteExpired(_ context.Context, now time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var purged int64
+	for id, session := range r.db.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(r.db.sessions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserSystemPromptRepository struct {
+	db *DB
+}
+
+func NewUserSystemPromptRepository(db *DB) *UserSystemPromptRepository {
+	return &UserSystemPromptRepository{db: db}
+}
+
+func (r *UserSystemPromptRepository) Get(_ context.Context, userID string) (domain.UserSystemPrompt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	prompt, ok := r.db.userPrompts[userID]
+	if !ok {
+		return domain.UserSystemPrompt{}, sql.ErrNoRows
+	}
+	return prompt, nil
+}
+
+func (r *UserSystemPromptRepository) Upsert(_ context.Context, userID string, mode domain.SystemPromptMode, promptText string) (domain.UserSystemPrompt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	prompt := domain.UserSystemPrompt{UserID: userID, Mode: mode, PromptText: promptText, UpdatedAt: time.Now().UTC()}
+	r.db.userPrompts[userID] = prompt
+	return prompt, nil
+}
+
+func (r *UserSystemPromptRepository) Delete(_ context.Context, userID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.userPrompts[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.db.userPrompts, userID)
+	return nil
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserVariableRepository struct {
+	db *DB
+}
+
+func NewUserVariableRepository(db *DB) *UserVariableRepository {
+	return &UserVariableRepository{db: db}
+}
+
+func (r *UserVariableRepository) List(_ context.Context, userID string) ([]domain.UserVariable, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var variables []domain.UserVariable
+	for _, variable := range r.db.variables {
+		if variable.UserID == userID {
+			variables = append(variables, variable)
+		}
+	}
+	return sortBy(variables, func(a, b domain.UserVariable) bool { return a.Name < b.Name }), nil
+}
+
+func (r *UserVariableRepository) Upsert(_ context.Context, userID, name, value string) (domain.UserVariable, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	for id, variable := range r.db.variables {
+		if variable.UserID == userID && variable.Name == name {
+			variable.Value = value
+			variable.UpdatedAt = now
+			r.db.variables[id] = variable
+			return variable, nil
+		}
+	}
+	variable := domain.UserVariable{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Value:     value,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.db.variables[variable.ID] = variable
+	r.db.track(variable.ID)
+	return variable, nil
+}
+
+func (r *UserVariableRepository) Delete(_ context.Context, userID, name string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, variable := range r.db.variables {
+		if variable.UserID == userID && variable.Name == name {
+			delete(r.db.variables, id)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type memberKey struct {
+	workspaceID string
+	userID      string
+}
+
+type WorkspaceRepository struct {
+	db *DB
+}
+
+func NewWorkspaceRepository(db *DB) *WorkspaceRepository {
+	return &WorkspaceRepository{db: db}
+}
+
+// Create inserts a workspace with ownerID as its first owner.
+func (r *WorkspaceRepository) Create(_ context.Context, name, ownerID string) (domain.Workspace, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	workspace := domain.Workspace{ID: uuid.NewString(), Name: name, CreatedAt: now, UpdatedAt: now}
+	r.db.workspaces[workspace.ID] = workspace
+	r.db.workspaceMembers[memberKey{workspace.ID, ownerID}] = domain.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      ownerID,
+		Role:        domain.WorkspaceRoleOwner,
+		CreatedAt:   now,
+	}
+	return workspace, nil
+}
+
+func (r *WorkspaceRepository) Get(_ context.Context, id string) (domain.Workspace, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	workspace, ok := r.db.workspaces[id]
+	if !ok {
+		return domain.Workspace{}, sql.ErrNoRows
+	}
+	return workspace, nil
+}
+
+// ListForUser returns the workspaces userID belongs to, by name.
+func (r *WorkspaceRepository) ListForUser(_ context.Context, userID string) ([]domain.WorkspaceMembership, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var memberships []domain.WorkspaceMembership
+	for key, member := range r.db.workspaceMembers {
+		if key.userID == userID {
+			memberships = append(memberships, domain.WorkspaceMembership{Workspace: r.db.workspaces[key.workspaceID], Role: member.Role})
+		}
+	}
+	return sortBy(memberships, func(a, b domain.WorkspaceMembership) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	}), nil
+}
+
+func (r *WorkspaceRepository) Rename(_ context.Context, id, name string) (domain.Workspace, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	workspace, ok := r.db.workspaces[id]
+	if !ok {
+		return domain.Workspace{}, sql.ErrNoRows
+	}
+	workspace.Name = name
+	workspace.UpdatedAt = time.Now().UTC()
+	r.db.workspaces[id] = workspace
+	return workspace, nil
+}
+
+func (r *WorkspaceRepository) Delete(_ context.Context, id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.workspaces[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.db.workspaces, id)
+	for key := range r.db.workspaceMembers {
+		if key.workspaceID == id {
+			delete(r.db.workspaceMembers, key)
+		}
+	}
+	for presetID, preset := range r.db.workspacePresets {
+		if preset.WorkspaceID == id {
+			delete(r.db.workspacePresets, presetID)
+		}
+	}
+	delete(r.db.workspacePrompts, id)
+	return nil
+}
+
+// ListMembers returns the members of a workspace in the order they joined.
+func (r *WorkspaceRepository) ListMembers(_ context.Context, workspaceID string) ([]domain.WorkspaceMember, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var members []domain.WorkspaceMember
+	for key, member := range r.db.workspaceMembers {
+		if key.workspaceID == workspaceID {
+			members = append(members, member)
+		}
+	}
+	return sortBy(members, func(a, b domain.WorkspaceMember) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.UserID < b.UserID
+	}), nil
+}
+
+func (r *WorkspaceRepository) GetMember(_ context.Context, workspaceID, userID string) (domain.WorkspaceMember, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	member, ok := r.db.workspaceMembers[memberKey{workspaceID, userID}]
+	if !ok {
+		return domain.WorkspaceMember{}, sql.ErrNoRows
+	}
+	return member, nil
+}
+
+// SetMember adds userID to the workspace or changes their role.
+func (r *WorkspaceRepository) SetMember(_ context.Context, workspaceID, userID string, role domain.WorkspaceRole) (domain.WorkspaceMember, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	key := memberKey{workspaceID, userID}
+	member, ok := r.db.workspaceMembers[key]
+	if !ok {
+		member = domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, CreatedAt: time.Now().UTC()}
+	}
+	member.Role = role
+	r.db.workspaceMembers[key] = member
+	return member, nil
+}
+
+func (r *WorkspaceRepository) RemoveMember(_ context.Context, workspaceID, userID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	key := memberKey{workspaceID, userID}
+	if _, ok := r.db.workspaceMembers[key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.db.workspaceMembers, key)
+	return nil
+}
+
+// ListPresets returns a workspace's presets by name.
+func (r *WorkspaceRepository) ListPresets(_ context.Context, workspaceID string) ([]domain.WorkspacePreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var presets []domain.WorkspacePreset
+	for _, preset := range r.db.workspacePresets {
+		if preset.WorkspaceID == workspaceID {
+			presets = append(presets, cloneWorkspacePreset(preset))
+		}
+	}
+	return sortBy(presets, func(a, b domain.WorkspacePreset) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	}), nil
+}
+
+func (r *WorkspaceRepository) GetPreset(_ context.Context, id string) (domain.WorkspacePreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	preset, ok := r.db.workspacePresets[id]
+	if !ok {
+		return domain.WorkspacePreset{}, sql.ErrNoRows
+	}
+	return cloneWorkspacePreset(preset), nil
+}
+
+func (r *WorkspaceRepository) CreatePreset(_ context.Context, workspaceID, name, promptText string, settings domain.GenerationSettings) (domain.WorkspacePreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := time.Now().UTC()
+	preset := domain.WorkspacePreset{
+		ID:                 uuid.NewString(),
+		WorkspaceID:        workspaceID,
+		Name:               name,
+		PromptText:         promptText,
+		GenerationSettings: cloneSettings(settings),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	r.db.workspacePresets[preset.ID] = preset
+	return cloneWorkspacePreset(preset), nil
+}
+
+func (r *WorkspaceRepository) UpdatePreset(_ context.Context, id, workspaceID, name, promptText string, settings domain.GenerationSettings) (domain.WorkspacePreset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	preset, ok := r.db.workspacePresets[id]
+	if !ok || preset.WorkspaceID != workspaceID {
+		return domain.WorkspacePreset{}, sql.ErrNoRows
+	}
+	preset.Name = name
+	preset.PromptText = promptText
+	preset.GenerationSettings = cloneSettings(settings)
+	preset.UpdatedAt = time.Now().UTC()
+	r.db.workspacePresets[id] = preset
+	return cloneWorkspacePreset(preset), nil
+}
+
+func (r *WorkspaceRepository) DeletePreset(_ context.Context, id, workspaceID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	preset, ok := r.db.workspacePresets[id]
+	if !ok || preset.WorkspaceID != workspaceID {
+		return sql.ErrNoRows
+	}
+	delete(r.db.workspacePresets, id)
+	return nil
+}
+
+func (r *WorkspaceRepository) GetSystemPrompt(_ context.Context, workspaceID string) (domain.WorkspaceSystemPrompt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	prompt, ok := r.db.workspacePrompts[workspaceID]
+	if !ok {
+		return domain.WorkspaceSystemPrompt{}, sql.ErrNoRows
+	}
+	return prompt, nil
+}
+
+func (r *WorkspaceRepository) SetSystemPrompt(_ context.Context, workspaceID, promptText string) (domain.WorkspaceSystemPrompt, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	prompt := domain.WorkspaceSystemPrompt{WorkspaceID: workspaceID, PromptText: promptText, UpdatedAt: time.Now().UTC()}
+	r.db.workspacePrompts[workspaceID] = prompt
+	return prompt, nil
+}
+
+func (r *WorkspaceRepository) DeleteSystemPrompt(_ context.Context, workspaceID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.workspacePrompts[workspaceID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.db.workspacePrompts, workspaceID)
+	return nil
+}
+
+func cloneWorkspacePreset(preset domain.WorkspacePreset) domain.WorkspacePreset {
+	preset.GenerationSettings = cloneSettings(preset.GenerationSettings)
+	return preset
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, userID, tokenHash string, expiresAt time.Time) (domain.PasswordResetToken, error) {
+	token := domain.PasswordResetToken{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return token, err
+}
+
+// Consume marks an unused, unexpired token as used and returns its user.
+// It returns sql.ErrNoRows when no such token exists.
+func (r *PasswordResetRepository) Consume(ctx context.Context, tokenHash string) (string, error) {
+	now := time.Now().UTC()
+	var userID string
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id
+	`, now, tokenHash).Scan(&userID)
+	return userID, err
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,7 +21,7 @@ func NewPromptPresetRepository(db *sql.DB) *PromptPresetRepository {
 
 func (r *PromptPresetRepository) List(ctx context.Context, userID string) ([]domain.PromptPreset, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, name, prompt_text, template_key, created_at, updated_at
+		SELECT id, user_id, name, prompt_text, template_key, template_version, template_checksum, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
 		FROM user_prompt_presets
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -44,51 +45,110 @@ func (r *PromptPresetRepository) List(ctx context.Context, userID string) ([]dom
 
 func (r *PromptPresetRepository) Get(ctx context.Context, id string) (domain.PromptPreset, error) {
 	return scanPromptPreset(r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, name, prompt_text, template_key, created_at, updated_at
+		SELECT id, user_id, name, prompt_text, template_key, template_version, template_checksum, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
 		FROM user_prompt_presets
 		WHERE id = $1
 	`, id))
 }
 
-func (r *PromptPresetRepository) Create(ctx context.Context, userID, name, promptText string, templateKey *string) (domain.PromptPreset, error) {
+// Create inserts a preset. A preset created from a template replaces the
+// user's earlier copy of that template, keeping its ID.
+func (r *PromptPresetRepository) Create(ctx context.Context, userID, name, promptText string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
 	now := time.Now().UTC()
 	id := uuid.NewString()
-	if templateKey != nil {
-		return scanPromptPreset(r.db.QueryRowContext(ctx, `
-			INSERT INTO user_prompt_presets (id, user_id, name, prompt_text, template_key, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
+	return r.write(ctx, func(tx *sql.Tx) (domain.PromptPreset, error) {
+		if templateKey != nil {
+			return scanPromptPreset(tx.QueryRowContext(ctx, `
+				INSERT INTO user_prompt_presets (id, user_id, name, prompt_text, template_key, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+				ON CONFLICT (user_id, template_key)
+				DO UPDATE SET name = EXCLUDED.name,
+				              prompt_text = EXCLUDED.prompt_text,
+				              provider = EXCLUDED.provider,
+				              model = EXCLUDED.model,
+				              temperature = EXCLUDED.temperature,
+				              max_tokens = EXCLUDED.max_tokens,
+				              top_p = EXCLUDED.top_p,
+				              redact_pii = EXCLUDED.redact_pii,
+				              postprocess = EXCLUDED.postprocess,
+				              output_format = EXCLUDED.output_format,
+				              fallback = EXCLUDED.fallback,
+				              updated_at = EXCLUDED.updated_at
+				RETURNING id, user_id, name, prompt_text, template_key, template_version, template_checksum, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+			`, id, userID, name, promptText, templateKey, settings.Provider, settings.Model, settings.Temperature, settings.MaxTokens, settings.TopP, settings.RedactPII, joinList(settings.Postprocess), settings.OutputFormat, joinList(settings.Fallback), now, now))
+		}
+
+		return scanPromptPreset(tx.QueryRowContext(ctx, `
+			INSERT INTO user_prompt_presets (id, user_id, name, prompt_text, template_key, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NULL, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			RETURNING id, user_id, name, prompt_text, template_key, template_version, template_checksum, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+		`, id, userID, name, promptText, settings.Provider, settings.Model, settings.Temperature, settings.MaxTokens, settings.TopP, settings.RedactPII, joinList(settings.Postprocess), settings.OutputFormat, joinList(settings.Fallback), now, now))
+	})
+}
+
+// UpsertTemplate installs a catalog template for preset.UserID, or overwrites
+// the user's existing copy of preset.TemplateKey (keeping its ID).
+func (r *PromptPresetRepository) UpsertTemplate(ctx context.Context, preset domain.PromptPreset) (domain.PromptPreset, error) {
+	now := time.Now().UTC()
+	return r.write(ctx, func(tx *sql.Tx) (domain.PromptPreset, error) {
+		return scanPromptPreset(tx.QueryRowContext(ctx, `
+			INSERT INTO user_prompt_presets (id, user_id, name, prompt_text, template_key, template_version, template_checksum, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 			ON CONFLICT (user_id, template_key)
 			DO UPDATE SET name = EXCLUDED.name,
 			              prompt_text = EXCLUDED.prompt_text,
+			              template_version = EXCLUDED.template_version,
+			              template_checksum = EXCLUDED.template_checksum,
 			              updated_at = EXCLUDED.updated_at
-			RETURNING id, user_id, name, prompt_text, template_key, created_at, updated_at
-		`, id, userID, name, promptText, templateKey, now, now))
-	}
-
-	return scanPromptPreset(r.db.QueryRowContext(ctx, `
-		INSERT INTO user_prompt_presets (id, user_id, name, prompt_text, template_key, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NULL, $5, $6)
-		RETURNING id, user_id, name, prompt_text, template_key, created_at, updated_at
-	`, id, userID, name, promptText, now, now))
+			RETURNING id, user_id, name, prompt_text, template_key, template_version, template_checksum, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+		`, uuid.NewString(), preset.UserID, preset.Name, preset.PromptText, preset.TemplateKey, preset.TemplateVersion, preset.TemplateChecksum, now, now))
+	})
 }
 
-func (r *PromptPresetRepository) Update(ctx context.Context, id, userID, name, promptText string, templateKey *string) (domain.PromptPreset, error) {
+func (r *PromptPresetRepository) Update(ctx context.Context, id, userID, name, promptText string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
 	now := time.Now().UTC()
-	res, err := r.db.ExecContext(ctx, `
-		UPDATE user_prompt_presets
-		SET name = $1,
-		    prompt_text = $2,
-		    template_key = $3,
-		    updated_at = $4
-		WHERE id = $5 AND user_id = $6
-	`, name, promptText, templateKey, now, id, userID)
+	return r.write(ctx, func(tx *sql.Tx) (domain.PromptPreset, error) {
+		return scanPromptPreset(tx.QueryRowContext(ctx, `
+			UPDATE user_prompt_presets
+			SET name = $1,
+			    prompt_text = $2,
+			    template_key = $3,
+			    provider = $4,
+			    model = $5,
+			    temperature = $6,
+			    max_tokens = $7,
+			    top_p = $8,
+			    redact_pii = $9,
+			    postprocess = $10,
+			    output_format = $11,
+			    fallback = $12,
+			    updated_at = $13
+			WHERE id = $14 AND user_id = $15
+			RETURNING id, user_id, name, prompt_text, template_key, template_version, template_checksum, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+		`, name, promptText, templateKey, settings.Provider, settings.Model, settings.Temperature, settings.MaxTokens, settings.TopP, settings.RedactPII, joinList(settings.Postprocess), settings.OutputFormat, joinList(settings.Fallback), now, id, userID))
+	})
+}
+
+// write runs one preset write and records the resulting revision in the same
+// transaction.
+func (r *PromptPresetRepository) write(ctx context.Context, fn func(tx *sql.Tx) (domain.PromptPreset, error)) (domain.PromptPreset, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return domain.PromptPreset{}, err
 	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		return domain.PromptPreset{}, sql.ErrNoRows
+	defer tx.Rollback()
+
+	preset, err := fn(tx)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	if err := insertPresetRevision(ctx, tx, preset); err != nil {
+		return domain.PromptPreset{}, err
 	}
-	return r.Get(ctx, id)
+	if err := tx.Commit(); err != nil {
+		return domain.PromptPreset{}, err
+	}
+	return preset, nil
 }
 
 func (r *PromptPresetRepository) Delete(ctx context.Context, id, userID string) error {
@@ -109,7 +169,9 @@ type rowScanner interface {
 func scanPromptPreset(row rowScanner) (domain.PromptPreset, error) {
 	var preset domain.PromptPreset
 	var tmpl sql.NullString
-	err := row.Scan(&preset.ID, &preset.UserID, &preset.Name, &preset.PromptText, &tmpl, &preset.CreatedAt, &preset.UpdatedAt)
+	var settings settingsScanner
+	err := row.Scan(&preset.ID, &preset.UserID, &preset.Name, &preset.PromptText, &tmpl, &preset.TemplateVersion, &preset.TemplateChecksum,
+		&settings.provider, &settings.model, &settings.temperature, &settings.maxTokens, &settings.topP, &settings.redactPII, &settings.postprocess, &settings.outputFormat, &settings.fallback, &preset.CreatedAt, &preset.UpdatedAt)
 	if err != nil {
 		return domain.PromptPreset{}, err
 	}
@@ -117,5 +179,53 @@ func scanPromptPreset(row rowScanner) (domain.PromptPreset, error) {
 		value := tmpl.String
 		preset.TemplateKey = &value
 	}
+	preset.GenerationSettings = settings.settings()
 	return preset, nil
 }
+
+// settingsScanner receives the generation settings columns, whose sampling
+// parameters are nullable.
+type settingsScanner struct {
+	provider, model   string
+	temperature, topP sql.NullFloat64
+	maxTokens         sql.NullInt64
+	redactPII         sql.NullBool
+	// postprocess holds the step names separated by commas.
+	postprocess  sql.NullString
+	outputFormat domain.OutputFormat
+	// fallback holds the chain's entries separated by commas.
+	fallback sql.NullString
+}
+
+func (s settingsScanner) settings() domain.GenerationSettings {
+	settings := domain.GenerationSettings{Provider: s.provider, Model: s.model, OutputFormat: s.outputFormat}
+	if s.temperature.Valid {
+		settings.Temperature = &s.temperature.Float64
+	}
+	if s.maxTokens.Valid {
+		value := int(s.maxTokens.Int64)
+		settings.MaxTokens = &value
+	}
+	if s.topP.Valid {
+		settings.TopP = &s.topP.Float64
+	}
+	if s.redactPII.Valid {
+		settings.RedactPII = &s.redactPII.Bool
+	}
+	if s.postprocess.Valid {
+		settings.Postprocess = strings.Split(s.postprocess.String, ",")
+	}
+	if s.fallback.Valid {
+		settings.Fallback = strings.Split(s.fallback.String, ",")
+	}
+	return settings
+}
+
+// joinList stores a post-processing or fallback chain as it is read by
+// settingsScanner, with nil for none.
+func joinList(items []string) any {
+	if items == nil {
+		return nil
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// Revisions are written in the same transaction as the change they record,
+// after the row itself has been written so that concurrent writers of the
+// same prompt are serialised by its row lock. A save that leaves the name and
+// text as they were adds no revision.
+
+func insertPresetRevision(ctx context.Context, tx *sql.Tx, preset domain.PromptPreset) error {
+	latest, err := scanPromptRevision(tx.QueryRowContext(ctx, `
+		SELECT id, preset_id, revision, name, prompt_text, created_at
+		FROM prompt_preset_revisions
+		WHERE preset_id = $1
+		ORDER BY revision DESC
+		LIMIT 1
+	`, preset.ID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && latest.Name == preset.Name && latest.PromptText == preset.PromptText {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO prompt_preset_revisions (id, preset_id, revision, name, prompt_text, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, uuid.NewString(), preset.ID, latest.Revision+1, preset.Name, preset.PromptText, time.Now().UTC())
+	return err
+}
+
+func insertSystemPromptRevision(ctx context.Context, tx *sql.Tx, prompt domain.SystemPrompt) error {
+	latest, err := scanPromptRevision(tx.QueryRowContext(ctx, `
+		SELECT id, system_prompt_id, revision, '', prompt_text, created_at
+		FROM system_prompt_revisions
+		WHERE system_prompt_id = $1
+		ORDER BY revision DESC
+		LIMIT 1
+	`, prompt.ID))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && latest.PromptText == prompt.PromptText {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO system_prompt_revisions (id, system_prompt_id, revision, prompt_text, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.NewString(), prompt.ID, latest.Revision+1, prompt.PromptText, time.Now().UTC())
+	return err
+}
+
+// ListRevisions returns the preset's revisions, newest first.
+func (r *PromptPresetRepository) ListRevisions(ctx context.Context, presetID string) ([]domain.PromptRevision, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, preset_id, revision, name, prompt_text, created_at
+		FROM prompt_preset_revisions
+		WHERE preset_id = $1
+		ORDER BY revision DESC
+	`, presetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []domain.PromptRevision
+	for rows.Next() {
+		revision, err := scanPromptRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (r *PromptPresetRepository) GetRevision(ctx context.Context, presetID string, revision int) (domain.PromptRevision, error) {
+	return scanPromptRevision(r.db.QueryRowContext(ctx, `
+		SELECT id, preset_id, revision, name, prompt_text, created_at
+		FROM prompt_preset_revisions
+		WHERE preset_id = $1 AND revision = $2
+	`, presetID, revision))
+}
+
+// ListRevisions returns the system prompt's revisions, newest first.
+func (r *SystemPromptRepository) ListRevisions(ctx context.Context, promptID string) ([]domain.PromptRevision, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, system_prompt_id, revision, '', prompt_text, created_at
+		FROM system_prompt_revisions
+		WHERE system_prompt_id = $1
+		ORDER BY revision DESC
+	`, promptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []domain.PromptRevision
+	for rows.Next() {
+		revision, err := scanPromptRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (r *SystemPromptRepository) GetRevision(ctx context.Context, promptID string, revision int) (domain.PromptRevision, error) {
+	return scanPromptRevision(r.db.QueryRowContext(ctx, `
+		SELECT id, system_prompt_id, revision, '', prompt_text, created_at
+		FROM system_prompt_revisions
+		WHERE system_prompt_id = $1 AND revision = $2
+	`, promptID, revision))
+}
+
+func scanPromptRevision(row rowScanner) (domain.PromptRevision, error) {
+	var revision domain.PromptRevision
+	if err := row.Scan(&revision.ID, &revision.PromptID, &revision.Revision, &revision.Name, &revision.PromptText, &revision.CreatedAt); err != nil {
+		return domain.PromptRevision{}, err
+	}
+	return revision, nil
+}
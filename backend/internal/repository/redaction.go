@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type RedactionRepository struct {
+	db *sql.DB
+}
+
+func NewRedactionRepository(db *sql.DB) *RedactionRepository {
+	return &RedactionRepository{db: db}
+}
+
+func (r *RedactionRepository) GetSetting(ctx context.Context, userID string) (domain.RedactionSetting, error) {
+	var setting domain.RedactionSetting
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, enabled, updated_at
+		FROM user_redaction_settings
+		WHERE user_id = $1
+	`, userID).Scan(&setting.UserID, &setting.Enabled, &setting.UpdatedAt)
+	if err != nil {
+		return domain.RedactionSetting{}, err
+	}
+	return setting, nil
+}
+
+func (r *RedactionRepository) SetEnabled(ctx context.Context, userID string, enabled bool) (domain.RedactionSetting, error) {
+	var setting domain.RedactionSetting
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO user_redaction_settings (user_id, enabled, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id)
+		DO UPDATE SET enabled = EXCLUDED.enabled,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING user_id, enabled, updated_at
+	`, userID, enabled, time.Now().UTC()).Scan(&setting.UserID, &setting.Enabled, &setting.UpdatedAt)
+	if err != nil {
+		return domain.RedactionSetting{}, err
+	}
+	return setting, nil
+}
+
+func (r *RedactionRepository) ListRules(ctx context.Context, userID string) ([]domain.RedactionRule, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, name, pattern, created_at, updated_at
+		FROM user_redaction_rules
+		WHERE user_id = $1
+		ORDER BY name ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []domain.RedactionRule
+	for rows.Next() {
+		rule, err := scanRedactionRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *RedactionRepository) UpsertRule(ctx context.Context, userID, name, pattern string) (domain.RedactionRule, error) {
+	now := time.Now().UTC()
+	return scanRedactionRule(r.db.QueryRowContext(ctx, `
+		INSERT INTO user_redaction_rules (id, user_id, name, pattern, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, name)
+		DO UPDATE SET pattern = EXCLUDED.pattern,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING id, user_id, name, pattern, created_at, updated_at
+	`, uuid.NewString(), userID, name, pattern, now, now))
+}
+
+func (r *RedactionRepository) DeleteRule(ctx context.Context, userID, name string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_redaction_rules WHERE user_id = $1 AND name = $2`, userID, name)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanRedactionRule(row rowScanner) (domain.RedactionRule, error) {
+	var rule domain.RedactionRule
+	if err := row.Scan(&rule.ID, &rule.UserID, &rule.Name, &rule.Pattern, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return domain.RedactionRule{}, err
+	}
+	return rule, nil
+}
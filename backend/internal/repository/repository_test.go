@@ -0,0 +1,66 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Juicern/luma/internal/config"
+	"github.com/Juicern/luma/internal/repository"
+	"github.com/Juicern/luma/internal/repository/repotest"
+	"github.com/Juicern/luma/internal/storage"
+)
+
+// TestSQLiteConformance runs the suite against a fresh SQLite file.
+func TestSQLiteConformance(t *testing.T) {
+	db := openDatabase(t, "sqlite://"+filepath.Join(t.TempDir(), "luma.db"))
+	repotest.Run(t, func(t *testing.T) repotest.Stores { return sqlStores(db) })
+}
+
+// TestPostgresConformance runs the suite against the database named by
+// LUMA_TEST_POSTGRES_DSN. The suite only adds rows, so a shared development
+// database works, but a dedicated one is tidier.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("LUMA_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LUMA_TEST_POSTGRES_DSN is not set")
+	}
+	db := openDatabase(t, dsn)
+	repotest.Run(t, func(t *testing.T) repotest.Stores { return sqlStores(db) })
+}
+
+func openDatabase(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+	db, err := storage.NewDatabase(ctx, config.DatabaseConfig{DSN: dsn})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := storage.RunMigrations(ctx, db); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return db
+}
+
+func sqlStores(db *sql.DB) repotest.Stores {
+	return repotest.Stores{
+		Users:            repository.NewUserRepository(db),
+		Sessions:         repository.NewUserSessionRepository(db),
+		Identities:       repository.NewUserIdentityRepository(db),
+		PasswordResets:   repository.NewPasswordResetRepository(db),
+		LoginAttempts:    repository.NewLoginAttemptRepository(db),
+		AuditEvents:      repository.NewAuditEventRepository(db),
+		APIKeys:          repository.NewAPIKeyRepository(db),
+		Presets:          repository.NewPromptPresetRepository(db),
+		SystemPrompts:    repository.NewSystemPromptRepository(db),
+		UserPrompts:      repository.NewUserSystemPromptRepository(db),
+		Redaction:        repository.NewRedactionRepository(db),
+		Fallbacks:        repository.NewFallbackChainRepository(db),
+		Variables:        repository.NewUserVariableRepository(db),
+		Workspaces:       repository.NewWorkspaceRepository(db),
+		TranscriptionLog: repository.NewTranscriptionLogRepository(db),
+	}
+}
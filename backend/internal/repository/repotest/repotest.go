@@ -0,0 +1,1089 @@
+// Package repotest is a conformance suite for the repository interfaces. Every
+// implementation runs the same checks, so the in-memory stores used in tests
+// cannot drift from the SQL ones.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository"
+)
+
+// Stores is one implementation of every repository, sharing one backend.
+type Stores struct {
+	Users            repository.UserStore
+	Sessions         repository.UserSessionStore
+	Identities       repository.UserIdentityStore
+	PasswordResets   repository.PasswordResetStore
+	LoginAttempts    repository.LoginAttemptStore
+	AuditEvents      repository.AuditEventStore
+	APIKeys          repository.APIKeyStore
+	Presets          repository.PromptPresetStore
+	SystemPrompts    repository.SystemPromptStore
+	UserPrompts      repository.UserSystemPromptStore
+	Redaction        repository.RedactionStore
+	Fallbacks        repository.FallbackChainStore
+	Variables        repository.UserVariableStore
+	Workspaces       repository.WorkspaceStore
+	TranscriptionLog repository.TranscriptionLogStore
+}
+
+// Run runs the suite. newStores is called once per subtest. The backend may
+// be shared between subtests and may already hold data (the SQL baseline
+// seeds a local user), so every check works on rows it created itself.
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Stores)
+	}{
+		{"Users", testUsers},
+		{"UserDeleteCascades", testUserDeleteCascades},
+		{"Sessions", testSessions},
+		{"Identities", testIdentities},
+		{"PasswordResets", testPasswordResets},
+		{"LoginAttempts", testLoginAttempts},
+		{"AuditEvents", testAuditEvents},
+		{"APIKeys", testAPIKeys},
+		{"Presets", testPresets},
+		{"PresetRevisions", testPresetRevisions},
+		{"SystemPrompts", testSystemPrompts},
+		{"UserSystemPrompts", testUserSystemPrompts},
+		{"Redaction", testRedaction},
+		{"FallbackChains", testFallbackChains},
+		{"Variables", testVariables},
+		{"Workspaces", testWorkspaces},
+		{"WorkspaceContent", testWorkspaceContent},
+		{"TranscriptionLogs", testTranscriptionLogs},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStores(t))
+		})
+	}
+}
+
+func newUser(t *testing.T, s Stores) domain.User {
+	t.Helper()
+	user, err := s.Users.Create(context.Background(), "Test User", uuid.NewString()+"@example.com", "hash", domain.UserRoleMember)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func wantNoRows(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got %v, want sql.ErrNoRows", err)
+	}
+}
+
+// pause separates timestamps so that ordering by creation time is
+// well-defined on backends with coarse clocks.
+func pause() {
+	time.Sleep(5 * time.Millisecond)
+}
+
+func testUsers(t *testing.T, s Stores) {
+	ctx := context.Background()
+	admins, err := s.Users.CountByRole(ctx, domain.UserRoleAdmin)
+	must(t, err)
+
+	user := newUser(t, s)
+	got, err := s.Users.Get(ctx, user.ID)
+	must(t, err)
+	if got.Email != user.Email || got.Role != domain.UserRoleMember || got.PasswordHash != "hash" {
+		t.Fatalf("Get = %+v, want %+v", got, user)
+	}
+	byEmail, err := s.Users.GetByEmail(ctx, user.Email)
+	must(t, err)
+	if byEmail.ID != user.ID {
+		t.Fatalf("GetByEmail returned %s, want %s", byEmail.ID, user.ID)
+	}
+	if _, err := s.Users.Create(ctx, "Duplicate", user.Email, "hash", domain.UserRoleMember); err == nil {
+		t.Fatal("creating a user with a taken email succeeded")
+	}
+	_, err = s.Users.GetByEmail(ctx, uuid.NewString()+"@example.com")
+	wantNoRows(t, err)
+	_, err = s.Users.Get(ctx, uuid.NewString())
+	wantNoRows(t, err)
+
+	pause()
+	second := newUser(t, s)
+	users, err := s.Users.List(ctx)
+	must(t, err)
+	first, last := -1, -1
+	for i, u := range users {
+		switch u.ID {
+		case user.ID:
+			first = i
+		case second.ID:
+			last = i
+		}
+	}
+	if first < 0 || last < 0 || first > last {
+		t.Fatalf("List positions = %d, %d; want both present, oldest first", first, last)
+	}
+
+	must(t, s.Users.SetRole(ctx, user.ID, domain.UserRoleAdmin))
+	count, err := s.Users.CountByRole(ctx, domain.UserRoleAdmin)
+	must(t, err)
+	if count != admins+1 {
+		t.Fatalf("CountByRole = %d, want %d", count, admins+1)
+	}
+	wantNoRows(t, s.Users.SetRole(ctx, uuid.NewString(), domain.UserRoleAdmin))
+
+	must(t, s.Users.UpdatePassword(ctx, user.ID, "new-hash"))
+	got, err = s.Users.Get(ctx, user.ID)
+	must(t, err)
+	if got.PasswordHash != "new-hash" || got.Role != domain.UserRoleAdmin {
+		t.Fatalf("after updates Get = %+v", got)
+	}
+	wantNoRows(t, s.Users.UpdatePassword(ctx, uuid.NewString(), "hash"))
+
+	must(t, s.Users.Delete(ctx, user.ID))
+	_, err = s.Users.Get(ctx, user.ID)
+	wantNoRows(t, err)
+	wantNoRows(t, s.Users.Delete(ctx, user.ID))
+}
+
+func testUserDeleteCascades(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	token := uuid.NewString()
+	issuer := "https://" + uuid.NewString() + ".example.com"
+	_, err := s.Sessions.Create(ctx, user.ID, token, "agent", "127.0.0.1", time.Now().Add(time.Hour))
+	must(t, err)
+	_, err = s.Identities.Create(ctx, user.ID, issuer, "subject", user.Email)
+	must(t, err)
+	reset := uuid.NewString()
+	_, err = s.PasswordResets.Create(ctx, user.ID, reset, time.Now().Add(time.Hour))
+	must(t, err)
+	_, err = s.APIKeys.Upsert(ctx, user.ID, "openai", "default", "secret", false)
+	must(t, err)
+	preset, err := s.Presets.Create(ctx, user.ID, "Preset", "text", nil, domain.GenerationSettings{})
+	must(t, err)
+	entry, err := s.TranscriptionLog.Create(ctx, user.ID, "transcribe", "hello", 1, nil)
+	must(t, err)
+	_, err = s.Variables.Upsert(ctx, user.ID, "signature", "Best, Test")
+	must(t, err)
+	workspace, err := s.Workspaces.Create(ctx, "Team", user.ID)
+	must(t, err)
+	_, err = s.UserPrompts.Upsert(ctx, user.ID, domain.SystemPromptAppend, "Reply in Chinese.")
+	must(t, err)
+	_, err = s.Redaction.SetEnabled(ctx, user.ID, true)
+	must(t, err)
+	_, err = s.Redaction.UpsertRule(ctx, user.ID, "ticket", `TICKET-\d+`)
+	must(t, err)
+	_, err = s.Fallbacks.Upsert(ctx, user.ID, []string{"ollama"})
+	must(t, err)
+
+	must(t, s.Users.Delete(ctx, user.ID))
+
+	_, err = s.Sessions.GetByTokenHash(ctx, token)
+	wantNoRows(t, err)
+	_, err = s.Identities.Get(ctx, issuer, "subject")
+	wantNoRows(t, err)
+	_, err = s.PasswordResets.Consume(ctx, reset)
+	wantNoRows(t, err)
+	_, err = s.APIKeys.GetDefault(ctx, user.ID, "openai")
+	wantNoRows(t, err)
+	_, err = s.Presets.Get(ctx, preset.ID)
+	wantNoRows(t, err)
+	_, err = s.TranscriptionLog.GetByID(ctx, user.ID, entry.ID)
+	wantNoRows(t, err)
+	variables, err := s.Variables.List(ctx, user.ID)
+	must(t, err)
+	if len(variables) != 0 {
+		t.Fatalf("deleting a user left %d variables", len(variables))
+	}
+	_, err = s.Workspaces.GetMember(ctx, workspace.ID, user.ID)
+	wantNoRows(t, err)
+	_, err = s.UserPrompts.Get(ctx, user.ID)
+	wantNoRows(t, err)
+	_, err = s.Redaction.GetSetting(ctx, user.ID)
+	wantNoRows(t, err)
+	rules, err := s.Redaction.ListRules(ctx, user.ID)
+	must(t, err)
+	if len(rules) != 0 {
+		t.Fatalf("deleting a user left %d redaction rules", len(rules))
+	}
+	_, err = s.Fallbacks.Get(ctx, user.ID)
+	wantNoRows(t, err)
+}
+
+func testSessions(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+	now := time.Now()
+
+	first, err := s.Sessions.Create(ctx, user.ID, uuid.NewString(), "agent", "127.0.0.1", now.Add(time.Hour))
+	must(t, err)
+	pause()
+	second, err := s.Sessions.Create(ctx, user.ID, uuid.NewString(), "agent", "127.0.0.1", now.Add(time.Hour))
+	must(t, err)
+	expired, err := s.Sessions.Create(ctx, user.ID, uuid.NewString(), "agent", "127.0.0.1", now.Add(-time.Minute))
+	must(t, err)
+	if _, err := s.Sessions.Create(ctx, other.ID, first.TokenHash, "agent", "127.0.0.1", now.Add(time.Hour)); err == nil {
+		t.Fatal("creating a session with a taken token hash succeeded")
+	}
+
+	got, err := s.Sessions.GetByTokenHash(ctx, first.TokenHash)
+	must(t, err)
+	if got.ID != first.ID || got.UserID != user.ID || got.UserAgent != "agent" || got.IPAddress != "127.0.0.1" {
+		t.Fatalf("GetByTokenHash = %+v, want %+v", got, first)
+	}
+	_, err = s.Sessions.GetByTokenHash(ctx, uuid.NewString())
+	wantNoRows(t, err)
+
+	sessions, err := s.Sessions.ListByUser(ctx, user.ID)
+	must(t, err)
+	if len(sessions) != 2 || sessions[0].ID != second.ID || sessions[1].ID != first.ID {
+		t.Fatalf("ListByUser = %v, want [%s %s] (most recently used first, expired omitted)", sessionIDs(sessions), second.ID, first.ID)
+	}
+
+	pause()
+	extended := now.Add(2 * time.Hour)
+	must(t, s.Sessions.Touch(ctx, first.ID, extended))
+	got, err = s.Sessions.GetByTokenHash(ctx, first.TokenHash)
+	must(t, err)
+	if got.ExpiresAt.Sub(extended).Abs() > time.Second {
+		t.Fatalf("Touch set expiry %v, want %v", got.ExpiresAt, extended)
+	}
+	sessions, err = s.Sessions.ListByUser(ctx, user.ID)
+	must(t, err)
+	if len(sessions) != 2 || sessions[0].ID != first.ID {
+		t.Fatalf("after Touch ListByUser = %v, want %s first", sessionIDs(sessions), first.ID)
+	}
+
+	wantNoRows(t, s.Sessions.Delete(ctx, other.ID, first.ID))
+	must(t, s.Sessions.Delete(ctx, user.ID, second.ID))
+	wantNoRows(t, s.Sessions.Delete(ctx, user.ID, second.ID))
+
+	purged, err := s.Sessions.DeleteExpired(ctx, now)
+	must(t, err)
+	if purged < 1 {
+		t.Fatalf("DeleteExpired purged %d sessions, want at least 1", purged)
+	}
+	_, err = s.Sessions.GetByTokenHash(ctx, expired.TokenHash)
+	wantNoRows(t, err)
+
+	third, err := s.Sessions.Create(ctx, user.ID, uuid.NewString(), "agent", "127.0.0.1", now.Add(time.Hour))
+	must(t, err)
+	must(t, s.Sessions.DeleteByUser(ctx, user.ID, third.ID))
+	sessions, err = s.Sessions.ListByUser(ctx, user.ID)
+	must(t, err)
+	if len(sessions) != 1 || sessions[0].ID != third.ID {
+		t.Fatalf("after DeleteByUser ListByUser = %v, want [%s]", sessionIDs(sessions), third.ID)
+	}
+
+	must(t, s.Sessions.DeleteByTokenHash(ctx, third.TokenHash))
+	_, err = s.Sessions.GetByTokenHash(ctx, third.TokenHash)
+	wantNoRows(t, err)
+}
+
+func sessionIDs(sessions []domain.UserSession) []string {
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	return ids
+}
+
+func testIdentities(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	issuer := "https://" + uuid.NewString() + ".example.com"
+
+	identity, err := s.Identities.Create(ctx, user.ID, issuer, "subject", "old@example.com")
+	must(t, err)
+	if _, err := s.Identities.Create(ctx, user.ID, issuer, "subject", "old@example.com"); err == nil {
+		t.Fatal("linking the same issuer and subject twice succeeded")
+	}
+	_, err = s.Identities.Create(ctx, user.ID, issuer, "other-subject", "old@example.com")
+	must(t, err)
+
+	must(t, s.Identities.Touch(ctx, identity.ID, "new@example.com"))
+	got, err := s.Identities.Get(ctx, issuer, "subject")
+	must(t, err)
+	if got.ID != identity.ID || got.UserID != user.ID || got.Email != "new@example.com" {
+		t.Fatalf("Get = %+v", got)
+	}
+	_, err = s.Identities.Get(ctx, issuer, "missing")
+	wantNoRows(t, err)
+}
+
+func testPasswordResets(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	token := uuid.NewString()
+	_, err := s.PasswordResets.Create(ctx, user.ID, token, time.Now().Add(time.Hour))
+	must(t, err)
+	userID, err := s.PasswordResets.Consume(ctx, token)
+	must(t, err)
+	if userID != user.ID {
+		t.Fatalf("Consume = %s, want %s", userID, user.ID)
+	}
+	_, err = s.PasswordResets.Consume(ctx, token)
+	wantNoRows(t, err)
+
+	expired := uuid.NewString()
+	_, err = s.PasswordResets.Create(ctx, user.ID, expired, time.Now().Add(-time.Minute))
+	must(t, err)
+	_, err = s.PasswordResets.Consume(ctx, expired)
+	wantNoRows(t, err)
+	_, err = s.PasswordResets.Consume(ctx, uuid.NewString())
+	wantNoRows(t, err)
+}
+
+func testLoginAttempts(t *testing.T, s Stores) {
+	ctx := context.Background()
+	key := "account:" + uuid.NewString()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	attempt, err := s.LoginAttempts.Get(ctx, key)
+	must(t, err)
+	if attempt.Key != key || attempt.Failures != 0 || attempt.LockedUntil != nil {
+		t.Fatalf("Get on unknown key = %+v, want an empty record", attempt)
+	}
+
+	for want := 1; want <= 3; want++ {
+		attempt, err = s.LoginAttempts.RecordFailure(ctx, key, now, now.Add(-time.Hour))
+		must(t, err)
+		if attempt.Failures != want {
+			t.Fatalf("RecordFailure #%d counted %d failures", want, attempt.Failures)
+		}
+	}
+
+	until := now.Add(time.Minute)
+	must(t, s.LoginAttempts.Lock(ctx, key, until))
+	attempt, err = s.LoginAttempts.Get(ctx, key)
+	must(t, err)
+	if attempt.Failures != 3 || attempt.LockedUntil == nil || !attempt.LockedUntil.Equal(until) {
+		t.Fatalf("after Lock Get = %+v, want 3 failures locked until %v", attempt, until)
+	}
+
+	// A failure after the window restarts the count.
+	later := now.Add(2 * time.Hour)
+	attempt, err = s.LoginAttempts.RecordFailure(ctx, key, later, later.Add(-time.Hour))
+	must(t, err)
+	if attempt.Failures != 1 || !attempt.LastFailureAt.Equal(later) {
+		t.Fatalf("RecordFailure after the window = %+v, want 1 failure at %v", attempt, later)
+	}
+
+	must(t, s.LoginAttempts.Reset(ctx, key))
+	attempt, err = s.LoginAttempts.Get(ctx, key)
+	must(t, err)
+	if attempt.Failures != 0 || attempt.LockedUntil != nil {
+		t.Fatalf("after Reset Get = %+v, want an empty record", attempt)
+	}
+}
+
+func testAuditEvents(t *testing.T, s Stores) {
+	ctx := context.Background()
+	actor := uuid.NewString()
+	subject := uuid.NewString()
+	base := time.Now().UTC().Truncate(time.Second)
+
+	events := []domain.AuditEvent{
+		{Action: domain.AuditLogin, ActorUserID: actor, SubjectUserID: actor},
+		{Action: domain.AuditUserRoleChanged, ActorUserID: actor, SubjectUserID: subject, TargetType: "user", TargetID: subject, Metadata: map[string]string{"from": "member", "to": "admin"}},
+		{Action: domain.AuditLoginFailed, SubjectUserID: subject, IPAddress: "10.0.0.1", UserAgent: "curl"},
+		{Action: domain.AuditLogout, ActorUserID: actor, SubjectUserID: actor},
+	}
+	for i := range events {
+		events[i].ID = uuid.NewString()
+		events[i].CreatedAt = base.Add(time.Duration(i) * time.Second)
+		must(t, s.AuditEvents.Create(ctx, events[i]))
+	}
+
+	list := func(filter domain.AuditFilter) []string {
+		t.Helper()
+		if filter.Limit == 0 {
+			filter.Limit = 50
+		}
+		got, err := s.AuditEvents.List(ctx, filter)
+		must(t, err)
+		ids := make([]string, len(got))
+		for i, event := range got {
+			ids[i] = event.ID
+		}
+		return ids
+	}
+	want := func(name string, got []string, indexes ...int) {
+		t.Helper()
+		if len(got) != len(indexes) {
+			t.Fatalf("%s returned %d events, want %d", name, len(got), len(indexes))
+		}
+		for i, index := range indexes {
+			if got[i] != events[index].ID {
+				t.Fatalf("%s[%d] = %s, want event %d", name, i, got[i], index)
+			}
+		}
+	}
+
+	want("actor", list(domain.AuditFilter{ActorUserID: actor}), 3, 1, 0)
+	want("user", list(domain.AuditFilter{UserID: subject}), 2, 1)
+	want("action", list(domain.AuditFilter{UserID: actor, Action: string(domain.AuditLogin)}), 0)
+	want("action prefix", list(domain.AuditFilter{UserID: actor, Action: "auth.*"}), 3, 0)
+	want("since", list(domain.AuditFilter{UserID: actor, Since: base.Add(time.Second)}), 3, 1)
+	want("until", list(domain.AuditFilter{UserID: actor, Until: base.Add(3 * time.Second)}), 1, 0)
+
+	page := list(domain.AuditFilter{ActorUserID: actor, Limit: 2})
+	want("first page", page, 3, 1)
+	want("second page", list(domain.AuditFilter{ActorUserID: actor, Limit: 2, Before: page[1]}), 0)
+
+	got, err := s.AuditEvents.List(ctx, domain.AuditFilter{UserID: subject, Action: string(domain.AuditUserRoleChanged), Limit: 1})
+	must(t, err)
+	if len(got) != 1 || got[0].Metadata["to"] != "admin" || got[0].TargetID != subject || !got[0].CreatedAt.Equal(events[1].CreatedAt) {
+		t.Fatalf("List returned %+v, want event 1 with its metadata", got)
+	}
+}
+
+func testAPIKeys(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	first, err := s.APIKeys.Upsert(ctx, user.ID, "openai", "work", "enc-1", false)
+	must(t, err)
+	if !first.IsDefault {
+		t.Fatal("the first key for a provider did not become the default")
+	}
+	pause()
+	second, err := s.APIKeys.Upsert(ctx, user.ID, "openai", "personal", "enc-2", false)
+	must(t, err)
+	if second.IsDefault {
+		t.Fatal("a later key took over the default without makeDefault")
+	}
+	pause()
+	third, err := s.APIKeys.Upsert(ctx, user.ID, "openai", "spare", "enc-3", true)
+	must(t, err)
+	if !third.IsDefault {
+		t.Fatal("makeDefault did not make the key the default")
+	}
+	_, err = s.APIKeys.Upsert(ctx, user.ID, "anthropic", "default", "enc-4", false)
+	must(t, err)
+
+	updated, err := s.APIKeys.Upsert(ctx, user.ID, "openai", "work", "enc-1b", false)
+	must(t, err)
+	if updated.ID != first.ID || updated.EncryptedKey != "enc-1b" || updated.IsDefault {
+		t.Fatalf("updating an existing label = %+v", updated)
+	}
+
+	keys, err := s.APIKeys.List(ctx, user.ID)
+	must(t, err)
+	if got := keyLabels(keys); !equal(got, []string{"anthropic/default", "openai/spare", "openai/personal", "openai/work"}) {
+		t.Fatalf("List = %v", got)
+	}
+	keys, err = s.APIKeys.ListByProvider(ctx, user.ID, "openai")
+	must(t, err)
+	if got := keyLabels(keys); !equal(got, []string{"openai/spare", "openai/work", "openai/personal"}) {
+		t.Fatalf("ListByProvider = %v", got)
+	}
+
+	must(t, s.APIKeys.SetDefault(ctx, user.ID, "openai", "personal"))
+	def, err := s.APIKeys.GetDefault(ctx, user.ID, "openai")
+	must(t, err)
+	if def.ID != second.ID {
+		t.Fatalf("GetDefault = %s, want %s", def.Label, second.Label)
+	}
+	wantNoRows(t, s.APIKeys.SetDefault(ctx, user.ID, "openai", "missing"))
+
+	// Deleting the default promotes the oldest remaining key.
+	must(t, s.APIKeys.Delete(ctx, user.ID, "openai", "personal"))
+	def, err = s.APIKeys.GetDefault(ctx, user.ID, "openai")
+	must(t, err)
+	if def.ID != first.ID {
+		t.Fatalf("after deleting the default GetDefault = %s, want %s", def.Label, first.Label)
+	}
+	byLabel, err := s.APIKeys.GetByLabel(ctx, user.ID, "openai", "spare")
+	must(t, err)
+	if byLabel.ID != third.ID || byLabel.EncryptedKey != "enc-3" {
+		t.Fatalf("GetByLabel = %+v", byLabel)
+	}
+	_, err = s.APIKeys.GetByLabel(ctx, user.ID, "openai", "personal")
+	wantNoRows(t, err)
+
+	must(t, s.APIKeys.Delete(ctx, user.ID, "openai", ""))
+	keys, err = s.APIKeys.ListByProvider(ctx, user.ID, "openai")
+	must(t, err)
+	if len(keys) != 0 {
+		t.Fatalf("after deleting every openai key ListByProvider = %v", keyLabels(keys))
+	}
+	_, err = s.APIKeys.GetDefault(ctx, user.ID, "openai")
+	wantNoRows(t, err)
+	_, err = s.APIKeys.GetDefault(ctx, user.ID, "anthropic")
+	must(t, err)
+}
+
+func keyLabels(keys []domain.APIKey) []string {
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		labels[i] = key.ProviderName + "/" + key.Label
+	}
+	return labels
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testPresets(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	plain, err := s.Presets.Create(ctx, user.ID, "Plain", "Be brief.", nil, domain.GenerationSettings{})
+	must(t, err)
+	if plain.TemplateKey != nil {
+		t.Fatalf("Create without a template set TemplateKey %q", *plain.TemplateKey)
+	}
+	pause()
+	key := "email"
+	templated, err := s.Presets.Create(ctx, user.ID, "Email", "Write an email.", &key, domain.GenerationSettings{})
+	must(t, err)
+	again, err := s.Presets.Create(ctx, user.ID, "Email v2", "Write a short email.", &key, domain.GenerationSettings{Model: "gpt-4o"})
+	must(t, err)
+	if again.ID != templated.ID || again.Name != "Email v2" || again.PromptText != "Write a short email." {
+		t.Fatalf("re-creating a template preset = %+v, want an update of %s", again, templated.ID)
+	}
+	_, err = s.Presets.Create(ctx, other.ID, "Email", "Write an email.", &key, domain.GenerationSettings{})
+	must(t, err)
+
+	presets, err := s.Presets.List(ctx, user.ID)
+	must(t, err)
+	if len(presets) != 2 || presets[0].ID != templated.ID || presets[1].ID != plain.ID {
+		t.Fatalf("List returned %d presets, want [templated plain]", len(presets))
+	}
+	if presets[0].TemplateKey == nil || *presets[0].TemplateKey != key {
+		t.Fatalf("List lost the template key: %+v", presets[0])
+	}
+
+	upgraded, err := s.Presets.UpsertTemplate(ctx, domain.PromptPreset{
+		UserID: user.ID, Name: "Email", PromptText: "Write a polite email.",
+		TemplateKey: &key, TemplateVersion: 2, TemplateChecksum: "sum-2",
+	})
+	must(t, err)
+	if upgraded.ID != templated.ID || upgraded.PromptText != "Write a polite email." || upgraded.TemplateVersion != 2 || upgraded.TemplateChecksum != "sum-2" {
+		t.Fatalf("UpsertTemplate over an installed template = %+v, want an update of %s", upgraded, templated.ID)
+	}
+	if upgraded.Model != "gpt-4o" {
+		t.Fatalf("UpsertTemplate reset the generation settings: %+v", upgraded.GenerationSettings)
+	}
+	fresh := "fresh"
+	installed, err := s.Presets.UpsertTemplate(ctx, domain.PromptPreset{
+		UserID: user.ID, Name: "Fresh", PromptText: "text", TemplateKey: &fresh, TemplateVersion: 1, TemplateChecksum: "sum-1",
+	})
+	must(t, err)
+	got, err := s.Presets.Get(ctx, installed.ID)
+	must(t, err)
+	if got.TemplateKey == nil || *got.TemplateKey != fresh || got.TemplateVersion != 1 || got.TemplateChecksum != "sum-1" {
+		t.Fatalf("Get after UpsertTemplate = %+v", got)
+	}
+	must(t, s.Presets.Delete(ctx, installed.ID, user.ID))
+
+	temperature, maxTokens, topP, redact := 0.0, 256, 0.9, true
+	literal := domain.GenerationSettings{Provider: "openai", Model: "gpt-4o-mini", Temperature: &temperature, MaxTokens: &maxTokens, TopP: &topP, RedactPII: &redact,
+		Postprocess: []string{"strip_quotes", "numerals"}, OutputFormat: domain.OutputEmail, Fallback: []string{"anthropic/claude-3-5-haiku-latest", "ollama"}}
+	renamed, err := s.Presets.Update(ctx, plain.ID, user.ID, "Renamed", "Be very brief.", nil, literal)
+	must(t, err)
+	if renamed.Name != "Renamed" || renamed.PromptText != "Be very brief." {
+		t.Fatalf("Update = %+v", renamed)
+	}
+	got, err = s.Presets.Get(ctx, plain.ID)
+	must(t, err)
+	if settings := got.GenerationSettings; settings.Provider != "openai" || settings.Model != "gpt-4o-mini" ||
+		settings.Temperature == nil || *settings.Temperature != 0 || settings.MaxTokens == nil || *settings.MaxTokens != 256 ||
+		settings.TopP == nil || *settings.TopP != 0.9 || settings.RedactPII == nil || !*settings.RedactPII ||
+		!slices.Equal(settings.Postprocess, []string{"strip_quotes", "numerals"}) || settings.OutputFormat != domain.OutputEmail ||
+		!slices.Equal(settings.Fallback, []string{"anthropic/claude-3-5-haiku-latest", "ollama"}) {
+		t.Fatalf("Get after Update lost the generation settings: %+v", settings)
+	}
+	_, err = s.Presets.Update(ctx, plain.ID, other.ID, "Stolen", "text", nil, domain.GenerationSettings{})
+	wantNoRows(t, err)
+	got, err = s.Presets.Get(ctx, plain.ID)
+	must(t, err)
+	if got.Name != "Renamed" {
+		t.Fatalf("Get after Update = %+v", got)
+	}
+
+	wantNoRows(t, s.Presets.Delete(ctx, plain.ID, other.ID))
+	must(t, s.Presets.Delete(ctx, plain.ID, user.ID))
+	_, err = s.Presets.Get(ctx, plain.ID)
+	wantNoRows(t, err)
+	wantNoRows(t, s.Presets.Delete(ctx, plain.ID, user.ID))
+}
+
+func testPresetRevisions(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+
+	preset, err := s.Presets.Create(ctx, user.ID, "Notes", "First.", nil, domain.GenerationSettings{})
+	must(t, err)
+	_, err = s.Presets.Update(ctx, preset.ID, user.ID, "Notes", "Second.", nil, domain.GenerationSettings{})
+	must(t, err)
+	// Saving without changes adds no revision.
+	_, err = s.Presets.Update(ctx, preset.ID, user.ID, "Notes", "Second.", nil, domain.GenerationSettings{})
+	must(t, err)
+	_, err = s.Presets.Update(ctx, preset.ID, user.ID, "Meeting notes", "Second.", nil, domain.GenerationSettings{})
+	must(t, err)
+
+	revisions, err := s.Presets.ListRevisions(ctx, preset.ID)
+	must(t, err)
+	if len(revisions) != 3 {
+		t.Fatalf("ListRevisions returned %d revisions, want 3", len(revisions))
+	}
+	for i, want := range []struct {
+		revision   int
+		name, text string
+	}{{3, "Meeting notes", "Second."}, {2, "Notes", "Second."}, {1, "Notes", "First."}} {
+		got := revisions[i]
+		if got.Revision != want.revision || got.Name != want.name || got.PromptText != want.text || got.PromptID != preset.ID {
+			t.Fatalf("revision %d = %+v, want %+v", i, got, want)
+		}
+	}
+	first, err := s.Presets.GetRevision(ctx, preset.ID, 1)
+	must(t, err)
+	if first.PromptText != "First." {
+		t.Fatalf("GetRevision(1) = %+v", first)
+	}
+	_, err = s.Presets.GetRevision(ctx, preset.ID, 4)
+	wantNoRows(t, err)
+
+	key := "revisions-" + uuid.NewString()
+	templated, err := s.Presets.UpsertTemplate(ctx, domain.PromptPreset{UserID: user.ID, Name: "Tmpl", PromptText: "v1", TemplateKey: &key, TemplateVersion: 1})
+	must(t, err)
+	_, err = s.Presets.UpsertTemplate(ctx, domain.PromptPreset{UserID: user.ID, Name: "Tmpl", PromptText: "v2", TemplateKey: &key, TemplateVersion: 2})
+	must(t, err)
+	revisions, err = s.Presets.ListRevisions(ctx, templated.ID)
+	must(t, err)
+	if len(revisions) != 2 || revisions[0].PromptText != "v2" {
+		t.Fatalf("template revisions = %+v, want v2 then v1", revisions)
+	}
+
+	must(t, s.Presets.Delete(ctx, preset.ID, user.ID))
+	revisions, err = s.Presets.ListRevisions(ctx, preset.ID)
+	must(t, err)
+	if len(revisions) != 0 {
+		t.Fatalf("deleting a preset left %d revisions", len(revisions))
+	}
+}
+
+func testSystemPrompts(t *testing.T, s Stores) {
+	ctx := context.Background()
+	text := "Be helpful. " + uuid.NewString()
+
+	created, err := s.SystemPrompts.Upsert(ctx, text)
+	must(t, err)
+	active, err := s.SystemPrompts.GetActive(ctx)
+	must(t, err)
+	if active.ID != created.ID || active.PromptText != text || !active.Active {
+		t.Fatalf("GetActive = %+v, want %+v", active, created)
+	}
+
+	updated, err := s.SystemPrompts.Upsert(ctx, text+" Updated.")
+	must(t, err)
+	if updated.ID != created.ID {
+		t.Fatalf("Upsert replaced the active prompt %s with %s", created.ID, updated.ID)
+	}
+	active, err = s.SystemPrompts.GetActive(ctx)
+	must(t, err)
+	if active.PromptText != text+" Updated." {
+		t.Fatalf("GetActive after update = %q", active.PromptText)
+	}
+
+	revisions, err := s.SystemPrompts.ListRevisions(ctx, created.ID)
+	must(t, err)
+	if len(revisions) < 2 || revisions[0].PromptText != text+" Updated." || revisions[1].PromptText != text {
+		t.Fatalf("ListRevisions did not end with the two saved texts: %+v", revisions)
+	}
+	latest, err := s.SystemPrompts.GetRevision(ctx, created.ID, revisions[0].Revision)
+	must(t, err)
+	if latest.ID != revisions[0].ID || latest.Revision != revisions[1].Revision+1 {
+		t.Fatalf("GetRevision = %+v, want %+v", latest, revisions[0])
+	}
+	_, err = s.SystemPrompts.GetRevision(ctx, created.ID, latest.Revision+1)
+	wantNoRows(t, err)
+}
+
+func testUserSystemPrompts(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	_, err := s.UserPrompts.Get(ctx, user.ID)
+	wantNoRows(t, err)
+	_, err = s.UserPrompts.Upsert(ctx, user.ID, domain.SystemPromptAppend, "Reply in Chinese.")
+	must(t, err)
+	_, err = s.UserPrompts.Upsert(ctx, other.ID, domain.SystemPromptAppend, "Be brief.")
+	must(t, err)
+
+	updated, err := s.UserPrompts.Upsert(ctx, user.ID, domain.SystemPromptReplace, "只输出改写后的消息。")
+	must(t, err)
+	prompt, err := s.UserPrompts.Get(ctx, user.ID)
+	must(t, err)
+	if prompt.Mode != domain.SystemPromptReplace || prompt.PromptText != "只输出改写后的消息。" || !prompt.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Fatalf("Get after Upsert = %+v, want %+v", prompt, updated)
+	}
+
+	must(t, s.UserPrompts.Delete(ctx, user.ID))
+	wantNoRows(t, s.UserPrompts.Delete(ctx, user.ID))
+	prompt, err = s.UserPrompts.Get(ctx, other.ID)
+	must(t, err)
+	if prompt.PromptText != "Be brief." {
+		t.Fatalf("another user's prompt changed: %+v", prompt)
+	}
+}
+
+func testRedaction(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	_, err := s.Redaction.GetSetting(ctx, user.ID)
+	wantNoRows(t, err)
+	_, err = s.Redaction.SetEnabled(ctx, user.ID, true)
+	must(t, err)
+	updated, err := s.Redaction.SetEnabled(ctx, user.ID, false)
+	must(t, err)
+	setting, err := s.Redaction.GetSetting(ctx, user.ID)
+	must(t, err)
+	if setting.Enabled || !setting.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Fatalf("GetSetting after SetEnabled = %+v, want %+v", setting, updated)
+	}
+
+	ticket, err := s.Redaction.UpsertRule(ctx, user.ID, "ticket", `TICKET-\d+`)
+	must(t, err)
+	_, err = s.Redaction.UpsertRule(ctx, user.ID, "employee_id", `E\d{6}`)
+	must(t, err)
+	_, err = s.Redaction.UpsertRule(ctx, other.ID, "ticket", `JIRA-\d+`)
+	must(t, err)
+	changed, err := s.Redaction.UpsertRule(ctx, user.ID, "ticket", `(TICKET|BUG)-\d+`)
+	must(t, err)
+	if changed.ID != ticket.ID || changed.Pattern != `(TICKET|BUG)-\d+` {
+		t.Fatalf("UpsertRule on an existing name = %+v, want ID %s", changed, ticket.ID)
+	}
+	rules, err := s.Redaction.ListRules(ctx, user.ID)
+	must(t, err)
+	if len(rules) != 2 || rules[0].Name != "employee_id" || rules[1].Name != "ticket" {
+		t.Fatalf("ListRules = %+v, want [employee_id, ticket]", rules)
+	}
+
+	must(t, s.Redaction.DeleteRule(ctx, user.ID, "ticket"))
+	wantNoRows(t, s.Redaction.DeleteRule(ctx, user.ID, "ticket"))
+	rules, err = s.Redaction.ListRules(ctx, other.ID)
+	must(t, err)
+	if len(rules) != 1 || rules[0].Pattern != `JIRA-\d+` {
+		t.Fatalf("another user's rules changed: %+v", rules)
+	}
+}
+
+func testFallbackChains(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	_, err := s.Fallbacks.Get(ctx, user.ID)
+	wantNoRows(t, err)
+	_, err = s.Fallbacks.Upsert(ctx, user.ID, []string{"openai/gpt-4o"})
+	must(t, err)
+	updated, err := s.Fallbacks.Upsert(ctx, user.ID, []string{"anthropic/claude-3-5-sonnet-latest", "ollama/llama3.2"})
+	must(t, err)
+	_, err = s.Fallbacks.Upsert(ctx, other.ID, []string{"none"})
+	must(t, err)
+	got, err := s.Fallbacks.Get(ctx, user.ID)
+	must(t, err)
+	if !slices.Equal(got.Chain, []string{"anthropic/claude-3-5-sonnet-latest", "ollama/llama3.2"}) || !got.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Fatalf("Get after Upsert = %+v, want %+v", got, updated)
+	}
+
+	must(t, s.Fallbacks.Delete(ctx, user.ID))
+	wantNoRows(t, s.Fallbacks.Delete(ctx, user.ID))
+	_, err = s.Fallbacks.Get(ctx, user.ID)
+	wantNoRows(t, err)
+	got, err = s.Fallbacks.Get(ctx, other.ID)
+	must(t, err)
+	if !slices.Equal(got.Chain, []string{"none"}) {
+		t.Fatalf("another user's chain changed: %+v", got)
+	}
+}
+
+func testVariables(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	signature, err := s.Variables.Upsert(ctx, user.ID, "signature", "Best, Ann")
+	must(t, err)
+	_, err = s.Variables.Upsert(ctx, user.ID, "company", "Acme")
+	must(t, err)
+	_, err = s.Variables.Upsert(ctx, other.ID, "signature", "Cheers, Bob")
+	must(t, err)
+
+	updated, err := s.Variables.Upsert(ctx, user.ID, "signature", "Regards, Ann")
+	must(t, err)
+	if updated.ID != signature.ID || updated.Value != "Regards, Ann" {
+		t.Fatalf("Upsert of an existing name = %+v, want an update of %s", updated, signature.ID)
+	}
+
+	variables, err := s.Variables.List(ctx, user.ID)
+	must(t, err)
+	if len(variables) != 2 || variables[0].Name != "company" || variables[1].Name != "signature" || variables[1].Value != "Regards, Ann" {
+		t.Fatalf("List = %+v, want company and signature sorted by name", variables)
+	}
+
+	must(t, s.Variables.Delete(ctx, user.ID, "company"))
+	wantNoRows(t, s.Variables.Delete(ctx, user.ID, "company"))
+	variables, err = s.Variables.List(ctx, other.ID)
+	must(t, err)
+	if len(variables) != 1 || variables[0].Value != "Cheers, Bob" {
+		t.Fatalf("another user's variables changed: %+v", variables)
+	}
+}
+
+func testWorkspaces(t *testing.T, s Stores) {
+	ctx := context.Background()
+	owner := newUser(t, s)
+	member := newUser(t, s)
+
+	beta, err := s.Workspaces.Create(ctx, "Beta", owner.ID)
+	must(t, err)
+	alpha, err := s.Workspaces.Create(ctx, "Alpha", owner.ID)
+	must(t, err)
+	got, err := s.Workspaces.Get(ctx, beta.ID)
+	must(t, err)
+	if got.Name != "Beta" {
+		t.Fatalf("Get = %+v", got)
+	}
+	_, err = s.Workspaces.Get(ctx, uuid.NewString())
+	wantNoRows(t, err)
+
+	creator, err := s.Workspaces.GetMember(ctx, beta.ID, owner.ID)
+	must(t, err)
+	if creator.Role != domain.WorkspaceRoleOwner {
+		t.Fatalf("Create made the creator %q, want owner", creator.Role)
+	}
+	memberships, err := s.Workspaces.ListForUser(ctx, owner.ID)
+	must(t, err)
+	if len(memberships) != 2 || memberships[0].ID != alpha.ID || memberships[1].ID != beta.ID || memberships[0].Role != domain.WorkspaceRoleOwner {
+		t.Fatalf("ListForUser = %+v, want [Alpha Beta] as owner", memberships)
+	}
+
+	pause()
+	_, err = s.Workspaces.SetMember(ctx, beta.ID, member.ID, domain.WorkspaceRoleMember)
+	must(t, err)
+	promoted, err := s.Workspaces.SetMember(ctx, beta.ID, member.ID, domain.WorkspaceRoleEditor)
+	must(t, err)
+	if promoted.Role != domain.WorkspaceRoleEditor {
+		t.Fatalf("SetMember on an existing member = %+v", promoted)
+	}
+	members, err := s.Workspaces.ListMembers(ctx, beta.ID)
+	must(t, err)
+	if len(members) != 2 || members[0].UserID != owner.ID || members[1].UserID != member.ID || members[1].Role != domain.WorkspaceRoleEditor {
+		t.Fatalf("ListMembers = %+v, want [owner editor]", members)
+	}
+	memberships, err = s.Workspaces.ListForUser(ctx, member.ID)
+	must(t, err)
+	if len(memberships) != 1 || memberships[0].ID != beta.ID || memberships[0].Role != domain.WorkspaceRoleEditor {
+		t.Fatalf("ListForUser for the new member = %+v", memberships)
+	}
+
+	must(t, s.Workspaces.RemoveMember(ctx, beta.ID, member.ID))
+	wantNoRows(t, s.Workspaces.RemoveMember(ctx, beta.ID, member.ID))
+	_, err = s.Workspaces.GetMember(ctx, beta.ID, member.ID)
+	wantNoRows(t, err)
+
+	renamed, err := s.Workspaces.Rename(ctx, beta.ID, "Gamma")
+	must(t, err)
+	if renamed.ID != beta.ID || renamed.Name != "Gamma" {
+		t.Fatalf("Rename = %+v", renamed)
+	}
+	_, err = s.Workspaces.Rename(ctx, uuid.NewString(), "Nothing")
+	wantNoRows(t, err)
+
+	must(t, s.Workspaces.Delete(ctx, alpha.ID))
+	wantNoRows(t, s.Workspaces.Delete(ctx, alpha.ID))
+	_, err = s.Workspaces.GetMember(ctx, alpha.ID, owner.ID)
+	wantNoRows(t, err)
+}
+
+func testWorkspaceContent(t *testing.T, s Stores) {
+	ctx := context.Background()
+	owner := newUser(t, s)
+	workspace, err := s.Workspaces.Create(ctx, "Team", owner.ID)
+	must(t, err)
+	other, err := s.Workspaces.Create(ctx, "Other", owner.ID)
+	must(t, err)
+
+	temperature, redact := 0.2, false
+	style, err := s.Workspaces.CreatePreset(ctx, workspace.ID, "Style guide", "Use British spelling.", domain.GenerationSettings{Model: "gpt-4o", Temperature: &temperature, RedactPII: &redact, Postprocess: []string{"none"}, OutputFormat: domain.OutputHTML, Fallback: []string{"none"}})
+	must(t, err)
+	_, err = s.Workspaces.CreatePreset(ctx, workspace.ID, "Announcements", "Be upbeat.", domain.GenerationSettings{})
+	must(t, err)
+	presets, err := s.Workspaces.ListPresets(ctx, workspace.ID)
+	must(t, err)
+	if len(presets) != 2 || presets[0].Name != "Announcements" || presets[1].ID != style.ID {
+		t.Fatalf("ListPresets = %+v, want [Announcements, Style guide]", presets)
+	}
+	got, err := s.Workspaces.GetPreset(ctx, style.ID)
+	must(t, err)
+	if got.WorkspaceID != workspace.ID || got.Model != "gpt-4o" || got.Temperature == nil || *got.Temperature != 0.2 || got.MaxTokens != nil ||
+		got.RedactPII == nil || *got.RedactPII || !slices.Equal(got.Postprocess, []string{"none"}) ||
+		got.OutputFormat != domain.OutputHTML || !slices.Equal(got.Fallback, []string{"none"}) {
+		t.Fatalf("GetPreset = %+v", got)
+	}
+
+	updated, err := s.Workspaces.UpdatePreset(ctx, style.ID, workspace.ID, "Style guide", "Use American spelling.", domain.GenerationSettings{})
+	must(t, err)
+	if updated.PromptText != "Use American spelling." || updated.Temperature != nil || updated.RedactPII != nil || updated.Postprocess != nil || updated.OutputFormat != "" || updated.Fallback != nil {
+		t.Fatalf("UpdatePreset = %+v", updated)
+	}
+	_, err = s.Workspaces.UpdatePreset(ctx, style.ID, other.ID, "Stolen", "text", domain.GenerationSettings{})
+	wantNoRows(t, err)
+	wantNoRows(t, s.Workspaces.DeletePreset(ctx, style.ID, other.ID))
+	must(t, s.Workspaces.DeletePreset(ctx, style.ID, workspace.ID))
+	_, err = s.Workspaces.GetPreset(ctx, style.ID)
+	wantNoRows(t, err)
+
+	_, err = s.Workspaces.GetSystemPrompt(ctx, workspace.ID)
+	wantNoRows(t, err)
+	_, err = s.Workspaces.SetSystemPrompt(ctx, workspace.ID, "We are Acme.")
+	must(t, err)
+	_, err = s.Workspaces.SetSystemPrompt(ctx, workspace.ID, "We are Acme Corp.")
+	must(t, err)
+	prompt, err := s.Workspaces.GetSystemPrompt(ctx, workspace.ID)
+	must(t, err)
+	if prompt.WorkspaceID != workspace.ID || prompt.PromptText != "We are Acme Corp." {
+		t.Fatalf("GetSystemPrompt = %+v", prompt)
+	}
+	must(t, s.Workspaces.DeleteSystemPrompt(ctx, workspace.ID))
+	wantNoRows(t, s.Workspaces.DeleteSystemPrompt(ctx, workspace.ID))
+
+	remaining, err := s.Workspaces.CreatePreset(ctx, workspace.ID, "Kept", "text", domain.GenerationSettings{})
+	must(t, err)
+	_, err = s.Workspaces.SetSystemPrompt(ctx, workspace.ID, "We are Acme.")
+	must(t, err)
+	must(t, s.Workspaces.Delete(ctx, workspace.ID))
+	_, err = s.Workspaces.GetPreset(ctx, remaining.ID)
+	wantNoRows(t, err)
+	_, err = s.Workspaces.GetSystemPrompt(ctx, workspace.ID)
+	wantNoRows(t, err)
+}
+
+func testTranscriptionLogs(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := newUser(t, s)
+	other := newUser(t, s)
+
+	first, err := s.TranscriptionLog.Create(ctx, user.ID, "transcribe", "hello", 1.5, nil)
+	must(t, err)
+	pause()
+	generated := "Hello!"
+	second, err := s.TranscriptionLog.Create(ctx, user.ID, "rewrite", "hello again", 2, &generated)
+	must(t, err)
+
+	got, err := s.TranscriptionLog.GetByID(ctx, user.ID, second.ID)
+	must(t, err)
+	if got.Mode != "rewrite" || got.Transcript != "hello again" || got.DurationSeconds != 2 || got.GeneratedText == nil || *got.GeneratedText != generated {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	_, err = s.TranscriptionLog.GetByID(ctx, other.ID, second.ID)
+	wantNoRows(t, err)
+
+	if got.ContextTruncated || got.ContextInjection != "" {
+		t.Fatalf("new entry has a composition outcome: %+v", got)
+	}
+	rewritten := "Hi."
+	must(t, s.TranscriptionLog.UpdateComposition(ctx, first.ID, domain.ComposeOutcome{
+		GeneratedText: &rewritten, ContextTruncated: true, ContextInjection: domain.InjectionWarn, OutputFormat: domain.OutputEmail, EmailSubject: "Hello",
+		Provider: "anthropic", Model: "claude-3-5-haiku-latest",
+	}))
+	got, err = s.TranscriptionLog.GetByID(ctx, user.ID, first.ID)
+	must(t, err)
+	if got.GeneratedText == nil || *got.GeneratedText != "Hi." || !got.ContextTruncated || got.ContextInjection != domain.InjectionWarn ||
+		got.OutputFormat != domain.OutputEmail || got.EmailSubject != "Hello" || got.Provider != "anthropic" || got.Model != "claude-3-5-haiku-latest" {
+		t.Fatalf("after UpdateComposition GetByID = %+v", got)
+	}
+	if got.Candidates != nil || got.ChosenCandidate != nil {
+		t.Fatalf("single rewrite has candidates: %+v", got)
+	}
+
+	temperature := 0.2
+	candidates := []domain.RewriteCandidate{
+		{Text: "Hi.", PresetID: "short", Temperature: &temperature},
+		{Text: "Hello there, good to hear from you.", OutputFormat: domain.OutputEmail, EmailSubject: "Hello"},
+	}
+	must(t, s.TranscriptionLog.UpdateComposition(ctx, first.ID, domain.ComposeOutcome{GeneratedText: &rewritten, Candidates: candidates}))
+	must(t, s.TranscriptionLog.ChooseCandidate(ctx, user.ID, first.ID, 1))
+	wantNoRows(t, s.TranscriptionLog.ChooseCandidate(ctx, other.ID, first.ID, 0))
+	got, err = s.TranscriptionLog.GetByID(ctx, user.ID, first.ID)
+	must(t, err)
+	if len(got.Candidates) != 2 || got.ChosenCandidate == nil || *got.ChosenCandidate != 1 {
+		t.Fatalf("after ChooseCandidate GetByID = %+v", got)
+	}
+	if c := got.Candidates[0]; c.Text != "Hi." || c.PresetID != "short" || c.Temperature == nil || *c.Temperature != 0.2 {
+		t.Fatalf("first candidate = %+v", c)
+	}
+	if c := got.Candidates[1]; c.Text != candidates[1].Text || c.OutputFormat != domain.OutputEmail || c.EmailSubject != "Hello" || c.Temperature != nil {
+		t.Fatalf("second candidate = %+v", c)
+	}
+
+	must(t, s.TranscriptionLog.UpdateComposition(ctx, second.ID, domain.ComposeOutcome{ContextInjection: domain.InjectionRefuse}))
+	got, err = s.TranscriptionLog.GetByID(ctx, user.ID, second.ID)
+	must(t, err)
+	if got.GeneratedText != nil || got.ContextInjection != domain.InjectionRefuse {
+		t.Fatalf("after refused UpdateComposition GetByID = %+v", got)
+	}
+
+	logs, err := s.TranscriptionLog.ListByUser(ctx, user.ID, 0)
+	must(t, err)
+	if len(logs) != 2 || logs[0].ID != second.ID || logs[1].ID != first.ID {
+		t.Fatalf("ListByUser returned %d entries, want newest first", len(logs))
+	}
+	if len(logs[0].Candidates) != 0 || len(logs[1].Candidates) != 2 {
+		t.Fatalf("ListByUser returned %d and %d candidates, want 0 and 2", len(logs[0].Candidates), len(logs[1].Candidates))
+	}
+
+	// A new outcome replaces the candidates and the choice.
+	must(t, s.TranscriptionLog.UpdateComposition(ctx, first.ID, domain.ComposeOutcome{GeneratedText: &rewritten}))
+	got, err = s.TranscriptionLog.GetByID(ctx, user.ID, first.ID)
+	must(t, err)
+	if len(got.Candidates) != 0 || got.ChosenCandidate != nil {
+		t.Fatalf("after second UpdateComposition GetByID = %+v", got)
+	}
+	logs, err = s.TranscriptionLog.ListByUser(ctx, user.ID, 1)
+	must(t, err)
+	if len(logs) != 1 || logs[0].ID != second.ID {
+		t.Fatalf("ListByUser with limit 1 returned %d entries", len(logs))
+	}
+	logs, err = s.TranscriptionLog.ListByUser(ctx, other.ID, 0)
+	must(t, err)
+	if len(logs) != 0 {
+		t.Fatalf("ListByUser for another user returned %d entries", len(logs))
+	}
+}
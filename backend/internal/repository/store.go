@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// The interfaces below are what the services depend on. The SQL repositories
+// in this package implement them for Postgres and SQLite; package memory
+// implements them in-process for tests. Lookups that find nothing return
+// sql.ErrNoRows in every implementation.
+
+type UserStore interface {
+	Create(ctx context.Context, name, email, passwordHash string, role domain.UserRole) (domain.User, error)
+	Get(ctx context.Context, id string) (domain.User, error)
+	List(ctx context.Context) ([]domain.User, error)
+	GetByEmail(ctx context.Context, email string) (domain.User, error)
+	SetRole(ctx context.Context, id string, role domain.UserRole) error
+	CountByRole(ctx context.Context, role domain.UserRole) (int, error)
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	Delete(ctx context.Context, id string) error
+}
+
+type UserSessionStore interface {
+	Create(ctx context.Context, userID, tokenHash, userAgent, ipAddress string, expiresAt time.Time) (domain.UserSession, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (domain.UserSession, error)
+	ListByUser(ctx context.Context, userID string) ([]domain.UserSession, error)
+	Touch(ctx context.Context, id string, expiresAt time.Time) error
+	DeleteByTokenHash(ctx context.Context, tokenHash string) error
+	Delete(ctx context.Context, userID, id string) error
+	DeleteByUser(ctx context.Context, userID, keepID string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type UserIdentityStore interface {
+	Create(ctx context.Context, userID, issuer, subject, email string) (domain.UserIdentity, error)
+	Get(ctx context.Context, issuer, subject string) (domain.UserIdentity, error)
+	Touch(ctx context.Context, id, email string) error
+}
+
+type PasswordResetStore interface {
+	Create(ctx context.Context, userID, tokenHash string, expiresAt time.Time) (domain.PasswordResetToken, error)
+	Consume(ctx context.Context, tokenHash string) (string, error)
+}
+
+// LoginAttemptStore persists failed-login counters.
+type LoginAttemptStore interface {
+	Get(ctx context.Context, key string) (domain.LoginAttempt, error)
+	RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (domain.LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type AuditEventStore interface {
+	Create(ctx context.Context, event domain.AuditEvent) error
+	List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error)
+}
+
+type APIKeyStore interface {
+	List(ctx context.Context, userID string) ([]domain.APIKey, error)
+	ListByProvider(ctx context.Context, userID, provider string) ([]domain.APIKey, error)
+	Upsert(ctx context.Context, userID, provider, label, encrypted string, makeDefault bool) (domain.APIKey, error)
+	SetDefault(ctx context.Context, userID, provider, label string) error
+	Delete(ctx context.Context, userID, provider, label string) error
+	GetDefault(ctx context.Context, userID, provider string) (domain.APIKey, error)
+	GetByLabel(ctx context.Context, userID, provider, label string) (domain.APIKey, error)
+}
+
+type PromptPresetStore interface {
+	List(ctx context.Context, userID string) ([]domain.PromptPreset, error)
+	Get(ctx context.Context, id string) (domain.PromptPreset, error)
+	Create(ctx context.Context, userID, name, promptText string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error)
+	UpsertTemplate(ctx context.Context, preset domain.PromptPreset) (domain.PromptPreset, error)
+	Update(ctx context.Context, id, userID, name, promptText string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error)
+	Delete(ctx context.Context, id, userID string) error
+	ListRevisions(ctx context.Context, presetID string) ([]domain.PromptRevision, error)
+	GetRevision(ctx context.Context, presetID string, revision int) (domain.PromptRevision, error)
+}
+
+// WorkspaceStore keeps workspaces with their members, presets and system
+// prompt. Deleting a workspace deletes all of them.
+type WorkspaceStore interface {
+	Create(ctx context.Context, name, ownerID string) (domain.Workspace, error)
+	Get(ctx context.Context, id string) (domain.Workspace, error)
+	ListForUser(ctx context.Context, userID string) ([]domain.WorkspaceMembership, error)
+	Rename(ctx context.Context, id, name string) (domain.Workspace, error)
+	Delete(ctx context.Context, id string) error
+
+	ListMembers(ctx context.Context, workspaceID string) ([]domain.WorkspaceMember, error)
+	GetMember(ctx context.Context, workspaceID, userID string) (domain.WorkspaceMember, error)
+	SetMember(ctx context.Context, workspaceID, userID string, role domain.WorkspaceRole) (domain.WorkspaceMember, error)
+	RemoveMember(ctx context.Context, workspaceID, userID string) error
+
+	ListPresets(ctx context.Context, workspaceID string) ([]domain.WorkspacePreset, error)
+	GetPreset(ctx context.Context, id string) (domain.WorkspacePreset, error)
+	CreatePreset(ctx context.Context, workspaceID, name, promptText string, settings domain.GenerationSettings) (domain.WorkspacePreset, error)
+	UpdatePreset(ctx context.Context, id, workspaceID, name, promptText string, settings domain.GenerationSettings) (domain.WorkspacePreset, error)
+	DeletePreset(ctx context.Context, id, workspaceID string) error
+
+	GetSystemPrompt(ctx context.Context, workspaceID string) (domain.WorkspaceSystemPrompt, error)
+	SetSystemPrompt(ctx context.Context, workspaceID, promptText string) (domain.WorkspaceSystemPrompt, error)
+	DeleteSystemPrompt(ctx context.Context, workspaceID string) error
+}
+
+type SystemPromptStore interface {
+	GetActive(ctx context.Context) (domain.SystemPrompt, error)
+	Upsert(ctx context.Context, promptText string) (domain.SystemPrompt, error)
+	ListRevisions(ctx context.Context, promptID string) ([]domain.PromptRevision, error)
+	GetRevision(ctx context.Context, promptID string, revision int) (domain.PromptRevision, error)
+}
+
+type UserSystemPromptStore interface {
+	Get(ctx context.Context, userID string) (domain.UserSystemPrompt, error)
+	Upsert(ctx context.Context, userID string, mode domain.SystemPromptMode, promptText string) (domain.UserSystemPrompt, error)
+	Delete(ctx context.Context, userID string) error
+}
+
+// RedactionStore keeps each user's redaction switch and custom rules.
+type RedactionStore interface {
+	GetSetting(ctx context.Context, userID string) (domain.RedactionSetting, error)
+	SetEnabled(ctx context.Context, userID string, enabled bool) (domain.RedactionSetting, error)
+	ListRules(ctx context.Context, userID string) ([]domain.RedactionRule, error)
+	UpsertRule(ctx context.Context, userID, name, pattern string) (domain.RedactionRule, error)
+	DeleteRule(ctx context.Context, userID, name string) error
+}
+
+// FallbackChainStore keeps each user's own fallback chain.
+type FallbackChainStore interface {
+	Get(ctx context.Context, userID string) (domain.FallbackChain, error)
+	Upsert(ctx context.Context, userID string, chain []string) (domain.FallbackChain, error)
+	Delete(ctx context.Context, userID string) error
+}
+
+type UserVariableStore interface {
+	List(ctx context.Context, userID string) ([]domain.UserVariable, error)
+	Upsert(ctx context.Context, userID, name, value string) (domain.UserVariable, error)
+	Delete(ctx context.Context, userID, name string) error
+}
+
+type TranscriptionLogStore interface {
+	Create(ctx context.Context, userID, mode, transcript string, duration float64, generatedText *string) (domain.TranscriptionLog, error)
+	UpdateComposition(ctx context.Context, id string, outcome domain.ComposeOutcome) error
+	ChooseCandidate(ctx context.Context, userID, id string, index int) error
+	GetByID(ctx context.Context, userID, id string) (domain.TranscriptionLog, error)
+	ListByUser(ctx context.Context, userID string, limit int) ([]domain.TranscriptionLog, error)
+}
+
+var (
+	_ UserStore             = (*UserRepository)(nil)
+	_ UserSessionStore      = (*UserSessionRepository)(nil)
+	_ UserIdentityStore     = (*UserIdentityRepository)(nil)
+	_ PasswordResetStore    = (*PasswordResetRepository)(nil)
+	_ LoginAttemptStore     = (*LoginAttemptRepository)(nil)
+	_ AuditEventStore       = (*AuditEventRepository)(nil)
+	_ APIKeyStore           = (*APIKeyRepository)(nil)
+	_ PromptPresetStore     = (*PromptPresetRepository)(nil)
+	_ SystemPromptStore     = (*SystemPromptRepository)(nil)
+	_ UserSystemPromptStore = (*UserSystemPromptRepository)(nil)
+	_ RedactionStore        = (*RedactionRepository)(nil)
+	_ FallbackChainStore    = (*FallbackChainRepository)(nil)
+	_ UserVariableStore     = (*UserVariableRepository)(nil)
+	_ WorkspaceStore        = (*WorkspaceRepository)(nil)
+	_ TranscriptionLogStore = (*TranscriptionLogRepository)(nil)
+)
@@ -78,6 +78,9 @@ func (r *SystemPromptRepository) Upsert(ctx context.Context, promptText string)
 		}
 	}
 
+	if err := insertSystemPromptRevision(ctx, tx, prompt); err != nil {
+		return domain.SystemPrompt{}, err
+	}
 	if err := tx.Commit(); err != nil {
 		return domain.SystemPrompt{}, err
 	}
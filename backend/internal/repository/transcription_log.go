@@ -37,30 +37,67 @@ func (r *TranscriptionLogRepository) Create(ctx context.Context, userID, mode, t
 	return entry, err
 }
 
-func (r *TranscriptionLogRepository) UpdateGeneratedText(ctx context.Context, id string, text string) error {
-	_, err := r.db.ExecContext(ctx, `
+// UpdateComposition records the outcome of a rewrite, replacing any
+// candidates recorded before.
+func (r *TranscriptionLogRepository) UpdateComposition(ctx context.Context, id string, outcome domain.ComposeOutcome) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE transcription_logs
+		SET generated_text = $1, context_truncated = $2, context_injection = $3, output_format = $4, email_subject = $5, chosen_candidate = NULL,
+		    provider = $6, model = $7
+		WHERE id = $8
+	`, outcome.GeneratedText, outcome.ContextTruncated, outcome.ContextInjection, outcome.OutputFormat, outcome.EmailSubject, outcome.Provider, outcome.Model, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rewrite_candidates WHERE log_id = $1`, id); err != nil {
+		return err
+	}
+	for i, candidate := range outcome.Candidates {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO rewrite_candidates (log_id, position, text, output_format, email_subject, preset_id, temperature)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, id, i, candidate.Text, candidate.OutputFormat, candidate.EmailSubject, candidate.PresetID, candidate.Temperature); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ChooseCandidate records the candidate the user copied.
+func (r *TranscriptionLogRepository) ChooseCandidate(ctx context.Context, userID, id string, index int) error {
+	res, err := r.db.ExecContext(ctx, `
 		UPDATE transcription_logs
-		SET generated_text = $1
-		WHERE id = $2
-	`, text, id)
-	return err
+		SET chosen_candidate = $1
+		WHERE id = $2 AND user_id = $3
+	`, index, id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (r *TranscriptionLogRepository) GetByID(ctx context.Context, userID, id string) (domain.TranscriptionLog, error) {
-	var entry domain.TranscriptionLog
-	var generated sql.NullString
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, mode, transcript, generated_text, duration_seconds, created_at
+	entry, err := scanTranscriptionLog(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, mode, transcript, generated_text, duration_seconds, context_truncated, context_injection, output_format, email_subject, chosen_candidate, provider, model, created_at
 		FROM transcription_logs
 		WHERE id = $1 AND user_id = $2
-	`, id, userID).Scan(&entry.ID, &entry.UserID, &entry.Mode, &entry.Transcript, &generated, &entry.DurationSeconds, &entry.CreatedAt)
+	`, id, userID))
 	if err != nil {
 		return domain.TranscriptionLog{}, err
 	}
-	if generated.Valid {
-		value := generated.String
-		entry.GeneratedText = &value
+	candidates, err := r.candidates(ctx, `WHERE log_id = $1`, id)
+	if err != nil {
+		return domain.TranscriptionLog{}, err
 	}
+	entry.Candidates = candidates[entry.ID]
 	return entry, nil
 }
 
@@ -69,7 +106,7 @@ func (r *TranscriptionLogRepository) ListByUser(ctx context.Context, userID stri
 		limit = 50
 	}
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, mode, transcript, generated_text, duration_seconds, created_at
+		SELECT id, user_id, mode, transcript, generated_text, duration_seconds, context_truncated, context_injection, output_format, email_subject, chosen_candidate, provider, model, created_at
 		FROM transcription_logs
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -82,16 +119,76 @@ func (r *TranscriptionLogRepository) ListByUser(ctx context.Context, userID stri
 
 	var logs []domain.TranscriptionLog
 	for rows.Next() {
-		var entry domain.TranscriptionLog
-		var generated sql.NullString
-		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Mode, &entry.Transcript, &generated, &entry.DurationSeconds, &entry.CreatedAt); err != nil {
+		entry, err := scanTranscriptionLog(rows)
+		if err != nil {
 			return nil, err
 		}
-		if generated.Valid {
-			value := generated.String
-			entry.GeneratedText = &value
-		}
 		logs = append(logs, entry)
 	}
-	return logs, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	candidates, err := r.candidates(ctx, `
+		WHERE log_id IN (
+			SELECT id FROM transcription_logs
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+		)
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range logs {
+		logs[i].Candidates = candidates[logs[i].ID]
+	}
+	return logs, nil
+}
+
+// candidates loads the candidates selected by where, by log entry and in
+// order.
+func (r *TranscriptionLogRepository) candidates(ctx context.Context, where string, args ...any) (map[string][]domain.RewriteCandidate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT log_id, text, output_format, email_subject, preset_id, temperature
+		FROM rewrite_candidates
+	`+where+`
+		ORDER BY log_id, position
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := make(map[string][]domain.RewriteCandidate)
+	for rows.Next() {
+		var logID string
+		var candidate domain.RewriteCandidate
+		var temperature sql.NullFloat64
+		if err := rows.Scan(&logID, &candidate.Text, &candidate.OutputFormat, &candidate.EmailSubject, &candidate.PresetID, &temperature); err != nil {
+			return nil, err
+		}
+		if temperature.Valid {
+			candidate.Temperature = &temperature.Float64
+		}
+		candidates[logID] = append(candidates[logID], candidate)
+	}
+	return candidates, rows.Err()
+}
+
+func scanTranscriptionLog(row rowScanner) (domain.TranscriptionLog, error) {
+	var entry domain.TranscriptionLog
+	var generated sql.NullString
+	var chosen sql.NullInt64
+	if err := row.Scan(&entry.ID, &entry.UserID, &entry.Mode, &entry.Transcript, &generated, &entry.DurationSeconds, &entry.ContextTruncated, &entry.ContextInjection, &entry.OutputFormat, &entry.EmailSubject, &chosen, &entry.Provider, &entry.Model, &entry.CreatedAt); err != nil {
+		return domain.TranscriptionLog{}, err
+	}
+	if generated.Valid {
+		value := generated.String
+		entry.GeneratedText = &value
+	}
+	if chosen.Valid {
+		index := int(chosen.Int64)
+		entry.ChosenCandidate = &index
+	}
+	return entry, nil
 }
@@ -18,36 +18,35 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) Create(ctx context.Context, name, email, passwordHash string) (domain.User, error) {
+func (r *UserRepository) Create(ctx context.Context, name, email, passwordHash string, role domain.UserRole) (domain.User, error) {
 	now := time.Now().UTC()
 	user := domain.User{
 		ID:           uuid.NewString(),
 		Name:         name,
 		Email:        email,
 		PasswordHash: passwordHash,
+		Role:         role,
 		CreatedAt:    now,
 	}
 
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO users (id, name, email, password_hash, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, user.ID, user.Name, user.Email, user.PasswordHash, user.CreatedAt)
+		INSERT INTO users (id, name, email, password_hash, role, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, user.ID, user.Name, user.Email, user.PasswordHash, user.Role, user.CreatedAt)
 	return user, err
 }
 
 func (r *UserRepository) Get(ctx context.Context, id string) (domain.User, error) {
-	var user domain.User
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, name, email, password_hash, created_at
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT id, name, email, password_hash, role, created_at
 		FROM users
 		WHERE id = $1
-	`, id).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.CreatedAt)
-	return user, err
+	`, id))
 }
 
 func (r *UserRepository) List(ctx context.Context) ([]domain.User, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, name, email, password_hash, created_at
+		SELECT id, name, email, password_hash, role, created_at
 		FROM users
 		ORDER BY created_at ASC
 	`)
@@ -58,8 +57,8 @@ func (r *UserRepository) List(ctx context.Context) ([]domain.User, error) {
 
 	var users []domain.User
 	for rows.Next() {
-		var u domain.User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.PasswordHash, &u.CreatedAt); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -68,11 +67,67 @@ func (r *UserRepository) List(ctx context.Context) ([]domain.User, error) {
 }
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (domain.User, error) {
-	var user domain.User
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, name, email, password_hash, created_at
+	return scanUser(r.db.QueryRowContext(ctx, `
+		SELECT id, name, email, password_hash, role, created_at
 		FROM users
 		WHERE email = $1
-	`, email).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.CreatedAt)
-	return user, err
+	`, email))
+}
+
+func (r *UserRepository) SetRole(ctx context.Context, id string, role domain.UserRole) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *UserRepository) CountByRole(ctx context.Context, role domain.UserRole) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, role).Scan(&count)
+	return count, err
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes the user and everything they own. Most tables cascade via
+// their foreign key; presets carry no constraint and are removed explicitly.
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_prompt_presets WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func scanUser(row rowScanner) (domain.User, error) {
+	var user domain.User
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt); err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
 }
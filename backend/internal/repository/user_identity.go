@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewUserIdentityRepository(db *sql.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{db: db}
+}
+
+func (r *UserIdentityRepository) Create(ctx context.Context, userID, issuer, subject, email string) (domain.UserIdentity, error) {
+	now := time.Now().UTC()
+	identity := domain.UserIdentity{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Issuer:      issuer,
+		Subject:     subject,
+		Email:       email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt, identity.LastLoginAt)
+	return identity, err
+}
+
+func (r *UserIdentityRepository) Get(ctx context.Context, issuer, subject string) (domain.UserIdentity, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2
+	`, issuer, subject)
+	return scanUserIdentity(row)
+}
+
+// Touch records a sign-in and refreshes the email reported by the provider.
+func (r *UserIdentityRepository) Touch(ctx context.Context, id, email string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_identities SET email = $1, last_login_at = $2 WHERE id = $3
+	`, email, time.Now().UTC(), id)
+	return err
+}
+
+func scanUserIdentity(scanner rowScanner) (domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	err := scanner.Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	return identity, err
+}
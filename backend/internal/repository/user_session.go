@@ -18,45 +18,118 @@ func NewUserSessionRepository(db *sql.DB) *UserSessionRepository {
 	return &UserSessionRepository{db: db}
 }
 
-func (r *UserSessionRepository) Create(ctx context.Context, userID, token string, expiresAt time.Time) (domain.UserSession, error) {
+func (r *UserSessionRepository) Create(ctx context.Context, userID, tokenHash, userAgent, ipAddress string, expiresAt time.Time) (domain.UserSession, error) {
+	now := time.Now().UTC()
 	session := domain.UserSession{
 		ID:        uuid.NewString(),
 		UserID:    userID,
-		Token:     token,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now().UTC(),
-		LastUsed:  time.Now().UTC(),
+		TokenHash: tokenHash,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: now,
+		LastUsed:  now,
 	}
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO user_sessions (id, user_id, token, expires_at, created_at, last_used_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, session.ID, session.UserID, session.Token, session.ExpiresAt, session.CreatedAt, session.LastUsed)
+		INSERT INTO user_sessions (id, user_id, token_hash, user_agent, ip_address, expires_at, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, session.ID, session.UserID, session.TokenHash, session.UserAgent, session.IPAddress, session.ExpiresAt, session.CreatedAt, session.LastUsed)
 	return session, err
 }
 
-func (r *UserSessionRepository) GetByToken(ctx context.Context, token string) (domain.UserSession, error) {
-	var session domain.UserSession
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, token, expires_at, created_at, last_used_at
+func (r *UserSessionRepository) GetByTokenHash(ctx context.Context, tokenHash string) (domain.UserSession, error) {
+	return scanUserSession(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, token_hash, user_agent, ip_address, expires_at, created_at, last_used_at
 		FROM user_sessions
-		WHERE token = $1
-	`, token).Scan(&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &session.CreatedAt, &session.LastUsed)
-	return session, err
+		WHERE token_hash = $1
+	`, tokenHash))
 }
 
-func (r *UserSessionRepository) Touch(ctx context.Context, id string) error {
+// ListByUser returns the user's unexpired sessions, most recently used first.
+func (r *UserSessionRepository) ListByUser(ctx context.Context, userID string) ([]domain.UserSession, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, token_hash, user_agent, ip_address, expires_at, created_at, last_used_at
+		FROM user_sessions
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []domain.UserSession
+	for rows.Next() {
+		session, err := scanUserSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records a use of the session and slides its expiry forward.
+func (r *UserSessionRepository) Touch(ctx context.Context, id string, expiresAt time.Time) error {
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE user_sessions
-		SET last_used_at = $2
+		SET last_used_at = $2, expires_at = $3
 		WHERE id = $1
-	`, id, time.Now().UTC())
+	`, id, time.Now().UTC(), expiresAt.UTC())
+	return err
+}
+
+func (r *UserSessionRepository) DeleteByTokenHash(ctx context.Context, tokenHash string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM user_sessions
+		WHERE token_hash = $1
+	`, tokenHash)
 	return err
 }
 
-func (r *UserSessionRepository) DeleteByToken(ctx context.Context, token string) error {
+// Delete revokes a single session owned by userID.
+func (r *UserSessionRepository) Delete(ctx context.Context, userID, id string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM user_sessions
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteByUser revokes every session of the user except keepID, which may be
+// empty to revoke them all.
+func (r *UserSessionRepository) DeleteByUser(ctx context.Context, userID, keepID string) error {
 	_, err := r.db.ExecContext(ctx, `
 		DELETE FROM user_sessions
-		WHERE token = $1
-	`, token)
+		WHERE user_id = $1 AND id <> $2
+	`, userID, keepID)
 	return err
 }
+
+// DeleteExpired removes sessions that expired before now and reports how
+// many were purged.
+func (r *UserSessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM user_sessions
+		WHERE expires_at <= $1
+	`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanUserSession(row rowScanner) (domain.UserSession, error) {
+	var session domain.UserSession
+	err := row.Scan(&session.ID, &session.UserID, &session.TokenHash, &session.UserAgent, &session.IPAddress, &session.ExpiresAt, &session.CreatedAt, &session.LastUsed)
+	if err != nil {
+		return domain.UserSession{}, err
+	}
+	return session, nil
+}
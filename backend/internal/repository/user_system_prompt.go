@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserSystemPromptRepository struct {
+	db *sql.DB
+}
+
+func NewUserSystemPromptRepository(db *sql.DB) *UserSystemPromptRepository {
+	return &UserSystemPromptRepository{db: db}
+}
+
+func (r *UserSystemPromptRepository) Get(ctx context.Context, userID string) (domain.UserSystemPrompt, error) {
+	return scanUserSystemPrompt(r.db.QueryRowContext(ctx, `
+		SELECT user_id, mode, prompt_text, updated_at
+		FROM user_system_prompts
+		WHERE user_id = $1
+	`, userID))
+}
+
+func (r *UserSystemPromptRepository) Upsert(ctx context.Context, userID string, mode domain.SystemPromptMode, promptText string) (domain.UserSystemPrompt, error) {
+	return scanUserSystemPrompt(r.db.QueryRowContext(ctx, `
+		INSERT INTO user_system_prompts (user_id, mode, prompt_text, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id)
+		DO UPDATE SET mode = EXCLUDED.mode,
+		              prompt_text = EXCLUDED.prompt_text,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING user_id, mode, prompt_text, updated_at
+	`, userID, mode, promptText, time.Now().UTC()))
+}
+
+func (r *UserSystemPromptRepository) Delete(ctx context.Context, userID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_system_prompts WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanUserSystemPrompt(row rowScanner) (domain.UserSystemPrompt, error) {
+	var prompt domain.UserSystemPrompt
+	if err := row.Scan(&prompt.UserID, &prompt.Mode, &prompt.PromptText, &prompt.UpdatedAt); err != nil {
+		return domain.UserSystemPrompt{}, err
+	}
+	return prompt, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type UserVariableRepository struct {
+	db *sql.DB
+}
+
+func NewUserVariableRepository(db *sql.DB) *UserVariableRepository {
+	return &UserVariableRepository{db: db}
+}
+
+func (r *UserVariableRepository) List(ctx context.Context, userID string) ([]domain.UserVariable, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, name, value, created_at, updated_at
+		FROM user_variables
+		WHERE user_id = $1
+		ORDER BY name ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variables []domain.UserVariable
+	for rows.Next() {
+		var variable domain.UserVariable
+		if err := rows.Scan(&variable.ID, &variable.UserID, &variable.Name, &variable.Value, &variable.CreatedAt, &variable.UpdatedAt); err != nil {
+			return nil, err
+		}
+		variables = append(variables, variable)
+	}
+	return variables, rows.Err()
+}
+
+func (r *UserVariableRepository) Upsert(ctx context.Context, userID, name, value string) (domain.UserVariable, error) {
+	now := time.Now().UTC()
+	var variable domain.UserVariable
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO user_variables (id, user_id, name, value, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, name)
+		DO UPDATE SET value = EXCLUDED.value,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING id, user_id, name, value, created_at, updated_at
+	`, uuid.NewString(), userID, name, value, now, now).Scan(&variable.ID, &variable.UserID, &variable.Name, &variable.Value, &variable.CreatedAt, &variable.UpdatedAt)
+	if err != nil {
+		return domain.UserVariable{}, err
+	}
+	return variable, nil
+}
+
+func (r *UserVariableRepository) Delete(ctx context.Context, userID, name string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_variables WHERE user_id = $1 AND name = $2`, userID, name)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
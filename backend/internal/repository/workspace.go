@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+type WorkspaceRepository struct {
+	db *sql.DB
+}
+
+func NewWorkspaceRepository(db *sql.DB) *WorkspaceRepository {
+	return &WorkspaceRepository{db: db}
+}
+
+// Create inserts a workspace with ownerID as its first owner.
+func (r *WorkspaceRepository) Create(ctx context.Context, name, ownerID string) (domain.Workspace, error) {
+	now := time.Now().UTC()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Workspace{}, err
+	}
+	defer tx.Rollback()
+
+	workspace, err := scanWorkspace(tx.QueryRowContext(ctx, `
+		INSERT INTO workspaces (id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, name, created_at, updated_at
+	`, uuid.NewString(), name, now, now))
+	if err != nil {
+		return domain.Workspace{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, workspace.ID, ownerID, domain.WorkspaceRoleOwner, now); err != nil {
+		return domain.Workspace{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Workspace{}, err
+	}
+	return workspace, nil
+}
+
+func (r *WorkspaceRepository) Get(ctx context.Context, id string) (domain.Workspace, error) {
+	return scanWorkspace(r.db.QueryRowContext(ctx, `
+		SELECT id, name, created_at, updated_at
+		FROM workspaces
+		WHERE id = $1
+	`, id))
+}
+
+// ListForUser returns the workspaces userID belongs to, by name.
+func (r *WorkspaceRepository) ListForUser(ctx context.Context, userID string) ([]domain.WorkspaceMembership, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT w.id, w.name, w.created_at, w.updated_at, m.role
+		FROM workspaces w
+		JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY w.name ASC, w.id ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []domain.WorkspaceMembership
+	for rows.Next() {
+		var m domain.WorkspaceMembership
+		if err := rows.Scan(&m.ID, &m.Name, &m.CreatedAt, &m.UpdatedAt, &m.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+func (r *WorkspaceRepository) Rename(ctx context.Context, id, name string) (domain.Workspace, error) {
+	return scanWorkspace(r.db.QueryRowContext(ctx, `
+		UPDATE workspaces
+		SET name = $1,
+		    updated_at = $2
+		WHERE id = $3
+		RETURNING id, name, created_at, updated_at
+	`, name, time.Now().UTC(), id))
+}
+
+func (r *WorkspaceRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM workspaces WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListMembers returns the members of a workspace in the order they joined.
+func (r *WorkspaceRepository) ListMembers(ctx context.Context, workspaceID string) ([]domain.WorkspaceMember, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT workspace_id, user_id, role, created_at
+		FROM workspace_members
+		WHERE workspace_id = $1
+		ORDER BY created_at ASC, user_id ASC
+	`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []domain.WorkspaceMember
+	for rows.Next() {
+		member, err := scanWorkspaceMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *WorkspaceRepository) GetMember(ctx context.Context, workspaceID, userID string) (domain.WorkspaceMember, error) {
+	return scanWorkspaceMember(r.db.QueryRowContext(ctx, `
+		SELECT workspace_id, user_id, role, created_at
+		FROM workspace_members
+		WHERE workspace_id = $1 AND user_id = $2
+	`, workspaceID, userID))
+}
+
+// SetMember adds userID to the workspace or changes their role.
+func (r *WorkspaceRepository) SetMember(ctx context.Context, workspaceID, userID string, role domain.WorkspaceRole) (domain.WorkspaceMember, error) {
+	return scanWorkspaceMember(r.db.QueryRowContext(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, user_id)
+		DO UPDATE SET role = EXCLUDED.role
+		RETURNING workspace_id, user_id, role, created_at
+	`, workspaceID, userID, role, time.Now().UTC()))
+}
+
+func (r *WorkspaceRepository) RemoveMember(ctx context.Context, workspaceID, userID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListPresets returns a workspace's presets by name.
+func (r *WorkspaceRepository) ListPresets(ctx context.Context, workspaceID string) ([]domain.WorkspacePreset, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, workspace_id, name, prompt_text, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+		FROM workspace_presets
+		WHERE workspace_id = $1
+		ORDER BY name ASC, id ASC
+	`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var presets []domain.WorkspacePreset
+	for rows.Next() {
+		preset, err := scanWorkspacePreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	return presets, rows.Err()
+}
+
+func (r *WorkspaceRepository) GetPreset(ctx context.Context, id string) (domain.WorkspacePreset, error) {
+	return scanWorkspacePreset(r.db.QueryRowContext(ctx, `
+		SELECT id, workspace_id, name, prompt_text, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+		FROM workspace_presets
+		WHERE id = $1
+	`, id))
+}
+
+func (r *WorkspaceRepository) CreatePreset(ctx context.Context, workspaceID, name, promptText string, settings domain.GenerationSettings) (domain.WorkspacePreset, error) {
+	now := time.Now().UTC()
+	return scanWorkspacePreset(r.db.QueryRowContext(ctx, `
+		INSERT INTO workspace_presets (id, workspace_id, name, prompt_text, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, workspace_id, name, prompt_text, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+	`, uuid.NewString(), workspaceID, name, promptText, settings.Provider, settings.Model, settings.Temperature, settings.MaxTokens, settings.TopP, settings.RedactPII, joinList(settings.Postprocess), settings.OutputFormat, joinList(settings.Fallback), now, now))
+}
+
+func (r *WorkspaceRepository) UpdatePreset(ctx context.Context, id, workspaceID, name, promptText string, settings domain.GenerationSettings) (domain.WorkspacePreset, error) {
+	return scanWorkspacePreset(r.db.QueryRowContext(ctx, `
+		UPDATE workspace_presets
+		SET name = $1,
+		    prompt_text = $2,
+		    provider = $3,
+		    model = $4,
+		    temperature = $5,
+		    max_tokens = $6,
+		    top_p = $7,
+		    redact_pii = $8,
+		    postprocess = $9,
+		    output_format = $10,
+		    fallback = $11,
+		    updated_at = $12
+		WHERE id = $13 AND workspace_id = $14
+		RETURNING id, workspace_id, name, prompt_text, provider, model, temperature, max_tokens, top_p, redact_pii, postprocess, output_format, fallback, created_at, updated_at
+	`, name, promptText, settings.Provider, settings.Model, settings.Temperature, settings.MaxTokens, settings.TopP, settings.RedactPII, joinList(settings.Postprocess), settings.OutputFormat, joinList(settings.Fallback), time.Now().UTC(), id, workspaceID))
+}
+
+func (r *WorkspaceRepository) DeletePreset(ctx context.Context, id, workspaceID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM workspace_presets WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *WorkspaceRepository) GetSystemPrompt(ctx context.Context, workspaceID string) (domain.WorkspaceSystemPrompt, error) {
+	var prompt domain.WorkspaceSystemPrompt
+	err := r.db.QueryRowContext(ctx, `
+		SELECT workspace_id, prompt_text, updated_at
+		FROM workspace_system_prompts
+		WHERE workspace_id = $1
+	`, workspaceID).Scan(&prompt.WorkspaceID, &prompt.PromptText, &prompt.UpdatedAt)
+	if err != nil {
+		return domain.WorkspaceSystemPrompt{}, err
+	}
+	return prompt, nil
+}
+
+func (r *WorkspaceRepository) SetSystemPrompt(ctx context.Context, workspaceID, promptText string) (domain.WorkspaceSystemPrompt, error) {
+	var prompt domain.WorkspaceSystemPrompt
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO workspace_system_prompts (workspace_id, prompt_text, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id)
+		DO UPDATE SET prompt_text = EXCLUDED.prompt_text,
+		              updated_at = EXCLUDED.updated_at
+		RETURNING workspace_id, prompt_text, updated_at
+	`, workspaceID, promptText, time.Now().UTC()).Scan(&prompt.WorkspaceID, &prompt.PromptText, &prompt.UpdatedAt)
+	if err != nil {
+		return domain.WorkspaceSystemPrompt{}, err
+	}
+	return prompt, nil
+}
+
+func (r *WorkspaceRepository) DeleteSystemPrompt(ctx context.Context, workspaceID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM workspace_system_prompts WHERE workspace_id = $1`, workspaceID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanWorkspace(row rowScanner) (domain.Workspace, error) {
+	var workspace domain.Workspace
+	if err := row.Scan(&workspace.ID, &workspace.Name, &workspace.CreatedAt, &workspace.UpdatedAt); err != nil {
+		return domain.Workspace{}, err
+	}
+	return workspace, nil
+}
+
+func scanWorkspaceMember(row rowScanner) (domain.WorkspaceMember, error) {
+	var member domain.WorkspaceMember
+	if err := row.Scan(&member.WorkspaceID, &member.UserID, &member.Role, &member.CreatedAt); err != nil {
+		return domain.WorkspaceMember{}, err
+	}
+	return member, nil
+}
+
+func scanWorkspacePreset(row rowScanner) (domain.WorkspacePreset, error) {
+	var preset domain.WorkspacePreset
+	var settings settingsScanner
+	err := row.Scan(&preset.ID, &preset.WorkspaceID, &preset.Name, &preset.PromptText,
+		&settings.provider, &settings.model, &settings.temperature, &settings.maxTokens, &settings.topP, &settings.redactPII, &settings.postprocess, &settings.outputFormat, &settings.fallback, &preset.CreatedAt, &preset.UpdatedAt)
+	if err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	preset.GenerationSettings = settings.settings()
+	return preset, nil
+}
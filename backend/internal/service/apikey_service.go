@@ -6,9 +6,12 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"errors"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Juicern/luma/internal/domain"
@@ -16,21 +19,34 @@ import (
 )
 
 type APIKeyService struct {
-	repo *repository.APIKeyRepository
-	key  []byte
+	repo  repository.APIKeyStore
+	key   []byte
+	audit *AuditService
 }
 
+// DefaultKeyLabel is the label given to keys stored without one.
+const DefaultKeyLabel = "default"
+
 type PlainAPIKey struct {
 	ProviderName string `json:"provider_name"`
+	Label        string `json:"label"`
+	IsDefault    bool   `json:"is_default"`
 	APIKey       string `json:"api_key"`
 	UpdatedAt    string `json:"updated_at"`
 }
 
-func NewAPIKeyService(repo *repository.APIKeyRepository, encryptionKey string) *APIKeyService {
+// ProviderKey is a decrypted key ready to be handed to a provider client.
+type ProviderKey struct {
+	Label  string
+	APIKey string
+}
+
+func NewAPIKeyService(repo repository.APIKeyStore, encryptionKey string, audit *AuditService) *APIKeyService {
 	hashed := sha256.Sum256([]byte(encryptionKey))
 	return &APIKeyService{
-		repo: repo,
-		key:  hashed[:],
+		repo:  repo,
+		key:   hashed[:],
+		audit: audit,
 	}
 }
 
@@ -51,33 +67,134 @@ func (s *APIKeyService) ListPlain(ctx context.Context, userID string) ([]PlainAP
 		}
 		plain = append(plain, PlainAPIKey{
 			ProviderName: rec.ProviderName,
+			Label:        rec.Label,
+			IsDefault:    rec.IsDefault,
 			APIKey:       key,
 			UpdatedAt:    rec.UpdatedAt.Format(time.RFC3339),
 		})
 	}
+	if len(plain) > 0 {
+		s.audit.Record(ctx, AuditEntry{
+			Action:        domain.AuditAPIKeysRevealed,
+			SubjectUserID: userID,
+			TargetType:    "api_key",
+			Metadata:      map[string]string{"count": strconv.Itoa(len(plain))},
+		})
+	}
 	return plain, nil
 }
 
-func (s *APIKeyService) Upsert(ctx context.Context, userID, provider, plaintext string) (domain.APIKey, error) {
+func (s *APIKeyService) Upsert(ctx context.Context, userID, provider, label, plaintext string, makeDefault bool) (domain.APIKey, error) {
 	encrypted, err := s.encrypt(plaintext)
 	if err != nil {
 		return domain.APIKey{}, err
 	}
-	return s.repo.Upsert(ctx, userID, provider, encrypted)
+	key, err := s.repo.Upsert(ctx, userID, provider, normalizeKeyLabel(label), encrypted, makeDefault)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditAPIKeyStored,
+		SubjectUserID: userID,
+		TargetType:    "api_key",
+		TargetID:      key.ID,
+		Metadata: map[string]string{
+			"provider": key.ProviderName,
+			"label":    key.Label,
+			"default":  strconv.FormatBool(key.IsDefault),
+		},
+	})
+	return key, nil
 }
 
-func (s *APIKeyService) Delete(ctx context.Context, userID, provider string) error {
-	return s.repo.Delete(ctx, userID, provider)
+func (s *APIKeyService) SetDefault(ctx context.Context, userID, provider, label string) error {
+	label = normalizeKeyLabel(label)
+	if err := s.repo.SetDefault(ctx, userID, provider, label); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditAPIKeyDefaultChanged,
+		SubjectUserID: userID,
+		TargetType:    "api_key",
+		Metadata:      map[string]string{"provider": provider, "label": label},
+	})
+	return nil
 }
 
-func (s *APIKeyService) GetDecrypted(ctx context.Context, userID, provider string) (string, error) {
-	record, err := s.repo.GetByProvider(ctx, userID, provider)
+// Delete removes one labelled key, or all of the provider's keys when label
+// is empty.
+func (s *APIKeyService) Delete(ctx context.Context, userID, provider, label string) error {
+	label = strings.TrimSpace(label)
+	if err := s.repo.Delete(ctx, userID, provider, label); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditAPIKeyDeleted,
+		SubjectUserID: userID,
+		TargetType:    "api_key",
+		Metadata:      map[string]string{"provider": provider, "label": label},
+	})
+	return nil
+}
+
+// GetDecrypted returns the key stored under label, or the provider default
+// when label is empty.
+func (s *APIKeyService) GetDecrypted(ctx context.Context, userID, provider, label string) (string, error) {
+	var (
+		record domain.APIKey
+		err    error
+	)
+	if label = strings.TrimSpace(label); label != "" {
+		record, err = s.repo.GetByLabel(ctx, userID, provider, label)
+	} else {
+		record, err = s.repo.GetDefault(ctx, userID, provider)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMissingAPIKey
+	}
 	if err != nil {
 		return "", err
 	}
 	return s.decrypt(record.EncryptedKey)
 }
 
+// Candidates lists the keys to try for a request, in order. An explicit
+// label pins the request to that key; otherwise the default comes first and
+// the remaining keys follow as failover options.
+func (s *APIKeyService) Candidates(ctx context.Context, userID, provider, label string) ([]ProviderKey, error) {
+	if label = strings.TrimSpace(label); label != "" {
+		key, err := s.GetDecrypted(ctx, userID, provider, label)
+		if err != nil {
+			return nil, err
+		}
+		return []ProviderKey{{Label: label, APIKey: key}}, nil
+	}
+
+	records, err := s.repo.ListByProvider(ctx, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrMissingAPIKey
+	}
+	keys := make([]ProviderKey, 0, len(records))
+	for _, rec := range records {
+		key, err := s.decrypt(rec.EncryptedKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ProviderKey{Label: rec.Label, APIKey: key})
+	}
+	return keys, nil
+}
+
+func normalizeKeyLabel(label string) string {
+	if label = strings.TrimSpace(label); label != "" {
+		return label
+	}
+	return DefaultKeyLabel
+}
+
 func (s *APIKeyService) encrypt(plaintext string) (string, error) {
 	block, err := aes.NewCipher(s.key)
 	if err != nil {
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// Actor identifies who is performing the current request.
+type Actor struct {
+	UserID string
+	// ClaimedUserID is the user an unauthenticated request said it acted
+	// for. It is kept in the metadata of events without an actor, never
+	// taken as the actor itself.
+	ClaimedUserID string
+	Client        ClientInfo
+}
+
+type actorContextKey struct{}
+
+// WithActor attaches the acting user and client to ctx so that services can
+// attribute audit events without threading them through every call.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorContextKey{}).(Actor)
+	return actor
+}
+
+// AuditEntry is what services report; actor and client details are filled in
+// from the request context.
+type AuditEntry struct {
+	Action        domain.AuditAction
+	SubjectUserID string
+	TargetType    string
+	TargetID      string
+	Metadata      map[string]string
+	// ActorUserID overrides the context actor, e.g. for a login where the
+	// request was anonymous until the credentials checked out.
+	ActorUserID string
+}
+
+type AuditService struct {
+	repo   repository.AuditEventStore
+	logger *slog.Logger
+}
+
+func NewAuditService(repo repository.AuditEventStore, logger *slog.Logger) *AuditService {
+	return &AuditService{repo: repo, logger: logger}
+}
+
+// Record stores an audit event. Auditing never fails the operation being
+// audited, so errors are logged rather than returned. A nil service is a
+// no-op.
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) {
+	if s == nil {
+		return
+	}
+	actor := ActorFromContext(ctx)
+	if entry.ActorUserID != "" {
+		actor.UserID = entry.ActorUserID
+	}
+	metadata := entry.Metadata
+	if actor.UserID == "" && actor.ClaimedUserID != "" {
+		metadata = make(map[string]string, len(entry.Metadata)+1)
+		for k, v := range entry.Metadata {
+			metadata[k] = v
+		}
+		metadata["claimed_user_id"] = actor.ClaimedUserID
+	}
+	event := domain.AuditEvent{
+		ID:            uuid.NewString(),
+		ActorUserID:   actor.UserID,
+		SubjectUserID: entry.SubjectUserID,
+		Action:        entry.Action,
+		TargetType:    entry.TargetType,
+		TargetID:      entry.TargetID,
+		IPAddress:     actor.Client.IPAddress,
+		UserAgent:     truncate(actor.Client.UserAgent, maxUserAgentLen),
+		Metadata:      metadata,
+		CreatedAt:     time.Now().UTC(),
+	}
+	// Detach from request cancellation so the event survives a client hang-up.
+	if err := s.repo.Create(context.WithoutCancel(ctx), event); err != nil {
+		s.logger.Error("failed to record audit event",
+			slog.String("action", string(entry.Action)),
+			slog.Any("error", err),
+		)
+	}
+}
+
+func (s *AuditService) List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	return s.repo.List(ctx, filter)
+}
+
+// auditSampler thins out bursts of one kind of event. The first event of a
+// key is recorded; later ones within window are only counted. The count is
+// reported with the next event recorded for that key or, when none comes
+// before the key expires, in a summary event of its own.
+type auditSampler struct {
+	audit  *AuditService
+	window time.Duration
+	// limit caps the keys tracked. Past it the oldest are evicted, and their
+	// counts written out, so that a run across many keys cannot grow the map.
+	limit int
+	now   func() time.Time
+
+	mu    sync.Mutex
+	keys  map[string]*sampledKey
+	swept time.Time
+}
+
+type sampledKey struct {
+	recorded   time.Time
+	suppressed int
+	// last and actor are the latest event left out and who caused it, for
+	// the summary.
+	last  AuditEntry
+	actor Actor
+}
+
+// sampledSummary is a count of left-out events due to be written.
+type sampledSummary struct {
+	entry AuditEntry
+	actor Actor
+}
+
+// maxSampledKeys bounds the keys an auditSampler tracks.
+const maxSampledKeys = 10000
+
+func newAuditSampler(audit *AuditService, window time.Duration) *auditSampler {
+	return &auditSampler{audit: audit, window: window, limit: maxSampledKeys, now: time.Now, keys: make(map[string]*sampledKey)}
+}
+
+// record records entry, or counts it when an event for key was recorded less
+// than window ago.
+func (s *auditSampler) record(ctx context.Context, key string, entry AuditEntry) {
+	s.mu.Lock()
+	now := s.now()
+	var due []sampledSummary
+	write := true
+	if now.Sub(s.swept) >= s.window || len(s.keys) >= s.limit {
+		// The key's own count goes with the event below.
+		due = s.sweepLocked(now, key)
+	}
+	sk, ok := s.keys[key]
+	switch {
+	case !ok:
+		if len(s.keys) >= s.limit {
+			due = append(due, s.evictLocked(len(s.keys)-s.limit+max(s.limit/10, 1))...)
+		}
+		s.keys[key] = &sampledKey{recorded: now}
+	case now.Sub(sk.recorded) < s.window:
+		sk.suppressed++
+		sk.last, sk.actor = entry, ActorFromContext(ctx)
+		write = false
+	default:
+		entry = withSuppressed(entry, sk.suppressed)
+		sk.recorded, sk.suppressed = now, 0
+	}
+	s.mu.Unlock()
+
+	s.writeSummaries(ctx, due)
+	if write {
+		s.audit.Record(ctx, entry)
+	}
+}
+
+// flush writes the counts of expired keys and forgets them.
+func (s *auditSampler) flush(ctx context.Context) {
+	s.mu.Lock()
+	due := s.sweepLocked(s.now(), "")
+	s.mu.Unlock()
+	s.writeSummaries(ctx, due)
+}
+
+// sweepLocked forgets expired keys other than except and returns the
+// summaries they owe.
+func (s *auditSampler) sweepLocked(now time.Time, except string) []sampledSummary {
+	s.swept = now
+	var due []sampledSummary
+	for key, sk := range s.keys {
+		if key != except && now.Sub(sk.recorded) >= s.window {
+			due = append(due, sk.summary()...)
+			delete(s.keys, key)
+		}
+	}
+	return due
+}
+
+// evictLocked forgets the n keys recorded longest ago and returns the
+// summaries they owe.
+func (s *auditSampler) evictLocked(n int) []sampledSummary {
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.keys[keys[i]].recorded.Before(s.keys[keys[j]].recorded) })
+	var due []sampledSummary
+	for _, key := range keys[:min(n, len(keys))] {
+		due = append(due, s.keys[key].summary()...)
+		delete(s.keys, key)
+	}
+	return due
+}
+
+func (sk *sampledKey) summary() []sampledSummary {
+	if sk.suppressed == 0 {
+		return nil
+	}
+	entry := withSuppressed(sk.last, sk.suppressed)
+	entry.Metadata["summary"] = "true"
+	return []sampledSummary{{entry: entry, actor: sk.actor}}
+}
+
+// writeSummaries records summaries as coming from the client that caused
+// them rather than the current one.
+func (s *auditSampler) writeSummaries(ctx context.Context, due []sampledSummary) {
+	for _, summary := range due {
+		s.audit.Record(WithActor(context.WithoutCancel(ctx), summary.actor), summary.entry)
+	}
+}
+
+// withSuppressed adds a count of left-out events to the metadata of entry.
+func withSuppressed(entry AuditEntry, suppressed int) AuditEntry {
+	if suppressed == 0 {
+		return entry
+	}
+	metadata := make(map[string]string, len(entry.Metadata)+1)
+	for k, v := range entry.Metadata {
+		metadata[k] = v
+	}
+	metadata["suppressed"] = strconv.Itoa(suppressed)
+	entry.Metadata = metadata
+	return entry
+}
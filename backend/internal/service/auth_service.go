@@ -3,8 +3,10 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -19,53 +21,220 @@ var (
 	ErrSessionNotFound    = errors.New("session_not_found")
 )
 
+const (
+	defaultSessionTTL = 30 * 24 * time.Hour
+	maxUserAgentLen   = 512
+)
+
+// ClientInfo describes where a request came from.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
 type AuthService struct {
-	users    *repository.UserRepository
-	sessions *repository.UserSessionRepository
+	users      repository.UserStore
+	sessions   repository.UserSessionStore
+	identities repository.UserIdentityStore
+	sessionTTL time.Duration
+	limiter    *LoginLimiter
+	oidc       *OIDCConnector
+	audit      *AuditService
+	// failures samples the audit events of failed logins, so that password
+	// guessing cannot flood the audit log.
+	failures *auditSampler
 }
 
-func NewAuthService(users *repository.UserRepository, sessions *repository.UserSessionRepository) *AuthService {
-	return &AuthService{users: users, sessions: sessions}
+// failedLoginSampleWindow is how long repeated failed logins for one account
+// and address are counted rather than recorded one by one.
+const failedLoginSampleWindow = time.Minute
+
+// NewAuthService builds the auth service. sessionTTL is a sliding idle
+// timeout: every authenticated request pushes the expiry out again. A nil
+// limiter disables failed-login lockouts and a nil oidc connector disables
+// single sign-on.
+func NewAuthService(users repository.UserStore, sessions repository.UserSessionStore, identities repository.UserIdentityStore, sessionTTL time.Duration, limiter *LoginLimiter, oidc *OIDCConnector, audit *AuditService) *AuthService {
+	if sessionTTL <= 0 {
+		sessionTTL = defaultSessionTTL
+	}
+	return &AuthService{
+		users:      users,
+		sessions:   sessions,
+		identities: identities,
+		sessionTTL: sessionTTL,
+		limiter:    limiter,
+		oidc:       oidc,
+		audit:      audit,
+		failures:   newAuditSampler(audit, failedLoginSampleWindow),
+	}
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (domain.User, domain.UserSession, error) {
+// Login checks the credentials and opens a new session. While the account
+// or client address is locked out it returns a *LockoutError without looking
+// at the password.
+func (s *AuthService) Login(ctx context.Context, email, password string, client ClientInfo) (domain.User, domain.UserSession, error) {
+	if s.limiter != nil {
+		if err := s.limiter.Check(ctx, email, client.IPAddress); err != nil {
+			return domain.User{}, domain.UserSession{}, err
+		}
+	}
 	user, err := s.users.GetByEmail(ctx, email)
+	if err == nil && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		err = ErrInvalidCredentials
+	}
 	if err != nil {
+		// user.ID is empty for unknown emails; the attempted address is kept in
+		// the metadata either way. Repeated failures for the same address and
+		// client are counted rather than recorded one by one.
+		s.failures.record(ctx, strings.ToLower(strings.TrimSpace(email))+"|"+client.IPAddress, AuditEntry{
+			Action:        domain.AuditLoginFailed,
+			SubjectUserID: user.ID,
+			Metadata:      map[string]string{"email": email},
+		})
+		if s.limiter != nil {
+			if lockErr := s.limiter.RecordFailure(ctx, email, client.IPAddress); lockErr != nil {
+				var lockout *LockoutError
+				if errors.As(lockErr, &lockout) && lockout.Triggered {
+					s.audit.Record(ctx, AuditEntry{
+						Action:        domain.AuditLockout,
+						SubjectUserID: user.ID,
+						Metadata: map[string]string{
+							"email":       email,
+							"scope":       lockout.Scope,
+							"retry_after": lockout.RetryAfter.Round(time.Second).String(),
+						},
+					})
+				}
+				return domain.User{}, domain.UserSession{}, lockErr
+			}
+		}
 		return domain.User{}, domain.UserSession{}, ErrInvalidCredentials
 	}
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
-		return domain.User{}, domain.UserSession{}, ErrInvalidCredentials
+	if s.limiter != nil {
+		_ = s.limiter.RecordSuccess(ctx, email)
 	}
-	token, err := generateToken()
+	session, err := s.startSession(ctx, user, client, "password")
 	if err != nil {
 		return domain.User{}, domain.UserSession{}, err
 	}
-	session, err := s.sessions.Create(ctx, user.ID, token, time.Now().Add(365*24*time.Hour))
+	return user, session, nil
+}
+
+// startSession opens a session for an authenticated user. The returned
+// session carries the plaintext token for the cookie.
+func (s *AuthService) startSession(ctx context.Context, user domain.User, client ClientInfo, method string) (domain.UserSession, error) {
+	token, err := generateToken()
 	if err != nil {
-		return domain.User{}, domain.UserSession{}, err
+		return domain.UserSession{}, err
 	}
-	return user, session, nil
+	session, err := s.sessions.Create(ctx, user.ID, hashToken(token), truncate(client.UserAgent, maxUserAgentLen), client.IPAddress, time.Now().Add(s.sessionTTL))
+	if err != nil {
+		return domain.UserSession{}, err
+	}
+	session.Token = token
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditLogin,
+		ActorUserID:   user.ID,
+		SubjectUserID: user.ID,
+		TargetType:    "session",
+		TargetID:      session.ID,
+		Metadata:      map[string]string{"method": method},
+	})
+	return session, nil
 }
 
+// touchFraction is the share of the session TTL that must pass between two
+// writes of a session's expiry. Uses in between only read the session.
+const touchFraction = 10
+
+// Verify looks up the session of token and slides its expiry forward. The
+// expiry is written at most once every TTL/touchFraction, so most requests
+// do not write to the database.
 func (s *AuthService) Verify(ctx context.Context, token string) (domain.User, domain.UserSession, error) {
-	session, err := s.sessions.GetByToken(ctx, token)
-	if err != nil {
+	tokenHash := hashToken(token)
+	session, err := s.sessions.GetByTokenHash(ctx, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
 		return domain.User{}, domain.UserSession{}, ErrSessionNotFound
 	}
+	if err != nil {
+		return domain.User{}, domain.UserSession{}, err
+	}
 	if session.ExpiresAt.Before(time.Now()) {
-		_ = s.sessions.DeleteByToken(ctx, token)
+		_ = s.sessions.DeleteByTokenHash(ctx, tokenHash)
 		return domain.User{}, domain.UserSession{}, ErrSessionExpired
 	}
 	user, err := s.users.Get(ctx, session.UserID)
 	if err != nil {
 		return domain.User{}, domain.UserSession{}, err
 	}
-	_ = s.sessions.Touch(ctx, session.ID)
+	if now := time.Now(); now.Sub(session.LastUsed) >= s.sessionTTL/touchFraction {
+		session.ExpiresAt, session.LastUsed = now.Add(s.sessionTTL).UTC(), now.UTC()
+		_ = s.sessions.Touch(ctx, session.ID, session.ExpiresAt)
+	}
 	return user, session, nil
 }
 
 func (s *AuthService) Logout(ctx context.Context, token string) error {
-	return s.sessions.DeleteByToken(ctx, token)
+	tokenHash := hashToken(token)
+	session, err := s.sessions.GetByTokenHash(ctx, tokenHash)
+	if err != nil {
+		// Unknown or already removed; logging out is idempotent.
+		return s.sessions.DeleteByTokenHash(ctx, tokenHash)
+	}
+	if err := s.sessions.DeleteByTokenHash(ctx, tokenHash); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditLogout,
+		ActorUserID:   session.UserID,
+		SubjectUserID: session.UserID,
+		TargetType:    "session",
+		TargetID:      session.ID,
+	})
+	return nil
+}
+
+func (s *AuthService) ListSessions(ctx context.Context, userID string) ([]domain.UserSession, error) {
+	return s.sessions.ListByUser(ctx, userID)
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := s.sessions.Delete(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditSessionRevoked,
+		SubjectUserID: userID,
+		TargetType:    "session",
+		TargetID:      sessionID,
+	})
+	return nil
+}
+
+// RevokeOtherSessions signs the user out everywhere except keepSessionID.
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	if err := s.sessions.DeleteByUser(ctx, userID, keepSessionID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditSessionRevoked,
+		SubjectUserID: userID,
+		TargetType:    "session",
+		Metadata:      map[string]string{"scope": "others", "kept": keepSessionID},
+	})
+	return nil
+}
+
+// PurgeExpiredSessions deletes expired sessions and returns how many were
+// removed. It is run periodically by the server.
+// FlushFailedLogins writes the counts of failed logins that were left out
+// of the audit log and had no later event to carry them.
+func (s *AuthService) FlushFailedLogins(ctx context.Context) {
+	s.failures.flush(ctx)
+}
+
+func (s *AuthService) PurgeExpiredSessions(ctx context.Context) (int64, error) {
+	return s.sessions.DeleteExpired(ctx, time.Now())
 }
 
 func generateToken() (string, error) {
@@ -75,3 +244,10 @@ func generateToken() (string, error) {
 	}
 	return hex.EncodeToString(buf), nil
 }
+
+func truncate(value string, limit int) string {
+	if len(value) > limit {
+		return value[:limit]
+	}
+	return value
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository"
+	"github.com/Juicern/luma/internal/repository/memory"
+)
+
+type authFixture struct {
+	auth     *AuthService
+	sessions *memory.UserSessionRepository
+	audit    *memory.AuditEventRepository
+	user     domain.User
+}
+
+// newAuthFixture builds an auth service with one member, ada@example.com,
+// whose password is "correct horse".
+func newAuthFixture(t *testing.T, ttl time.Duration, limiter *LoginLimiter) authFixture {
+	t.Helper()
+	db := memory.NewDB()
+	users := memory.NewUserRepository(db)
+	f := authFixture{sessions: memory.NewUserSessionRepository(db), audit: memory.NewAuditEventRepository(db)}
+	var err error
+	f.user, err = users.Create(context.Background(), "Ada", "ada@example.com", mustHash(t, "correct horse"), domain.UserRoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.auth = NewAuthService(users, f.sessions, memory.NewUserIdentityRepository(db), ttl, limiter, nil, NewAuditService(f.audit, discardLogger()))
+	return f
+}
+
+func (f authFixture) events(t *testing.T, action domain.AuditAction) []domain.AuditEvent {
+	t.Helper()
+	events, err := f.audit.List(context.Background(), domain.AuditFilter{Action: string(action), Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t, time.Hour, nil)
+	client := ClientInfo{UserAgent: "test", IPAddress: "203.0.113.7"}
+
+	tests := []struct {
+		name, email, password string
+		want                  error
+	}{
+		{name: "wrong password", email: "ada@example.com", password: "wrong", want: ErrInvalidCredentials},
+		{name: "unknown email", email: "nobody@example.com", password: "correct horse", want: ErrInvalidCredentials},
+		{name: "empty password", email: "ada@example.com", password: "", want: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		if _, _, err := f.auth.Login(ctx, tt.email, tt.password, client); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Login = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	user, session, err := f.auth.Login(ctx, "ada@example.com", "correct horse", client)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if user.ID != f.user.ID || session.Token == "" || session.IPAddress != client.IPAddress {
+		t.Errorf("Login = %+v, %+v", user, session)
+	}
+	verified, _, err := f.auth.Verify(ctx, session.Token)
+	if err != nil || verified.ID != f.user.ID {
+		t.Fatalf("Verify = %+v, %v", verified, err)
+	}
+	if err := f.auth.Logout(ctx, session.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.auth.Verify(ctx, session.Token); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Verify after logout = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(LoginLimitPolicy{MaxAccountFailures: 2, Window: time.Hour, BaseLockout: time.Minute})
+	f := newAuthFixture(t, time.Hour, limiter)
+
+	if _, _, err := f.auth.Login(ctx, "ada@example.com", "wrong", ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("first failure = %v", err)
+	}
+	if _, _, err := f.auth.Login(ctx, "ada@example.com", "wrong", ClientInfo{}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("second failure = %v, want a lockout", err)
+	}
+	// While locked out even the right password is refused.
+	if _, _, err := f.auth.Login(ctx, "ada@example.com", "correct horse", ClientInfo{}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("login while locked out = %v, want %v", err, ErrTooManyAttempts)
+	}
+	if n := len(f.events(t, domain.AuditLockout)); n != 1 {
+		t.Errorf("recorded %d lockouts, want 1", n)
+	}
+
+	clock.advance(2 * time.Minute)
+	if _, _, err := f.auth.Login(ctx, "ada@example.com", "correct horse", ClientInfo{}); err != nil {
+		t.Errorf("login after the lockout: %v", err)
+	}
+}
+
+func TestLoginFailuresAreSampled(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t, time.Hour, nil)
+	clock := newFakeClock()
+	f.auth.failures.now = clock.now
+	client := ClientInfo{IPAddress: "203.0.113.7"}
+
+	for range 5 {
+		_, _, _ = f.auth.Login(ctx, "ada@example.com", "wrong", client)
+	}
+	// Another address is counted apart.
+	_, _, _ = f.auth.Login(ctx, "ada@example.com", "wrong", ClientInfo{IPAddress: "198.51.100.1"})
+	if n := len(f.events(t, domain.AuditLoginFailed)); n != 2 {
+		t.Fatalf("recorded %d failed logins, want 2", n)
+	}
+
+	clock.advance(failedLoginSampleWindow)
+	_, _, _ = f.auth.Login(ctx, "ADA@example.com", "wrong", client)
+	events := f.events(t, domain.AuditLoginFailed)
+	if len(events) != 3 {
+		t.Fatalf("recorded %d failed logins, want 3", len(events))
+	}
+	// Events are listed newest first.
+	if got := events[0].Metadata["suppressed"]; got != "4" {
+		t.Errorf("suppressed = %q, want 4", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown token", func(t *testing.T) {
+		f := newAuthFixture(t, time.Hour, nil)
+		if _, _, err := f.auth.Verify(ctx, "nope"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("Verify = %v, want %v", err, ErrSessionNotFound)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		f := newAuthFixture(t, time.Hour, nil)
+		_, session, err := f.auth.Login(ctx, "ada@example.com", "correct horse", ClientInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.sessions.Touch(ctx, session.ID, time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.auth.Verify(ctx, session.Token); !errors.Is(err, ErrSessionExpired) {
+			t.Fatalf("Verify = %v, want %v", err, ErrSessionExpired)
+		}
+		if _, err := f.sessions.GetByTokenHash(ctx, hashToken(session.Token)); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expired session kept: %v", err)
+		}
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		f := newAuthFixture(t, time.Hour, nil)
+		broken := errors.New("connection refused")
+		f.auth.sessions = failingSessions{f.sessions, broken}
+		if _, _, err := f.auth.Verify(ctx, "token"); !errors.Is(err, broken) {
+			t.Errorf("Verify = %v, want the store's error", err)
+		}
+	})
+
+	t.Run("expiry written sparingly", func(t *testing.T) {
+		ttl := 200 * time.Millisecond
+		f := newAuthFixture(t, ttl, nil)
+		_, session, err := f.auth.Login(ctx, "ada@example.com", "correct horse", ClientInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, fresh, err := f.auth.Verify(ctx, session.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fresh.ExpiresAt.Equal(session.ExpiresAt) {
+			t.Errorf("expiry rewritten right after sign-in: %s, was %s", fresh.ExpiresAt, session.ExpiresAt)
+		}
+
+		time.Sleep(ttl/touchFraction + 10*time.Millisecond)
+		_, touched, err := f.auth.Verify(ctx, session.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := f.sessions.GetByTokenHash(ctx, hashToken(session.Token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !touched.ExpiresAt.After(session.ExpiresAt) || !stored.ExpiresAt.Equal(touched.ExpiresAt) {
+			t.Errorf("expiry not slid forward: returned %s, stored %s, was %s", touched.ExpiresAt, stored.ExpiresAt, session.ExpiresAt)
+		}
+	})
+}
+
+// failingSessions is a session store whose lookups fail.
+type failingSessions struct {
+	repository.UserSessionStore
+	err error
+}
+
+func (s failingSessions) GetByTokenHash(context.Context, string) (domain.UserSession, error) {
+	return domain.UserSession{}, s.err
+}
+
+func TestFailedLoginSummaries(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t, time.Hour, nil)
+	clock := newFakeClock()
+	f.auth.failures.now = clock.now
+	client := WithActor(ctx, Actor{Client: ClientInfo{IPAddress: "203.0.113.7"}})
+
+	for range 3 {
+		_, _, _ = f.auth.Login(client, "ada@example.com", "wrong", ClientInfo{IPAddress: "203.0.113.7"})
+	}
+	f.auth.FlushFailedLogins(ctx)
+	if n := len(f.events(t, domain.AuditLoginFailed)); n != 1 {
+		t.Fatalf("flushed before the window was over: %d events", n)
+	}
+
+	clock.advance(failedLoginSampleWindow)
+	f.auth.FlushFailedLogins(ctx)
+	events := f.events(t, domain.AuditLoginFailed)
+	if len(events) != 2 {
+		t.Fatalf("recorded %d failed logins, want 2", len(events))
+	}
+	summary := events[0]
+	if summary.Metadata["summary"] != "true" || summary.Metadata["suppressed"] != "2" || summary.Metadata["email"] != "ada@example.com" {
+		t.Errorf("summary metadata = %v", summary.Metadata)
+	}
+	if summary.IPAddress != "203.0.113.7" {
+		t.Errorf("summary IP = %q, want the failing client's", summary.IPAddress)
+	}
+	// Nothing is owed any more.
+	f.auth.FlushFailedLogins(ctx)
+	if n := len(f.events(t, domain.AuditLoginFailed)); n != 2 {
+		t.Errorf("second flush wrote again: %d events", n)
+	}
+}
+
+func TestAuditSamplerLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewAuditEventRepository(memory.NewDB())
+	sampler := newAuditSampler(NewAuditService(repo, discardLogger()), time.Minute)
+	sampler.limit = 10
+	clock := newFakeClock()
+	sampler.now = clock.now
+
+	entry := AuditEntry{Action: domain.AuditLoginFailed, Metadata: map[string]string{}}
+	for i := range 25 {
+		key := string(rune('a' + i))
+		sampler.record(ctx, key, entry)
+		sampler.record(ctx, key, entry)
+		clock.advance(time.Millisecond)
+	}
+	if n := len(sampler.keys); n > sampler.limit {
+		t.Errorf("tracking %d keys, over the limit of %d", n, sampler.limit)
+	}
+	events, err := repo.List(ctx, domain.AuditFilter{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries := 0
+	for _, event := range events {
+		if event.Metadata["summary"] == "true" {
+			summaries++
+		}
+	}
+	// Every key is recorded once; each evicted one also owes a summary.
+	if want := 25 + 25 - len(sampler.keys); len(events) != want {
+		t.Errorf("recorded %d events (%d summaries), want %d", len(events), summaries, want)
+	}
+}
+
+func TestClaimedUserIsNotTheActor(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewAuditEventRepository(memory.NewDB())
+	audit := NewAuditService(repo, discardLogger())
+
+	audit.Record(WithActor(ctx, Actor{ClaimedUserID: "victim"}), AuditEntry{Action: domain.AuditPresetCreated, Metadata: map[string]string{"name": "x"}})
+	audit.Record(WithActor(ctx, Actor{UserID: "ada", ClaimedUserID: "victim"}), AuditEntry{Action: domain.AuditPresetCreated})
+
+	events, err := repo.List(ctx, domain.AuditFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("recorded %d events, want 2", len(events))
+	}
+	signedIn, anonymous := events[0], events[1]
+	if anonymous.ActorUserID != "" || anonymous.Metadata["claimed_user_id"] != "victim" || anonymous.Metadata["name"] != "x" {
+		t.Errorf("anonymous event = actor %q, metadata %v", anonymous.ActorUserID, anonymous.Metadata)
+	}
+	if signedIn.ActorUserID != "ada" || signedIn.Metadata["claimed_user_id"] != "" {
+		t.Errorf("signed-in event = actor %q, metadata %v", signedIn.ActorUserID, signedIn.Metadata)
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxCandidates is the most rewrites one request may ask for.
+const MaxCandidates = 5
+
+// ComposeVariant changes a request for one of its candidates: the preset,
+// the temperature or both take the place of the request's.
+type ComposeVariant struct {
+	PresetID    string
+	Temperature *float64
+}
+
+func (v ComposeVariant) apply(req ComposeRequest) ComposeRequest {
+	if v.PresetID != "" {
+		req.PresetID, req.PresetText = v.PresetID, ""
+	}
+	if v.Temperature != nil {
+		req.Temperature = v.Temperature
+	}
+	req.Candidates, req.Variants = 0, nil
+	return req
+}
+
+func checkCandidates(req ComposeRequest) error {
+	switch {
+	// Zero is the unset value and asks for one rewrite.
+	case req.Candidates != 0 && (req.Candidates < 1 || req.Candidates > MaxCandidates):
+		return fmt.Errorf("%w: n must be between 1 and %d", ErrInvalidGenerationSettings, MaxCandidates)
+	case len(req.Variants) > MaxCandidates:
+		return fmt.Errorf("%w: at most %d candidate variants are allowed", ErrInvalidGenerationSettings, MaxCandidates)
+	case req.Candidates > 1 && len(req.Variants) > 0:
+		return fmt.Errorf("%w: n cannot be combined with candidate variants", ErrInvalidGenerationSettings)
+	}
+	return nil
+}
+
+// composeVariants composes one candidate per variant, in parallel. Variants
+// that fail are left out; the request fails only when all of them do.
+func (s *ComposeService) composeVariants(ctx context.Context, req ComposeRequest) (ComposeResult, error) {
+	results := make([]ComposeResult, len(req.Variants))
+	errs := make([]error, len(req.Variants))
+	var wg sync.WaitGroup
+	for i, variant := range req.Variants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.compose(ctx, variant.apply(req))
+		}()
+	}
+	wg.Wait()
+
+	var merged ComposeResult
+	for i, result := range results {
+		if errs[i] != nil {
+			continue
+		}
+		candidate := result.Candidates[0]
+		candidate.PresetID, candidate.Temperature = req.Variants[i].PresetID, req.Variants[i].Temperature
+		if merged.Candidates == nil {
+			merged = result
+			merged.Candidates = nil
+		}
+		merged.Candidates = append(merged.Candidates, candidate)
+	}
+	if merged.Candidates == nil {
+		return results[0], errors.Join(errs...)
+	}
+	return merged, nil
+}
@@ -2,83 +2,508 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/postprocess"
+	"github.com/Juicern/luma/internal/promptvars"
 	"github.com/Juicern/luma/internal/providers"
 )
 
 type ComposeService struct {
-	prompts  *PromptService
-	apiKeys  *APIKeyService
-	registry *providers.Registry
+	prompts    *PromptService
+	apiKeys    *APIKeyService
+	variables  *VariableService
+	workspaces *WorkspaceService
+	redaction  *RedactionService
+	fallback   *FallbackService
+	registry   *providers.Registry
+	context    ContextPolicy
+	// steps is the post-processing chain of requests whose presets do not
+	// choose one.
+	steps []postprocess.Step
 }
 
-func NewComposeService(prompts *PromptService, apiKeys *APIKeyService, registry *providers.Registry) *ComposeService {
+func NewComposeService(prompts *PromptService, apiKeys *APIKeyService, variables *VariableService, workspaces *WorkspaceService, redaction *RedactionService, fallback *FallbackService, registry *providers.Registry, context ContextPolicy, steps []postprocess.Step) *ComposeService {
 	return &ComposeService{
-		prompts:  prompts,
-		apiKeys:  apiKeys,
-		registry: registry,
+		prompts:    prompts,
+		apiKeys:    apiKeys,
+		variables:  variables,
+		workspaces: workspaces,
+		redaction:  redaction,
+		fallback:   fallback,
+		registry:   registry,
+		context:    context,
+		steps:      steps,
 	}
 }
 
+// Default provider and model for requests whose preset does not choose one.
+const (
+	defaultComposeProvider = "openai"
+	defaultComposeModel    = "gpt-4o-mini"
+)
+
 type ComposeRequest struct {
-	UserID          string
-	Provider        string
-	Model           string
-	SystemPrompt    string
-	PresetID        string
-	PresetText      string
-	TemporaryPrompt string
-	ContextText     string
-	Content         string
-}
-
-func (s *ComposeService) Compose(ctx context.Context, req ComposeRequest) (string, error) {
-	if req.Content == "" {
-		return "", errors.New("content is required")
+	UserID   string
+	KeyLabel string
+	// GenerationSettings set by the request override those of the preset.
+	domain.GenerationSettings
+	PresetID   string
+	PresetText string
+	// WorkspaceID adds the workspace's system prompt; WorkspacePresetID
+	// adds a shared preset (and implies its workspace).
+	WorkspaceID       string
+	WorkspacePresetID string
+	TemporaryPrompt   string
+	ContextText       string
+	Content           string
+	// TargetApp, Timezone and ContextLanguage describe the client's situation
+	// and feed the built-in prompt variables. All are optional.
+	TargetApp       string
+	Timezone        string
+	ContextLanguage string
+	// Candidates asks for that many rewrites from one call to the provider;
+	// zero asks for one.
+	// Variants instead ask for one rewrite each, composed in parallel.
+	Candidates int
+	Variants   []ComposeVariant
+}
+
+// ComposeResult is a rewrite together with the layers its system prompt was
+// built from and what became of its context.
+type ComposeResult struct {
+	Text string `json:"text"`
+	// Format is the output format Text is in, and Subject the subject of an
+	// email draft.
+	Format  domain.OutputFormat `json:"output_format,omitempty"`
+	Subject string              `json:"subject,omitempty"`
+	// Candidates are set when the request asked for more than one rewrite.
+	// Text, Format and Subject are those of the first.
+	Candidates []domain.RewriteCandidate `json:"candidates,omitempty"`
+	// Provider and Model answered the request: the ones it asked for, or a
+	// fallback.
+	Provider            string               `json:"provider"`
+	Model               string               `json:"model"`
+	SystemPromptSources []SystemPromptSource `json:"system_prompt_sources"`
+	Context             ContextReport        `json:"context"`
+}
+
+// SystemPromptSource names a layer of a user's effective system prompt.
+type SystemPromptSource string
+
+const (
+	SystemPromptSourceGlobal    SystemPromptSource = "global"
+	SystemPromptSourceWorkspace SystemPromptSource = "workspace"
+	SystemPromptSourceUser      SystemPromptSource = "user"
+)
+
+// EffectiveSystemPrompt is the system prompt sent for a user and the layers
+// it was built from, in order. Variables are not yet filled in.
+type EffectiveSystemPrompt struct {
+	PromptText string               `json:"prompt_text"`
+	Sources    []SystemPromptSource `json:"sources"`
+}
+
+func (p *EffectiveSystemPrompt) add(source SystemPromptSource, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if p.PromptText != "" {
+		p.PromptText += "\n\n"
 	}
+	p.PromptText += text
+	p.Sources = append(p.Sources, source)
+}
 
-	systemPromptText := req.SystemPrompt
-	if systemPromptText == "" {
-		systemPrompt, err := s.prompts.GetSystemPrompt(ctx)
+// EffectiveSystemPrompt resolves the system prompt of userID's rewrites,
+// optionally within a workspace.
+func (s *ComposeService) EffectiveSystemPrompt(ctx context.Context, userID, workspaceID string) (EffectiveSystemPrompt, error) {
+	layer, err := s.workspaces.ComposeLayer(ctx, userID, workspaceID, "")
+	if err != nil {
+		return EffectiveSystemPrompt{}, err
+	}
+	return s.effectiveSystemPrompt(ctx, userID, layer.SystemPrompt)
+}
+
+// effectiveSystemPrompt layers the system prompts. A user's own prompt in
+// replace mode takes the place of the global one; in append mode it comes
+// last, after the workspace's.
+func (s *ComposeService) effectiveSystemPrompt(ctx context.Context, userID, workspacePrompt string) (EffectiveSystemPrompt, error) {
+	var prompt EffectiveSystemPrompt
+	own, err := s.prompts.GetUserSystemPrompt(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return EffectiveSystemPrompt{}, err
+	}
+	if own.Mode == domain.SystemPromptReplace {
+		prompt.add(SystemPromptSourceUser, own.PromptText)
+	} else {
+		global, err := s.prompts.GetSystemPrompt(ctx)
 		if err != nil {
-			return "", err
+			return EffectiveSystemPrompt{}, err
 		}
-		systemPromptText = systemPrompt.PromptText
+		prompt.add(SystemPromptSourceGlobal, global.PromptText)
+	}
+	prompt.add(SystemPromptSourceWorkspace, workspacePrompt)
+	if own.Mode == domain.SystemPromptAppend {
+		prompt.add(SystemPromptSourceUser, own.PromptText)
 	}
+	return prompt, nil
+}
 
-	promptText := req.PresetText
-	if promptText == "" && req.PresetID != "" {
-		preset, err := s.prompts.GetPreset(ctx, req.PresetID)
+// Compose rewrites req.Content. Prompts are layered from the most general to
+// the most specific, and the more specific layer wins a conflict:
+//
+//   - the system prompt: the global one (or the user's replacement for it),
+//     then the workspace's, then the user's appended one;
+//   - the workspace preset, ranked below the personal preset;
+//   - the temporary prompt, above everything else.
+//
+// Generation settings follow the same order: the request's override the
+// personal preset's, which override the workspace preset's.
+//
+// When redaction is on, personal data in the content and context is replaced
+// by placeholders before the provider is called, and put back in its answer.
+// The answer is post-processed before that, so the steps never alter the
+// redacted data, and converted to the output format after.
+//
+// When the context looks like a prompt injection and the policy refuses it,
+// Compose returns ErrContextInjection with a result reporting the finding.
+func (s *ComposeService) Compose(ctx context.Context, req ComposeRequest) (ComposeResult, error) {
+	if err := checkCandidates(req); err != nil {
+		return ComposeResult{}, err
+	}
+	if len(req.Variants) > 0 {
+		return s.composeVariants(ctx, req)
+	}
+	result, err := s.compose(ctx, req)
+	if len(result.Candidates) == 1 {
+		result.Candidates = nil
+	}
+	return result, err
+}
+
+// compose rewrites req.Content into req.Candidates candidates, or one.
+func (s *ComposeService) compose(ctx context.Context, req ComposeRequest) (ComposeResult, error) {
+	c, err := s.prepare(ctx, req)
+	if err != nil {
+		return ComposeResult{}, err
+	}
+	if injection := c.preview.Context.Injection; injection != nil && injection.Action == domain.InjectionRefuse {
+		return ComposeResult{SystemPromptSources: c.preview.SystemPromptSources, Context: c.preview.Context}, ErrContextInjection
+	}
+	if c.preview.Context.Strategy == TruncateSummarize {
+		// Summaries are left to the requested provider; without a client or
+		// a key for it the context is cut instead.
+		if keys, err := s.providerKeys(ctx, req.UserID, c.request.ProviderName, req.KeyLabel); err == nil && c.client != nil {
+			s.summarizeContext(ctx, &c, c.context, keys)
+		} else {
+			c.preview.Context.Strategy = TruncateHeadTail
+		}
+	}
+
+	texts, target, err := s.generateWithFallback(ctx, c, req.UserID, req.KeyLabel, max(req.Candidates, 1))
+	if err != nil {
+		return ComposeResult{}, err
+	}
+	format := c.preview.Settings.OutputFormat
+	result := ComposeResult{
+		Format:              format,
+		Provider:            target.provider,
+		Model:               target.model,
+		SystemPromptSources: c.preview.SystemPromptSources,
+		Context:             c.preview.Context,
+	}
+	for _, text := range texts {
+		text, subject := formatOutput(format, c.redactor.restore(postprocess.Apply(text, c.steps)))
+		result.Candidates = append(result.Candidates, domain.RewriteCandidate{Text: text, OutputFormat: format, EmailSubject: subject})
+	}
+	result.Text, result.Subject = result.Candidates[0].Text, result.Candidates[0].EmailSubject
+	return result, nil
+}
+
+// generateWithFallback asks the requested provider for n answers and, while
+// that fails, each target of the fallback chain in turn. It returns the
+// target that answered. The request's key label pins only the key of the
+// requested provider.
+func (s *ComposeService) generateWithFallback(ctx context.Context, c composition, userID, keyLabel string, n int) ([]string, fallbackTarget, error) {
+	var errs []error
+	for i, target := range c.targets {
+		client, ok := s.registry.Client(target.provider)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", target, ErrProviderNotSupported))
+			continue
+		}
+		label := keyLabel
+		if i > 0 {
+			label = ""
+		}
+		keys, err := s.providerKeys(ctx, userID, target.provider, label)
 		if err != nil {
-			return "", err
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+			continue
+		}
+		req := c.request
+		req.ProviderName, req.Model = target.provider, target.model
+		texts, err := generateN(ctx, client, req, keys, n, s.fallback.retry)
+		if err == nil {
+			return texts, target, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		if ctx.Err() != nil {
+			break
 		}
-		promptText = preset.PromptText
 	}
+	return nil, fallbackTarget{}, errors.Join(errs...)
+}
 
-	client, ok := s.registry.Client(req.Provider)
-	if !ok {
-		return "", ErrProviderNotSupported
+// providerKeys lists the keys to try with a provider. Providers that need
+// none, such as a local server, are called once without.
+func (s *ComposeService) providerKeys(ctx context.Context, userID, provider, label string) ([]ProviderKey, error) {
+	keys, err := s.apiKeys.Candidates(ctx, userID, provider, label)
+	if errors.Is(err, ErrMissingAPIKey) && s.registry.Keyless(provider) {
+		return []ProviderKey{{}}, nil
 	}
+	return keys, err
+}
 
-	apiKey, err := s.apiKeys.GetDecrypted(ctx, req.UserID, req.Provider)
+// generate calls the provider with the first key it accepts. It fails over
+// to the next key only when the provider rejected the key itself; any other
+// error is returned as is. Each key is retried as retry says.
+func generate(ctx context.Context, client providers.LLMClient, req providers.GenerateRequest, keys []ProviderKey, retry RetryPolicy) (string, error) {
+	texts, err := generateN(ctx, client, req, keys, 1, retry)
 	if err != nil {
 		return "", err
 	}
+	return texts[0], nil
+}
+
+// generateN is generate for n answers.
+func generateN(ctx context.Context, client providers.LLMClient, req providers.GenerateRequest, keys []ProviderKey, n int, retry RetryPolicy) ([]string, error) {
+	var lastErr error
+	for _, key := range keys {
+		req.APIKey = key.APIKey
+		texts, err := retry.do(ctx, func(ctx context.Context) ([]string, error) {
+			return providers.GenerateN(ctx, client, req, n)
+		})
+		if err == nil {
+			return texts, nil
+		}
+		if !errors.Is(err, providers.ErrKeyRejected) {
+			return nil, err
+		}
+		lastErr = fmt.Errorf("key %q: %w", key.Label, err)
+	}
+	return nil, lastErr
+}
+
+// ComposePreview shows what Compose would send for a request.
+type ComposePreview struct {
+	// Settings are the resolved provider, model and sampling parameters.
+	// Their fallback chain is the one the request would fall back on.
+	Settings            domain.GenerationSettings `json:"settings"`
+	Messages            []providers.Message       `json:"messages"`
+	SystemPromptSources []SystemPromptSource      `json:"system_prompt_sources"`
+	Preset              *PreviewPreset            `json:"preset,omitempty"`
+	WorkspacePreset     *PreviewPreset            `json:"workspace_preset,omitempty"`
+	Variables           []VariableExpansion       `json:"variables"`
+	Context             ContextReport             `json:"context"`
+	// Redactions lists the placeholders standing in for personal data.
+	Redactions      []Redaction `json:"redactions,omitempty"`
+	EstimatedTokens int         `json:"estimated_tokens"`
+}
+
+// PreviewPreset identifies a preset used by a composition.
+type PreviewPreset struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// TextOverridden is set when the request supplied its own text for the
+	// preset.
+	TextOverridden bool `json:"text_overridden,omitempty"`
+}
+
+// VariableExpansion is one placeholder used by the prompts. Unresolved ones
+// are sent as written.
+type VariableExpansion struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Builtin  bool   `json:"builtin"`
+	Resolved bool   `json:"resolved"`
+}
+
+// Preview resolves a request exactly as Compose does, without needing an API
+// key and without calling the provider. Context that Compose would summarize
+// is shown cut to its head and tail, as it is sent if summarizing fails.
+func (s *ComposeService) Preview(ctx context.Context, req ComposeRequest) (ComposePreview, error) {
+	c, err := s.prepare(ctx, req)
+	if err != nil {
+		return ComposePreview{}, err
+	}
+	return c.preview, nil
+}
+
+// composition is a request resolved up to the provider call.
+type composition struct {
+	// client is the requested provider's, nil when it is not registered.
+	client  providers.LLMClient
+	request providers.GenerateRequest
+	// targets are the requested provider and model, then the fallbacks.
+	targets []fallbackTarget
+	preview ComposePreview
+	// context is the redacted and screened context text before truncation.
+	context  string
+	redactor *redactor
+	steps    []postprocess.Step
+}
+
+func (s *ComposeService) prepare(ctx context.Context, req ComposeRequest) (composition, error) {
+	if req.Content == "" {
+		return composition{}, errors.New("content is required")
+	}
+	var preview ComposePreview
 
-	model := req.Model
-	if model == "" {
-		model = "gpt-4o-mini"
+	promptText := req.PresetText
+	var presetSettings domain.GenerationSettings
+	if req.PresetID != "" {
+		preset, err := s.prompts.ownedPreset(ctx, req.UserID, req.PresetID)
+		if err != nil {
+			return composition{}, err
+		}
+		preview.Preset = &PreviewPreset{ID: preset.ID, Name: preset.Name, TextOverridden: promptText != ""}
+		if promptText == "" {
+			promptText = preset.PromptText
+		}
+		presetSettings = preset.GenerationSettings
+	}
+	layer, err := s.workspaces.ComposeLayer(ctx, req.UserID, req.WorkspaceID, req.WorkspacePresetID)
+	if err != nil {
+		return composition{}, err
+	}
+	systemPrompt, err := s.effectiveSystemPrompt(ctx, req.UserID, layer.SystemPrompt)
+	if err != nil {
+		return composition{}, err
+	}
+	preview.SystemPromptSources = systemPrompt.Sources
+	var workspacePrompt string
+	var workspaceSettings domain.GenerationSettings
+	if layer.Preset != nil {
+		preview.WorkspacePreset = &PreviewPreset{ID: layer.Preset.ID, Name: layer.Preset.Name}
+		workspacePrompt = layer.Preset.PromptText
+		workspaceSettings = layer.Preset.GenerationSettings
 	}
 
-	return client.Generate(ctx, providers.GenerateRequest{
-		ProviderName:    req.Provider,
-		Model:           model,
-		SystemPrompt:    systemPromptText,
-		PresetPrompt:    promptText,
-		TemporaryPrompt: req.TemporaryPrompt,
+	settings, err := normalizeGenerationSettings(req.GenerationSettings.Or(presetSettings).Or(workspaceSettings))
+	if err != nil {
+		return composition{}, err
+	}
+	steps := s.steps
+	if settings.Postprocess != nil {
+		// Checked by normalizeGenerationSettings.
+		steps, _ = postprocess.Parse(settings.Postprocess)
+	} else {
+		for _, step := range steps {
+			settings.Postprocess = append(settings.Postprocess, string(step))
+		}
+	}
+	if settings.Provider == "" {
+		settings.Provider = defaultComposeProvider
+	}
+	if settings.Model == "" {
+		settings.Model = defaultComposeModel
+	}
+	chain, err := s.fallback.chain(ctx, req.UserID, settings.Fallback)
+	if err != nil {
+		return composition{}, err
+	}
+	targets := fallbackTargets(fallbackTarget{provider: settings.Provider, model: settings.Model}, chain)
+	settings.Fallback = nil
+	for _, target := range targets[1:] {
+		settings.Fallback = append(settings.Fallback, target.String())
+	}
+	preview.Settings = settings
+	// An unknown provider is skipped like any failing target, so it is only
+	// an error when there is nothing to fall back to.
+	client, ok := s.registry.Client(settings.Provider)
+	if !ok && len(targets) == 1 {
+		return composition{}, ErrProviderNotSupported
+	}
+
+	redactor, err := s.redaction.redactor(ctx, req.UserID, settings.RedactPII)
+	if err != nil {
+		return composition{}, err
+	}
+
+	vars, err := s.variables.Values(ctx, req.UserID, composeEnvironment(req))
+	if err != nil {
+		return composition{}, err
+	}
+	preview.Variables = variableExpansions(vars, systemPrompt.PromptText, promptText, workspacePrompt, req.TemporaryPrompt)
+
+	genReq := providers.GenerateRequest{
+		ProviderName:    settings.Provider,
+		Model:           settings.Model,
+		SystemPrompt:    promptvars.Expand(systemPrompt.PromptText, vars),
+		PresetPrompt:    promptvars.Expand(promptText, vars),
+		WorkspacePrompt: promptvars.Expand(workspacePrompt, vars),
+		TemporaryPrompt: promptvars.Expand(req.TemporaryPrompt, vars),
+		FormatPrompt:    formatPrompts[settings.OutputFormat],
+		Content:         redactor.redact(req.Content),
+		Temperature:     settings.Temperature,
+		MaxTokens:       settings.MaxTokens,
+		TopP:            settings.TopP,
+	}
+	contextText, injection := s.context.Injection.screen(redactor.redact(req.ContextText))
+	genReq.ContextText = contextText
+	preview.Context = s.context.fitContext(&genReq)
+	preview.Context.Injection = injection
+	preview.Redactions = redactor.redactions()
+	preview.Messages = providers.BuildMessages(genReq)
+	preview.EstimatedTokens = providers.EstimatorFor(genReq.Model).CountMessages(preview.Messages)
+	return composition{client: client, request: genReq, targets: targets, preview: preview, context: contextText, redactor: redactor, steps: steps}, nil
+}
+
+// variableExpansions lists the placeholders used across texts, in order of
+// first use, with the values they expand to.
+func variableExpansions(vars map[string]string, texts ...string) []VariableExpansion {
+	expansions := []VariableExpansion{}
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		for _, name := range promptvars.Names(text) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			value, ok := vars[name]
+			expansions = append(expansions, VariableExpansion{
+				Name:     name,
+				Value:    value,
+				Builtin:  promptvars.IsBuiltin(name),
+				Resolved: ok,
+			})
+		}
+	}
+	return expansions
+}
+
+// composeEnvironment describes the request for the built-in variables. An
+// unknown time zone falls back to the server's rather than failing the
+// request.
+func composeEnvironment(req ComposeRequest) promptvars.Environment {
+	env := promptvars.Environment{
+		Now:             time.Now(),
+		TargetApp:       req.TargetApp,
+		ContextLanguage: req.ContextLanguage,
 		ContextText:     req.ContextText,
-		Content:         req.Content,
-		APIKey:          apiKey,
-	})
+	}
+	if req.Timezone != "" {
+		if location, err := time.LoadLocation(req.Timezone); err == nil {
+			env.Location = location
+		}
+	}
+	return env
 }
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Juicern/luma/internal/providers"
+)
+
+func TestContextWindow(t *testing.T) {
+	policy := ContextPolicy{ContextWindows: map[string]int{"default": 8000, "gpt-4": 8192, "gpt-4o": 128000}}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4o-mini", 128000},
+		{"GPT-4-turbo", 8192},
+		{"llama3", 8000},
+	}
+	for _, tt := range tests {
+		if got := policy.window(tt.model); got != tt.want {
+			t.Errorf("window(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+	if got := (ContextPolicy{}).window("gpt-4o"); got != 0 {
+		t.Errorf("window without windows = %d, want 0", got)
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	maxTokens := 300
+	tests := []struct {
+		name      string
+		policy    ContextPolicy
+		prompt    int
+		maxTokens *int
+		want      int
+	}{
+		{name: "unlimited", policy: ContextPolicy{}, prompt: 100, want: -1},
+		{name: "cap only", policy: ContextPolicy{BudgetTokens: 500}, prompt: 100, want: 500},
+		{
+			name:   "window less prompt and reserve",
+			policy: ContextPolicy{ReserveOutputTokens: 200, ContextWindows: map[string]int{"default": 1000}},
+			prompt: 100,
+			want:   700,
+		},
+		{
+			name:      "max_tokens replaces the reserve",
+			policy:    ContextPolicy{ReserveOutputTokens: 200, ContextWindows: map[string]int{"default": 1000}},
+			prompt:    100,
+			maxTokens: &maxTokens,
+			want:      600,
+		},
+		{
+			name:   "cap below the room",
+			policy: ContextPolicy{BudgetTokens: 50, ContextWindows: map[string]int{"default": 1000}},
+			prompt: 100,
+			want:   50,
+		},
+		{
+			name:   "no room",
+			policy: ContextPolicy{ReserveOutputTokens: 500, ContextWindows: map[string]int{"default": 1000}},
+			prompt: 900,
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.budget("model", tt.prompt, tt.maxTokens); got != tt.want {
+			t.Errorf("%s: budget = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	estimator := providers.EstimatorFor("gpt-4o")
+	text := longContext()
+
+	if got := headTail("short text", 100, estimator); got != "short text" {
+		t.Errorf("text within budget changed to %q", got)
+	}
+	if got := headTail(text, 0, estimator); got != "" {
+		t.Errorf("zero budget kept %q", got)
+	}
+	for _, budget := range []int{20, 100, 1000} {
+		got := headTail(text, budget, estimator)
+		if tokens := estimator.Count(got); tokens > budget || tokens < budget/2 {
+			t.Errorf("budget %d: kept %d tokens", budget, tokens)
+		}
+		if !strings.HasPrefix(got, "BEGINNING") || !strings.HasSuffix(got, "ENDING") {
+			t.Errorf("budget %d: ends not kept: %.40q…", budget, got)
+		}
+		// The cut falls between words.
+		head, _, _ := strings.Cut(got, "\n\n[…")
+		if words := strings.Fields(head); len(words) > 1 && len(words[len(words)-1]) != len("worda") {
+			t.Errorf("budget %d: head cut inside a word: …%q", budget, words[len(words)-1])
+		}
+	}
+	// Text without spaces is cut all the same.
+	cjk := strings.Repeat("会议改到周五", 200)
+	if got := headTail(cjk, 100, estimator); estimator.Count(got) > 100 || got == "" {
+		t.Errorf("CJK text cut to %d tokens", estimator.Count(got))
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime"
+	"mime/quotedprintable"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// ErrNotEmailDraft is returned for a transcription whose rewrite is not a
+// finished email draft.
+var ErrNotEmailDraft = errors.New("not_email_draft")
+
+// EmailDraft returns the rewrite of a transcription, or the candidate the
+// user chose, as an RFC 5322 message that mail clients open as an unsent
+// draft.
+func (t *TranscriptionService) EmailDraft(ctx context.Context, userID, id string) ([]byte, error) {
+	entry, err := t.logs.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.GeneratedText == nil {
+		return nil, ErrNotEmailDraft
+	}
+	draft := domain.RewriteCandidate{Text: *entry.GeneratedText, OutputFormat: entry.OutputFormat, EmailSubject: entry.EmailSubject}
+	if i := entry.ChosenCandidate; i != nil && *i < len(entry.Candidates) {
+		draft = entry.Candidates[*i]
+	}
+	if draft.OutputFormat != domain.OutputEmail {
+		return nil, ErrNotEmailDraft
+	}
+
+	var b bytes.Buffer
+	b.WriteString("Date: " + entry.CreatedAt.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", draft.EmailSubject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("X-Unsent: 1\r\n\r\n")
+	body := quotedprintable.NewWriter(&b)
+	if _, err := body.Write([]byte(draft.Text)); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteString("\r\n")
+	return b.Bytes(), nil
+}
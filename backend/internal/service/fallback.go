@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/providers"
+	"github.com/Juicern/luma/internal/repository"
+)
+
+var ErrInvalidFallback = errors.New("invalid_fallback")
+
+// NoFallback is the chain that turns fallback off where a wider one would
+// otherwise apply.
+const NoFallback = "none"
+
+// fallbackModels are the models tried for chain entries that name only a
+// provider. Other providers keep the model of the request.
+var fallbackModels = map[string]string{
+	"openai":    "gpt-4o-mini",
+	"anthropic": "claude-3-5-haiku-latest",
+	"ollama":    "llama3.2",
+}
+
+// RetryPolicy says how often and how patiently a provider is called before
+// the next one in the chain is tried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls per provider and key; at least one
+	// is always made.
+	MaxAttempts int
+	// InitialBackoff caps the wait before the first retry and doubles for
+	// each one after, up to MaxBackoff. The wait itself is a random share of
+	// the cap, so that clients failing together do not retry together.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// AttemptTimeout bounds each call; zero leaves it to the request.
+	AttemptTimeout time.Duration
+}
+
+// do calls fn until it succeeds, fails with an error that is not worth
+// repeating, or runs out of attempts.
+func (p RetryPolicy) do(ctx context.Context, fn func(context.Context) ([]string, error)) ([]string, error) {
+	var err error
+	for attempt := range max(p.MaxAttempts, 1) {
+		if attempt > 0 {
+			timer := time.NewTimer(p.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, err
+			case <-timer.C:
+			}
+		}
+		var texts []string
+		texts, err = p.attempt(ctx, fn)
+		// A per-attempt timeout is retried; the end of the request is not.
+		if err == nil || !providers.Retryable(err) || ctx.Err() != nil {
+			return texts, err
+		}
+	}
+	return nil, err
+}
+
+func (p RetryPolicy) attempt(ctx context.Context, fn func(context.Context) ([]string, error)) ([]string, error) {
+	if p.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// backoff is the wait before retry number retry, counted from zero.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.InitialBackoff
+	for ; retry > 0 && ceiling < p.MaxBackoff; retry-- {
+		ceiling *= 2
+	}
+	if p.MaxBackoff > 0 && ceiling > p.MaxBackoff {
+		ceiling = p.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// FallbackService manages users' fallback chains: the providers tried, in
+// order, when the one a rewrite asked for keeps failing.
+type FallbackService struct {
+	repo repository.FallbackChainStore
+	// defaultChain applies to users without a chain of their own.
+	defaultChain []string
+	retry        RetryPolicy
+	audit        *AuditService
+}
+
+// NewFallbackService checks the server's default chain, which is given in
+// the same form as users' chains.
+func NewFallbackService(repo repository.FallbackChainStore, defaultChain []string, retry RetryPolicy, audit *AuditService) (*FallbackService, error) {
+	chain, err := normalizeFallback(defaultChain)
+	if err != nil {
+		return nil, fmt.Errorf("fallback: %w", err)
+	}
+	return &FallbackService{repo: repo, defaultChain: chain, retry: retry, audit: audit}, nil
+}
+
+// FallbackSettings are a user's fallback chain.
+type FallbackSettings struct {
+	Chain []string `json:"chain"`
+	// Default is set when the user has no chain and the server's default
+	// applies.
+	Default bool `json:"default"`
+}
+
+func (s *FallbackService) Settings(ctx context.Context, userID string) (FallbackSettings, error) {
+	chain, err := s.repo.Get(ctx, userID)
+	switch {
+	case err == nil:
+		return FallbackSettings{Chain: chain.Chain}, nil
+	case errors.Is(err, sql.ErrNoRows):
+		settings := FallbackSettings{Chain: s.defaultChain, Default: true}
+		if settings.Chain == nil {
+			settings.Chain = []string{}
+		}
+		return settings, nil
+	default:
+		return FallbackSettings{}, err
+	}
+}
+
+// SetChain replaces a user's chain. Entries are "provider" or
+// "provider/model"; the single entry "none" turns fallback off even where
+// the server has a default chain.
+func (s *FallbackService) SetChain(ctx context.Context, userID string, chain []string) (FallbackSettings, error) {
+	chain, err := normalizeFallback(chain)
+	if err != nil {
+		return FallbackSettings{}, fmt.Errorf("%w: %v", ErrInvalidFallback, err)
+	}
+	if len(chain) == 0 {
+		return FallbackSettings{}, fmt.Errorf("%w: chain is empty", ErrInvalidFallback)
+	}
+	if _, err := s.repo.Upsert(ctx, userID, chain); err != nil {
+		return FallbackSettings{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditFallbackUpdated,
+		SubjectUserID: userID,
+		TargetType:    "fallback",
+		TargetID:      userID,
+		Metadata:      map[string]string{"chain": strings.Join(chain, ",")},
+	})
+	return FallbackSettings{Chain: chain}, nil
+}
+
+// ClearChain removes a user's chain, so the server's default applies again.
+func (s *FallbackService) ClearChain(ctx context.Context, userID string) error {
+	if err := s.repo.Delete(ctx, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditFallbackCleared,
+		SubjectUserID: userID,
+		TargetType:    "fallback",
+		TargetID:      userID,
+	})
+	return nil
+}
+
+// chain resolves the fallback chain of a rewrite: the one its request or
+// preset chose, else the user's, else the server's. "none" resolves to no
+// chain.
+func (s *FallbackService) chain(ctx context.Context, userID string, chosen []string) ([]string, error) {
+	chain := chosen
+	if chain == nil {
+		settings, err := s.Settings(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		chain = settings.Chain
+	}
+	if len(chain) == 1 && chain[0] == NoFallback {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// fallbackTarget is a provider and model a rewrite may be sent to.
+type fallbackTarget struct {
+	provider string
+	model    string
+}
+
+func (t fallbackTarget) String() string {
+	return t.provider + "/" + t.model
+}
+
+// fallbackTargets turns the entries of a checked chain into the targets
+// tried after primary, leaving out repeats.
+func fallbackTargets(primary fallbackTarget, chain []string) []fallbackTarget {
+	targets := []fallbackTarget{primary}
+	for _, entry := range chain {
+		provider, model, _ := strings.Cut(entry, "/")
+		if model == "" {
+			model = fallbackModels[provider]
+		}
+		if model == "" {
+			model = primary.model
+		}
+		target := fallbackTarget{provider: provider, model: model}
+		repeated := false
+		for _, t := range targets {
+			repeated = repeated || t == target
+		}
+		if !repeated {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// normalizeFallback checks a chain and lowercases its provider names. Model
+// names are kept as written.
+func normalizeFallback(chain []string) ([]string, error) {
+	if chain == nil {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(chain))
+	for _, entry := range chain {
+		provider, model, hasModel := strings.Cut(strings.TrimSpace(entry), "/")
+		provider, model = strings.ToLower(strings.TrimSpace(provider)), strings.TrimSpace(model)
+		switch {
+		case provider == "":
+			return nil, errors.New("fallback entries must name a provider")
+		case hasModel && model == "":
+			return nil, fmt.Errorf("fallback entry %q has an empty model", entry)
+		case provider == NoFallback && (hasModel || len(chain) > 1):
+			return nil, fmt.Errorf("%q must be the only fallback entry", NoFallback)
+		case hasModel:
+			normalized = append(normalized, provider+"/"+model)
+		default:
+			normalized = append(normalized, provider)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/postprocess"
+)
+
+var ErrInvalidGenerationSettings = errors.New("invalid_generation_settings")
+
+// normalizeGenerationSettings trims the provider and model names, checks the
+// sampling parameters against the ranges every adapter accepts, and the
+// post-processing steps and output format against those that exist, and the
+// form of the fallback chain. An empty post-processing chain is unset.
+func normalizeGenerationSettings(settings domain.GenerationSettings) (domain.GenerationSettings, error) {
+	settings.Provider = strings.ToLower(strings.TrimSpace(settings.Provider))
+	settings.Model = strings.TrimSpace(settings.Model)
+	if t := settings.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return settings, fmt.Errorf("%w: temperature must be between 0 and 2", ErrInvalidGenerationSettings)
+	}
+	if p := settings.TopP; p != nil && (*p <= 0 || *p > 1) {
+		return settings, fmt.Errorf("%w: top_p must be greater than 0 and at most 1", ErrInvalidGenerationSettings)
+	}
+	if n := settings.MaxTokens; n != nil && *n <= 0 {
+		return settings, fmt.Errorf("%w: max_tokens must be positive", ErrInvalidGenerationSettings)
+	}
+	settings.OutputFormat = domain.OutputFormat(strings.ToLower(strings.TrimSpace(string(settings.OutputFormat))))
+	if f := settings.OutputFormat; f != "" && !f.Valid() {
+		return settings, fmt.Errorf("%w: output_format must be plain, markdown, html or email", ErrInvalidGenerationSettings)
+	}
+	if settings.Postprocess != nil {
+		chain, err := postprocess.Parse(settings.Postprocess)
+		if err != nil {
+			return settings, fmt.Errorf("%w: %v", ErrInvalidGenerationSettings, err)
+		}
+		settings.Postprocess = nil
+		for _, step := range chain {
+			settings.Postprocess = append(settings.Postprocess, string(step))
+		}
+	}
+	fallback, err := normalizeFallback(settings.Fallback)
+	if err != nil {
+		return settings, fmt.Errorf("%w: %v", ErrInvalidGenerationSettings, err)
+	}
+	settings.Fallback = fallback
+	return settings, nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+// ErrContextInjection is returned by Compose when the context looks like a
+// prompt injection and the policy refuses such rewrites.
+var ErrContextInjection = errors.New("context_injection")
+
+// defaultInjectionPatterns match common attempts to take over a model from
+// within pasted text. They are matched case-insensitively.
+var defaultInjectionPatterns = []string{
+	`\b(ignore|disregard|override|skip)\s+(all\s+|any\s+)?(of\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|preceding|system|original)\s+(instructions|prompts?|messages|rules|directions)`,
+	`\bforget\s+(all\s+|everything\s+)?(you\s+(were|have\s+been)\s+told|(your|the|previous|prior)\s+instructions)`,
+	`\byou\s+are\s+now\s+(a|an|in|the)\b`,
+	`\b(new|updated|real|actual)\s+(system\s+)?instructions\s*:`,
+	`\b(reveal|print|show|repeat|output)\s+(your|the)\s+(system\s+prompt|hidden\s+instructions|instructions\s+above)`,
+	`<\s*/?\s*(system|assistant|clipboard_context)\s*>`,
+	`<\|im_(start|end)\|>`,
+	`\[/?INST\]`,
+	`(?m)^\s*#*\s*(system|assistant)\s*:`,
+}
+
+// InjectionPolicy screens context text for prompt injections.
+type InjectionPolicy struct {
+	Action   domain.InjectionAction
+	patterns []*regexp.Regexp
+}
+
+// NewInjectionPolicy compiles the built-in patterns together with extra
+// ones. An empty action defaults to InjectionWarn.
+func NewInjectionPolicy(action domain.InjectionAction, extra []string) (InjectionPolicy, error) {
+	if action == "" {
+		action = domain.InjectionWarn
+	}
+	if !action.Valid() {
+		return InjectionPolicy{}, fmt.Errorf("unknown injection action %q", action)
+	}
+	policy := InjectionPolicy{Action: action}
+	for _, pattern := range append(append([]string{}, defaultInjectionPatterns...), extra...) {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return InjectionPolicy{}, fmt.Errorf("injection pattern %q: %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+	return policy, nil
+}
+
+// InjectionReport is what the detector found in a request's context and
+// what was done about it.
+type InjectionReport struct {
+	Action domain.InjectionAction `json:"action"`
+	// Matches quotes the suspicious passages, shortened.
+	Matches []string `json:"matches"`
+}
+
+// maxReportedMatches and maxMatchLength bound the quotes in a report.
+const (
+	maxReportedMatches = 5
+	maxMatchLength     = 80
+)
+
+// strippedLine replaces each line removed by InjectionStrip.
+const strippedLine = "[line removed]"
+
+// screen checks text against the policy. It returns the text to send, with
+// offending lines removed under InjectionStrip, and a report when anything
+// was found.
+func (p InjectionPolicy) screen(text string) (string, *InjectionReport) {
+	if p.Action == domain.InjectionOff || text == "" {
+		return text, nil
+	}
+	var spans [][]int
+	for _, re := range p.patterns {
+		spans = append(spans, re.FindAllStringIndex(text, -1)...)
+	}
+	if len(spans) == 0 {
+		return text, nil
+	}
+
+	report := &InjectionReport{Action: p.Action, Matches: []string{}}
+	seen := make(map[string]bool)
+	for _, span := range spans {
+		match := strings.Join(strings.Fields(text[span[0]:span[1]]), " ")
+		if seen[match] || len(report.Matches) == maxReportedMatches {
+			continue
+		}
+		seen[match] = true
+		if runes := []rune(match); len(runes) > maxMatchLength {
+			match = string(runes[:maxMatchLength]) + "…"
+		}
+		report.Matches = append(report.Matches, match)
+	}
+	if p.Action == domain.InjectionStrip {
+		text = stripLines(text, spans)
+	}
+	return text, report
+}
+
+// stripLines replaces every line that overlaps one of spans.
+func stripLines(text string, spans [][]int) string {
+	lines := strings.SplitAfter(text, "\n")
+	var b strings.Builder
+	start := 0
+	for _, line := range lines {
+		end := start + len(line)
+		hit := false
+		for _, span := range spans {
+			if span[0] < end && span[1] > start {
+				hit = true
+				break
+			}
+		}
+		if hit {
+			b.WriteString(strippedLine)
+			if strings.HasSuffix(line, "\n") {
+				b.WriteString("\n")
+			}
+		} else {
+			b.WriteString(line)
+		}
+		start = end
+	}
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Juicern/luma/internal/repository"
+)
+
+var ErrTooManyAttempts = errors.New("too_many_attempts")
+
+// LockoutError is returned by Login while an account or client address is
+// locked out. It matches ErrTooManyAttempts with errors.Is.
+type LockoutError struct {
+	// Scope is "account" or "ip".
+	Scope      string
+	RetryAfter time.Duration
+	// Triggered is set on the failed attempt that started the lockout.
+	Triggered bool
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed login attempts for %s; retry after %s", e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// LoginLimitPolicy configures lockouts. Once a key reaches its failure
+// threshold it is locked for BaseLockout, doubling with every further failure
+// up to MaxLockout. Counters restart after Window without failures.
+type LoginLimitPolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	Window             time.Duration
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+}
+
+type LoginLimiter struct {
+	store  repository.LoginAttemptStore
+	policy LoginLimitPolicy
+	now    func() time.Time
+}
+
+func NewLoginLimiter(store repository.LoginAttemptStore, policy LoginLimitPolicy) *LoginLimiter {
+	return &LoginLimiter{store: store, policy: policy, now: time.Now}
+}
+
+type limitKey struct {
+	scope     string
+	key       string
+	threshold int
+}
+
+func (l *LoginLimiter) keys(email, ip string) []limitKey {
+	keys := []limitKey{{scope: "account", key: "account:" + strings.ToLower(strings.TrimSpace(email)), threshold: l.policy.MaxAccountFailures}}
+	if ip != "" {
+		keys = append(keys, limitKey{scope: "ip", key: "ip:" + ip, threshold: l.policy.MaxIPFailures})
+	}
+	return keys
+}
+
+// Check returns a LockoutError if the account or address is currently locked.
+func (l *LoginLimiter) Check(ctx context.Context, email, ip string) error {
+	now := l.now()
+	for _, k := range l.keys(email, ip) {
+		if k.threshold <= 0 {
+			continue
+		}
+		attempt, err := l.store.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			return &LockoutError{Scope: k.scope, RetryAfter: attempt.LockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt and returns a LockoutError when it
+// pushed the account or address over its threshold.
+func (l *LoginLimiter) RecordFailure(ctx context.Context, email, ip string) error {
+	now := l.now()
+	var lockout *LockoutError
+	for _, k := range l.keys(email, ip) {
+		if k.threshold <= 0 {
+			continue
+		}
+		attempt, err := l.store.RecordFailure(ctx, k.key, now, now.Add(-l.policy.Window))
+		if err != nil {
+			return err
+		}
+		if attempt.Failures < k.threshold {
+			continue
+		}
+		duration := l.lockoutFor(attempt.Failures - k.threshold)
+		if err := l.store.Lock(ctx, k.key, now.Add(duration)); err != nil {
+			return err
+		}
+		if lockout == nil || duration > lockout.RetryAfter {
+			lockout = &LockoutError{Scope: k.scope, RetryAfter: duration, Triggered: true}
+		}
+	}
+	if lockout != nil {
+		return lockout
+	}
+	return nil
+}
+
+// RecordSuccess clears the account counter. The address counter is left
+// alone so one valid login cannot mask guessing against other accounts.
+func (l *LoginLimiter) RecordSuccess(ctx context.Context, email string) error {
+	return l.store.Reset(ctx, l.keys(email, "")[0].key)
+}
+
+func (l *LoginLimiter) lockoutFor(excess int) time.Duration {
+	duration := l.policy.BaseLockout
+	for i := 0; i < excess && duration < l.policy.MaxLockout; i++ {
+		duration *= 2
+	}
+	if l.policy.MaxLockout > 0 && duration > l.policy.MaxLockout {
+		duration = l.policy.MaxLockout
+	}
+	return duration
+}
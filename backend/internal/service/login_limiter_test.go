@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Juicern/luma/internal/repository/memory"
+)
+
+// fakeClock is a settable time source for the now fields of services.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(policy LoginLimitPolicy) (*LoginLimiter, *fakeClock) {
+	clock := newFakeClock()
+	limiter := NewLoginLimiter(memory.NewLoginAttemptRepository(memory.NewDB()), policy)
+	limiter.now = clock.now
+	return limiter, clock
+}
+
+func lockoutOf(t *testing.T, err error) *LockoutError {
+	t.Helper()
+	var lockout *LockoutError
+	if !errors.As(err, &lockout) {
+		t.Fatalf("error = %v, want a *LockoutError", err)
+	}
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("%v does not match ErrTooManyAttempts", err)
+	}
+	return lockout
+}
+
+func TestLoginLimiterLocksAccount(t *testing.T) {
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(LoginLimitPolicy{
+		MaxAccountFailures: 3,
+		Window:             15 * time.Minute,
+		BaseLockout:        time.Minute,
+		MaxLockout:         3 * time.Minute,
+	})
+
+	for i := range 2 {
+		if err := limiter.RecordFailure(ctx, "ada@example.com", "203.0.113.7"); err != nil {
+			t.Fatalf("failure %d: %v", i+1, err)
+		}
+	}
+	lockout := lockoutOf(t, limiter.RecordFailure(ctx, "Ada@Example.com ", "203.0.113.7"))
+	if !lockout.Triggered || lockout.Scope != "account" || lockout.RetryAfter != time.Minute {
+		t.Errorf("lockout = %+v, want a triggered one-minute account lockout", lockout)
+	}
+
+	clock.advance(30 * time.Second)
+	lockout = lockoutOf(t, limiter.Check(ctx, "ada@example.com", "198.51.100.1"))
+	if lockout.Triggered || lockout.RetryAfter != 30*time.Second {
+		t.Errorf("lockout = %+v, want 30s left", lockout)
+	}
+	if err := limiter.Check(ctx, "grace@example.com", "203.0.113.7"); err != nil {
+		t.Errorf("other account locked: %v", err)
+	}
+
+	// Every further failure doubles the lockout, up to the maximum.
+	clock.advance(time.Minute)
+	if err := limiter.Check(ctx, "ada@example.com", ""); err != nil {
+		t.Fatalf("still locked after the lockout: %v", err)
+	}
+	for _, want := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if lockout := lockoutOf(t, limiter.RecordFailure(ctx, "ada@example.com", "")); lockout.RetryAfter != want {
+			t.Errorf("lockout = %s, want %s", lockout.RetryAfter, want)
+		}
+	}
+
+	// A successful login starts the count again.
+	clock.advance(time.Hour)
+	if err := limiter.RecordSuccess(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.RecordFailure(ctx, "ada@example.com", ""); err != nil {
+		t.Errorf("first failure after a success: %v", err)
+	}
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(LoginLimitPolicy{MaxAccountFailures: 2, Window: 10 * time.Minute, BaseLockout: time.Minute})
+
+	if err := limiter.RecordFailure(ctx, "ada@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(11 * time.Minute)
+	if err := limiter.RecordFailure(ctx, "ada@example.com", ""); err != nil {
+		t.Errorf("failure after the window counted with the one before: %v", err)
+	}
+	clock.advance(time.Minute)
+	lockoutOf(t, limiter.RecordFailure(ctx, "ada@example.com", ""))
+}
+
+func TestLoginLimiterLocksAddress(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(LoginLimitPolicy{
+		MaxAccountFailures: 10,
+		MaxIPFailures:      3,
+		Window:             time.Hour,
+		BaseLockout:        5 * time.Minute,
+	})
+
+	// Guessing against many accounts from one address.
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := limiter.RecordFailure(ctx, email, "203.0.113.7"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lockout := lockoutOf(t, limiter.RecordFailure(ctx, "c@example.com", "203.0.113.7"))
+	if lockout.Scope != "ip" || lockout.RetryAfter != 5*time.Minute {
+		t.Errorf("lockout = %+v, want a five-minute address lockout", lockout)
+	}
+	if lockout := lockoutOf(t, limiter.Check(ctx, "d@example.com", "203.0.113.7")); lockout.Scope != "ip" {
+		t.Errorf("scope = %q, want ip", lockout.Scope)
+	}
+	if err := limiter.Check(ctx, "d@example.com", "198.51.100.1"); err != nil {
+		t.Errorf("other address locked: %v", err)
+	}
+	// A success clears only the account, not the address.
+	if err := limiter.RecordSuccess(ctx, "c@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	lockoutOf(t, limiter.Check(ctx, "c@example.com", "203.0.113.7"))
+}
+
+func TestLoginLimiterDisabled(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(LoginLimitPolicy{})
+	for range 20 {
+		if err := limiter.RecordFailure(ctx, "ada@example.com", "203.0.113.7"); err != nil {
+			t.Fatalf("zero thresholds locked out: %v", err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+var (
+	ErrOIDCDisabled        = errors.New("oidc_disabled")
+	ErrInvalidOIDCState    = errors.New("invalid_oidc_state")
+	ErrOIDCLoginFailed     = errors.New("oidc_login_failed")
+	ErrOIDCEmailNotAllowed = errors.New("oidc_email_not_allowed")
+	ErrOIDCEmailUnverified = errors.New("oidc_email_unverified")
+	// ErrOIDCNoAccount is returned for a sign-in that would need a new
+	// account while automatic account creation is off.
+	ErrOIDCNoAccount = errors.New("oidc_no_account")
+)
+
+const oidcHTTPTimeout = 10 * time.Second
+
+// OIDCOptions configures the OpenID Connect client.
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+	// AllowedDomains limits sign-in to these email domains. Empty allows all.
+	AllowedDomains []string
+	// AutoCreate gives identities without a matching account a new member
+	// account. When false they are refused, and only existing accounts can
+	// sign in.
+	AutoCreate bool
+	// HTTPClient is used for discovery, key and token requests. Defaults to a
+	// client with a short timeout.
+	HTTPClient *http.Client
+}
+
+// OIDCFlow is the state of one sign-in attempt. It is kept by the browser
+// between the redirect to the provider and the callback.
+type OIDCFlow struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// OIDCConnector talks to the identity provider. Discovery happens on first
+// use and is retried on later logins if it fails, so an unreachable provider
+// does not keep the server from starting.
+type OIDCConnector struct {
+	opts OIDCOptions
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCConnector(opts OIDCOptions) *OIDCConnector {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+	}
+	return &OIDCConnector{opts: opts}
+}
+
+func (c *OIDCConnector) Issuer() string {
+	return c.opts.Issuer
+}
+
+// clientContext makes the oidc and oauth2 packages use the configured client.
+// It is not tied to a request because the key set keeps it for later
+// refreshes.
+func (c *OIDCConnector) clientContext() context.Context {
+	return oidc.ClientContext(context.Background(), c.opts.HTTPClient)
+}
+
+func (c *OIDCConnector) discover() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.oauth != nil {
+		return c.oauth, c.verifier, nil
+	}
+	provider, err := oidc.NewProvider(c.clientContext(), c.opts.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range c.opts.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	c.oauth = &oauth2.Config{
+		ClientID:     c.opts.ClientID,
+		ClientSecret: c.opts.ClientSecret,
+		RedirectURL:  c.opts.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	c.verifier = provider.Verifier(&oidc.Config{ClientID: c.opts.ClientID})
+	return c.oauth, c.verifier, nil
+}
+
+func (c *OIDCConnector) emailAllowed(email string) bool {
+	if len(c.opts.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range c.opts.AllowedDomains {
+		if strings.EqualFold(domain, strings.TrimPrefix(allowed, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+func (s *AuthService) OIDCEnabled() bool {
+	return s.oidc != nil
+}
+
+// BeginOIDC starts an authorization-code flow with PKCE. It returns the
+// provider URL to redirect to and the flow state the caller must keep until
+// the callback.
+func (s *AuthService) BeginOIDC(ctx context.Context) (string, OIDCFlow, error) {
+	if s.oidc == nil {
+		return "", OIDCFlow{}, ErrOIDCDisabled
+	}
+	oauthCfg, _, err := s.oidc.discover()
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+	state, err := generateToken()
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		return "", OIDCFlow{}, err
+	}
+	flow := OIDCFlow{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+	authURL := oauthCfg.AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier))
+	return authURL, flow, nil
+}
+
+// CompleteOIDC finishes the flow: it exchanges the code, verifies the ID
+// token against the provider's keys and opens a session for the linked user.
+// Unknown identities are linked to the account with the same verified email,
+// or get a new member account if the connector allows it.
+func (s *AuthService) CompleteOIDC(ctx context.Context, flow OIDCFlow, state, code string, client ClientInfo) (domain.User, domain.UserSession, error) {
+	if s.oidc == nil {
+		return domain.User{}, domain.UserSession{}, ErrOIDCDisabled
+	}
+	if flow.State == "" || state != flow.State || code == "" {
+		return domain.User{}, domain.UserSession{}, ErrInvalidOIDCState
+	}
+	oauthCfg, verifier, err := s.oidc.discover()
+	if err != nil {
+		return domain.User{}, domain.UserSession{}, err
+	}
+	token, err := oauthCfg.Exchange(oidc.ClientContext(ctx, s.oidc.opts.HTTPClient), code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return domain.User{}, domain.UserSession{}, fmt.Errorf("%w: token exchange: %w", ErrOIDCLoginFailed, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return domain.User{}, domain.UserSession{}, fmt.Errorf("%w: token response has no id_token", ErrOIDCLoginFailed)
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return domain.User{}, domain.UserSession{}, fmt.Errorf("%w: %w", ErrOIDCLoginFailed, err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return domain.User{}, domain.UserSession{}, fmt.Errorf("%w: nonce mismatch", ErrOIDCLoginFailed)
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return domain.User{}, domain.UserSession{}, fmt.Errorf("%w: %w", ErrOIDCLoginFailed, err)
+	}
+	claims.Email = strings.TrimSpace(claims.Email)
+	if !s.oidc.emailAllowed(claims.Email) {
+		return domain.User{}, domain.UserSession{}, ErrOIDCEmailNotAllowed
+	}
+
+	user, err := s.resolveOIDCUser(ctx, idToken.Issuer, idToken.Subject, claims)
+	if err != nil {
+		return domain.User{}, domain.UserSession{}, err
+	}
+	session, err := s.startSession(ctx, user, client, "oidc")
+	if err != nil {
+		return domain.User{}, domain.UserSession{}, err
+	}
+	return user, session, nil
+}
+
+func (s *AuthService) resolveOIDCUser(ctx context.Context, issuer, subject string, claims oidcClaims) (domain.User, error) {
+	identity, err := s.identities.Get(ctx, issuer, subject)
+	if err == nil {
+		_ = s.identities.Touch(ctx, identity.ID, claims.Email)
+		return s.users.Get(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return domain.User{}, err
+	}
+	// Linking and account creation are keyed on the email, so it has to be
+	// one the provider vouches for.
+	if claims.Email == "" || !claims.EmailVerified {
+		return domain.User{}, ErrOIDCEmailUnverified
+	}
+
+	user, err := s.users.GetByEmail(ctx, claims.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if !s.oidc.opts.AutoCreate {
+			return domain.User{}, ErrOIDCNoAccount
+		}
+		// Accounts created here have no password; they sign in through the
+		// provider until they set one.
+		user, err = s.users.Create(ctx, oidcDisplayName(claims), claims.Email, "", domain.UserRoleMember)
+		if err != nil {
+			return domain.User{}, err
+		}
+		s.audit.Record(ctx, AuditEntry{
+			Action:        domain.AuditUserCreated,
+			ActorUserID:   user.ID,
+			SubjectUserID: user.ID,
+			TargetType:    "user",
+			TargetID:      user.ID,
+			Metadata:      map[string]string{"email": user.Email, "role": string(user.Role), "via": "oidc"},
+		})
+	case err != nil:
+		return domain.User{}, err
+	}
+
+	identity, err = s.identities.Create(ctx, user.ID, issuer, subject, claims.Email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditIdentityLinked,
+		ActorUserID:   user.ID,
+		SubjectUserID: user.ID,
+		TargetType:    "user_identity",
+		TargetID:      identity.ID,
+		Metadata:      map[string]string{"issuer": issuer, "subject": subject},
+	})
+	return user, nil
+}
+
+func oidcDisplayName(claims oidcClaims) string {
+	switch {
+	case claims.Name != "":
+		return claims.Name
+	case claims.PreferredUsername != "":
+		return claims.PreferredUsername
+	default:
+		name, _, _ := strings.Cut(claims.Email, "@")
+		return name
+	}
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository/memory"
+)
+
+const (
+	fakeClientID     = "luma"
+	fakeClientSecret = "secret"
+	fakeRedirectURL  = "https://luma.example/api/v1/auth/oidc/callback"
+)
+
+// fakeIssuer is an in-process OpenID provider. Tests play the browser: they
+// read the authorization URL from BeginOIDC and call authorize with the
+// claims the provider would vouch for, which returns a code for the
+// callback.
+type fakeIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// signer signs ID tokens; tests swap it for one whose key is not
+	// published.
+	signer jose.Signer
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	f := &fakeIssuer{t: t, codes: make(map[string]fakeGrant)}
+	f.key = newRSAKey(t)
+	f.signer = newSigner(t, f.key)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                f.server.URL,
+			"authorization_endpoint":                f.server.URL + "/authorize",
+			"token_endpoint":                        f.server.URL + "/token",
+			"jwks_uri":                              f.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &f.key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", f.token)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newSigner(t *testing.T, key *rsa.PrivateKey) jose.Signer {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// authorize checks the authorization URL as the provider would and grants a
+// code for claims. nonce, when set, replaces the one the client sent.
+func (f *fakeIssuer) authorize(authURL string, claims map[string]any, nonce string) (state, code string) {
+	f.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != fakeClientID || q.Get("redirect_uri") != fakeRedirectURL {
+		f.t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		f.t.Fatalf("authorization URL without a PKCE challenge: %s", authURL)
+	}
+	if nonce == "" {
+		nonce = q.Get("nonce")
+	}
+	code = rand.Text()
+	f.mu.Lock()
+	f.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), nonce: nonce, claims: claims}
+	f.mu.Unlock()
+	return q.Get("state"), code
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	f.mu.Lock()
+	grant, known := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case clientID != fakeClientID || secret != fakeClientSecret:
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]string{"error": "invalid_client"})
+		return
+	case !known || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge:
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   f.server.URL,
+		"aud":   fakeClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	payload, _ := json.Marshal(claims)
+	signed, err := f.signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+	writeJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+}
+
+type oidcFixture struct {
+	issuer     *fakeIssuer
+	auth       *AuthService
+	users      *memory.UserRepository
+	identities *memory.UserIdentityRepository
+	audit      *memory.AuditEventRepository
+}
+
+func newOIDCFixture(t *testing.T, opts OIDCOptions) oidcFixture {
+	t.Helper()
+	issuer := newFakeIssuer(t)
+	opts.Issuer, opts.ClientID, opts.ClientSecret, opts.RedirectURL = issuer.server.URL, fakeClientID, fakeClientSecret, fakeRedirectURL
+	opts.Scopes = []string{"email", "profile"}
+	db := memory.NewDB()
+	f := oidcFixture{
+		issuer:     issuer,
+		users:      memory.NewUserRepository(db),
+		identities: memory.NewUserIdentityRepository(db),
+		audit:      memory.NewAuditEventRepository(db),
+	}
+	audit := NewAuditService(f.audit, discardLogger())
+	f.auth = NewAuthService(f.users, memory.NewUserSessionRepository(db), f.identities, time.Hour, nil, NewOIDCConnector(opts), audit)
+	return f
+}
+
+// signIn runs a whole sign-in for claims and returns the result of the
+// callback.
+func (f oidcFixture) signIn(t *testing.T, claims map[string]any) (domain.User, domain.UserSession, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, flow, err := f.auth.BeginOIDC(ctx)
+	if err != nil {
+		t.Fatalf("BeginOIDC: %v", err)
+	}
+	state, code := f.issuer.authorize(authURL, claims, "")
+	return f.auth.CompleteOIDC(ctx, flow, state, code, ClientInfo{IPAddress: "203.0.113.7"})
+}
+
+func verifiedClaims(subject, email string) map[string]any {
+	return map[string]any{"sub": subject, "email": email, "email_verified": true, "name": "Ada Lovelace"}
+}
+
+func TestOIDCCreatesAccountOnFirstSignIn(t *testing.T) {
+	f := newOIDCFixture(t, OIDCOptions{AutoCreate: true})
+
+	user, session, err := f.signIn(t, verifiedClaims("sub-1", "ada@example.com"))
+	if err != nil {
+		t.Fatalf("sign-in: %v", err)
+	}
+	if user.Email != "ada@example.com" || user.Name != "Ada Lovelace" || user.Role != domain.UserRoleMember {
+		t.Errorf("created user = %+v", user)
+	}
+	if user.PasswordHash != "" {
+		t.Error("account created through sign-on has a password")
+	}
+	if session.Token == "" || session.UserID != user.ID {
+		t.Errorf("session = %+v, want one for %s", session, user.ID)
+	}
+	if _, err := f.identities.Get(context.Background(), f.issuer.server.URL, "sub-1"); err != nil {
+		t.Errorf("identity not linked: %v", err)
+	}
+
+	again, _, err := f.signIn(t, verifiedClaims("sub-1", "ada@example.com"))
+	if err != nil {
+		t.Fatalf("second sign-in: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second sign-in got user %s, want %s", again.ID, user.ID)
+	}
+	events, err := f.audit.List(context.Background(), domain.AuditFilter{Action: string(domain.AuditUserCreated), Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Errorf("recorded %d account creations, want 1", len(events))
+	}
+}
+
+func TestOIDCLinksExistingAccount(t *testing.T) {
+	f := newOIDCFixture(t, OIDCOptions{})
+	existing, err := f.users.Create(context.Background(), "Grace", "grace@example.com", "hash", domain.UserRoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Linking works even with account creation off.
+	user, _, err := f.signIn(t, verifiedClaims("sub-2", "grace@example.com"))
+	if err != nil {
+		t.Fatalf("sign-in: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("signed in as %s, want the existing account %s", user.ID, existing.ID)
+	}
+}
+
+func TestOIDCRefusesSignIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   OIDCOptions
+		claims map[string]any
+		want   error
+	}{
+		{
+			name:   "account creation off",
+			opts:   OIDCOptions{AutoCreate: false},
+			claims: verifiedClaims("sub-3", "new@example.com"),
+			want:   ErrOIDCNoAccount,
+		},
+		{
+			name:   "domain not allowed",
+			opts:   OIDCOptions{AutoCreate: true, AllowedDomains: []string{"@corp.example"}},
+			claims: verifiedClaims("sub-4", "someone@example.com"),
+			want:   ErrOIDCEmailNotAllowed,
+		},
+		{
+			name:   "email not verified",
+			opts:   OIDCOptions{AutoCreate: true},
+			claims: map[string]any{"sub": "sub-5", "email": "someone@example.com", "email_verified": false},
+			want:   ErrOIDCEmailUnverified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t, tt.opts)
+			if _, _, err := f.signIn(t, tt.claims); !errors.Is(err, tt.want) {
+				t.Fatalf("sign-in error = %v, want %v", err, tt.want)
+			}
+			if _, err := f.users.GetByEmail(context.Background(), tt.claims["email"].(string)); err == nil {
+				t.Error("refused sign-in created an account")
+			}
+		})
+	}
+}
+
+func TestOIDCAllowedDomain(t *testing.T) {
+	f := newOIDCFixture(t, OIDCOptions{AutoCreate: true, AllowedDomains: []string{"@corp.example"}})
+	if _, _, err := f.signIn(t, verifiedClaims("sub-6", "ada@CORP.example")); err != nil {
+		t.Fatalf("sign-in from an allowed domain: %v", err)
+	}
+}
+
+func TestOIDCRejectsTamperedFlow(t *testing.T) {
+	ctx := context.Background()
+	claims := verifiedClaims("sub-7", "ada@example.com")
+	tests := []struct {
+		name string
+		// run performs the sign-in with one thing wrong.
+		run  func(f oidcFixture) error
+		want error
+	}{
+		{
+			name: "state mismatch",
+			run: func(f oidcFixture) error {
+				authURL, flow, err := f.auth.BeginOIDC(ctx)
+				if err != nil {
+					return err
+				}
+				_, code := f.issuer.authorize(authURL, claims, "")
+				_, _, err = f.auth.CompleteOIDC(ctx, flow, "forged-state", code, ClientInfo{})
+				return err
+			},
+			want: ErrInvalidOIDCState,
+		},
+		{
+			name: "missing flow",
+			run: func(f oidcFixture) error {
+				authURL, _, err := f.auth.BeginOIDC(ctx)
+				if err != nil {
+					return err
+				}
+				state, code := f.issuer.authorize(authURL, claims, "")
+				_, _, err = f.auth.CompleteOIDC(ctx, OIDCFlow{}, state, code, ClientInfo{})
+				return err
+			},
+			want: ErrInvalidOIDCState,
+		},
+		{
+			name: "nonce mismatch",
+			run: func(f oidcFixture) error {
+				authURL, flow, err := f.auth.BeginOIDC(ctx)
+				if err != nil {
+					return err
+				}
+				state, code := f.issuer.authorize(authURL, claims, "replayed-nonce")
+				_, _, err = f.auth.CompleteOIDC(ctx, flow, state, code, ClientInfo{})
+				return err
+			},
+			want: ErrOIDCLoginFailed,
+		},
+		{
+			name: "wrong PKCE verifier",
+			run: func(f oidcFixture) error {
+				authURL, flow, err := f.auth.BeginOIDC(ctx)
+				if err != nil {
+					return err
+				}
+				state, code := f.issuer.authorize(authURL, claims, "")
+				_, other, err := f.auth.BeginOIDC(ctx)
+				if err != nil {
+					return err
+				}
+				flow.Verifier = other.Verifier
+				_, _, err = f.auth.CompleteOIDC(ctx, flow, state, code, ClientInfo{})
+				return err
+			},
+			want: ErrOIDCLoginFailed,
+		},
+		{
+			name: "signed with an unpublished key",
+			run: func(f oidcFixture) error {
+				f.issuer.signer = newSigner(f.issuer.t, newRSAKey(f.issuer.t))
+				_, _, err := f.signIn(f.issuer.t, claims)
+				return err
+			},
+			want: ErrOIDCLoginFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t, OIDCOptions{AutoCreate: true})
+			if err := tt.run(f); !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if _, err := f.users.GetByEmail(ctx, "ada@example.com"); err == nil {
+				t.Error("rejected flow created an account")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/markup"
+)
+
+// formatPrompts tell the model the shape of its answer. HTML is asked for as
+// Markdown and rendered here, so that no markup the model writes reaches the
+// client unescaped.
+var formatPrompts = map[domain.OutputFormat]string{
+	domain.OutputPlain: "Write plain text only: no Markdown, HTML or other markup. Use line breaks and simple dashes for structure.",
+	domain.OutputMarkdown: "Write Markdown. Use headings, lists, emphasis and links where they help the reader, " +
+		"and nothing beyond standard Markdown.",
+	domain.OutputHTML: "Write Markdown (it is converted to HTML afterwards). Use headings, lists, emphasis and links where they help " +
+		"the reader. Do not write HTML tags.",
+	domain.OutputEmail: "Write an email. The first line must be \"Subject: \" followed by a short subject line, then an empty line, " +
+		"then the body in plain text with a greeting and sign-off where appropriate. No Markdown.",
+}
+
+// subjectLine matches the subject line of an email draft, which models
+// sometimes write in bold or in the language of the content.
+var subjectLine = regexp.MustCompile(`(?i)^\s*(?:\*\*)?(?:subject|主题|主旨|件名|betreff|objet|asunto)(?:\*\*)?\s*[:：]\s*(?:\*\*)?(.*?)(?:\*\*)?\s*$`)
+
+// formatOutput converts generated text to format and returns it with the
+// subject of an email draft. The empty format leaves text alone.
+func formatOutput(format domain.OutputFormat, text string) (string, string) {
+	switch format {
+	case domain.OutputPlain:
+		return markup.Plain(text), ""
+	case domain.OutputMarkdown:
+		return strings.TrimSpace(text), ""
+	case domain.OutputHTML:
+		return markup.HTML(text), ""
+	case domain.OutputEmail:
+		subject, body := splitEmail(text)
+		return markup.Plain(body), subject
+	}
+	return text, ""
+}
+
+// splitEmail takes the subject line off the top of an email draft. A draft
+// without one gets an empty subject rather than failing the rewrite.
+func splitEmail(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	first, rest, _ := strings.Cut(text, "\n")
+	m := subjectLine.FindStringSubmatch(first)
+	if m == nil {
+		return "", text
+	}
+	return markup.Plain(strings.TrimSpace(m[1])), strings.TrimSpace(rest)
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Juicern/luma/internal/domain"
+)
+
+var (
+	ErrInvalidPresetFile     = errors.New("invalid_preset_file")
+	ErrInvalidImportStrategy = errors.New("invalid_import_strategy")
+)
+
+// PresetFileVersion is the version of the preset file format written by
+// ExportPresets. Files without a version are read as version 1.
+const PresetFileVersion = 1
+
+// PresetFile is the portable form of a user's presets. It is written as JSON
+// or YAML; both spell the fields the same way.
+type PresetFile struct {
+	Version int               `json:"version" yaml:"version"`
+	Presets []PresetFileEntry `json:"presets" yaml:"presets"`
+}
+
+// PresetFileEntry is one preset in a PresetFile. IDs, owners and history are
+// not exported, so a file can be imported by anyone.
+type PresetFileEntry struct {
+	Name        string   `json:"name" yaml:"name"`
+	PromptText  string   `json:"prompt_text" yaml:"prompt_text"`
+	TemplateKey string   `json:"template_key,omitempty" yaml:"template_key,omitempty"`
+	Provider    string   `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Model       string   `json:"model,omitempty" yaml:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty" yaml:"top_p,omitempty"`
+	RedactPII   *bool    `json:"redact_pii,omitempty" yaml:"redact_pii,omitempty"`
+	Postprocess []string `json:"postprocess,omitempty" yaml:"postprocess,omitempty"`
+	// OutputFormat is plain, markdown, html or email.
+	OutputFormat string `json:"output_format,omitempty" yaml:"output_format,omitempty"`
+	// Fallback lists the providers tried when the preset's one fails.
+	Fallback []string `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+}
+
+func (e PresetFileEntry) settings() domain.GenerationSettings {
+	return domain.GenerationSettings{
+		Provider:     e.Provider,
+		Model:        e.Model,
+		Temperature:  e.Temperature,
+		MaxTokens:    e.MaxTokens,
+		TopP:         e.TopP,
+		RedactPII:    e.RedactPII,
+		Postprocess:  e.Postprocess,
+		OutputFormat: domain.OutputFormat(e.OutputFormat),
+		Fallback:     e.Fallback,
+	}
+}
+
+func (e PresetFileEntry) templateKey() *string {
+	if e.TemplateKey == "" {
+		return nil
+	}
+	key := e.TemplateKey
+	return &key
+}
+
+// ParsePresetFile reads a preset file. YAML is a superset of JSON, so one
+// parser takes both formats.
+func ParsePresetFile(data []byte) (PresetFile, error) {
+	var file PresetFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return PresetFile{}, fmt.Errorf("%w: %w", ErrInvalidPresetFile, err)
+	}
+	if file.Version == 0 {
+		file.Version = PresetFileVersion
+	}
+	if file.Version != PresetFileVersion {
+		return PresetFile{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidPresetFile, file.Version)
+	}
+	return file, nil
+}
+
+// ImportStrategy decides what happens to an imported preset that clashes
+// with an existing one.
+type ImportStrategy string
+
+const (
+	ImportSkip      ImportStrategy = "skip"
+	ImportOverwrite ImportStrategy = "overwrite"
+	ImportRename    ImportStrategy = "rename"
+)
+
+func ParseImportStrategy(value string) (ImportStrategy, error) {
+	switch strategy := ImportStrategy(value); strategy {
+	case "":
+		return ImportSkip, nil
+	case ImportSkip, ImportOverwrite, ImportRename:
+		return strategy, nil
+	default:
+		return "", ErrInvalidImportStrategy
+	}
+}
+
+// Import actions reported per entry.
+const (
+	ImportActionCreate    = "create"
+	ImportActionOverwrite = "overwrite"
+	ImportActionRename    = "rename"
+	ImportActionSkip      = "skip"
+	ImportActionInvalid   = "invalid"
+)
+
+// ImportResult is the outcome for one entry of the file.
+type ImportResult struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// PresetID is the preset that was (or, in a dry run, would be)
+	// overwritten, or the one created.
+	PresetID string `json:"preset_id,omitempty"`
+	// NewName is the name given to a renamed copy.
+	NewName string `json:"new_name,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImportReport lists the outcome of every entry, in file order.
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Results []ImportResult `json:"results"`
+}
+
+// ExportPresets returns the user's presets as a file, oldest first so that a
+// re-import keeps their order.
+func (s *PromptService) ExportPresets(ctx context.Context, userID string) (PresetFile, error) {
+	presets, err := s.presetRepo.List(ctx, userID)
+	if err != nil {
+		return PresetFile{}, err
+	}
+	file := PresetFile{Version: PresetFileVersion, Presets: []PresetFileEntry{}}
+	for i := len(presets) - 1; i >= 0; i-- {
+		preset := presets[i]
+		entry := PresetFileEntry{
+			Name:         preset.Name,
+			PromptText:   preset.PromptText,
+			Provider:     preset.Provider,
+			Model:        preset.Model,
+			Temperature:  preset.Temperature,
+			MaxTokens:    preset.MaxTokens,
+			TopP:         preset.TopP,
+			RedactPII:    preset.RedactPII,
+			Postprocess:  preset.Postprocess,
+			OutputFormat: string(preset.OutputFormat),
+			Fallback:     preset.Fallback,
+		}
+		if preset.TemplateKey != nil {
+			entry.TemplateKey = *preset.TemplateKey
+		}
+		file.Presets = append(file.Presets, entry)
+	}
+	return file, nil
+}
+
+// ImportPresets adds the presets of a file to the user's. An entry clashes
+// with the existing preset for the same template key or, failing that, with
+// the same name. Entries are checked before anything is written: when one is
+// invalid nothing is imported and ErrInvalidPresetFile is returned along with
+// the report. A dry run only reports.
+func (s *PromptService) ImportPresets(ctx context.Context, userID string, file PresetFile, strategy ImportStrategy, dryRun bool) (ImportReport, error) {
+	existing, err := s.presetRepo.List(ctx, userID)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	plan := newImportPlan(existing)
+
+	report := ImportReport{DryRun: dryRun, Results: []ImportResult{}}
+	steps := make([]importStep, 0, len(file.Presets))
+	invalid := false
+	for _, entry := range file.Presets {
+		if err := s.validateImportEntry(ctx, userID, entry); err != nil {
+			invalid = true
+			report.Results = append(report.Results, ImportResult{Name: entry.Name, Action: ImportActionInvalid, Error: err.Error()})
+			steps = append(steps, importStep{})
+			continue
+		}
+		step := plan.add(entry, strategy)
+		report.Results = append(report.Results, step.result)
+		steps = append(steps, step)
+	}
+	if invalid {
+		return report, ErrInvalidPresetFile
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	for i, step := range steps {
+		entry := step.entry
+		var preset domain.PromptPreset
+		switch step.result.Action {
+		case ImportActionCreate, ImportActionRename:
+			preset, err = s.CreatePreset(ctx, userID, step.name, entry.PromptText, step.templateKey, entry.settings())
+		case ImportActionOverwrite:
+			preset, err = s.UpdatePreset(ctx, step.result.PresetID, userID, step.name, entry.PromptText, step.templateKey, entry.settings())
+		default:
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("import %q: %w", entry.Name, err)
+		}
+		report.Results[i].PresetID = preset.ID
+	}
+	return report, nil
+}
+
+func (s *PromptService) validateImportEntry(ctx context.Context, userID string, entry PresetFileEntry) error {
+	if strings.TrimSpace(entry.Name) == "" || strings.TrimSpace(entry.PromptText) == "" {
+		return errors.New("name and prompt_text are required")
+	}
+	if _, err := normalizeGenerationSettings(entry.settings()); err != nil {
+		return err
+	}
+	return s.variables.Validate(ctx, userID, entry.PromptText)
+}
+
+// importStep is the planned write for one entry.
+type importStep struct {
+	entry       PresetFileEntry
+	result      ImportResult
+	name        string
+	templateKey *string
+}
+
+// importPlan tracks the user's presets as they will be once the steps
+// planned so far are applied, so that entries clashing with each other are
+// resolved the same way in a dry run and a real import.
+type importPlan struct {
+	names     map[string]string // name -> preset ID ("" for planned creates)
+	templates map[string]string // template key -> preset ID
+}
+
+func newImportPlan(presets []domain.PromptPreset) *importPlan {
+	plan := &importPlan{names: make(map[string]string), templates: make(map[string]string)}
+	for _, preset := range presets {
+		plan.names[preset.Name] = preset.ID
+		if preset.TemplateKey != nil {
+			plan.templates[*preset.TemplateKey] = preset.ID
+		}
+	}
+	return plan
+}
+
+func (p *importPlan) add(entry PresetFileEntry, strategy ImportStrategy) importStep {
+	step := importStep{
+		entry:       entry,
+		result:      ImportResult{Name: entry.Name, Action: ImportActionCreate},
+		name:        entry.Name,
+		templateKey: entry.templateKey(),
+	}
+	id, byTemplate := p.templates[entry.TemplateKey]
+	byTemplate = byTemplate && entry.TemplateKey != ""
+	if !byTemplate {
+		var byName bool
+		if id, byName = p.names[entry.Name]; !byName {
+			p.claim(step)
+			return step
+		}
+	}
+
+	switch {
+	case strategy == ImportOverwrite && id != "":
+		step.result.Action = ImportActionOverwrite
+		step.result.PresetID = id
+	case strategy == ImportRename:
+		step.result.Action = ImportActionRename
+		step.name = p.freeName(entry.Name)
+		if step.name != entry.Name {
+			step.result.NewName = step.name
+		}
+		// The template key stays with the preset that already has it.
+		if byTemplate {
+			step.templateKey = nil
+		}
+	default:
+		// Skipping is also the only safe choice when the clash is with an
+		// earlier entry of the same file, which has no ID yet.
+		step.result.Action = ImportActionSkip
+		step.result.PresetID = id
+		return step
+	}
+	p.claim(step)
+	return step
+}
+
+func (p *importPlan) claim(step importStep) {
+	p.names[step.name] = step.result.PresetID
+	if step.templateKey != nil {
+		p.templates[*step.templateKey] = step.result.PresetID
+	}
+}
+
+// freeName returns name if no preset uses it, or else name with the lowest
+// free " (n)" suffix.
+func (p *importPlan) freeName(name string) string {
+	if _, taken := p.names[name]; !taken {
+		return name
+	}
+	for n := 2; ; n++ {
+		candidate := name + " (" + strconv.Itoa(n) + ")"
+		if _, taken := p.names[candidate]; !taken {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/textdiff"
+)
+
+// RevisionDiff compares two revisions of one prompt. From is the zero value
+// when diffing the first revision against an empty prompt.
+type RevisionDiff struct {
+	From    domain.PromptRevision `json:"from"`
+	To      domain.PromptRevision `json:"to"`
+	Changed bool                  `json:"changed"`
+	Unified string                `json:"unified"`
+	Lines   []textdiff.Line       `json:"lines"`
+}
+
+// revisionSource reads the history of one prompt.
+type revisionSource struct {
+	list func(ctx context.Context) ([]domain.PromptRevision, error)
+	get  func(ctx context.Context, revision int) (domain.PromptRevision, error)
+}
+
+func (s *PromptService) ListPresetRevisions(ctx context.Context, userID, presetID string) ([]domain.PromptRevision, error) {
+	if _, err := s.ownedPreset(ctx, userID, presetID); err != nil {
+		return nil, err
+	}
+	return s.presetRepo.ListRevisions(ctx, presetID)
+}
+
+// DiffPresetRevisions diffs revision from against revision to. A zero to
+// means the latest revision and a zero from the one before to.
+func (s *PromptService) DiffPresetRevisions(ctx context.Context, userID, presetID string, from, to int) (RevisionDiff, error) {
+	if _, err := s.ownedPreset(ctx, userID, presetID); err != nil {
+		return RevisionDiff{}, err
+	}
+	return diffRevisions(ctx, s.presetSource(presetID), from, to)
+}
+
+// RestorePresetRevision saves an earlier revision's name and text as the
+// preset's current state; its generation settings are kept. History is
+// kept: the restore adds a revision. The old text is checked like any
+// update, so it fails if it uses variables that no longer exist.
+func (s *PromptService) RestorePresetRevision(ctx context.Context, userID, presetID string, revision int) (domain.PromptPreset, error) {
+	current, err := s.ownedPreset(ctx, userID, presetID)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	old, err := s.presetRepo.GetRevision(ctx, presetID, revision)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	preset, err := s.updatePreset(ctx, presetID, userID, old.Name, old.PromptText, current.TemplateKey, current.GenerationSettings)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditPresetUpdated,
+		SubjectUserID: preset.UserID,
+		TargetType:    "preset",
+		TargetID:      preset.ID,
+		Metadata:      map[string]string{"name": preset.Name, "restored_revision": strconv.Itoa(revision)},
+	})
+	return preset, nil
+}
+
+func (s *PromptService) ListSystemPromptRevisions(ctx context.Context) ([]domain.PromptRevision, error) {
+	prompt, err := s.GetSystemPrompt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.systemRepo.ListRevisions(ctx, prompt.ID)
+}
+
+// DiffSystemPromptRevisions is DiffPresetRevisions for the active system
+// prompt.
+func (s *PromptService) DiffSystemPromptRevisions(ctx context.Context, from, to int) (RevisionDiff, error) {
+	prompt, err := s.GetSystemPrompt(ctx)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	return diffRevisions(ctx, s.systemPromptSource(prompt.ID), from, to)
+}
+
+func (s *PromptService) RestoreSystemPromptRevision(ctx context.Context, revision int) (domain.SystemPrompt, error) {
+	current, err := s.GetSystemPrompt(ctx)
+	if err != nil {
+		return domain.SystemPrompt{}, err
+	}
+	old, err := s.systemRepo.GetRevision(ctx, current.ID, revision)
+	if err != nil {
+		return domain.SystemPrompt{}, err
+	}
+	if err := s.variables.ValidateShared(old.PromptText); err != nil {
+		return domain.SystemPrompt{}, err
+	}
+	prompt, err := s.systemRepo.Upsert(ctx, old.PromptText)
+	if err != nil {
+		return domain.SystemPrompt{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:     domain.AuditSystemPromptUpdated,
+		TargetType: "system_prompt",
+		TargetID:   prompt.ID,
+		Metadata:   map[string]string{"length": strconv.Itoa(len(prompt.PromptText)), "restored_revision": strconv.Itoa(revision)},
+	})
+	return prompt, nil
+}
+
+// ownedPreset loads a preset, hiding other users' presets as not found.
+func (s *PromptService) ownedPreset(ctx context.Context, userID, presetID string) (domain.PromptPreset, error) {
+	preset, err := s.presetRepo.Get(ctx, presetID)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	if preset.UserID != userID {
+		return domain.PromptPreset{}, sql.ErrNoRows
+	}
+	return preset, nil
+}
+
+func (s *PromptService) presetSource(presetID string) revisionSource {
+	return revisionSource{
+		list: func(ctx context.Context) ([]domain.PromptRevision, error) {
+			return s.presetRepo.ListRevisions(ctx, presetID)
+		},
+		get: func(ctx context.Context, revision int) (domain.PromptRevision, error) {
+			return s.presetRepo.GetRevision(ctx, presetID, revision)
+		},
+	}
+}
+
+func (s *PromptService) systemPromptSource(promptID string) revisionSource {
+	return revisionSource{
+		list: func(ctx context.Context) ([]domain.PromptRevision, error) {
+			return s.systemRepo.ListRevisions(ctx, promptID)
+		},
+		get: func(ctx context.Context, revision int) (domain.PromptRevision, error) {
+			return s.systemRepo.GetRevision(ctx, promptID, revision)
+		},
+	}
+}
+
+func diffRevisions(ctx context.Context, src revisionSource, from, to int) (RevisionDiff, error) {
+	var diff RevisionDiff
+	if to <= 0 {
+		revisions, err := src.list(ctx)
+		if err != nil {
+			return RevisionDiff{}, err
+		}
+		if len(revisions) == 0 {
+			return RevisionDiff{}, sql.ErrNoRows
+		}
+		diff.To = revisions[0]
+	} else {
+		rev, err := src.get(ctx, to)
+		if err != nil {
+			return RevisionDiff{}, err
+		}
+		diff.To = rev
+	}
+	if from <= 0 {
+		from = diff.To.Revision - 1
+	}
+	if from > 0 {
+		rev, err := src.get(ctx, from)
+		if err != nil {
+			return RevisionDiff{}, err
+		}
+		diff.From = rev
+	}
+
+	diff.Lines = textdiff.Lines(diff.From.PromptText, diff.To.PromptText)
+	diff.Changed = textdiff.Changed(diff.Lines)
+	diff.Unified = textdiff.Unified(fmt.Sprintf("revision %d", diff.From.Revision), fmt.Sprintf("revision %d", diff.To.Revision), diff.Lines)
+	return diff, nil
+}
@@ -4,20 +4,32 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strconv"
 
 	"github.com/Juicern/luma/internal/domain"
 	"github.com/Juicern/luma/internal/repository"
+	"github.com/Juicern/luma/internal/templates"
 )
 
+var ErrInvalidSystemPromptMode = errors.New("invalid_system_prompt_mode")
+
 type PromptService struct {
-	systemRepo *repository.SystemPromptRepository
-	presetRepo *repository.PromptPresetRepository
+	systemRepo     repository.SystemPromptStore
+	userPromptRepo repository.UserSystemPromptStore
+	presetRepo     repository.PromptPresetStore
+	catalog        *templates.Catalog
+	variables      *VariableService
+	audit          *AuditService
 }
 
-func NewPromptService(systemRepo *repository.SystemPromptRepository, presetRepo *repository.PromptPresetRepository) *PromptService {
+func NewPromptService(systemRepo repository.SystemPromptStore, userPromptRepo repository.UserSystemPromptStore, presetRepo repository.PromptPresetStore, catalog *templates.Catalog, variables *VariableService, audit *AuditService) *PromptService {
 	return &PromptService{
-		systemRepo: systemRepo,
-		presetRepo: presetRepo,
+		systemRepo:     systemRepo,
+		userPromptRepo: userPromptRepo,
+		presetRepo:     presetRepo,
+		catalog:        catalog,
+		variables:      variables,
+		audit:          audit,
 	}
 }
 
@@ -45,23 +57,128 @@ func (s *PromptService) GetSystemPrompt(ctx context.Context) (domain.SystemPromp
 }
 
 func (s *PromptService) UpdateSystemPrompt(ctx context.Context, text string) (domain.SystemPrompt, error) {
-	return s.systemRepo.Upsert(ctx, text)
+	if err := s.variables.ValidateShared(text); err != nil {
+		return domain.SystemPrompt{}, err
+	}
+	prompt, err := s.systemRepo.Upsert(ctx, text)
+	if err != nil {
+		return domain.SystemPrompt{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:     domain.AuditSystemPromptUpdated,
+		TargetType: "system_prompt",
+		TargetID:   prompt.ID,
+		Metadata:   map[string]string{"length": strconv.Itoa(len(text))},
+	})
+	return prompt, nil
+}
+
+// GetUserSystemPrompt returns the user's own system prompt, or sql.ErrNoRows
+// when they use the global one unchanged.
+func (s *PromptService) GetUserSystemPrompt(ctx context.Context, userID string) (domain.UserSystemPrompt, error) {
+	return s.userPromptRepo.Get(ctx, userID)
+}
+
+// SetUserSystemPrompt saves the user's own system prompt, which replaces the
+// global one or is appended to it. Unlike the global prompt it may use the
+// user's custom variables.
+func (s *PromptService) SetUserSystemPrompt(ctx context.Context, userID string, mode domain.SystemPromptMode, text string) (domain.UserSystemPrompt, error) {
+	if !mode.Valid() {
+		return domain.UserSystemPrompt{}, ErrInvalidSystemPromptMode
+	}
+	if err := s.variables.Validate(ctx, userID, text); err != nil {
+		return domain.UserSystemPrompt{}, err
+	}
+	prompt, err := s.userPromptRepo.Upsert(ctx, userID, mode, text)
+	if err != nil {
+		return domain.UserSystemPrompt{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditUserSystemPromptSet,
+		SubjectUserID: userID,
+		TargetType:    "system_prompt",
+		TargetID:      userID,
+		Metadata:      map[string]string{"mode": string(mode), "length": strconv.Itoa(len(text))},
+	})
+	return prompt, nil
+}
+
+func (s *PromptService) DeleteUserSystemPrompt(ctx context.Context, userID string) error {
+	if err := s.userPromptRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditUserSystemPromptClear,
+		SubjectUserID: userID,
+		TargetType:    "system_prompt",
+		TargetID:      userID,
+	})
+	return nil
 }
 
 func (s *PromptService) ListPresets(ctx context.Context, userID string) ([]domain.PromptPreset, error) {
 	return s.presetRepo.List(ctx, userID)
 }
 
-func (s *PromptService) CreatePreset(ctx context.Context, userID, name, text string, templateKey *string) (domain.PromptPreset, error) {
-	return s.presetRepo.Create(ctx, userID, name, text, templateKey)
+func (s *PromptService) CreatePreset(ctx context.Context, userID, name, text string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
+	if err := s.variables.Validate(ctx, userID, text); err != nil {
+		return domain.PromptPreset{}, err
+	}
+	settings, err := normalizeGenerationSettings(settings)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	preset, err := s.presetRepo.Create(ctx, userID, name, text, templateKey, settings)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	s.recordPreset(ctx, domain.AuditPresetCreated, preset)
+	return preset, nil
 }
 
-func (s *PromptService) UpdatePreset(ctx context.Context, id, userID, name, text string, templateKey *string) (domain.PromptPreset, error) {
-	return s.presetRepo.Update(ctx, id, userID, name, text, templateKey)
+func (s *PromptService) UpdatePreset(ctx context.Context, id, userID, name, text string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
+	preset, err := s.updatePreset(ctx, id, userID, name, text, templateKey, settings)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	s.recordPreset(ctx, domain.AuditPresetUpdated, preset)
+	return preset, nil
+}
+
+// updatePreset checks and saves a preset without recording it, for callers
+// that audit the change their own way.
+func (s *PromptService) updatePreset(ctx context.Context, id, userID, name, text string, templateKey *string, settings domain.GenerationSettings) (domain.PromptPreset, error) {
+	if err := s.variables.Validate(ctx, userID, text); err != nil {
+		return domain.PromptPreset{}, err
+	}
+	settings, err := normalizeGenerationSettings(settings)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	return s.presetRepo.Update(ctx, id, userID, name, text, templateKey, settings)
 }
 
 func (s *PromptService) DeletePreset(ctx context.Context, id, userID string) error {
-	return s.presetRepo.Delete(ctx, id, userID)
+	if err := s.presetRepo.Delete(ctx, id, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditPresetDeleted,
+		SubjectUserID: userID,
+		TargetType:    "preset",
+		TargetID:      id,
+	})
+	return nil
+}
+
+func (s *PromptService) recordPreset(ctx context.Context, action domain.AuditAction, preset domain.PromptPreset) {
+	s.audit.Record(ctx, AuditEntry{
+		Action:        action,
+		SubjectUserID: preset.UserID,
+		TargetType:    "preset",
+		TargetID:      preset.ID,
+		Metadata:      map[string]string{"name": preset.Name},
+	})
 }
 
 func (s *PromptService) GetPreset(ctx context.Context, id string) (domain.PromptPreset, error) {
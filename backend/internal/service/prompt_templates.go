@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/templates"
+)
+
+var (
+	ErrTemplateNotFound  = errors.New("template_not_found")
+	ErrTemplateInstalled = errors.New("template_installed")
+)
+
+// TemplateStatus is a catalog template as seen by one user: whether it is
+// installed as a preset, and whether that preset can take the latest version.
+type TemplateStatus struct {
+	templates.Template
+	Installed        bool   `json:"installed"`
+	PresetID         string `json:"preset_id,omitempty"`
+	InstalledVersion int    `json:"installed_version,omitempty"`
+	// Customized is set once the user has edited the installed text. Such
+	// presets are never updated automatically.
+	Customized      bool `json:"customized"`
+	UpdateAvailable bool `json:"update_available"`
+}
+
+// TemplateUpdateResult reports what UpdateTemplates did.
+type TemplateUpdateResult struct {
+	Updated []domain.PromptPreset `json:"updated"`
+	// Skipped lists the keys of outdated templates that were left alone
+	// because the user customised them.
+	Skipped []string `json:"skipped"`
+}
+
+// ListTemplates returns the catalog annotated with the user's installs.
+func (s *PromptService) ListTemplates(ctx context.Context, userID string) ([]TemplateStatus, error) {
+	installed, err := s.installedTemplates(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []TemplateStatus
+	for _, tmpl := range s.catalog.List() {
+		var preset *domain.PromptPreset
+		if p, ok := installed[tmpl.Key]; ok {
+			preset = &p
+		}
+		statuses = append(statuses, templateStatus(tmpl, preset))
+	}
+	return statuses, nil
+}
+
+// InstallTemplate copies a catalog template into the user's presets.
+func (s *PromptService) InstallTemplate(ctx context.Context, userID, key string) (domain.PromptPreset, error) {
+	tmpl, ok := s.catalog.Get(key)
+	if !ok {
+		return domain.PromptPreset{}, ErrTemplateNotFound
+	}
+	installed, err := s.installedTemplates(ctx, userID)
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	if _, exists := installed[key]; exists {
+		return domain.PromptPreset{}, ErrTemplateInstalled
+	}
+	preset, err := s.presetRepo.UpsertTemplate(ctx, templatePreset(userID, tmpl))
+	if err != nil {
+		return domain.PromptPreset{}, err
+	}
+	s.recordTemplate(ctx, domain.AuditPresetCreated, preset)
+	return preset, nil
+}
+
+// UpdateTemplates moves the user's installed templates to the latest catalog
+// version. Only the given keys are considered, or all when keys is empty.
+// Presets the user has edited are skipped.
+func (s *PromptService) UpdateTemplates(ctx context.Context, userID string, keys []string) (TemplateUpdateResult, error) {
+	installed, err := s.installedTemplates(ctx, userID)
+	if err != nil {
+		return TemplateUpdateResult{}, err
+	}
+	for _, key := range keys {
+		if _, ok := s.catalog.Get(key); !ok {
+			return TemplateUpdateResult{}, ErrTemplateNotFound
+		}
+	}
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	result := TemplateUpdateResult{Updated: []domain.PromptPreset{}, Skipped: []string{}}
+	for _, tmpl := range s.catalog.List() {
+		preset, ok := installed[tmpl.Key]
+		if !ok || (len(wanted) > 0 && !wanted[tmpl.Key]) {
+			continue
+		}
+		status := templateStatus(tmpl, &preset)
+		switch {
+		case status.Customized:
+			if status.InstalledVersion < tmpl.Version {
+				result.Skipped = append(result.Skipped, tmpl.Key)
+			}
+			continue
+		case !status.UpdateAvailable:
+			continue
+		}
+		next := templatePreset(userID, tmpl)
+		next.Name = preset.Name
+		updated, err := s.presetRepo.UpsertTemplate(ctx, next)
+		if err != nil {
+			return TemplateUpdateResult{}, err
+		}
+		s.recordTemplate(ctx, domain.AuditPresetUpdated, updated)
+		result.Updated = append(result.Updated, updated)
+	}
+	return result, nil
+}
+
+// installedTemplates maps template keys to the user's presets for them.
+func (s *PromptService) installedTemplates(ctx context.Context, userID string) (map[string]domain.PromptPreset, error) {
+	presets, err := s.presetRepo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]domain.PromptPreset)
+	for _, preset := range presets {
+		if preset.TemplateKey != nil {
+			installed[*preset.TemplateKey] = preset
+		}
+	}
+	return installed, nil
+}
+
+func (s *PromptService) recordTemplate(ctx context.Context, action domain.AuditAction, preset domain.PromptPreset) {
+	s.audit.Record(ctx, AuditEntry{
+		Action:        action,
+		SubjectUserID: preset.UserID,
+		TargetType:    "preset",
+		TargetID:      preset.ID,
+		Metadata: map[string]string{
+			"name":             preset.Name,
+			"template_key":     *preset.TemplateKey,
+			"template_version": strconv.Itoa(preset.TemplateVersion),
+		},
+	})
+}
+
+func templatePreset(userID string, tmpl templates.Template) domain.PromptPreset {
+	key := tmpl.Key
+	return domain.PromptPreset{
+		UserID:           userID,
+		Name:             tmpl.Name,
+		PromptText:       tmpl.PromptText,
+		TemplateKey:      &key,
+		TemplateVersion:  tmpl.Version,
+		TemplateChecksum: tmpl.Checksum(),
+	}
+}
+
+func templateStatus(tmpl templates.Template, preset *domain.PromptPreset) TemplateStatus {
+	status := TemplateStatus{Template: tmpl}
+	if preset == nil {
+		return status
+	}
+	status.Installed = true
+	status.PresetID = preset.ID
+	status.InstalledVersion = installedVersion(tmpl, *preset)
+	status.Customized = templateCustomized(tmpl, *preset)
+	status.UpdateAvailable = !status.Customized && status.InstalledVersion < tmpl.Version
+	return status
+}
+
+// installedVersion is the catalog version a preset was installed from.
+// Presets saved by older clients carry the key but no version; they count as
+// the current version when their text matches it.
+func installedVersion(tmpl templates.Template, preset domain.PromptPreset) int {
+	if preset.TemplateVersion == 0 && preset.PromptText == tmpl.PromptText {
+		return tmpl.Version
+	}
+	return preset.TemplateVersion
+}
+
+// templateCustomized reports whether the preset text differs from what was
+// installed. Without a recorded checksum only the current text can vouch for
+// the preset.
+func templateCustomized(tmpl templates.Template, preset domain.PromptPreset) bool {
+	if preset.TemplateChecksum == "" {
+		return preset.PromptText != tmpl.PromptText
+	}
+	return templates.Checksum(preset.PromptText) != preset.TemplateChecksum
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository"
+)
+
+var ErrInvalidRedactionRule = errors.New("invalid_redaction_rule")
+
+// RedactionService manages users' redaction settings and rules, and builds
+// the redactor of each rewrite.
+type RedactionService struct {
+	repo repository.RedactionStore
+	// defaultEnabled applies to users who have not chosen.
+	defaultEnabled bool
+	audit          *AuditService
+}
+
+func NewRedactionService(repo repository.RedactionStore, defaultEnabled bool, audit *AuditService) *RedactionService {
+	return &RedactionService{repo: repo, defaultEnabled: defaultEnabled, audit: audit}
+}
+
+// RedactionSettings are a user's redaction switch and custom rules.
+type RedactionSettings struct {
+	Enabled bool `json:"enabled"`
+	// Default is set when the user has not chosen and the server's default
+	// applies.
+	Default bool                   `json:"default"`
+	Rules   []domain.RedactionRule `json:"rules"`
+}
+
+func (s *RedactionService) Settings(ctx context.Context, userID string) (RedactionSettings, error) {
+	settings := RedactionSettings{Enabled: s.defaultEnabled, Default: true}
+	setting, err := s.repo.GetSetting(ctx, userID)
+	switch {
+	case err == nil:
+		settings.Enabled, settings.Default = setting.Enabled, false
+	case !errors.Is(err, sql.ErrNoRows):
+		return RedactionSettings{}, err
+	}
+	rules, err := s.repo.ListRules(ctx, userID)
+	if err != nil {
+		return RedactionSettings{}, err
+	}
+	settings.Rules = rules
+	if settings.Rules == nil {
+		settings.Rules = []domain.RedactionRule{}
+	}
+	return settings, nil
+}
+
+func (s *RedactionService) SetEnabled(ctx context.Context, userID string, enabled bool) (RedactionSettings, error) {
+	if _, err := s.repo.SetEnabled(ctx, userID, enabled); err != nil {
+		return RedactionSettings{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditRedactionUpdated,
+		SubjectUserID: userID,
+		TargetType:    "redaction",
+		TargetID:      userID,
+		Metadata:      map[string]string{"enabled": strconv.FormatBool(enabled)},
+	})
+	return s.Settings(ctx, userID)
+}
+
+// SetRule defines or changes a custom rule. Names follow the rules of
+// variable names; patterns are regular expressions that must not match
+// empty text.
+func (s *RedactionService) SetRule(ctx context.Context, userID, name, pattern string) (domain.RedactionRule, error) {
+	if !variableNamePattern.MatchString(name) {
+		return domain.RedactionRule{}, fmt.Errorf("%w: name must be a lowercase identifier", ErrInvalidRedactionRule)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return domain.RedactionRule{}, fmt.Errorf("%w: %v", ErrInvalidRedactionRule, err)
+	}
+	if re.MatchString("") {
+		return domain.RedactionRule{}, fmt.Errorf("%w: pattern must not match empty text", ErrInvalidRedactionRule)
+	}
+	rule, err := s.repo.UpsertRule(ctx, userID, name, pattern)
+	if err != nil {
+		return domain.RedactionRule{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditRedactionRuleSet,
+		SubjectUserID: userID,
+		TargetType:    "redaction_rule",
+		TargetID:      rule.ID,
+		Metadata:      map[string]string{"name": name},
+	})
+	return rule, nil
+}
+
+func (s *RedactionService) DeleteRule(ctx context.Context, userID, name string) error {
+	if err := s.repo.DeleteRule(ctx, userID, name); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditRedactionRuleDeleted,
+		SubjectUserID: userID,
+		TargetType:    "redaction_rule",
+		Metadata:      map[string]string{"name": name},
+	})
+	return nil
+}
+
+// redactor returns the redactor of a rewrite by userID, or nil when nothing
+// is redacted. enabled is the choice of the request or its preset; nil
+// follows the user's setting.
+func (s *RedactionService) redactor(ctx context.Context, userID string, enabled *bool) (*redactor, error) {
+	settings, err := s.Settings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled != nil {
+		settings.Enabled = *enabled
+	}
+	if !settings.Enabled {
+		return nil, nil
+	}
+	r := &redactor{values: make(map[string]string), placeholders: make(map[string]string), counts: make(map[string]int)}
+	for _, rule := range settings.Rules {
+		// Rules were checked when saved. One that no longer compiles fails
+		// the rewrite rather than letting its matches through.
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %q: %w", rule.Name, err)
+		}
+		r.rules = append(r.rules, redactionRule{label: strings.ToUpper(rule.Name), pattern: re})
+	}
+	r.rules = append(r.rules, builtinRedactionRules...)
+	return r, nil
+}
+
+// redactionRule finds one kind of entity. valid, when set, rejects matches
+// that only look like one.
+type redactionRule struct {
+	label   string
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+// builtinRedactionRules find emails, IBANs, payment card numbers and phone
+// numbers, in that order of precedence.
+var builtinRedactionRules = []redactionRule{
+	{label: "EMAIL", pattern: regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}\b`)},
+	{label: "IBAN", pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), valid: validIBAN},
+	{label: "CARD", pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: validCardNumber},
+	{label: "PHONE", pattern: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\b\d{3,4}[\s.-]?\d{3,4}(?:[\s.-]?\d{2,4})?\b`), valid: validPhone},
+}
+
+// redactor swaps entities for placeholders such as [EMAIL_1] and swaps them
+// back in the answer. The same value gets the same placeholder in every text
+// of a rewrite.
+type redactor struct {
+	rules []redactionRule
+	// values maps placeholders to the text they stand for, placeholders
+	// the other way round.
+	values       map[string]string
+	placeholders map[string]string
+	// counts numbers the placeholders of each label.
+	counts map[string]int
+	// found lists the placeholders in order of first use.
+	found []Redaction
+}
+
+// Redaction is one entity kept from the provider.
+type Redaction struct {
+	Placeholder string `json:"placeholder"`
+	// Rule is the label of the rule that found it: EMAIL, IBAN, CARD, PHONE
+	// or a custom rule's name in upper case.
+	Rule string `json:"rule"`
+}
+
+// redact replaces the entities in text. Where matches overlap, the earlier
+// rule wins, and of matches by the same rule the first.
+func (r *redactor) redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	type match struct {
+		start, end int
+		label      string
+	}
+	var matches []match
+	taken := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.end && end > m.start {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range r.rules {
+		for _, span := range rule.pattern.FindAllStringIndex(text, -1) {
+			value := text[span[0]:span[1]]
+			if span[0] == span[1] || (rule.valid != nil && !rule.valid(value)) || taken(span[0], span[1]) {
+				continue
+			}
+			matches = append(matches, match{span[0], span[1], rule.label})
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.start])
+		b.WriteString(r.placeholder(m.label, text[m.start:m.end]))
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (r *redactor) placeholder(label, value string) string {
+	if placeholder, ok := r.placeholders[value]; ok {
+		return placeholder
+	}
+	r.counts[label]++
+	placeholder := fmt.Sprintf("[%s_%d]", label, r.counts[label])
+	r.values[placeholder] = value
+	r.placeholders[value] = placeholder
+	r.found = append(r.found, Redaction{Placeholder: placeholder, Rule: label})
+	return placeholder
+}
+
+// restore puts the redacted values back into text.
+func (r *redactor) restore(text string) string {
+	if r == nil || len(r.values) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(r.values))
+	for placeholder, value := range r.values {
+		pairs = append(pairs, placeholder, value)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+func (r *redactor) redactions() []Redaction {
+	if r == nil {
+		return nil
+	}
+	return r.found
+}
+
+func digitsOf(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, text)
+}
+
+// validCardNumber applies the Luhn checksum.
+func validCardNumber(match string) bool {
+	digits := digitsOf(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIBAN applies the ISO 13616 mod-97 check.
+func validIBAN(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	var numeric strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			numeric.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			numeric.WriteString(strconv.Itoa(int(r-'A') + 10))
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validPhone accepts 7 to 15 digits. Unformatted runs of fewer than ten
+// digits are more often amounts or IDs than phone numbers.
+func validPhone(match string) bool {
+	digits := digitsOf(match)
+	if len(digits) < 7 || len(digits) > 15 {
+		return false
+	}
+	return len(digits) >= 10 || len(digits) != len(match)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Juicern/luma/internal/repository/memory"
+)
+
+func TestRedactRestore(t *testing.T) {
+	ctx := context.Background()
+	redaction := NewRedactionService(memory.NewRedactionRepository(memory.NewDB()), true, nil)
+	if _, err := redaction.SetRule(ctx, "u1", "ticket", `TICKET-\d+`); err != nil {
+		t.Fatal(err)
+	}
+	r, err := redaction.redactor(ctx, "u1", nil)
+	if err != nil || r == nil {
+		t.Fatalf("redactor = %v, %v", r, err)
+	}
+
+	text := "Mail ada@example.com about TICKET-42, pay GB82 WEST 1234 5698 7654 32 " +
+		"or card 4111 1111 1111 1111, call +1 415 555 2671. Again: ada@example.com."
+	redacted := r.redact(text)
+	for _, value := range []string{"ada@example.com", "TICKET-42", "GB82", "4111", "555 2671"} {
+		if strings.Contains(redacted, value) {
+			t.Errorf("%q left in %q", value, redacted)
+		}
+	}
+	if strings.Count(redacted, "[EMAIL_1]") != 2 {
+		t.Errorf("the same email got different placeholders: %q", redacted)
+	}
+	var rules []string
+	for _, found := range r.redactions() {
+		rules = append(rules, found.Rule)
+	}
+	if want := []string{"EMAIL", "TICKET", "IBAN", "CARD", "PHONE"}; !slices.Equal(rules, want) {
+		t.Errorf("found %v, want %v", rules, want)
+	}
+
+	// The answer may reorder the placeholders; each is put back.
+	answer := "Call [PHONE_1] and mail [EMAIL_1] about [TICKET_1]."
+	if got, want := r.restore(answer), "Call +1 415 555 2671 and mail ada@example.com about TICKET-42."; got != want {
+		t.Errorf("restore = %q, want %q", got, want)
+	}
+	if got := r.restore(redacted); got != text {
+		t.Errorf("round trip = %q, want %q", got, text)
+	}
+}
+
+func TestRedactorSwitch(t *testing.T) {
+	ctx := context.Background()
+	redaction := NewRedactionService(memory.NewRedactionRepository(memory.NewDB()), false, nil)
+	on, off := true, false
+
+	if r, err := redaction.redactor(ctx, "u1", nil); err != nil || r != nil {
+		t.Errorf("default off: redactor = %v, %v", r, err)
+	}
+	if r, err := redaction.redactor(ctx, "u1", &on); err != nil || r == nil {
+		t.Errorf("request on: redactor = %v, %v", r, err)
+	}
+	if _, err := redaction.SetEnabled(ctx, "u1", true); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := redaction.redactor(ctx, "u1", nil); err != nil || r == nil {
+		t.Errorf("user on: redactor = %v, %v", r, err)
+	}
+	if r, err := redaction.redactor(ctx, "u1", &off); err != nil || r != nil {
+		t.Errorf("request off: redactor = %v, %v", r, err)
+	}
+	// A nil redactor passes text through.
+	var r *redactor
+	if got := r.restore(r.redact("ada@example.com")); got != "ada@example.com" {
+		t.Errorf("nil redactor changed the text to %q", got)
+	}
+}
+
+func TestSetRuleValidation(t *testing.T) {
+	redaction := NewRedactionService(memory.NewRedactionRepository(memory.NewDB()), true, nil)
+	tests := []struct {
+		name, pattern string
+	}{
+		{name: "Ticket", pattern: `T-\d+`},
+		{name: "ticket", pattern: `T-(\d+`},
+		{name: "ticket", pattern: `\d*`},
+	}
+	for _, tt := range tests {
+		if _, err := redaction.SetRule(context.Background(), "u1", tt.name, tt.pattern); !errors.Is(err, ErrInvalidRedactionRule) {
+			t.Errorf("SetRule(%q, %q) = %v, want %v", tt.name, tt.pattern, err, ErrInvalidRedactionRule)
+		}
+	}
+}
+
+func TestValidCardNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1111", true},
+		{"5500005555555559", true},
+		{"4111 1111 1111 1112", false},
+		{"411111111111", false},
+		{"41111111111111111111", false},
+	}
+	for _, tt := range tests {
+		if got := validCardNumber(tt.in); got != tt.want {
+			t.Errorf("validCardNumber(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"GB82WEST12345698765432", true},
+		{"GB82 WEST 1234 5698 7654 32", true},
+		{"DE89370400440532013000", true},
+		{"GB83WEST12345698765432", false},
+		{"GB82WEST123", false},
+		{"GB82-WEST-1234-5698-7654-32", false},
+	}
+	for _, tt := range tests {
+		if got := validIBAN(tt.in); got != tt.want {
+			t.Errorf("validIBAN(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidPhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"+1 415 555 2671", true},
+		{"4155552671", true},
+		{"555-1234", true},
+		{"(020) 7946 0958", true},
+		// Bare runs of fewer than ten digits look more like amounts.
+		{"1234567", false},
+		{"123456", false},
+		{"1234567890123456", false},
+	}
+	for _, tt := range tests {
+		if got := validPhone(tt.in); got != tt.want {
+			t.Errorf("validPhone(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
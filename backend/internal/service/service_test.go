@@ -0,0 +1,11 @@
+package service
+
+import (
+	"io"
+	"log/slog"
+)
+
+// discardLogger is the logger of services under test.
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"os"
 	"strings"
 
@@ -13,11 +14,11 @@ import (
 
 type TranscriptionService struct {
 	apiKeys  *APIKeyService
-	logs     *repository.TranscriptionLogRepository
+	logs     repository.TranscriptionLogStore
 	baseURLs map[string]string
 }
 
-func NewTranscriptionService(apiKeys *APIKeyService, logs *repository.TranscriptionLogRepository, baseURLs map[string]string) *TranscriptionService {
+func NewTranscriptionService(apiKeys *APIKeyService, logs repository.TranscriptionLogStore, baseURLs map[string]string) *TranscriptionService {
 	return &TranscriptionService{
 		apiKeys:  apiKeys,
 		logs:     logs,
@@ -25,11 +26,11 @@ func NewTranscriptionService(apiKeys *APIKeyService, logs *repository.Transcript
 	}
 }
 
-func (t *TranscriptionService) Transcribe(ctx context.Context, userID, provider, mode string, duration float64, audioBytes []byte, filename string) (domain.TranscriptionLog, error) {
+func (t *TranscriptionService) Transcribe(ctx context.Context, userID, provider, keyLabel, mode string, duration float64, audioBytes []byte, filename string) (domain.TranscriptionLog, error) {
 	if provider == "" {
 		provider = "openai"
 	}
-	key, err := t.apiKeys.GetDecrypted(ctx, userID, provider)
+	key, err := t.apiKeys.GetDecrypted(ctx, userID, provider, keyLabel)
 	if err != nil {
 		return domain.TranscriptionLog{}, err
 	}
@@ -61,8 +62,29 @@ func (t *TranscriptionService) Transcribe(ctx context.Context, userID, provider,
 	return entry, nil
 }
 
-func (t *TranscriptionService) AttachGeneratedText(ctx context.Context, logID, text string) error {
-	return t.logs.UpdateGeneratedText(ctx, logID, text)
+func (t *TranscriptionService) AttachComposition(ctx context.Context, logID string, outcome domain.ComposeOutcome) error {
+	return t.logs.UpdateComposition(ctx, logID, outcome)
+}
+
+// ErrInvalidCandidate is returned when a choice names a candidate the
+// transcription does not have.
+var ErrInvalidCandidate = errors.New("invalid_candidate")
+
+// ChooseCandidate records which of a transcription's candidates the user
+// copied.
+func (t *TranscriptionService) ChooseCandidate(ctx context.Context, userID, id string, index int) (domain.TranscriptionLog, error) {
+	entry, err := t.logs.GetByID(ctx, userID, id)
+	if err != nil {
+		return domain.TranscriptionLog{}, err
+	}
+	if index < 0 || index >= len(entry.Candidates) {
+		return domain.TranscriptionLog{}, ErrInvalidCandidate
+	}
+	if err := t.logs.ChooseCandidate(ctx, userID, id, index); err != nil {
+		return domain.TranscriptionLog{}, err
+	}
+	entry.ChosenCandidate = &index
+	return entry, nil
 }
 
 func (t *TranscriptionService) ListHistory(ctx context.Context, userID string, limit int) ([]domain.TranscriptionLog, error) {
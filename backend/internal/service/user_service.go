@@ -2,6 +2,11 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -9,20 +14,52 @@ import (
 	"github.com/Juicern/luma/internal/repository"
 )
 
+var (
+	ErrInvalidRole       = errors.New("invalid_role")
+	ErrLastAdmin         = errors.New("last_admin")
+	ErrWeakPassword      = errors.New("weak_password")
+	ErrInvalidResetToken = errors.New("invalid_reset_token")
+)
+
+const (
+	minPasswordLength    = 8
+	defaultResetTokenTTL = 24 * time.Hour
+)
+
 type UserService struct {
-	repo *repository.UserRepository
+	repo     repository.UserStore
+	sessions repository.UserSessionStore
+	resets   repository.PasswordResetStore
+	audit    *AuditService
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.UserStore, sessions repository.UserSessionStore, resets repository.PasswordResetStore, audit *AuditService) *UserService {
+	return &UserService{repo: repo, sessions: sessions, resets: resets, audit: audit}
 }
 
-func (s *UserService) Create(ctx context.Context, name, email, password string) (domain.User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (s *UserService) Create(ctx context.Context, name, email, password string, role domain.UserRole) (domain.User, error) {
+	if role == "" {
+		role = domain.UserRoleMember
+	}
+	if !validRole(role) {
+		return domain.User{}, ErrInvalidRole
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := s.repo.Create(ctx, name, email, hash, role)
 	if err != nil {
 		return domain.User{}, err
 	}
-	return s.repo.Create(ctx, name, email, string(hash))
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditUserCreated,
+		SubjectUserID: user.ID,
+		TargetType:    "user",
+		TargetID:      user.ID,
+		Metadata:      map[string]string{"email": user.Email, "role": string(user.Role)},
+	})
+	return user, nil
 }
 
 func (s *UserService) List(ctx context.Context) ([]domain.User, error) {
@@ -32,3 +69,224 @@ func (s *UserService) List(ctx context.Context) ([]domain.User, error) {
 func (s *UserService) Get(ctx context.Context, id string) (domain.User, error) {
 	return s.repo.Get(ctx, id)
 }
+
+func (s *UserService) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	return s.repo.GetByEmail(ctx, email)
+}
+
+// SetRole changes a user's role. Demoting the only remaining admin is refused
+// so the instance cannot lock itself out of administration.
+func (s *UserService) SetRole(ctx context.Context, id string, role domain.UserRole) (domain.User, error) {
+	if !validRole(role) {
+		return domain.User{}, ErrInvalidRole
+	}
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	if user.IsAdmin() {
+		admins, err := s.repo.CountByRole(ctx, domain.UserRoleAdmin)
+		if err != nil {
+			return domain.User{}, err
+		}
+		if admins <= 1 {
+			return domain.User{}, ErrLastAdmin
+		}
+	}
+	if err := s.repo.SetRole(ctx, id, role); err != nil {
+		return domain.User{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditUserRoleChanged,
+		SubjectUserID: id,
+		TargetType:    "user",
+		TargetID:      id,
+		Metadata:      map[string]string{"from": string(user.Role), "to": string(role)},
+	})
+	user.Role = role
+	return user, nil
+}
+
+// EnsureAdmin makes sure an admin account exists for email. An existing user
+// is promoted (their password is left untouched); otherwise a new admin is
+// created with the given password.
+func (s *UserService) EnsureAdmin(ctx context.Context, name, email, password string) (domain.User, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err == nil {
+		if user.IsAdmin() {
+			return user, nil
+		}
+		return s.SetRole(ctx, user.ID, domain.UserRoleAdmin)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return domain.User{}, err
+	}
+	if password == "" {
+		return domain.User{}, errors.New("password is required to create the admin account")
+	}
+	if name == "" {
+		name = "Administrator"
+	}
+	return s.Create(ctx, name, email, password, domain.UserRoleAdmin)
+}
+
+// ChangePassword replaces the user's password and signs out their other
+// sessions. An account without a password, created through single sign-on,
+// sets its first one without currentPassword.
+func (s *UserService) ChangePassword(ctx context.Context, userID, currentSessionID, currentPassword, newPassword string) error {
+	user, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !passwordMatches(user, currentPassword) {
+		return ErrInvalidCredentials
+	}
+	if err := s.setPassword(ctx, userID, newPassword); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditPasswordChanged,
+		SubjectUserID: userID,
+		TargetType:    "user",
+		TargetID:      userID,
+	})
+	return s.sessions.DeleteByUser(ctx, userID, currentSessionID)
+}
+
+// IssueResetToken creates a one-time password reset token for the account.
+// There is no mail delivery; the caller hands the token to the user.
+func (s *UserService) IssueResetToken(ctx context.Context, email string, ttl time.Duration) (string, time.Time, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if ttl <= 0 {
+		ttl = defaultResetTokenTTL
+	}
+	token, err := generateToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	record, err := s.resets.Create(ctx, user.ID, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditPasswordResetIssued,
+		SubjectUserID: user.ID,
+		TargetType:    "password_reset_token",
+		TargetID:      record.ID,
+		Metadata:      map[string]string{"expires_at": record.ExpiresAt.UTC().Format(time.RFC3339)},
+	})
+	return token, record.ExpiresAt, nil
+}
+
+// ResetPassword redeems a reset token, sets the new password and signs the
+// user out everywhere.
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	userID, err := s.resets.Consume(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, userID, newPassword); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditPasswordReset,
+		SubjectUserID: userID,
+		TargetType:    "user",
+		TargetID:      userID,
+	})
+	return s.sessions.DeleteByUser(ctx, userID, "")
+}
+
+// Delete removes the account and all data it owns. The last admin cannot be
+// deleted.
+func (s *UserService) Delete(ctx context.Context, id string) error {
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.IsAdmin() {
+		admins, err := s.repo.CountByRole(ctx, domain.UserRoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:        domain.AuditUserDeleted,
+		SubjectUserID: id,
+		TargetType:    "user",
+		TargetID:      id,
+		Metadata:      map[string]string{"email": user.Email},
+	})
+	return nil
+}
+
+// DeleteSelf deletes the user's own account once they confirm it with their
+// password; accounts without one are confirmed by the session alone.
+func (s *UserService) DeleteSelf(ctx context.Context, id, password string) error {
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !passwordMatches(user, password) {
+		return ErrInvalidCredentials
+	}
+	return s.Delete(ctx, id)
+}
+
+// passwordMatches checks a password a signed-in user gave to confirm a
+// change. Accounts without a password have nothing to check.
+func passwordMatches(user domain.User, password string) bool {
+	return user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+func (s *UserService) setPassword(ctx context.Context, userID, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePassword(ctx, userID, hash)
+}
+
+func (s *UserService) CountAdmins(ctx context.Context) (int, error) {
+	return s.repo.CountByRole(ctx, domain.UserRoleAdmin)
+}
+
+func validRole(role domain.UserRole) bool {
+	return role == domain.UserRoleAdmin || role == domain.UserRoleMember
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// hashToken derives the stored form of a random bearer token. The tokens are
+// high-entropy, so an unsalted SHA-256 is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
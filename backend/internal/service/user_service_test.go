@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository/memory"
+)
+
+type userFixture struct {
+	users    *UserService
+	auth     *AuthService
+	repo     *memory.UserRepository
+	sessions *memory.UserSessionRepository
+}
+
+func newUserFixture() userFixture {
+	db := memory.NewDB()
+	f := userFixture{repo: memory.NewUserRepository(db), sessions: memory.NewUserSessionRepository(db)}
+	f.users = NewUserService(f.repo, f.sessions, memory.NewPasswordResetRepository(db), nil)
+	f.auth = NewAuthService(f.repo, f.sessions, memory.NewUserIdentityRepository(db), time.Hour, nil, nil, nil)
+	return f
+}
+
+// TestPasswordlessAccount covers an account created through single sign-on:
+// it cannot sign in with a password until it sets one, which needs no
+// current password the first time.
+func TestPasswordlessAccount(t *testing.T) {
+	ctx := context.Background()
+	f := newUserFixture()
+	user, err := f.repo.Create(ctx, "Ada", "ada@example.com", "", domain.UserRoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.auth.Login(ctx, "ada@example.com", "", ClientInfo{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login without a password = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	if err := f.users.ChangePassword(ctx, user.ID, "", "", "correct horse"); err != nil {
+		t.Fatalf("setting the first password: %v", err)
+	}
+	if _, _, err := f.auth.Login(ctx, "ada@example.com", "correct horse", ClientInfo{}); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	// From now on the password is checked.
+	if err := f.users.ChangePassword(ctx, user.ID, "", "", "battery staple"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("changing the password without the current one = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if err := f.users.DeleteSelf(ctx, user.ID, ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("deleting without the password = %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestDeleteSelf(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     error
+	}{
+		{name: "password-less account", hash: "", password: "", want: nil},
+		{name: "wrong password", hash: mustHash(t, "correct horse"), password: "wrong", want: ErrInvalidCredentials},
+		{name: "right password", hash: mustHash(t, "correct horse"), password: "correct horse", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newUserFixture()
+			user, err := f.repo.Create(ctx, "Ada", "ada@example.com", tt.hash, domain.UserRoleMember)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := f.users.DeleteSelf(ctx, user.ID, tt.password); !errors.Is(err, tt.want) {
+				t.Fatalf("DeleteSelf = %v, want %v", err, tt.want)
+			}
+			_, err = f.repo.Get(ctx, user.ID)
+			if deleted := err != nil; deleted != (tt.want == nil) {
+				t.Errorf("account deleted = %v, want %v", deleted, tt.want == nil)
+			}
+		})
+	}
+}
+
+func mustHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
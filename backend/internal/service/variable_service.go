@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/promptvars"
+	"github.com/Juicern/luma/internal/repository"
+)
+
+var (
+	ErrInvalidVariableName = errors.New("invalid_variable_name")
+	ErrUndefinedVariable   = errors.New("undefined_variable")
+)
+
+var variableNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// UndefinedVariablesError lists the placeholders in a prompt that have no
+// value. It matches ErrUndefinedVariable with errors.Is.
+type UndefinedVariablesError struct {
+	Names []string
+}
+
+func (e *UndefinedVariablesError) Error() string {
+	return "undefined variables: " + strings.Join(e.Names, ", ")
+}
+
+func (e *UndefinedVariablesError) Is(target error) bool {
+	return target == ErrUndefinedVariable
+}
+
+// VariableService manages custom prompt variables and resolves every
+// variable for a request.
+type VariableService struct {
+	repo  repository.UserVariableStore
+	users repository.UserStore
+}
+
+func NewVariableService(repo repository.UserVariableStore, users repository.UserStore) *VariableService {
+	return &VariableService{repo: repo, users: users}
+}
+
+func (s *VariableService) List(ctx context.Context, userID string) ([]domain.UserVariable, error) {
+	return s.repo.List(ctx, userID)
+}
+
+// Set defines or changes a custom variable. Names are lowercase identifiers
+// and may not shadow a built-in variable.
+func (s *VariableService) Set(ctx context.Context, userID, name, value string) (domain.UserVariable, error) {
+	if !variableNamePattern.MatchString(name) || promptvars.IsBuiltin(name) {
+		return domain.UserVariable{}, ErrInvalidVariableName
+	}
+	return s.repo.Upsert(ctx, userID, name, value)
+}
+
+func (s *VariableService) Delete(ctx context.Context, userID, name string) error {
+	return s.repo.Delete(ctx, userID, name)
+}
+
+// Validate checks that every placeholder in a user's prompt is a built-in or
+// one of the user's variables.
+func (s *VariableService) Validate(ctx context.Context, userID, text string) error {
+	if len(promptvars.Names(text)) == 0 {
+		return nil
+	}
+	variables, err := s.repo.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+	custom := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		custom[variable.Name] = true
+	}
+	return undefinedError(promptvars.Undefined(text, func(name string) bool {
+		return promptvars.IsBuiltin(name) || custom[name]
+	}))
+}
+
+// ValidateShared checks a prompt shared by all users, such as the system
+// prompt, which can only use built-in variables.
+func (s *VariableService) ValidateShared(text string) error {
+	return undefinedError(promptvars.Undefined(text, promptvars.IsBuiltin))
+}
+
+// Values resolves the built-in and custom variables of a user.
+func (s *VariableService) Values(ctx context.Context, userID string, env promptvars.Environment) (map[string]string, error) {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	values := promptvars.BuiltinValues(user.Name, user.Email, env)
+	variables, err := s.repo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, variable := range variables {
+		values[variable.Name] = variable.Value
+	}
+	return values, nil
+}
+
+func undefinedError(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	return &UndefinedVariablesError{Names: names}
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Juicern/luma/internal/domain"
+	"github.com/Juicern/luma/internal/repository"
+)
+
+var (
+	ErrInvalidWorkspaceRole = errors.New("invalid_workspace_role")
+	ErrWorkspaceForbidden   = errors.New("workspace_forbidden")
+	ErrLastWorkspaceOwner   = errors.New("last_workspace_owner")
+)
+
+// WorkspaceService manages workspaces, their members and the presets and
+// system prompt they share. Callers who are not members of a workspace get
+// sql.ErrNoRows, as if it did not exist; members whose role is too low get
+// ErrWorkspaceForbidden.
+type WorkspaceService struct {
+	repo      repository.WorkspaceStore
+	users     repository.UserStore
+	variables *VariableService
+	audit     *AuditService
+}
+
+func NewWorkspaceService(repo repository.WorkspaceStore, users repository.UserStore, variables *VariableService, audit *AuditService) *WorkspaceService {
+	return &WorkspaceService{
+		repo:      repo,
+		users:     users,
+		variables: variables,
+		audit:     audit,
+	}
+}
+
+func (s *WorkspaceService) List(ctx context.Context, userID string) ([]domain.WorkspaceMembership, error) {
+	return s.repo.ListForUser(ctx, userID)
+}
+
+// Create makes a workspace owned by userID.
+func (s *WorkspaceService) Create(ctx context.Context, userID, name string) (domain.Workspace, error) {
+	workspace, err := s.repo.Create(ctx, name, userID)
+	if err != nil {
+		return domain.Workspace{}, err
+	}
+	s.record(ctx, domain.AuditWorkspaceCreated, workspace.ID, "", map[string]string{"name": name})
+	return workspace, nil
+}
+
+func (s *WorkspaceService) Get(ctx context.Context, userID, workspaceID string) (domain.WorkspaceMembership, error) {
+	member, err := s.member(ctx, userID, workspaceID)
+	if err != nil {
+		return domain.WorkspaceMembership{}, err
+	}
+	workspace, err := s.repo.Get(ctx, workspaceID)
+	if err != nil {
+		return domain.WorkspaceMembership{}, err
+	}
+	return domain.WorkspaceMembership{Workspace: workspace, Role: member.Role}, nil
+}
+
+func (s *WorkspaceService) Rename(ctx context.Context, userID, workspaceID, name string) (domain.Workspace, error) {
+	if _, err := s.require(ctx, userID, workspaceID, isOwner); err != nil {
+		return domain.Workspace{}, err
+	}
+	workspace, err := s.repo.Rename(ctx, workspaceID, name)
+	if err != nil {
+		return domain.Workspace{}, err
+	}
+	s.record(ctx, domain.AuditWorkspaceUpdated, workspaceID, "", map[string]string{"name": name})
+	return workspace, nil
+}
+
+// Delete removes a workspace with its members, presets and system prompt.
+func (s *WorkspaceService) Delete(ctx context.Context, userID, workspaceID string) error {
+	if _, err := s.require(ctx, userID, workspaceID, isOwner); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, workspaceID); err != nil {
+		return err
+	}
+	s.record(ctx, domain.AuditWorkspaceDeleted, workspaceID, "", nil)
+	return nil
+}
+
+func (s *WorkspaceService) Members(ctx context.Context, userID, workspaceID string) ([]domain.WorkspaceMember, error) {
+	if _, err := s.member(ctx, userID, workspaceID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, workspaceID)
+}
+
+// SetMember adds a user to the workspace or changes their role. Only owners
+// manage members, and a workspace always keeps at least one owner.
+func (s *WorkspaceService) SetMember(ctx context.Context, actorID, workspaceID, userID string, role domain.WorkspaceRole) (domain.WorkspaceMember, error) {
+	if !role.Valid() {
+		return domain.WorkspaceMember{}, ErrInvalidWorkspaceRole
+	}
+	if _, err := s.require(ctx, actorID, workspaceID, isOwner); err != nil {
+		return domain.WorkspaceMember{}, err
+	}
+	if _, err := s.users.Get(ctx, userID); err != nil {
+		return domain.WorkspaceMember{}, err
+	}
+	if role != domain.WorkspaceRoleOwner {
+		if err := s.keepOwner(ctx, workspaceID, userID); err != nil {
+			return domain.WorkspaceMember{}, err
+		}
+	}
+	member, err := s.repo.SetMember(ctx, workspaceID, userID, role)
+	if err != nil {
+		return domain.WorkspaceMember{}, err
+	}
+	s.record(ctx, domain.AuditWorkspaceMemberSet, workspaceID, userID, map[string]string{"role": string(role)})
+	return member, nil
+}
+
+// AddMemberByEmail is SetMember for the account with the given email.
+func (s *WorkspaceService) AddMemberByEmail(ctx context.Context, actorID, workspaceID, email string, role domain.WorkspaceRole) (domain.WorkspaceMember, error) {
+	user, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		return domain.WorkspaceMember{}, err
+	}
+	return s.SetMember(ctx, actorID, workspaceID, user.ID, role)
+}
+
+// RemoveMember takes a user out of the workspace. Owners may remove anyone;
+// every member may leave.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, actorID, workspaceID, userID string) error {
+	check := isOwner
+	if actorID == userID {
+		check = isMember
+	}
+	if _, err := s.require(ctx, actorID, workspaceID, check); err != nil {
+		return err
+	}
+	if err := s.keepOwner(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+	if err := s.repo.RemoveMember(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+	s.record(ctx, domain.AuditWorkspaceMemberRemoved, workspaceID, userID, nil)
+	return nil
+}
+
+// keepOwner fails when userID is the workspace's only owner, so that they
+// can neither leave nor be demoted.
+func (s *WorkspaceService) keepOwner(ctx context.Context, workspaceID, userID string) error {
+	members, err := s.repo.ListMembers(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	owners, isTarget := 0, false
+	for _, member := range members {
+		if member.Role == domain.WorkspaceRoleOwner {
+			owners++
+			isTarget = isTarget || member.UserID == userID
+		}
+	}
+	if isTarget && owners == 1 {
+		return ErrLastWorkspaceOwner
+	}
+	return nil
+}
+
+func (s *WorkspaceService) Presets(ctx context.Context, userID, workspaceID string) ([]domain.WorkspacePreset, error) {
+	if _, err := s.member(ctx, userID, workspaceID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListPresets(ctx, workspaceID)
+}
+
+// CreatePreset adds a shared preset. Workspace prompts are used by every
+// member, so they may only contain built-in variables.
+func (s *WorkspaceService) CreatePreset(ctx context.Context, userID, workspaceID, name, text string, settings domain.GenerationSettings) (domain.WorkspacePreset, error) {
+	if _, err := s.require(ctx, userID, workspaceID, canEdit); err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	settings, err := s.validatePreset(text, settings)
+	if err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	preset, err := s.repo.CreatePreset(ctx, workspaceID, name, text, settings)
+	if err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	s.recordPreset(ctx, domain.AuditPresetCreated, preset)
+	return preset, nil
+}
+
+func (s *WorkspaceService) UpdatePreset(ctx context.Context, userID, workspaceID, presetID, name, text string, settings domain.GenerationSettings) (domain.WorkspacePreset, error) {
+	if _, err := s.require(ctx, userID, workspaceID, canEdit); err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	settings, err := s.validatePreset(text, settings)
+	if err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	preset, err := s.repo.UpdatePreset(ctx, presetID, workspaceID, name, text, settings)
+	if err != nil {
+		return domain.WorkspacePreset{}, err
+	}
+	s.recordPreset(ctx, domain.AuditPresetUpdated, preset)
+	return preset, nil
+}
+
+func (s *WorkspaceService) DeletePreset(ctx context.Context, userID, workspaceID, presetID string) error {
+	if _, err := s.require(ctx, userID, workspaceID, canEdit); err != nil {
+		return err
+	}
+	if err := s.repo.DeletePreset(ctx, presetID, workspaceID); err != nil {
+		return err
+	}
+	s.recordPreset(ctx, domain.AuditPresetDeleted, domain.WorkspacePreset{ID: presetID, WorkspaceID: workspaceID})
+	return nil
+}
+
+func (s *WorkspaceService) validatePreset(text string, settings domain.GenerationSettings) (domain.GenerationSettings, error) {
+	if err := s.variables.ValidateShared(text); err != nil {
+		return settings, err
+	}
+	return normalizeGenerationSettings(settings)
+}
+
+// SystemPrompt returns the workspace's system prompt, or sql.ErrNoRows when
+// it has none.
+func (s *WorkspaceService) SystemPrompt(ctx context.Context, userID, workspaceID string) (domain.WorkspaceSystemPrompt, error) {
+	if _, err := s.member(ctx, userID, workspaceID); err != nil {
+		return domain.WorkspaceSystemPrompt{}, err
+	}
+	return s.repo.GetSystemPrompt(ctx, workspaceID)
+}
+
+func (s *WorkspaceService) SetSystemPrompt(ctx context.Context, userID, workspaceID, text string) (domain.WorkspaceSystemPrompt, error) {
+	if _, err := s.require(ctx, userID, workspaceID, canEdit); err != nil {
+		return domain.WorkspaceSystemPrompt{}, err
+	}
+	if err := s.variables.ValidateShared(text); err != nil {
+		return domain.WorkspaceSystemPrompt{}, err
+	}
+	prompt, err := s.repo.SetSystemPrompt(ctx, workspaceID, text)
+	if err != nil {
+		return domain.WorkspaceSystemPrompt{}, err
+	}
+	s.record(ctx, domain.AuditWorkspacePromptSet, workspaceID, "", nil)
+	return prompt, nil
+}
+
+func (s *WorkspaceService) DeleteSystemPrompt(ctx context.Context, userID, workspaceID string) error {
+	if _, err := s.require(ctx, userID, workspaceID, canEdit); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteSystemPrompt(ctx, workspaceID); err != nil {
+		return err
+	}
+	s.record(ctx, domain.AuditWorkspacePromptSet, workspaceID, "", map[string]string{"removed": "true"})
+	return nil
+}
+
+// WorkspaceLayer is what a workspace contributes to a composition.
+type WorkspaceLayer struct {
+	SystemPrompt string
+	Preset       *domain.WorkspacePreset
+}
+
+// ComposeLayer resolves the workspace prompts userID composes with. A preset
+// implies its workspace; when both are given they must match.
+func (s *WorkspaceService) ComposeLayer(ctx context.Context, userID, workspaceID, presetID string) (WorkspaceLayer, error) {
+	var layer WorkspaceLayer
+	if presetID != "" {
+		preset, err := s.repo.GetPreset(ctx, presetID)
+		if err != nil {
+			return WorkspaceLayer{}, err
+		}
+		if workspaceID == "" {
+			workspaceID = preset.WorkspaceID
+		}
+		if preset.WorkspaceID != workspaceID {
+			return WorkspaceLayer{}, sql.ErrNoRows
+		}
+		layer.Preset = &preset
+	}
+	if workspaceID == "" {
+		return layer, nil
+	}
+	if _, err := s.member(ctx, userID, workspaceID); err != nil {
+		return WorkspaceLayer{}, err
+	}
+	prompt, err := s.repo.GetSystemPrompt(ctx, workspaceID)
+	switch {
+	case err == nil:
+		layer.SystemPrompt = prompt.PromptText
+	case !errors.Is(err, sql.ErrNoRows):
+		return WorkspaceLayer{}, err
+	}
+	return layer, nil
+}
+
+func isMember(domain.WorkspaceRole) bool { return true }
+
+func isOwner(role domain.WorkspaceRole) bool { return role == domain.WorkspaceRoleOwner }
+
+func canEdit(role domain.WorkspaceRole) bool { return role.CanEdit() }
+
+func (s *WorkspaceService) member(ctx context.Context, userID, workspaceID string) (domain.WorkspaceMember, error) {
+	return s.repo.GetMember(ctx, workspaceID, userID)
+}
+
+func (s *WorkspaceService) require(ctx context.Context, userID, workspaceID string, allowed func(domain.WorkspaceRole) bool) (domain.WorkspaceMember, error) {
+	member, err := s.member(ctx, userID, workspaceID)
+	if err != nil {
+		return domain.WorkspaceMember{}, err
+	}
+	if !allowed(member.Role) {
+		return domain.WorkspaceMember{}, ErrWorkspaceForbidden
+	}
+	return member, nil
+}
+
+func (s *WorkspaceService) record(ctx context.Context, action domain.AuditAction, workspaceID, subjectID string, metadata map[string]string) {
+	s.audit.Record(ctx, AuditEntry{
+		Action:        action,
+		SubjectUserID: subjectID,
+		TargetType:    "workspace",
+		TargetID:      workspaceID,
+		Metadata:      metadata,
+	})
+}
+
+func (s *WorkspaceService) recordPreset(ctx context.Context, action domain.AuditAction, preset domain.WorkspacePreset) {
+	metadata := map[string]string{"workspace_id": preset.WorkspaceID}
+	if preset.Name != "" {
+		metadata["name"] = preset.Name
+	}
+	s.audit.Record(ctx, AuditEntry{
+		Action:     action,
+		TargetType: "workspace_preset",
+		TargetID:   preset.ID,
+		Metadata:   metadata,
+	})
+}
@@ -6,19 +6,47 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
 
 	"github.com/Juicern/luma/internal/config"
 )
 
+// Dialect identifies the SQL database behind a *sql.DB.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection. Times are stored in
+// SQLite's text format so that they compare and sort correctly.
+var sqlitePragmas = []string{
+	"_pragma=foreign_keys(1)",
+	"_pragma=busy_timeout(5000)",
+	"_pragma=journal_mode(WAL)",
+	"_time_format=sqlite",
+}
+
+// NewDatabase opens the configured database. The DSN scheme picks the
+// backend: postgres:// (or postgresql://) for Postgres, whose database is
+// created if missing, and sqlite:// followed by a file path for a local
+// single-file database.
 func NewDatabase(ctx context.Context, cfg config.DatabaseConfig) (*sql.DB, error) {
 	if cfg.DSN == "" {
 		return nil, errors.New("database DSN is required")
 	}
 
+	if path, ok := sqlitePath(cfg.DSN); ok {
+		return openSQLite(path)
+	}
+
 	if err := ensureDatabaseExists(ctx, cfg.DSN); err != nil {
 		return nil, err
 	}
@@ -30,125 +58,49 @@ func NewDatabase(ctx context.Context, cfg config.DatabaseConfig) (*sql.DB, error
 	return db, nil
 }
 
-func RunMigrations(ctx context.Context, db *sql.DB) error {
-	if db == nil {
-		return errors.New("db is nil")
+// DialectOf reports which backend db was opened with.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return DialectSQLite
 	}
+	return DialectPostgres
+}
 
-	_, err := db.ExecContext(ctx, schemaSQL)
-	return err
+// sqlitePath extracts the file path from sqlite://PATH or sqlite:PATH.
+// sqlite::memory: opens a private in-memory database.
+func sqlitePath(dsn string) (string, bool) {
+	for _, prefix := range []string{"sqlite://", "sqlite:", "sqlite3://"} {
+		if strings.HasPrefix(dsn, prefix) {
+			return strings.TrimPrefix(dsn, prefix), true
+		}
+	}
+	return "", false
 }
 
-const schemaSQL = `
-CREATE TABLE IF NOT EXISTS users (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL,
-    email TEXT NOT NULL UNIQUE,
-    password_hash TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-INSERT INTO users (id, name, email, password_hash, created_at)
-VALUES ('local-user', 'Local User', 'local@example.com', '$2a$10$rWDlMSB2oE9n1kpLMht0n.7EfmgBl08YfC6I.wfPvj9ycwkQqu8nO', CURRENT_TIMESTAMP)
-ON CONFLICT (id) DO NOTHING;
-
-CREATE TABLE IF NOT EXISTS system_prompts (
-    id TEXT PRIMARY KEY,
-    prompt_text TEXT NOT NULL,
-    active BOOLEAN NOT NULL DEFAULT TRUE,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE IF NOT EXISTS user_prompt_presets (
-    id TEXT PRIMARY KEY,
-    user_id TEXT NOT NULL,
-    name TEXT NOT NULL,
-    prompt_text TEXT NOT NULL,
-    template_key TEXT,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-ALTER TABLE user_prompt_presets ADD COLUMN IF NOT EXISTS template_key TEXT;
-
-CREATE INDEX IF NOT EXISTS idx_user_prompt_presets_user_id
-    ON user_prompt_presets (user_id);
-
-CREATE UNIQUE INDEX IF NOT EXISTS idx_user_prompt_presets_template
-    ON user_prompt_presets (user_id, template_key);
-
-CREATE TABLE IF NOT EXISTS api_keys (
-    id TEXT PRIMARY KEY,
-    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    provider_name TEXT NOT NULL,
-    encrypted_key TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS user_id TEXT;
-UPDATE api_keys SET user_id = 'local-user' WHERE user_id IS NULL;
-ALTER TABLE api_keys ALTER COLUMN user_id SET NOT NULL;
-ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_user_fk;
-ALTER TABLE api_keys ADD CONSTRAINT api_keys_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
-DROP INDEX IF EXISTS idx_api_keys_provider;
-CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_user_provider
-    ON api_keys (user_id, provider_name);
-
-CREATE TABLE IF NOT EXISTS sessions (
-    id TEXT PRIMARY KEY,
-    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    preset_id TEXT NOT NULL REFERENCES user_prompt_presets(id) ON DELETE CASCADE,
-    provider_name TEXT NOT NULL,
-    model TEXT NOT NULL,
-    temporary_prompt TEXT,
-    context_text TEXT,
-    clipboard_enabled BOOLEAN NOT NULL DEFAULT FALSE,
-    system_prompt_id TEXT NOT NULL REFERENCES system_prompts(id),
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_id TEXT;
-UPDATE sessions SET user_id = 'local-user' WHERE user_id IS NULL;
-ALTER TABLE sessions ALTER COLUMN user_id SET NOT NULL;
-ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_fk;
-ALTER TABLE sessions ADD CONSTRAINT sessions_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
-
-CREATE TABLE IF NOT EXISTS messages (
-    id TEXT PRIMARY KEY,
-    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
-    type TEXT NOT NULL,
-    raw_text TEXT NOT NULL,
-    transformed_text TEXT,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE IF NOT EXISTS transcription_logs (
-    id TEXT PRIMARY KEY,
-    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    mode TEXT NOT NULL,
-    transcript TEXT NOT NULL,
-    generated_text TEXT,
-    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-ALTER TABLE transcription_logs ADD COLUMN IF NOT EXISTS generated_text TEXT;
-
-CREATE INDEX IF NOT EXISTS idx_transcription_logs_user
-    ON transcription_logs (user_id, created_at DESC);
-
-CREATE TABLE IF NOT EXISTS user_sessions (
-    id TEXT PRIMARY KEY,
-    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    token TEXT NOT NULL UNIQUE,
-    expires_at TIMESTAMP NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-`
+func openSQLite(path string) (*sql.DB, error) {
+	file, query, _ := strings.Cut(path, "?")
+	if file == "" {
+		return nil, errors.New("sqlite DSN must include a file path")
+	}
+	if file != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	params := append([]string{}, sqlitePragmas...)
+	if query != "" {
+		params = append(params, query)
+	}
+	db, err := sql.Open("sqlite", file+"?"+strings.Join(params, "&"))
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection avoids
+	// SQLITE_BUSY between our own transactions and keeps :memory: databases
+	// from being split across connections.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
 
 func ensureDatabaseExists(ctx context.Context, dsn string) error {
 	u, err := url.Parse(dsn)
@@ -0,0 +1,209 @@
+-- Postgres schema bootstrap used before versioned migrations. It only runs
+-- once, to bring a database created by an older release up to the 0001
+-- baseline.
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member';
+
+INSERT INTO users (id, name, email, password_hash, created_at)
+VALUES ('local-user', 'Local User', 'local@example.com', '$2a$10$rWDlMSB2oE9n1kpLMht0n.7EfmgBl08YfC6I.wfPvj9ycwkQqu8nO', CURRENT_TIMESTAMP)
+ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS system_prompts (
+    id TEXT PRIMARY KEY,
+    prompt_text TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_prompt_presets (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    prompt_text TEXT NOT NULL,
+    template_key TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_prompt_presets ADD COLUMN IF NOT EXISTS template_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_user_prompt_presets_user_id
+    ON user_prompt_presets (user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_prompt_presets_template
+    ON user_prompt_presets (user_id, template_key);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider_name TEXT NOT NULL,
+    label TEXT NOT NULL DEFAULT 'default',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    encrypted_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS user_id TEXT;
+UPDATE api_keys SET user_id = 'local-user' WHERE user_id IS NULL;
+ALTER TABLE api_keys ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_user_fk;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+DROP INDEX IF EXISTS idx_api_keys_provider;
+DROP INDEX IF EXISTS idx_api_keys_user_provider;
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS label TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE api_keys SET is_default = TRUE
+WHERE id IN (
+    SELECT k.id FROM api_keys k
+    WHERE NOT EXISTS (
+        SELECT 1 FROM api_keys d
+        WHERE d.user_id = k.user_id AND d.provider_name = k.provider_name AND d.is_default
+    )
+    AND k.created_at = (
+        SELECT MIN(o.created_at) FROM api_keys o
+        WHERE o.user_id = k.user_id AND o.provider_name = k.provider_name
+    )
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_user_provider_label
+    ON api_keys (user_id, provider_name, label);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_user_provider_default
+    ON api_keys (user_id, provider_name) WHERE is_default;
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    preset_id TEXT NOT NULL REFERENCES user_prompt_presets(id) ON DELETE CASCADE,
+    provider_name TEXT NOT NULL,
+    model TEXT NOT NULL,
+    temporary_prompt TEXT,
+    context_text TEXT,
+    clipboard_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    system_prompt_id TEXT NOT NULL REFERENCES system_prompts(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_id TEXT;
+UPDATE sessions SET user_id = 'local-user' WHERE user_id IS NULL;
+ALTER TABLE sessions ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_fk;
+ALTER TABLE sessions ADD CONSTRAINT sessions_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS messages (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    raw_text TEXT NOT NULL,
+    transformed_text TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transcription_logs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mode TEXT NOT NULL,
+    transcript TEXT NOT NULL,
+    generated_text TEXT,
+    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE transcription_logs ADD COLUMN IF NOT EXISTS generated_text TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_transcription_logs_user
+    ON transcription_logs (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS token_hash TEXT;
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS ip_address TEXT NOT NULL DEFAULT '';
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'user_sessions' AND column_name = 'token'
+    ) THEN
+        UPDATE user_sessions
+        SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex')
+        WHERE token_hash IS NULL;
+        ALTER TABLE user_sessions DROP COLUMN token;
+    END IF;
+END $$;
+ALTER TABLE user_sessions ALTER COLUMN token_hash SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_token_hash
+    ON user_sessions (token_hash);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user
+    ON user_sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires
+    ON user_sessions (expires_at);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id TEXT PRIMARY KEY,
+    actor_user_id TEXT NOT NULL DEFAULT '',
+    subject_user_id TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    metadata TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created
+    ON audit_events (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor
+    ON audit_events (actor_user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject
+    ON audit_events (subject_user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities (user_id);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS transcription_logs;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS user_prompt_presets;
+DROP TABLE IF EXISTS system_prompts;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,2 @@
+ALTER TABLE user_prompt_presets DROP COLUMN template_checksum;
+ALTER TABLE user_prompt_presets DROP COLUMN template_version;
@@ -0,0 +1,2 @@
+DROP TABLE system_prompt_revisions;
+DROP TABLE prompt_preset_revisions;
@@ -0,0 +1,25 @@
+CREATE TABLE prompt_preset_revisions (
+    id TEXT PRIMARY KEY,
+    preset_id TEXT NOT NULL REFERENCES user_prompt_presets(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    prompt_text TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (preset_id, revision)
+);
+
+CREATE TABLE system_prompt_revisions (
+    id TEXT PRIMARY KEY,
+    system_prompt_id TEXT NOT NULL REFERENCES system_prompts(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    prompt_text TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (system_prompt_id, revision)
+);
+
+-- Existing prompts start their history with their current text.
+INSERT INTO prompt_preset_revisions (id, preset_id, revision, name, prompt_text, created_at)
+SELECT id || ':1', id, 1, name, prompt_text, updated_at FROM user_prompt_presets;
+
+INSERT INTO system_prompt_revisions (id, system_prompt_id, revision, prompt_text, created_at)
+SELECT id || ':1', id, 1, prompt_text, updated_at FROM system_prompts;
@@ -0,0 +1,5 @@
+ALTER TABLE user_prompt_presets DROP COLUMN top_p;
+ALTER TABLE user_prompt_presets DROP COLUMN max_tokens;
+ALTER TABLE user_prompt_presets DROP COLUMN temperature;
+ALTER TABLE user_prompt_presets DROP COLUMN model;
+ALTER TABLE user_prompt_presets DROP COLUMN provider;
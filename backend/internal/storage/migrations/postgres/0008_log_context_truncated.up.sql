@@ -0,0 +1 @@
+ALTER TABLE transcription_logs ADD COLUMN context_truncated BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE transcription_logs DROP COLUMN context_injection;
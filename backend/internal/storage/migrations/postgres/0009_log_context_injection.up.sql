@@ -0,0 +1 @@
+ALTER TABLE transcription_logs ADD COLUMN context_injection TEXT NOT NULL DEFAULT '';
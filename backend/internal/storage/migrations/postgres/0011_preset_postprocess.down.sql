@@ -0,0 +1,2 @@
+ALTER TABLE workspace_presets DROP COLUMN postprocess;
+ALTER TABLE user_prompt_presets DROP COLUMN postprocess;
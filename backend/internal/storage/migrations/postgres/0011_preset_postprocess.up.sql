@@ -0,0 +1,2 @@
+ALTER TABLE user_prompt_presets ADD COLUMN postprocess TEXT;
+ALTER TABLE workspace_presets ADD COLUMN postprocess TEXT;
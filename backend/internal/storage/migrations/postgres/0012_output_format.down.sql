@@ -0,0 +1,4 @@
+ALTER TABLE transcription_logs DROP COLUMN email_subject;
+ALTER TABLE transcription_logs DROP COLUMN output_format;
+ALTER TABLE workspace_presets DROP COLUMN output_format;
+ALTER TABLE user_prompt_presets DROP COLUMN output_format;
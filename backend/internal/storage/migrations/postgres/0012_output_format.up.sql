@@ -0,0 +1,4 @@
+ALTER TABLE user_prompt_presets ADD COLUMN output_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE workspace_presets ADD COLUMN output_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE transcription_logs ADD COLUMN output_format TEXT NOT NULL DEFAULT '';
+ALTER TABLE transcription_logs ADD COLUMN email_subject TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE rewrite_candidates (
+    log_id TEXT NOT NULL REFERENCES transcription_logs(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    output_format TEXT NOT NULL DEFAULT '',
+    email_subject TEXT NOT NULL DEFAULT '',
+    preset_id TEXT NOT NULL DEFAULT '',
+    temperature DOUBLE PRECISION,
+    PRIMARY KEY (log_id, position)
+);
+
+ALTER TABLE transcription_logs ADD COLUMN chosen_candidate INTEGER;
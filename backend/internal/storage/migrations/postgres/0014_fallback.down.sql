@@ -0,0 +1,7 @@
+ALTER TABLE transcription_logs DROP COLUMN model;
+ALTER TABLE transcription_logs DROP COLUMN provider;
+
+DROP TABLE user_fallback_chains;
+
+ALTER TABLE workspace_presets DROP COLUMN fallback;
+ALTER TABLE user_prompt_presets DROP COLUMN fallback;
@@ -0,0 +1,2 @@
+ALTER TABLE user_prompt_presets ADD COLUMN template_version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_prompt_presets ADD COLUMN template_checksum TEXT NOT NULL DEFAULT '';
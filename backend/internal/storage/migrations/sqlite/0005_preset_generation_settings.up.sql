@@ -0,0 +1,5 @@
+ALTER TABLE user_prompt_presets ADD COLUMN provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_prompt_presets ADD COLUMN model TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_prompt_presets ADD COLUMN temperature REAL;
+ALTER TABLE user_prompt_presets ADD COLUMN max_tokens INTEGER;
+ALTER TABLE user_prompt_presets ADD COLUMN top_p REAL;
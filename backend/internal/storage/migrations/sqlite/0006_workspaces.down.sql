@@ -0,0 +1,4 @@
+DROP TABLE workspace_system_prompts;
+DROP TABLE workspace_presets;
+DROP TABLE workspace_members;
+DROP TABLE workspaces;
@@ -0,0 +1,4 @@
+ALTER TABLE workspace_presets DROP COLUMN redact_pii;
+ALTER TABLE user_prompt_presets DROP COLUMN redact_pii;
+DROP TABLE user_redaction_rules;
+DROP TABLE user_redaction_settings;
@@ -0,0 +1,3 @@
+ALTER TABLE transcription_logs DROP COLUMN chosen_candidate;
+
+DROP TABLE rewrite_candidates;
@@ -0,0 +1,11 @@
+ALTER TABLE user_prompt_presets ADD COLUMN fallback TEXT;
+ALTER TABLE workspace_presets ADD COLUMN fallback TEXT;
+
+CREATE TABLE user_fallback_chains (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    chain TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE transcription_logs ADD COLUMN provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE transcription_logs ADD COLUMN model TEXT NOT NULL DEFAULT '';
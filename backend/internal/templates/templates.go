@@ -0,0 +1,87 @@
+// Package templates holds the built-in prompt template catalog shipped with
+// the server.
+package templates
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var catalogYAML []byte
+
+// Template is one versioned built-in prompt.
+type Template struct {
+	Key         string `yaml:"key" json:"key"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Version     int    `yaml:"version" json:"version"`
+	PromptText  string `yaml:"prompt_text" json:"prompt_text"`
+}
+
+// Checksum identifies the template text. Installed presets keep the checksum
+// of the text they were installed with, so edits can be detected later.
+func (t Template) Checksum() string {
+	return Checksum(t.PromptText)
+}
+
+// Checksum returns the hex SHA-256 of a prompt text.
+func Checksum(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Catalog is an ordered, read-only set of templates.
+type Catalog struct {
+	templates []Template
+	byKey     map[string]Template
+}
+
+// Load parses the embedded catalog.
+func Load() (*Catalog, error) {
+	return Parse(catalogYAML)
+}
+
+// Parse reads a catalog in the format of catalog.yaml.
+func Parse(data []byte) (*Catalog, error) {
+	var file struct {
+		Templates []Template `yaml:"templates"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse template catalog: %w", err)
+	}
+	catalog := &Catalog{byKey: make(map[string]Template, len(file.Templates))}
+	for _, tmpl := range file.Templates {
+		switch {
+		case tmpl.Key == "":
+			return nil, fmt.Errorf("template %q has no key", tmpl.Name)
+		case tmpl.Version < 1:
+			return nil, fmt.Errorf("template %q: version must be at least 1", tmpl.Key)
+		case tmpl.PromptText == "":
+			return nil, fmt.Errorf("template %q has no prompt_text", tmpl.Key)
+		}
+		if _, dup := catalog.byKey[tmpl.Key]; dup {
+			return nil, fmt.Errorf("template %q is defined twice", tmpl.Key)
+		}
+		if tmpl.Name == "" {
+			tmpl.Name = tmpl.Key
+		}
+		catalog.templates = append(catalog.templates, tmpl)
+		catalog.byKey[tmpl.Key] = tmpl
+	}
+	return catalog, nil
+}
+
+// List returns the templates in catalog order.
+func (c *Catalog) List() []Template {
+	return append([]Template(nil), c.templates...)
+}
+
+func (c *Catalog) Get(key string) (Template, bool) {
+	tmpl, ok := c.byKey[key]
+	return tmpl, ok
+}
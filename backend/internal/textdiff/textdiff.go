@@ -0,0 +1,134 @@
+// Package textdiff computes line-based differences between two texts.
+package textdiff
+
+import "strings"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Line is one line of a diff: kept, added in the new text, or removed from
+// the old one.
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxTable bounds the cells of the LCS table, and so the memory one diff
+// may take. A changed block too large for it is diffed as a whole: every
+// old line deleted, every new one inserted.
+const maxTable = 1 << 20
+
+// Lines diffs a against b line by line using a longest common subsequence.
+// Within a changed block, deletions come before insertions.
+func Lines(a, b string) []Line {
+	from, to := splitLines(a), splitLines(b)
+
+	// Lines shared at both ends are kept as they are, so only the changed
+	// middle needs the table.
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	var lines []Line
+	for _, text := range from[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	lines = append(lines, diffBlock(from[prefix:len(from)-suffix], to[prefix:len(to)-suffix])...)
+	for _, text := range from[len(from)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	return lines
+}
+
+func diffBlock(from, to []string) []Line {
+	var lines []Line
+	if (len(from)+1)*(len(to)+1) > maxTable {
+		for _, text := range from {
+			lines = append(lines, Line{Op: Delete, Text: text})
+		}
+		for _, text := range to {
+			lines = append(lines, Line{Op: Insert, Text: text})
+		}
+		return lines
+	}
+
+	// common[i][j] is the LCS length of from[i:] and to[j:].
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			lines = append(lines, Line{Op: Equal, Text: from[i]})
+			i++
+			j++
+		case i < len(from) && (j == len(to) || common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, Line{Op: Delete, Text: from[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: to[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// Unified renders lines in unified diff style, with the whole text as
+// context: prompts are short enough that hunks would only hide it.
+func Unified(fromName, toName string, lines []Line) string {
+	var b strings.Builder
+	b.WriteString("--- " + fromName + "\n")
+	b.WriteString("+++ " + toName + "\n")
+	for _, line := range lines {
+		switch line.Op {
+		case Insert:
+			b.WriteByte('+')
+		case Delete:
+			b.WriteByte('-')
+		default:
+			b.WriteByte(' ')
+		}
+		b.WriteString(line.Text)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Changed reports whether lines contain any insertion or deletion.
+func Changed(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
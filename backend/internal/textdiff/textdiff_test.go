@@ -0,0 +1,75 @@
+package textdiff
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{name: "empty", a: "", b: "", want: nil},
+		{name: "added", a: "", b: "one\ntwo\n", want: []Line{{Insert, "one"}, {Insert, "two"}}},
+		{name: "removed", a: "one\n", b: "", want: []Line{{Delete, "one"}}},
+		{
+			name: "changed middle",
+			a:    "keep\nold\nend",
+			b:    "keep\nnew\nend",
+			want: []Line{{Equal, "keep"}, {Delete, "old"}, {Insert, "new"}, {Equal, "end"}},
+		},
+		{
+			name: "moved line",
+			a:    "a\nb\nc",
+			b:    "b\nc\na",
+			want: []Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}},
+		},
+		{
+			name: "repeated lines at both ends",
+			a:    "x\nx\nx",
+			b:    "x\nx",
+			want: []Line{{Equal, "x"}, {Equal, "x"}, {Delete, "x"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLinesLargeBlock checks that a changed block too large for the table
+// is diffed as a whole, while the unchanged ends are still kept.
+func TestLinesLargeBlock(t *testing.T) {
+	var from, to []string
+	for i := range 2000 {
+		from = append(from, "old "+strconv.Itoa(i))
+		to = append(to, "new "+strconv.Itoa(i))
+	}
+	a := "head\n" + strings.Join(from, "\n") + "\ntail"
+	b := "head\n" + strings.Join(to, "\n") + "\ntail"
+
+	lines := Lines(a, b)
+	if len(lines) != 4002 {
+		t.Fatalf("got %d lines, want 4002", len(lines))
+	}
+	if lines[0] != (Line{Equal, "head"}) || lines[len(lines)-1] != (Line{Equal, "tail"}) {
+		t.Errorf("ends not kept: %v … %v", lines[0], lines[len(lines)-1])
+	}
+	for i, line := range lines[1:2001] {
+		if line.Op != Delete || line.Text != from[i] {
+			t.Fatalf("line %d = %v, want deletion of %q", i+1, line, from[i])
+		}
+	}
+	for i, line := range lines[2001:4001] {
+		if line.Op != Insert || line.Text != to[i] {
+			t.Fatalf("line %d = %v, want insertion of %q", i+2001, line, to[i])
+		}
+	}
+}